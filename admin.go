@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// purgeEmptyEvery is how often the sweeper purges empty decks. It is read
+// from PURGE_EMPTY_EVERY (e.g. "1h"); when unset, the purge only runs on
+// demand.
+var purgeEmptyEvery, _ = time.ParseDuration(os.Getenv("PURGE_EMPTY_EVERY"))
+
+// PurgeResult represents the outcome of a purge of empty decks. Every purged
+// deck is archived first; Archived counts the documents written.
+type PurgeResult struct {
+	Purged   int64 `json:"purged"`
+	Archived int64 `json:"archived"`
+}
+
+func registerAdmin(mux *routeTable) {
+	mux.HandleFunc("/admin/decks/purge-empty", instrument("admin.purge-empty", requireAdmin(adminPurgeEmpty)))
+	mux.HandleFunc("/admin/faults", instrument("admin.faults", requireAdmin(adminFaults)))
+	mux.HandleFunc("/admin/sweeper", instrument("admin.sweeper", requireAdmin(showSweeper)))
+	mux.HandleFunc("/admin/sweeper/run", instrument("admin.sweeper.run", requireAdmin(runSweeper)))
+	mux.HandleFunc("/admin/archive", instrument("admin.archive", requireAdmin(handleAdminArchive)))
+	mux.HandleFunc("/admin/archive/", instrument("admin.archive", requireAdmin(handleAdminArchive)))
+	mux.HandleFunc("/admin/dump", instrument("admin.dump", requireAdmin(adminDump)))
+	mux.HandleFunc("/admin/consistency", instrument("admin.consistency", requireAdmin(showConsistency)))
+	mux.HandleFunc("/admin/deck/", instrument("admin.deck", requireAdmin(handleAdminDeck)))
+}
+
+func adminPurgeEmpty(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := purgeEmptyDecks()
+	if err != nil {
+		http.Error(w, "Error purging decks", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+// emptyDeckSweepTimeout bounds one run of the empty deck purge.
+const emptyDeckSweepTimeout = time.Minute
+
+// registerAdminSweeps registers the empty deck purge, run every
+// purgeEmptyEvery, and the archive of closed decks, run every archiveEvery;
+// either only runs on demand when its interval is not set.
+func registerAdminSweeps(s *sweepScheduler) {
+	s.register("empty_decks", purgeEmptyEvery, emptyDeckSweepTimeout, sweepEmptyDecks)
+	s.register("archive_decks", archiveEvery, archiveSweepTimeout, sweepArchive)
+}
+
+func sweepEmptyDecks(ctx context.Context) (SweepResult, error) {
+	var result SweepResult
+	if err := readDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM decks").Scan(&result.Examined); err != nil {
+		return result, err
+	}
+	purged, err := purgeEmptyDecks()
+	result.Deleted = purged.Purged
+	if purged.Purged > 0 {
+		log.Printf("Purged %d empty decks, archived %d", purged.Purged, purged.Archived)
+	}
+	return result, err
+}
+
+// purgeEmptyDecks archives, then deletes, every deck with no upcoming cards
+// left, except frozen decks. Rows that belong to no deck go along with them.
+func purgeEmptyDecks() (PurgeResult, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result PurgeResult
+	ids, err := emptyDecks()
+	if err != nil {
+		return result, err
+	}
+	for _, id := range ids {
+		if err := archiveDeck(id); err != nil {
+			return result, fmt.Errorf("archive deck %s: %w", id, err)
+		}
+		result.Archived++
+		result.Purged++
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	if err := deleteOrphans(tx); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	invalidateAllUpcoming()
+	return result, nil
+}
+
+// emptyDecks returns the decks with no upcoming cards left, except frozen
+// decks.
+func emptyDecks() ([]string, error) {
+	rows, err := db.Query("SELECT id FROM decks WHERE (upcoming IS NULL OR upcoming IN ('[]', 'null')) AND frozen = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Targets GET /deck/{id}/advise accepts.
+const (
+	defaultAdviseTarget = 21
+	maxAdviseTarget     = 100
+)
+
+// Advice represents the odds that the next card drawn keeps a hand at or
+// under a target.
+type Advice struct {
+	Target         int      `json:"target"`
+	Hand           []string `json:"hand"`
+	HandTotal      int      `json:"hand_total"`
+	Soft           bool     `json:"soft"`
+	Probability    float64  `json:"probability"`
+	SafeCards      int      `json:"safe_cards"`
+	TotalRemaining int      `json:"total_remaining"`
+}
+
+// handTotal returns the best blackjack total of a hand under target: its
+// hard total, or ten more when it holds an ace that can count 11 without
+// going over. soft reports the latter.
+func handTotal(ranks []string, target int) (total int, soft bool) {
+	ace := false
+	for _, rank := range ranks {
+		total += hardValue(rank)
+		ace = ace || rank == "a"
+	}
+	if ace && total+10 <= target {
+		return total + 10, true
+	}
+	return total, false
+}
+
+// showAdvice serves GET /deck/{id}/advise?target=21&hand=ah,ks: the odds
+// that the next upcoming card keeps the hand at or under target, counting
+// blackjack values. An ace can always fall back to 1, so a card is safe when
+// the hard total of the hand with it is within target. The hand is the
+// client's: its cards are not looked up in the deck.
+func showAdvice(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	query := r.URL.Query()
+	target := v.OptionalInt("target", query.Get("target"), defaultAdviseTarget, 2, maxAdviseTarget)
+	advice := Advice{Target: target, Hand: []string{}}
+	var ranks []string
+	if query.Get("hand") == "" {
+		v.Add("hand", "missing", "hand is required, e.g. hand=ah,ks")
+	}
+	for _, token := range strings.Split(query.Get("hand"), ",") {
+		if token == "" {
+			continue
+		}
+		code, err := resolveCardCode(token)
+		if err != nil {
+			v.Add("hand", "unknown_card", "%s", err.Error())
+			continue
+		}
+		advice.Hand = append(advice.Hand, code)
+		ranks = append(ranks, cardFromCode(code).Rank)
+	}
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	advice.HandTotal, advice.Soft = handTotal(ranks, target)
+	hard, _ := handTotal(ranks, 0)
+	advice.TotalRemaining = len(upcomingCards)
+	for _, card := range upcomingCards {
+		if hard+hardValue(card.Rank) <= target {
+			advice.SafeCards++
+		}
+	}
+	if advice.TotalRemaining > 0 {
+		advice.Probability = float64(advice.SafeCards) / float64(advice.TotalRemaining)
+	}
+
+	writeJSON(w, advice)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAdvise(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	tests := []struct {
+		query     string
+		total     int
+		soft      bool
+		safeCards int
+	}{
+		{"hand=10h,6s", 16, false, 20}, // ace to five
+		{"hand=ah,6d", 17, true, 52},   // the ace falls back to 1
+		{"hand=AH,ks", 21, true, 52},
+		{"hand=ks,qs,2h", 22, false, 0},
+		{"target=17&hand=10h,6s", 16, false, 4}, // aces only
+	}
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + "/deck/" + deckID + "/advise?" + test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var advice Advice
+		json.NewDecoder(resp.Body).Decode(&advice)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || advice.HandTotal != test.total || advice.Soft != test.soft || advice.SafeCards != test.safeCards || advice.TotalRemaining != 52 {
+			t.Errorf("%s: status %d, %+v", test.query, resp.StatusCode, advice)
+		}
+		if want := float64(test.safeCards) / 52; advice.Probability != want {
+			t.Errorf("%s: probability %v, want %v", test.query, advice.Probability, want)
+		}
+	}
+
+	for url, want := range map[string]int{
+		"/deck/" + deckID + "/advise":                    http.StatusBadRequest,
+		"/deck/" + deckID + "/advise?hand=zz":            http.StatusBadRequest,
+		"/deck/" + deckID + "/advise?hand=ah&target=1":   http.StatusBadRequest,
+		"/deck/" + deckID + "/advise?hand=ah&target=abc": http.StatusBadRequest,
+		"/deck/missing/advise?hand=ah":                   http.StatusNotFound,
+	} {
+		resp, err := http.Get(server.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", url, resp.StatusCode, want)
+		}
+	}
+}
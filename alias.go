@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rankTable and suitTable hold, for each canonical rank and suit code, its
+// display name and the aliases accepted as input. Every lookup of card names
+// and aliases goes through these two tables.
+var rankTable = []struct {
+	Code    string
+	Name    string
+	Aliases []string
+}{
+	{"2", "Two", []string{"two"}},
+	{"3", "Three", []string{"three"}},
+	{"4", "Four", []string{"four"}},
+	{"5", "Five", []string{"five"}},
+	{"6", "Six", []string{"six"}},
+	{"7", "Seven", []string{"seven"}},
+	{"8", "Eight", []string{"eight"}},
+	{"9", "Nine", []string{"nine"}},
+	{"10", "Ten", []string{"ten", "0"}},
+	{"j", "Jack", []string{"jack"}},
+	{"q", "Queen", []string{"queen"}},
+	{"k", "King", []string{"king"}},
+	{"a", "Ace", []string{"ace"}},
+}
+
+var suitTable = []struct {
+	Code    string
+	Name    string
+	Symbol  string
+	Aliases []string
+}{
+	{"h", "Hearts", "♥", []string{"hearts", "heart", "♥", "♡"}},
+	{"d", "Diamonds", "♦", []string{"diamonds", "diamond", "♦", "♢"}},
+	{"c", "Clubs", "♣", []string{"clubs", "club", "♣", "♧"}},
+	{"s", "Spades", "♠", []string{"spades", "spade", "♠", "♤"}},
+}
+
+var rankAliases, suitAliases = buildAliases()
+
+// suitCodes lists the suit codes in table order.
+var suitCodes = func() []string {
+	codes := make([]string, len(suitTable))
+	for i, suit := range suitTable {
+		codes[i] = suit.Code
+	}
+	return codes
+}()
+
+// suitSymbols maps each suit code to its Unicode symbol.
+var suitSymbols = func() map[string]string {
+	symbols := make(map[string]string)
+	for _, suit := range suitTable {
+		symbols[suit.Code] = suit.Symbol
+	}
+	return symbols
+}()
+
+func buildAliases() (map[string]string, map[string]string) {
+	ranks := make(map[string]string)
+	for _, rank := range rankTable {
+		ranks[rank.Code] = rank.Code
+		for _, alias := range rank.Aliases {
+			ranks[alias] = rank.Code
+		}
+	}
+	suits := make(map[string]string)
+	for _, suit := range suitTable {
+		suits[suit.Code] = suit.Code
+		for _, alias := range suit.Aliases {
+			suits[alias] = suit.Code
+		}
+	}
+	return ranks, suits
+}
+
+// UnknownCardError reports an input token that does not name a card.
+type UnknownCardError struct {
+	Token string
+}
+
+func (e *UnknownCardError) Error() string {
+	return fmt.Sprintf("Unknown card code: %q", e.Token)
+}
+
+// resolveCardCode normalizes a user-supplied card name such as "A♠", "AS",
+// "0s" or "ace_of_spades" to its canonical code ("as").
+func resolveCardCode(token string) (string, error) {
+	input := strings.ToLower(strings.TrimSpace(token))
+	if isJoker(input) {
+		return input, nil
+	}
+
+	if rank, suit, ok := strings.Cut(input, "_of_"); ok {
+		if code, ok := joinAliases(rank, suit); ok {
+			return code, nil
+		}
+		return "", &UnknownCardError{Token: token}
+	}
+
+	// Otherwise the suit is the last character (a letter or a symbol).
+	runes := []rune(input)
+	if len(runes) >= 2 {
+		if code, ok := joinAliases(string(runes[:len(runes)-1]), string(runes[len(runes)-1])); ok {
+			return code, nil
+		}
+	}
+	return "", &UnknownCardError{Token: token}
+}
+
+func joinAliases(rank, suit string) (string, bool) {
+	rankCode, ok := rankAliases[rank]
+	if !ok {
+		return "", false
+	}
+	suitCode, ok := suitAliases[suit]
+	if !ok {
+		return "", false
+	}
+	return rankCode + suitCode, true
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Closed decks are archived to cold storage: one gzipped JSON document per
+// deck in archiveDir, removed from the decks table. A deck is closed once its
+// locks_at deadline has passed, and archived when it has not changed for
+// archiveAfter since. The archive runs every ARCHIVE_EVERY (e.g. "24h"), or
+// only on demand from the sweeper when it is not set.
+//
+// The database always wins: the document is written and renamed into place
+// before the deck is deleted, and a restored deck is inserted before its
+// document is removed. An interruption between the two steps leaves the deck
+// in both places, which reads as a live deck and is tidied by the next run.
+var (
+	archiveDir      = envString("ARCHIVE_DIR", "archive")
+	archiveAfter    = envDuration("ARCHIVE_AFTER", 30*24*time.Hour)
+	archiveEvery, _ = time.ParseDuration(os.Getenv("ARCHIVE_EVERY"))
+)
+
+// archiveSweepTimeout bounds one run of the archive.
+const archiveSweepTimeout = 5 * time.Minute
+
+// archiveInterrupt, when set, is called between the two steps of an archive
+// ("written") and of a restore ("restored"). Returning an error stops the
+// operation there, as a crash would. Tests use it to check crash safety.
+var archiveInterrupt func(step string) error
+
+// archiveIDPattern is what a deck ID must look like to name an archive file.
+var archiveIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+var errNotArchived = errors.New("Deck not archived")
+
+// ArchivedDeck represents the document of a deck, archived or live. Row holds
+// every column of the deck as stored, so that a restore gives the deck back
+// exactly; the other fields are there to read it.
+type ArchivedDeck struct {
+	DeckID     string            `json:"deck_id"`
+	Status     string            `json:"status"`
+	ArchivedAt string            `json:"archived_at,omitempty"`
+	CreatedAt  string            `json:"created_at,omitempty"`
+	UpdatedAt  string            `json:"updated_at,omitempty"`
+	LocksAt    string            `json:"locks_at,omitempty"`
+	Upcoming   []Card            `json:"upcoming"`
+	Drawn      []DrawnCard       `json:"drawn"`
+	Piles      map[string][]Card `json:"piles"`
+	ShuffleLog []ShuffleLogEntry `json:"shuffle_log"`
+	Events     []DeckEvent       `json:"events,omitempty"`
+	Row        map[string]any    `json:"row"`
+}
+
+// ArchiveEntry represents an archived deck in the admin listing.
+type ArchiveEntry struct {
+	DeckID     string `json:"deck_id"`
+	ArchivedAt string `json:"archived_at"`
+	Bytes      int64  `json:"bytes"`
+}
+
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+func archivePath(deckID string) string {
+	return filepath.Join(archiveDir, deckID+".json.gz")
+}
+
+// loadDeckDocument builds the document of a deck from the database.
+func loadDeckDocument(q *sql.DB, deckID string) (ArchivedDeck, error) {
+	rows, err := q.Query("SELECT * FROM decks WHERE id = ?", deckID)
+	if err != nil {
+		return ArchivedDeck{}, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return ArchivedDeck{}, errDeckNotFound
+	}
+	doc, err := scanDeckDocument(rows)
+	if err != nil {
+		return ArchivedDeck{}, err
+	}
+	rows.Close()
+	if err := loadDeckPiles(context.Background(), q, &doc); err != nil {
+		return ArchivedDeck{}, err
+	}
+	if doc.ShuffleLog, err = readShuffleLog(q, deckID); err != nil {
+		return ArchivedDeck{}, err
+	}
+	doc.Events, err = readEvents(q, deckID)
+	return doc, err
+}
+
+// scanDeckDocument builds the document of the deck at the current row of a
+// SELECT * on the decks table, without its piles.
+func scanDeckDocument(rows *sql.Rows) (ArchivedDeck, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return ArchivedDeck{}, err
+	}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return ArchivedDeck{}, err
+	}
+
+	doc := ArchivedDeck{Status: "active", Row: map[string]any{}, Piles: map[string][]Card{}}
+	for i, column := range columns {
+		value := values[i]
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		doc.Row[column] = value
+	}
+	text := func(column string) string {
+		s, _ := doc.Row[column].(string)
+		return s
+	}
+	doc.DeckID = text("id")
+	doc.CreatedAt, doc.UpdatedAt, doc.LocksAt = text("created_at"), text("updated_at"), text("locks_at")
+	doc.Upcoming, _ = unmarshalUpcoming([]byte(text("upcoming")), text("scoring"))
+	json.Unmarshal([]byte(text("piged")), &doc.Drawn)
+	return doc, nil
+}
+
+// loadDeckPiles fills in the piles of a deck document.
+func loadDeckPiles(ctx context.Context, q *sql.DB, doc *ArchivedDeck) error {
+	pileRows, err := q.QueryContext(ctx, "SELECT name, cards FROM piles WHERE deck_id = ?", doc.DeckID)
+	if err != nil {
+		return err
+	}
+	defer pileRows.Close()
+	for pileRows.Next() {
+		var name, cardsJSON string
+		if err := pileRows.Scan(&name, &cardsJSON); err != nil {
+			return err
+		}
+		var cards []Card
+		json.Unmarshal([]byte(cardsJSON), &cards)
+		doc.Piles[name] = cards
+	}
+	return pileRows.Err()
+}
+
+// writeArchiveFile writes the document of a deck to a temporary file and
+// renames it into place, so that an archive file is always complete.
+func writeArchiveFile(doc ArchivedDeck) error {
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(archiveDir, doc.DeckID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(gz).Encode(doc); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), archivePath(doc.DeckID)); err != nil {
+		return err
+	}
+	// Make the rename itself durable.
+	if dir, err := os.Open(archiveDir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// readArchiveFile reads the document of an archived deck.
+func readArchiveFile(deckID string) (ArchivedDeck, error) {
+	if !archiveIDPattern.MatchString(deckID) {
+		return ArchivedDeck{}, errNotArchived
+	}
+	f, err := os.Open(archivePath(deckID))
+	if errors.Is(err, os.ErrNotExist) {
+		return ArchivedDeck{}, errNotArchived
+	} else if err != nil {
+		return ArchivedDeck{}, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return ArchivedDeck{}, err
+	}
+	defer gz.Close()
+
+	var doc ArchivedDeck
+	dec := json.NewDecoder(gz)
+	// Keep integers as written rather than as float64.
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return ArchivedDeck{}, err
+	}
+	return doc, nil
+}
+
+// deckExists reports whether a deck is in the decks table.
+func deckExists(exec execer, deckID string) bool {
+	var exists int
+	return exec.QueryRow("SELECT 1 FROM decks WHERE id = ?", deckID).Scan(&exists) == nil
+}
+
+// archiveDeck moves a deck to cold storage. The caller must hold mu.
+func archiveDeck(deckID string) error {
+	doc, err := loadDeckDocument(db, deckID)
+	if err != nil {
+		return err
+	}
+	doc.Status = "archived"
+	doc.ArchivedAt = now()
+	if err := writeArchiveFile(doc); err != nil {
+		return err
+	}
+	if archiveInterrupt != nil {
+		if err := archiveInterrupt("written"); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := deleteDeck(tx, deckID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deckColumns returns the columns of the decks table.
+func deckColumns() (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info('decks')")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// restoreDeck puts an archived deck back in the decks table. A deck that is
+// already there only has its leftover document removed. The restore counts
+// as a change: updated_at is set to now, or the next sweep would find the
+// deck closed for as long as before and archive it again. The caller must
+// hold mu.
+func restoreDeck(deckID string) error {
+	doc, err := readArchiveFile(deckID)
+	if err != nil {
+		return err
+	}
+	if deckExists(db, deckID) {
+		return os.Remove(archivePath(deckID))
+	}
+
+	known, err := deckColumns()
+	if err != nil {
+		return err
+	}
+	var columns, marks []string
+	var args []any
+	for column, value := range doc.Row {
+		if !known[column] {
+			continue
+		}
+		columns = append(columns, column)
+		marks = append(marks, "?")
+		args = append(args, value)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(fmt.Sprintf("INSERT INTO decks (%s) VALUES (%s)", strings.Join(columns, ", "), strings.Join(marks, ", ")), args...); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE decks SET updated_at = ? WHERE id = ?", now(), deckID); err != nil {
+		return err
+	}
+	for name, cards := range doc.Piles {
+		cardsJSON, err := marshalCards(cards)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO piles (deck_id, name, cards) VALUES (?, ?, ?)", deckID, name, string(cardsJSON)); err != nil {
+			return err
+		}
+	}
+	for _, entry := range doc.ShuffleLog {
+		entry.DeckID = deckID
+		if err := insertShuffleLog(tx, entry.Kind, entry); err != nil {
+			return err
+		}
+	}
+	for _, event := range doc.Events {
+		if err := recordEvent(tx, deckID, event.EventType, event.RecordedAt, event.Detail); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if archiveInterrupt != nil {
+		if err := archiveInterrupt("restored"); err != nil {
+			return err
+		}
+	}
+	return os.Remove(archivePath(deckID))
+}
+
+// closedDecks returns the decks whose deadline has passed and that have not
+// changed for archiveAfter. Frozen decks are kept.
+func closedDecks() ([]string, int64, error) {
+	rows, err := db.Query("SELECT id, locks_at, COALESCE(updated_at, '') FROM decks WHERE locks_at IS NOT NULL AND locks_at != '' AND frozen = 0")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	var examined int64
+	cutoff := clock.Now().Add(-archiveAfter)
+	for rows.Next() {
+		var id, locksAt, updatedAt string
+		if err := rows.Scan(&id, &locksAt, &updatedAt); err != nil {
+			return nil, examined, err
+		}
+		examined++
+		if !deadlinePassed(locksAt) {
+			continue
+		}
+		if updated, err := time.Parse(time.RFC3339, updatedAt); err == nil && updated.After(cutoff) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, examined, rows.Err()
+}
+
+// tidyArchive removes what an interrupted archive or restore left behind:
+// temporary files, and documents of decks that are still in the database.
+// The caller must hold mu.
+func tidyArchive() error {
+	entries, err := os.ReadDir(archiveDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, ".tmp"):
+			os.Remove(filepath.Join(archiveDir, name))
+		case strings.HasSuffix(name, ".json.gz"):
+			if deckExists(db, strings.TrimSuffix(name, ".json.gz")) {
+				os.Remove(filepath.Join(archiveDir, name))
+			}
+		}
+	}
+	return nil
+}
+
+// archiveClosedDecks archives every closed deck and returns how many decks
+// were examined and archived.
+func archiveClosedDecks() (SweepResult, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result SweepResult
+	if err := tidyArchive(); err != nil {
+		return result, err
+	}
+	ids, examined, err := closedDecks()
+	result.Examined = examined
+	if err != nil {
+		return result, err
+	}
+	for _, id := range ids {
+		if err := archiveDeck(id); err != nil {
+			return result, fmt.Errorf("archive deck %s: %w", id, err)
+		}
+		result.Deleted++
+	}
+	return result, nil
+}
+
+func sweepArchive(ctx context.Context) (SweepResult, error) {
+	result, err := archiveClosedDecks()
+	if result.Deleted > 0 {
+		log.Printf("Archived %d closed decks", result.Deleted)
+	}
+	return result, err
+}
+
+// listArchive returns the archived decks, oldest archive first. Documents of
+// decks that are back in the database are not archived decks and are left
+// out.
+func listArchive() ([]ArchiveEntry, error) {
+	entries, err := os.ReadDir(archiveDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []ArchiveEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	list := []ArchiveEntry{}
+	for _, entry := range entries {
+		deckID, ok := strings.CutSuffix(entry.Name(), ".json.gz")
+		if !ok || deckExists(readDB, deckID) {
+			continue
+		}
+		doc, err := readArchiveFile(deckID)
+		if err != nil {
+			continue
+		}
+		item := ArchiveEntry{DeckID: deckID, ArchivedAt: doc.ArchivedAt}
+		if info, err := entry.Info(); err == nil {
+			item.Bytes = info.Size()
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ArchivedAt < list[j].ArchivedAt })
+	return list, nil
+}
+
+// showArchivedDeckInfo answers GET /deck/{id} for an archived deck.
+func showArchivedDeckInfo(w http.ResponseWriter, doc ArchivedDeck) {
+	info := DeckInfo{
+		ID:        doc.DeckID,
+		Status:    "archived",
+		Remaining: len(doc.Upcoming),
+		Drawn:     len(doc.Drawn),
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+		LocksAt:   doc.LocksAt,
+		Locked:    true,
+	}
+	writeJSON(w, info)
+}
+
+// exportDeck serves GET /deck/{id}/export: the document of a live deck, or
+// the archived document of an archived deck. The event log is for admins
+// only, as on GET /deck/{id}/events.
+func exportDeck(w http.ResponseWriter, r *http.Request, deckID string) {
+	doc, err := loadDeckDocument(readDB, deckID)
+	if err == errDeckNotFound {
+		doc, err = readArchiveFile(deckID)
+		if err == errNotArchived {
+			err = errDeckNotFound
+		}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !isAdmin(r) {
+		doc.Events = nil
+	}
+	writeJSON(w, doc)
+}
+
+// handleAdminArchive serves GET /admin/archive, the archived decks, and POST
+// /admin/archive/{id}/restore.
+func handleAdminArchive(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/archive"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "" && r.Method == http.MethodGet:
+		list, err := listArchive()
+		if err != nil {
+			http.Error(w, "Error listing archive", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, list)
+	case len(parts) == 2 && parts[1] == "restore" && r.Method == http.MethodPost:
+		mu.Lock()
+		err := restoreDeck(parts[0])
+		mu.Unlock()
+		if err == errNotArchived {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("restore deck %s: %v", parts[0], err)
+			http.Error(w, "Error restoring deck", http.StatusInternalServerError)
+			return
+		}
+		showDeckInfo(w, parts[0])
+	case len(parts) == 1 && parts[0] == "", len(parts) == 2 && parts[1] == "restore":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setupArchive points the archive at a fresh directory and archives decks
+// closed for more than an hour.
+func setupArchive(t *testing.T) {
+	t.Helper()
+	savedDir, savedAfter, savedToken := archiveDir, archiveAfter, adminToken
+	archiveDir, archiveAfter, adminToken = t.TempDir(), time.Hour, "secret"
+	t.Cleanup(func() {
+		archiveDir, archiveAfter, adminToken = savedDir, savedAfter, savedToken
+		archiveInterrupt = nil
+	})
+}
+
+// closeDeck gives a deck a deadline and a last change two hours ago.
+func closeDeck(t *testing.T, deckID string) {
+	t.Helper()
+	past := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE decks SET locks_at = ?, updated_at = ? WHERE id = ?", past, past, deckID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deckStatus(t *testing.T, url string) (int, DeckInfo) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var info DeckInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	return resp.StatusCode, info
+}
+
+func TestArchiveClosedDecks(t *testing.T) {
+	setupArchive(t)
+	server := newTestServer(t)
+
+	closed := newTestDeck(t, server, 1)
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+closed+"/draw/3?label=question-1")
+	if resp, err := http.Post(server.URL+"/deck/"+closed+"/play/2/to/discard", "", nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("play to pile: %v", err)
+	}
+	closeDeck(t, closed)
+	before, err := loadDeckDocument(db, closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before.Events) != 1 || before.Events[0].EventType != "labeled_draw" {
+		t.Fatalf("event log before archive = %+v", before.Events)
+	}
+
+	open := newTestDeck(t, server, 1)
+	recent := newTestDeck(t, server, 1)
+	if _, err := db.Exec("UPDATE decks SET locks_at = ? WHERE id = ?", time.Now().Add(-time.Minute).UTC().Format(time.RFC3339), recent); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := archiveClosedDecks()
+	if err != nil || result.Deleted != 1 || result.Examined != 2 {
+		t.Fatalf("archive: %+v, %v", result, err)
+	}
+	for _, id := range []string{open, recent} {
+		if status, info := deckStatus(t, server.URL+"/deck/"+id); status != http.StatusOK || info.Status != "active" {
+			t.Errorf("deck %s: status %d, %q", id, status, info.Status)
+		}
+	}
+
+	status, info := deckStatus(t, server.URL+"/deck/"+closed)
+	if status != http.StatusOK || info.Status != "archived" || info.Drawn != 3 || info.Remaining != 47 {
+		t.Errorf("archived deck: status %d, %+v", status, info)
+	}
+	if deckExists(db, closed) {
+		t.Error("archived deck is still in the decks table")
+	}
+
+	resp := adminRequest(t, http.MethodGet, server.URL+"/deck/"+closed+"/export", "")
+	var doc ArchivedDeck
+	json.NewDecoder(resp.Body).Decode(&doc)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || doc.Status != "archived" || len(doc.Drawn) != 3 || len(doc.Piles["discard"]) != 2 || len(doc.Events) != 1 {
+		t.Errorf("export: status %d, %s with %d drawn and piles %v", resp.StatusCode, doc.Status, len(doc.Drawn), doc.Piles)
+	}
+	if fetch, _ := http.Get(server.URL + "/deck/missing/export"); fetch.StatusCode != http.StatusNotFound {
+		t.Errorf("export of a missing deck returned %d", fetch.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/deck/" + closed + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var public ArchivedDeck
+	json.NewDecoder(resp.Body).Decode(&public)
+	resp.Body.Close()
+	if len(public.Events) != 0 {
+		t.Errorf("public export shows the event log: %+v", public.Events)
+	}
+
+	resp = adminRequest(t, http.MethodGet, server.URL+"/admin/archive", "")
+	var list []ArchiveEntry
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0].DeckID != closed || list[0].Bytes == 0 {
+		t.Errorf("archive listing = %+v", list)
+	}
+
+	resp = adminRequest(t, http.MethodPost, server.URL+"/admin/archive/"+closed+"/restore", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore returned %d", resp.StatusCode)
+	}
+	after, err := loadDeckDocument(db, closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := time.Parse(time.RFC3339, after.UpdatedAt); err != nil || time.Since(updated) > time.Minute {
+		t.Errorf("restored deck updated at %q, want now", after.UpdatedAt)
+	}
+	// Everything else comes back as it was.
+	after.UpdatedAt, after.Row["updated_at"] = before.UpdatedAt, before.Row["updated_at"]
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("restored deck differs:\n%+v\nwant\n%+v", after, before)
+	}
+	if _, err := os.Stat(archivePath(closed)); !os.IsNotExist(err) {
+		t.Errorf("archive document left after restore: %v", err)
+	}
+	resp = adminRequest(t, http.MethodPost, server.URL+"/admin/archive/"+closed+"/restore", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("restore of a live deck returned %d", resp.StatusCode)
+	}
+}
+
+func TestArchiveInterrupted(t *testing.T) {
+	setupArchive(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID+"/draw/5")
+	closeDeck(t, deckID)
+
+	crash := errors.New("crash")
+	interruptAt := func(step string) {
+		archiveInterrupt = func(s string) error {
+			if s == step {
+				return crash
+			}
+			return nil
+		}
+	}
+
+	// The document is written but the deck not yet deleted: it is still live.
+	interruptAt("written")
+	if _, err := archiveClosedDecks(); !errors.Is(err, crash) {
+		t.Fatalf("interrupted archive returned %v", err)
+	}
+	if _, info := deckStatus(t, server.URL+"/deck/"+deckID); info.Status != "active" {
+		t.Errorf("deck status after an interrupted archive = %q", info.Status)
+	}
+	if list, _ := listArchive(); len(list) != 0 {
+		t.Errorf("interrupted archive is listed: %+v", list)
+	}
+
+	archiveInterrupt = nil
+	if result, err := archiveClosedDecks(); err != nil || result.Deleted != 1 {
+		t.Fatalf("archive after the interruption: %+v, %v", result, err)
+	}
+	if _, info := deckStatus(t, server.URL+"/deck/"+deckID); info.Status != "archived" || info.Drawn != 5 {
+		t.Errorf("deck after archive = %+v", info)
+	}
+
+	// The deck is back but its document not yet removed: it is live, and the
+	// next run removes the leftover document.
+	interruptAt("restored")
+	mu.Lock()
+	err := restoreDeck(deckID)
+	mu.Unlock()
+	if !errors.Is(err, crash) {
+		t.Fatalf("interrupted restore returned %v", err)
+	}
+	if _, info := deckStatus(t, server.URL+"/deck/"+deckID); info.Status != "active" || info.Drawn != 5 {
+		t.Errorf("deck after an interrupted restore = %+v", info)
+	}
+	archiveInterrupt = nil
+	if _, err := archiveClosedDecks(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archivePath(deckID)); !os.IsNotExist(err) {
+		t.Errorf("leftover document not removed: %v", err)
+	}
+	if !deckExists(db, deckID) {
+		t.Error("tidying the archive removed the live deck")
+	}
+}
+
+func TestSweepAfterRestore(t *testing.T) {
+	setupArchive(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	closeDeck(t, deckID)
+	if result, err := archiveClosedDecks(); err != nil || result.Deleted != 1 {
+		t.Fatalf("archive: %+v, %v", result, err)
+	}
+
+	resp := adminRequest(t, http.MethodPost, server.URL+"/admin/archive/"+deckID+"/restore", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore returned %d", resp.StatusCode)
+	}
+	// The deadline is still in the past, but the deck just changed.
+	if result, err := archiveClosedDecks(); err != nil || result.Deleted != 0 {
+		t.Fatalf("sweep right after the restore: %+v, %v", result, err)
+	}
+	if _, info := deckStatus(t, server.URL+"/deck/"+deckID); info.Status != "active" {
+		t.Errorf("deck status after the sweep = %q", info.Status)
+	}
+}
+
+func TestPurgeArchivesEmptyDecks(t *testing.T) {
+	setupArchive(t)
+	server := newTestServer(t)
+	empty := newTestDeck(t, server, 1)
+	kept := newTestDeck(t, server, 1)
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+empty+"/draw/52")
+
+	resp := adminRequest(t, http.MethodPost, server.URL+"/admin/decks/purge-empty", "")
+	defer resp.Body.Close()
+	var result PurgeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result != (PurgeResult{Purged: 1, Archived: 1}) {
+		t.Errorf("purge = %+v, want one deck purged and archived", result)
+	}
+	if deckExists(db, empty) || !deckExists(db, kept) {
+		t.Error("purge removed the wrong decks")
+	}
+	if _, info := deckStatus(t, server.URL+"/deck/"+empty); info.Status != "archived" || info.Drawn != 52 {
+		t.Errorf("purged deck = %+v", info)
+	}
+}
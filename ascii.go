@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// defaultCardsPerLine is used when cards_per_line is missing or invalid.
+const defaultCardsPerLine = 13
+
+// renderASCII draws cards as Unicode boxes, perLine cards per row:
+//
+//	┌───┐ ┌───┐
+//	│A ♥│ │10♠│
+//	└───┘ └───┘
+func renderASCII(cards []Card, perLine int) string {
+	var b strings.Builder
+	for start := 0; start < len(cards); start += perLine {
+		end := start + perLine
+		if end > len(cards) {
+			end = len(cards)
+		}
+		row := cards[start:end]
+
+		tops := make([]string, len(row))
+		faces := make([]string, len(row))
+		bottoms := make([]string, len(row))
+		for i, card := range row {
+			tops[i] = "┌───┐"
+			faces[i] = "│" + asciiFace(card) + "│"
+			bottoms[i] = "└───┘"
+		}
+		b.WriteString(strings.Join(tops, " ") + "\n")
+		b.WriteString(strings.Join(faces, " ") + "\n")
+		b.WriteString(strings.Join(bottoms, " ") + "\n")
+	}
+	return b.String()
+}
+
+// asciiFace returns the three-column face of a card, such as "A ♥" or "10♠".
+// Cards added by code only have their rank and suit read from the code.
+// Custom codes may hold any printable character, so the rank is cut and
+// padded by display width, never inside a character.
+func asciiFace(card Card) string {
+	rank, suit := card.Rank, card.Suit
+	if runes := []rune(card.Code); rank == "" && len(runes) >= 2 {
+		rank, suit = string(runes[:len(runes)-1]), string(runes[len(runes)-1:])
+	}
+	if rank == "joker" || isJoker(card.Code) {
+		return "JK★"
+	}
+
+	symbol, ok := suitSymbols[suit]
+	if !ok {
+		symbol = "?"
+	}
+	return fitColumns(strings.ToUpper(rank), 2) + symbol
+}
+
+// fitColumns cuts s to the characters that fit in width columns and pads it
+// with spaces to exactly width.
+func fitColumns(s string, width int) string {
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if used+w > width {
+			break
+		}
+		b.WriteRune(r)
+		used += w
+	}
+	return b.String() + strings.Repeat(" ", width-used)
+}
+
+// runeWidth returns the number of terminal columns r takes: none for
+// combining marks and format characters, two for East Asian wide and
+// fullwidth characters and emoji, one otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115F, // Hangul Jamo
+		r >= 0x2E80 && r <= 0xA4CF && r != 0x303F,              // CJK
+		r >= 0xAC00 && r <= 0xD7A3,                             // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF,                             // CJK compatibility ideographs
+		r >= 0xFE30 && r <= 0xFE4F,                             // CJK compatibility forms
+		r >= 0xFF00 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE6, // fullwidth forms
+		r >= 0x1F300 && r <= 0x1F64F, r >= 0x1F900 && r <= 0x1F9FF, // emoji
+		r >= 0x20000 && r <= 0x3FFFD: // CJK extensions
+		return 2
+	}
+	return 1
+}
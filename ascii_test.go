@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestASCIIFaces keeps every face three columns wide and valid UTF-8,
+// including for custom codes made of multibyte characters.
+func TestASCIIFaces(t *testing.T) {
+	tests := []struct {
+		card Card
+		want string
+	}{
+		{cardFromCode("ah"), "A ♥"},
+		{cardFromCode("10s"), "10♠"},
+		{Card{Code: "kd"}, "K ♦"},
+		{customCard("dragon"), "DR?"},
+		{customCard("été"), "ÉT?"},
+		{customCard("王様"), "王?"},
+		{customCard("a王"), "A ?"},
+		{customCard("🂡joker"), "🂡J?"},
+		{Card{Code: "é♥"}, "É ?"},
+	}
+	for _, tt := range tests {
+		got := asciiFace(tt.card)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("face of %q = %q, want %q", tt.card.Code, got, tt.want)
+		}
+	}
+
+	art := renderASCII([]Card{customCard("王様"), customCard("été")}, 2)
+	if !utf8.ValidString(art) || !strings.Contains(art, "│王?│ │ÉT?│") {
+		t.Errorf("boxes:\n%s", art)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// auditReferences maps a reference name of GET /deck/{id}/audit to the
+// cards it is made of. They come from generateCards, so they follow any
+// change to the ranks and suits of a pack.
+var auditReferences = map[string]func() []Card{
+	"standard52": func() []Card { return generateCards(1, 0, CardOrder{}) },
+	"standard54": func() []Card { return generateCards(1, 2, CardOrder{}) },
+}
+
+// CardCountMismatch represents a card a deck holds, but not as many times as
+// the reference.
+type CardCountMismatch struct {
+	Code     string `json:"code"`
+	Expected int    `json:"expected"`
+	Actual   int    `json:"actual"`
+}
+
+// DeckAudit represents how a deck compares with a reference composition.
+// Missing cards are in the reference only, extra cards in the deck only.
+type DeckAudit struct {
+	DeckID     string              `json:"deck_id"`
+	Reference  string              `json:"reference"`
+	Matches    bool                `json:"matches"`
+	Total      int                 `json:"total"`
+	Expected   int                 `json:"expected"`
+	Missing    []string            `json:"missing"`
+	Extra      []string            `json:"extra"`
+	WrongCount []CardCountMismatch `json:"wrong_count"`
+}
+
+func auditReferenceNames() []string {
+	names := make([]string, 0, len(auditReferences))
+	for name := range auditReferences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// heldCards returns every card a deck holds, upcoming, drawn and on piles.
+// Drawn cards a split moved to another deck are no longer part of it.
+func heldCards(doc ArchivedDeck) []Card {
+	held := append([]Card(nil), doc.Upcoming...)
+	for _, entry := range doc.Drawn {
+		if entry.To == "" {
+			held = append(held, Card{Code: entry.Code})
+		}
+	}
+	for _, cards := range doc.Piles {
+		held = append(held, cards...)
+	}
+	return held
+}
+
+// auditCards compares held with reference. Each list is in code order.
+func auditCards(held, reference []Card) DeckAudit {
+	have := map[string]int{}
+	for _, card := range held {
+		have[card.Code]++
+	}
+	want := map[string]int{}
+	for _, card := range reference {
+		want[card.Code]++
+	}
+
+	audit := DeckAudit{Total: len(held), Expected: len(reference), Missing: []string{}, Extra: []string{}, WrongCount: []CardCountMismatch{}}
+	for code, n := range want {
+		switch {
+		case have[code] == 0:
+			audit.Missing = append(audit.Missing, code)
+		case have[code] != n:
+			audit.WrongCount = append(audit.WrongCount, CardCountMismatch{Code: code, Expected: n, Actual: have[code]})
+		}
+	}
+	for code := range have {
+		if want[code] == 0 {
+			audit.Extra = append(audit.Extra, code)
+		}
+	}
+	sort.Strings(audit.Missing)
+	sort.Strings(audit.Extra)
+	sort.Slice(audit.WrongCount, func(i, j int) bool { return audit.WrongCount[i].Code < audit.WrongCount[j].Code })
+	audit.Matches = len(audit.Missing) == 0 && len(audit.Extra) == 0 && len(audit.WrongCount) == 0
+	return audit
+}
+
+// auditDeck serves GET /deck/{id}/audit?reference=standard52, which compares
+// every card of the deck, upcoming, drawn and on piles, with a reference.
+func auditDeck(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	reference := v.RequireOneOf("reference", r.URL.Query().Get("reference"), auditReferenceNames())
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	doc, err := loadDeckDocument(readDB, deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	audit := auditCards(heldCards(doc), auditReferences[reference]())
+	audit.DeckID, audit.Reference = deckID, reference
+	writeJSON(w, audit)
+}
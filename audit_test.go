@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditDeck(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	audit := func(reference string) DeckAudit {
+		t.Helper()
+		resp, err := http.Get(base + "/audit?reference=" + reference)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("audit against %s returned %d", reference, resp.StatusCode)
+		}
+		var a DeckAudit
+		json.NewDecoder(resp.Body).Decode(&a)
+		return a
+	}
+
+	// Drawing and playing to a pile keep every card in the deck.
+	fetchDeck(t, http.MethodGet, base+"/draw/3")
+	if resp, err := http.Post(base+"/play/2/to/discard", "", nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("play to pile: %v", err)
+	}
+	if a := audit("standard52"); !a.Matches || a.Total != 52 {
+		t.Errorf("untouched deck against standard52 = %+v", a)
+	}
+	if a := audit("standard54"); a.Matches || !reflect.DeepEqual(a.Missing, []string{"joker"}) {
+		t.Errorf("deck against standard54 = %+v", a)
+	}
+
+	// The deck is not shuffled: the next card is the sixth of the hearts.
+	removed := "7h"
+	req, _ := http.NewRequest(http.MethodDelete, base+"/cards/"+removed+"/upcoming", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("remove %s: %v", removed, err)
+	}
+	if resp, err := http.Post(base+"/add?cards=ah,joker", "", nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("add: %v", err)
+	}
+	a := audit("standard52")
+	wantWrong := []CardCountMismatch{{Code: "ah", Expected: 1, Actual: 2}}
+	if a.Matches || !reflect.DeepEqual(a.Missing, []string{removed}) || !reflect.DeepEqual(a.Extra, []string{"joker"}) || !reflect.DeepEqual(a.WrongCount, wantWrong) {
+		t.Errorf("after removing %s and adding ah and a joker: %+v", removed, a)
+	}
+
+	resp, err := http.Get(base + "/audit?reference=tarot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "standard52, standard54") {
+		t.Errorf("unknown reference: %d %s", resp.StatusCode, body)
+	}
+}
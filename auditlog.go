@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Draws made through POST /deck/{id}/draw/{n}/atomic-log are sent to the
+// external audit log at AUDIT_LOG_URL as a JWT signed with AUDIT_LOG_SECRET
+// (HS256).
+var (
+	auditLogURL    = os.Getenv("AUDIT_LOG_URL")
+	auditLogSecret = os.Getenv("AUDIT_LOG_SECRET")
+)
+
+// auditLogTimeout bounds one POST to the audit log.
+const auditLogTimeout = time.Second
+
+var errAuditLogDisabled = errors.New("Audit log not configured")
+
+// AuditLogClaims represents the payload of the JWT sent to the audit log.
+type AuditLogClaims struct {
+	DeckID     string   `json:"deck_id"`
+	DrawnCards []string `json:"drawn_cards"`
+	Remaining  int      `json:"remaining"`
+	Timestamp  string   `json:"timestamp"`
+	IssuedAt   int64    `json:"iat"`
+}
+
+// signJWT returns claims as a compact JWT signed with HMAC-SHA256.
+func signJWT(claims any, secret string) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encode(mac.Sum(nil)), nil
+}
+
+// sendAuditLog posts a signed token to the audit log. It is run on its own
+// goroutine once the draw is committed: a failure is only logged, and never
+// reaches the client.
+func sendAuditLog(url, token string) {
+	client := &http.Client{Timeout: auditLogTimeout}
+	resp, err := client.Post(url, "application/jwt", strings.NewReader(token))
+	if err != nil {
+		log.Printf("audit log: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("audit log: %s answered %d", url, resp.StatusCode)
+	}
+}
+
+// drawWithAuditLog serves POST /deck/{id}/draw/{n}/atomic-log: a draw, as
+// GET /deck/{id}/draw/{n} with the same parameters, whose result is then
+// sent to the audit log. The client gets its cards whether or not the audit
+// log takes them. Without AUDIT_LOG_URL and AUDIT_LOG_SECRET nothing could
+// be logged, so nothing is drawn.
+func drawWithAuditLog(w http.ResponseWriter, r *http.Request, deckID, countStr string) {
+	params, err := parseDrawParams(countStr, r.URL.Query())
+	if err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+	url, secret := auditLogURL, auditLogSecret
+	if url == "" || secret == "" {
+		http.Error(w, errAuditLogDisabled.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := submit(Request{
+		Type:            "draw",
+		DeckID:          deckID,
+		Draw:            params,
+		ReplyCh:         make(chan Response),
+		UnmodifiedSince: unmodifiedSince(r),
+	})
+	if resp.Error == nil {
+		now := clock.Now().UTC()
+		claims := AuditLogClaims{DeckID: deckID, DrawnCards: make([]string, len(resp.Deck.Cards)), Remaining: resp.Deck.Remaining, Timestamp: now.Format(time.RFC3339Nano), IssuedAt: now.Unix()}
+		for i, card := range resp.Deck.Cards {
+			claims.DrawnCards[i] = card.Code
+		}
+		if token, err := signJWT(claims, secret); err != nil {
+			log.Printf("audit log: signing draw of deck %s: %v", deckID, err)
+		} else {
+			go sendAuditLog(url, token)
+		}
+	}
+	handleDrawResponse(w, r, deckID, resp, params)
+}
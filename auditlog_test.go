@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupAuditLog(t *testing.T, url string) {
+	t.Helper()
+	savedURL, savedSecret := auditLogURL, auditLogSecret
+	auditLogURL, auditLogSecret = url, "s3cret"
+	t.Cleanup(func() { auditLogURL, auditLogSecret = savedURL, savedSecret })
+}
+
+// verifyJWT checks the HS256 signature of token and decodes its claims.
+func verifyJWT(t *testing.T, token, secret string) AuditLogClaims {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q is not a JWT", token)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+		t.Fatal("bad signature")
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims AuditLogClaims
+	json.Unmarshal(payload, &claims)
+	return claims
+}
+
+func TestDrawWithAuditLog(t *testing.T) {
+	tokens := make(chan string, 1)
+	auditLog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		tokens <- string(body)
+	}))
+	defer auditLog.Close()
+	setupAuditLog(t, auditLog.URL)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	drawn := fetchDeck(t, http.MethodPost, server.URL+"/deck/"+deckID+"/draw/3/atomic-log")
+	select {
+	case token := <-tokens:
+		claims := verifyJWT(t, token, "s3cret")
+		if claims.DeckID != deckID || claims.Remaining != 49 || strings.Join(claims.DrawnCards, ",") != strings.Join(cardCodes(drawn.Cards), ",") || claims.Timestamp == "" {
+			t.Errorf("claims = %+v, drew %v", claims, cardCodes(drawn.Cards))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing reached the audit log")
+	}
+}
+
+func TestDrawWithAuditLogFailing(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	setupAuditLog(t, slow.URL)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	start := time.Now()
+	if drawn := fetchDeck(t, http.MethodPost, server.URL+"/deck/"+deckID+"/draw/2/atomic-log"); drawn.Remaining != 50 {
+		t.Errorf("draw with a hanging audit log: %+v", drawn)
+	}
+	if elapsed := time.Since(start); elapsed >= auditLogTimeout {
+		t.Errorf("the draw waited %v for the audit log", elapsed)
+	}
+
+	setupAuditLog(t, "http://127.0.0.1:1")
+	if drawn := fetchDeck(t, http.MethodPost, server.URL+"/deck/"+deckID+"/draw/2/atomic-log"); drawn.Remaining != 48 {
+		t.Errorf("draw with an unreachable audit log: %+v", drawn)
+	}
+
+	setupAuditLog(t, "")
+	resp, err := http.Post(server.URL+"/deck/"+deckID+"/draw/2/atomic-log", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("draw without an audit log returned %d", resp.StatusCode)
+	}
+	if _, info := deckStatus(t, server.URL+"/deck/"+deckID); info.Remaining != 48 {
+		t.Errorf("%d cards left after a refused draw, want 48", info.Remaining)
+	}
+}
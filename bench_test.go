@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"TPReseau/deck"
+)
+
+func newBenchServer(b *testing.B) *httptest.Server {
+	return newTestServer(b)
+}
+
+// benchGet is safe to call from several goroutines, so it reports errors
+// without stopping the benchmark.
+func benchGet(b *testing.B, url string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func BenchmarkCreateDeck(b *testing.B) {
+	server := newBenchServer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		benchGet(b, server.URL+"/deck/new/1")
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
+
+func BenchmarkDrawCards(b *testing.B) {
+	server := newBenchServer(b)
+	deckID := newTestDeck(b, server, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		benchGet(b, fmt.Sprintf("%s/deck/%s/draw/1", server.URL, deckID))
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
+
+func BenchmarkShuffleDeck(b *testing.B) {
+	server := newBenchServer(b)
+	deckID := newTestDeck(b, server, 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		benchGet(b, fmt.Sprintf("%s/deck/%s/shuffle", server.URL, deckID))
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
+
+// BenchmarkConcurrentDraws measures draw throughput when 8 goroutines
+// contend for the same deck.
+func BenchmarkConcurrentDraws(b *testing.B) {
+	const workers = 8
+
+	server := newBenchServer(b)
+	deckID := newTestDeck(b, server, 10)
+	url := fmt.Sprintf("%s/deck/%s/draw/1", server.URL, deckID)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < b.N; i += workers {
+				benchGet(b, url)
+			}
+		}(w)
+	}
+	wg.Wait()
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
+
+// benchDeckState stores a deck of packs packs and returns its ID with the
+// state it holds after drawing drawn cards, for the store benchmarks to go
+// back to before each run.
+func benchDeckState(b *testing.B, packs, drawn int) (string, deck.State) {
+	b.Helper()
+	mu.Lock()
+	defer mu.Unlock()
+	deckID, err := insertDeck(db, generateCards(packs, 0, CardOrder{}), "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	state, err := sqlStore{db}.Load(deckID)
+	if err == nil && drawn > 0 {
+		_, err = deck.DrawN(&state, drawn, clock.Now())
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	return deckID, state
+}
+
+// resetDeckState writes state back to a deck outside the timed part of a
+// benchmark.
+func resetDeckState(b *testing.B, deckID string, state deck.State) {
+	b.StopTimer()
+	defer b.StartTimer()
+	mu.Lock()
+	defer mu.Unlock()
+	total := len(state.Upcoming) + len(state.Drawn)
+	if _, err := db.Exec("UPDATE decks SET card_total = ? WHERE id = ?", total, deckID); err != nil {
+		b.Fatal(err)
+	}
+	if err := (sqlStore{db}).Save(deckID, state); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// The two benchmarks below track the storage of upcoming cards as codes and
+// the history appended to the stored JSON. Against storing full objects and
+// re-encoding the history they went, per op, from 307 kB and 228 allocs to
+// 112 kB and 140 allocs for the draw, and from 224 kB and 215 allocs to
+// 100 kB and 127 allocs for the add: 2 to 3x fewer bytes, not the 5x first
+// asked for. Loading still decodes every upcoming card into a []Card, and
+// each SQL round trip costs some 25 allocations in database/sql and the
+// driver; going further needs the cards in rows of their own.
+
+// BenchmarkDrawOneFrom520 measures the store side of drawing one card from
+// 520 upcoming cards with 104 already drawn: loading the deck, drawing and
+// saving it the way the draw endpoints do, by appending the new entry to the
+// stored history.
+func BenchmarkDrawOneFrom520(b *testing.B) {
+	newBenchServer(b)
+	deckID, start := benchDeckState(b, 12, 104)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		resetDeckState(b, deckID, start)
+		mu.Lock()
+		state, err := sqlStore{db}.Load(deckID)
+		stored := len(state.Drawn)
+		if err == nil {
+			_, err = deck.DrawN(&state, 1, clock.Now())
+		}
+		if err == nil {
+			err = appendDeckState(db, deckID, state.Upcoming, state.Drawn, stored)
+		}
+		mu.Unlock()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAddTwoTo520 measures the store side of adding two cards to 520
+// upcoming cards.
+func BenchmarkAddTwoTo520(b *testing.B) {
+	newBenchServer(b)
+	deckID, start := benchDeckState(b, 10, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		resetDeckState(b, deckID, start)
+		mu.Lock()
+		state, err := sqlStore{db}.Load(deckID)
+		if err == nil {
+			deck.AddCards(&state, []Card{cardFromCode("ah"), cardFromCode("ks")})
+			err = adjustCardTotal(db, deckID, 2)
+		}
+		if err == nil {
+			err = sqlStore{db}.Save(deckID, state)
+		}
+		mu.Unlock()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// routeTable is a ServeMux that remembers the patterns registered on it, so
+// that /capabilities describes the routes actually served.
+type routeTable struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{ServeMux: http.NewServeMux()}
+}
+
+func (t *routeTable) Handle(pattern string, h http.Handler) {
+	t.patterns = append(t.patterns, pattern)
+	t.ServeMux.Handle(pattern, h)
+}
+
+func (t *routeTable) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request)) {
+	t.Handle(pattern, http.HandlerFunc(h))
+}
+
+// deprecatedRoutes maps legacy route patterns to the date they will be
+// removed. A route listed here that is no longer served is not reported.
+var deprecatedRoutes = map[string]string{}
+
+// Deprecation represents a legacy route and its removal date.
+type Deprecation struct {
+	Route     string `json:"route"`
+	RemovedOn string `json:"removed_on"`
+}
+
+// Capabilities represents what this server supports with its current
+// configuration.
+type Capabilities struct {
+	APIVersions  []string        `json:"api_versions"`
+	Routes       []string        `json:"routes"`
+	Features     map[string]bool `json:"features"`
+	ImageFormats []string        `json:"image_formats"`
+	Limits       map[string]int  `json:"limits"`
+	Deprecations []Deprecation   `json:"deprecations"`
+}
+
+var versionPrefix = regexp.MustCompile(`^/(v[0-9]+)/`)
+
+// capabilities builds the capabilities document from the live configuration
+// and the routes registered on t.
+func (t *routeTable) capabilities() Capabilities {
+	caps := Capabilities{
+		APIVersions: []string{},
+		Routes:      append([]string(nil), t.patterns...),
+		Features: map[string]bool{
+			"admin_auth":          adminToken != "",
+			"dashboard_actions":   adminToken != "" && dashboardActions,
+			"test_cheats":         testCheats,
+			"test_mode":           testMode,
+			"fault_injection":     faultInjection,
+			"strict_conservation": strictConservation,
+			"empty_deck_purge":    purgeEmptyEvery > 0,
+			"debug_logging":       debugLogging,
+			"trust_proxy_headers": trustProxyHeaders,
+		},
+		ImageFormats: []string{"svg"},
+		Limits: map[string]int{
+			"max_packs":             maxPacks,
+			"max_draw_count":        maxDrawCount,
+			"max_players":           maxPlayers,
+			"max_jokers":            maxJokers,
+			"max_multi_draw_decks":  maxMultiDrawDecks,
+			"max_pool_size":         maxPoolSize,
+			"response_budget_bytes": responseBudget,
+		},
+		Deprecations: []Deprecation{},
+	}
+	sort.Strings(caps.Routes)
+
+	versions := make(map[string]bool)
+	for _, pattern := range caps.Routes {
+		if m := versionPrefix.FindStringSubmatch(pattern); m != nil && !versions[m[1]] {
+			versions[m[1]] = true
+			caps.APIVersions = append(caps.APIVersions, m[1])
+		}
+		if removedOn, ok := deprecatedRoutes[pattern]; ok {
+			caps.Deprecations = append(caps.Deprecations, Deprecation{Route: pattern, RemovedOn: removedOn})
+		}
+	}
+	return caps
+}
+
+func (t *routeTable) showCapabilities(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, t.capabilities())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func fetchCapabilities(t *testing.T, server *httptest.Server) Capabilities {
+	t.Helper()
+	resp, err := http.Get(server.URL + "/capabilities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var caps Capabilities
+	if err := json.NewDecoder(resp.Body).Decode(&caps); err != nil {
+		t.Fatal(err)
+	}
+	return caps
+}
+
+func TestCapabilitiesListServedRoutes(t *testing.T) {
+	caps := fetchCapabilities(t, newTestServer(t))
+
+	served := make(map[string]bool)
+	for _, route := range caps.Routes {
+		served[route] = true
+	}
+	for _, route := range []string{"/deck/", "/capabilities", "/admin/decks/purge-empty"} {
+		if !served[route] {
+			t.Errorf("route %s missing from %v", route, caps.Routes)
+		}
+	}
+	if caps.Limits["max_packs"] != maxPacks {
+		t.Errorf("max_packs is %d, want %d", caps.Limits["max_packs"], maxPacks)
+	}
+}
+
+func TestCapabilitiesFollowFeatureFlags(t *testing.T) {
+	server := newTestServer(t)
+	defer func(enabled bool) { testCheats = enabled }(testCheats)
+
+	for _, enabled := range []bool{false, true} {
+		testCheats = enabled
+		if got := fetchCapabilities(t, server).Features["test_cheats"]; got != enabled {
+			t.Errorf("test_cheats is %v with ENABLE_TEST_CHEATS=%v", got, enabled)
+		}
+	}
+}
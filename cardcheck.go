@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// CardListCheck represents the outcome of checking a card list against the
+// cards a deck was made of. UnknownCodes are not cards at all; Invalid also
+// holds the cards that this deck does not contain.
+type CardListCheck struct {
+	Valid        bool     `json:"valid"`
+	Invalid      []string `json:"invalid"`
+	ValidCodes   []string `json:"valid_codes"`
+	UnknownCodes []string `json:"unknown_codes"`
+}
+
+// validateCardList serves POST /deck/{id}/cards/validate with a body such as
+// {"cards": ["ah", "kd"]}. Each entry is resolved like the cards of an add,
+// aliases included, and is valid when the deck was created with that card.
+// An invalid list is still a 200: the result describes it.
+func validateCardList(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	var body struct {
+		Cards []string `json:"cards"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		v.Add("body", "invalid_json", `body must be a JSON object such as {"cards": ["ah", "kd"]}`)
+	} else {
+		v.Check(len(body.Cards) <= maxDrawCount, "cards", "too_many_cards", "at most %d cards can be checked at once", maxDrawCount)
+	}
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	var cardsJSON string
+	if err := readDB.QueryRow("SELECT cards FROM decks WHERE id = ?", deckID).Scan(&cardsJSON); err != nil {
+		writeError(w, errDeckNotFound)
+		return
+	}
+	var deckCards []Card
+	json.Unmarshal([]byte(cardsJSON), &deckCards)
+	inDeck := make(map[string]bool, len(deckCards))
+	for _, card := range deckCards {
+		inDeck[card.Code] = true
+	}
+
+	check := CardListCheck{Invalid: []string{}, ValidCodes: []string{}, UnknownCodes: []string{}}
+	for _, token := range body.Cards {
+		code, err := resolveCardCode(token)
+		switch {
+		case err != nil:
+			check.Invalid = append(check.Invalid, token)
+			check.UnknownCodes = append(check.UnknownCodes, token)
+		case !inDeck[code]:
+			check.Invalid = append(check.Invalid, code)
+		default:
+			check.ValidCodes = append(check.ValidCodes, code)
+		}
+	}
+	check.Valid = len(check.Invalid) == 0
+
+	writeJSON(w, check)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateCardList(t *testing.T) {
+	server := newTestServer(t)
+	base := server.URL + "/deck/" + newTestDeck(t, server, 1)
+	// Drawn cards still belong to the deck.
+	fetchDeck(t, http.MethodGet, base+"/draw/52")
+
+	post := func(url, body string) (int, CardListCheck) {
+		t.Helper()
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var check CardListCheck
+		json.NewDecoder(resp.Body).Decode(&check)
+		return resp.StatusCode, check
+	}
+
+	status, check := post(base+"/cards/validate", `{"cards": ["ah", "kd", "xx", "joker", "ace_of_spades"]}`)
+	want := CardListCheck{
+		Valid:        false,
+		Invalid:      []string{"xx", "joker"},
+		ValidCodes:   []string{"ah", "kd", "as"},
+		UnknownCodes: []string{"xx"},
+	}
+	if status != http.StatusOK || !reflect.DeepEqual(check, want) {
+		t.Errorf("got %d %+v, want %+v", status, check, want)
+	}
+
+	status, check = post(base+"/cards/validate", `{"cards": ["ah"]}`)
+	if status != http.StatusOK || !check.Valid {
+		t.Errorf("valid list: got %d %+v", status, check)
+	}
+	if status, _ := post(base+"/cards/validate", `["ah"]`); status != http.StatusBadRequest {
+		t.Errorf("array body returned %d", status)
+	}
+	if status, _ := post(server.URL+"/deck/missing/cards/validate", `{"cards": []}`); status != http.StatusNotFound {
+		t.Errorf("missing deck returned %d", status)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// Decks listed per page by GET /decks/with.
+const (
+	defaultWithPage = 100
+	maxWithPage     = 1000
+)
+
+// DecksWithCard represents one page of GET /decks/with.
+type DecksWithCard struct {
+	Code       string   `json:"code"`
+	Decks      []string `json:"decks"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// The codes in the upcoming cards of each deck are indexed in deck_cards by
+// triggers on the decks table, as the change feed is, so that no write can
+// leave the index behind. A deck holding several copies of a card is indexed
+// once for it.
+func createCardIndex() {
+	// A deck whose upcoming column is not valid JSON is indexed as empty
+	// rather than failing the write.
+	const codes = `SELECT DISTINCT ` + storedCodeSQL + `, NEW.id FROM json_each(CASE WHEN json_valid(NEW.upcoming) THEN NEW.upcoming ELSE '[]' END)`
+	stmts := []string{
+		// The triggers are created anew in case an older version created
+		// them for an upcoming column of objects only.
+		`DROP TRIGGER IF EXISTS decks_cards_insert`,
+		`DROP TRIGGER IF EXISTS decks_cards_update`,
+		`CREATE TABLE IF NOT EXISTS deck_cards (
+			code TEXT NOT NULL,
+			deck_id TEXT NOT NULL,
+			PRIMARY KEY (code, deck_id)
+		) WITHOUT ROWID`,
+		`CREATE INDEX IF NOT EXISTS deck_cards_deck_id ON deck_cards (deck_id)`,
+		`CREATE TRIGGER IF NOT EXISTS decks_cards_insert AFTER INSERT ON decks BEGIN
+			INSERT OR IGNORE INTO deck_cards (code, deck_id) ` + codes + `;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS decks_cards_update AFTER UPDATE OF upcoming ON decks BEGIN
+			DELETE FROM deck_cards WHERE deck_id = NEW.id;
+			INSERT OR IGNORE INTO deck_cards (code, deck_id) ` + codes + `;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS decks_cards_delete AFTER DELETE ON decks BEGIN
+			DELETE FROM deck_cards WHERE deck_id = OLD.id;
+		END`,
+		// Decks created before the index existed are indexed once.
+		`INSERT OR IGNORE INTO deck_cards (code, deck_id)
+			SELECT DISTINCT ` + storedCodeSQL + `, decks.id
+			FROM decks, json_each(CASE WHEN json_valid(decks.upcoming) THEN decks.upcoming ELSE '[]' END)
+			WHERE decks.id NOT IN (SELECT deck_id FROM deck_cards)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("Error creating card index: %v", err)
+		}
+	}
+}
+
+// listDecksWithCard serves GET /decks/with?code=ah, the IDs of the decks
+// whose upcoming cards hold that card, in ID order. ?cursor=next_cursor
+// gives the next page.
+func listDecksWithCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	v := &Validator{}
+	query := r.URL.Query()
+	code := query.Get("code")
+	if code == "" {
+		v.Add("code", "missing", "code is required")
+	} else if resolved, err := resolveCardCode(code); err != nil {
+		v.Add("code", "unknown_card", "%s", err.Error())
+	} else {
+		code = resolved
+	}
+	limit := v.OptionalInt("limit", query.Get("limit"), defaultWithPage, 1, maxWithPage)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	// One extra row tells whether there is a next page.
+	rows, err := readDB.Query("SELECT deck_id FROM deck_cards WHERE code = ? AND deck_id > ? ORDER BY deck_id LIMIT ?", code, query.Get("cursor"), limit+1)
+	if err != nil {
+		http.Error(w, "Error reading decks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	page := DecksWithCard{Code: code, Decks: []string{}}
+	for rows.Next() {
+		var deckID string
+		if err := rows.Scan(&deckID); err != nil {
+			http.Error(w, "Error reading decks", http.StatusInternalServerError)
+			return
+		}
+		page.Decks = append(page.Decks, deckID)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error reading decks", http.StatusInternalServerError)
+		return
+	}
+	if len(page.Decks) > limit {
+		page.Decks = page.Decks[:limit]
+		page.NextCursor = page.Decks[limit-1]
+	}
+
+	writeJSON(w, page)
+}
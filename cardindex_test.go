@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+func decksWithCard(t *testing.T, url string) DecksWithCard {
+	t.Helper()
+	resp := adminRequest(t, http.MethodGet, url, "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s returned %d", url, resp.StatusCode)
+	}
+	var page DecksWithCard
+	json.NewDecoder(resp.Body).Decode(&page)
+	return page
+}
+
+func TestDecksWithCard(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	first, second, emptied := newTestDeck(t, server, 1), newTestDeck(t, server, 1), newTestDeck(t, server, 1)
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+emptied+"/draw/52")
+	want := []string{first, second}
+	sort.Strings(want)
+
+	page := decksWithCard(t, server.URL+"/decks/with?code=AH")
+	if page.Code != "ah" || len(page.Decks) != 2 || page.Decks[0] != want[0] || page.Decks[1] != want[1] || page.NextCursor != "" {
+		t.Fatalf("decks with ah = %+v, want %v", page, want)
+	}
+
+	page = decksWithCard(t, server.URL+"/decks/with?code=ah&limit=1")
+	if len(page.Decks) != 1 || page.Decks[0] != want[0] || page.NextCursor == "" {
+		t.Fatalf("first page = %+v", page)
+	}
+	page = decksWithCard(t, server.URL+"/decks/with?code=ah&limit=1&cursor="+page.NextCursor)
+	if len(page.Decks) != 1 || page.Decks[0] != want[1] || page.NextCursor != "" {
+		t.Fatalf("second page = %+v", page)
+	}
+
+	// The index follows removed cards and deleted decks, and is rebuilt for
+	// decks it misses.
+	resp := adminRequest(t, http.MethodDelete, server.URL+"/deck/"+first+"/cards/ah/upcoming", "")
+	resp.Body.Close()
+	if page := decksWithCard(t, server.URL+"/decks/with?code=ah"); len(page.Decks) != 1 || page.Decks[0] != second {
+		t.Errorf("decks with ah after removing it = %v, want [%s]", page.Decks, second)
+	}
+	if _, err := db.Exec("DELETE FROM decks WHERE id = ?", first); err != nil {
+		t.Fatal(err)
+	}
+	if page := decksWithCard(t, server.URL+"/decks/with?code=kh"); len(page.Decks) != 1 || page.Decks[0] != second {
+		t.Errorf("decks with kh after a delete = %v, want [%s]", page.Decks, second)
+	}
+	if _, err := db.Exec("DELETE FROM deck_cards WHERE deck_id = ?", second); err != nil {
+		t.Fatal(err)
+	}
+	createCardIndex()
+	if page := decksWithCard(t, server.URL+"/decks/with?code=ah"); len(page.Decks) != 1 || page.Decks[0] != second {
+		t.Errorf("decks with ah after a delete = %v, want [%s]", page.Decks, second)
+	}
+
+	for _, url := range []string{"/decks/with", "/decks/with?code=zz", "/decks/with?code=ah&limit=0"} {
+		resp := adminRequest(t, http.MethodGet, server.URL+url, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", url, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// Test cheats stack decks for deterministic integration tests. They are off
+// unless ENABLE_TEST_CHEATS=true; while they are off the endpoint does not
+// exist.
+var testCheats = os.Getenv("ENABLE_TEST_CHEATS") == "true"
+
+// CheatRequest represents the body of POST /deck/{id}/inject-cheat.
+type CheatRequest struct {
+	Code string `json:"code"`
+}
+
+// injectCheat moves the first upcoming copy of a card to the top of a deck.
+// No card is added or removed, so the deck still holds the cards it was
+// created with, and unlike a reorder the move leaves no trace beyond the
+// deck contents. A card with no upcoming copy is refused with 409.
+func injectCheat(w http.ResponseWriter, r *http.Request, deckID string) {
+	if !testCheats {
+		http.NotFound(w, r)
+		return
+	}
+
+	v := &Validator{}
+	var body CheatRequest
+	v.Check(json.NewDecoder(r.Body).Decode(&body) == nil, "body", "invalid_json", "request body must be a JSON object")
+	code, err := resolveCardCode(body.Code)
+	if err != nil {
+		v.Add("code", "unknown_card", "%s", err.Error())
+	}
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	at := slices.IndexFunc(upcomingCards, func(card Card) bool { return card.Code == code })
+	if at < 0 {
+		v.Add("code", "not_upcoming", "%s is not among the upcoming cards", code)
+		writeFieldErrors(w, http.StatusConflict, v.Err())
+		return
+	}
+	cheat := upcomingCards[at]
+	moved := make([]Card, 0, len(upcomingCards))
+	moved = append(append(append(moved, cheat), upcomingCards[:at]...), upcomingCards[at+1:]...)
+
+	if err := writeDeckState(db, deckID, moved, drawnHistory); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, Deck{
+		ID:        deckID,
+		Cards:     []Card{cheat},
+		Remaining: len(moved),
+	})
+}
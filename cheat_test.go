@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestInjectCheatMovesTheCard(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	if status := getStatusWithBody(t, http.MethodPost, base+"/inject-cheat", `{"code":"ks"}`); status != http.StatusNotFound {
+		t.Errorf("cheat while cheats are off: status %d, want 404", status)
+	}
+	testCheats = true
+	t.Cleanup(func() { testCheats = false })
+
+	if status := getStatusWithBody(t, http.MethodPost, base+"/inject-cheat", `{"code":"ks"}`); status != http.StatusOK {
+		t.Fatalf("cheat: status %d", status)
+	}
+	upcoming, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies := 0
+	for _, card := range upcoming {
+		if card.Code == "ks" {
+			copies++
+		}
+	}
+	if len(upcoming) != 52 || upcoming[0].Code != "ks" || copies != 1 {
+		t.Fatalf("after the cheat the deck has %d cards, %d of ks, top %s", len(upcoming), copies, upcoming[0].Code)
+	}
+
+	// A card that was drawn cannot be moved to the top.
+	fetchDeck(t, http.MethodGet, base+"/draw/1")
+	if status := getStatusWithBody(t, http.MethodPost, base+"/inject-cheat", `{"code":"ks"}`); status != http.StatusConflict {
+		t.Errorf("cheat with a drawn card: status %d, want 409", status)
+	}
+	if info := fetchDeckInfo(t, base); info.Remaining+info.Drawn != 52 {
+		t.Errorf("deck holds %d upcoming and %d drawn cards, want 52 in all", info.Remaining, info.Drawn)
+	}
+}
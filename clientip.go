@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// trustProxyHeaders makes clientIP believe X-Forwarded-For, for a server
+// behind a reverse proxy. It is off by default: without a proxy that
+// overwrites the header, any client can put any address in it.
+var trustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
+// clientIP returns the address of the client of r. With trustProxyHeaders it
+// is the leftmost public address of X-Forwarded-For, the first one the
+// proxies saw; otherwise, or when the header has none, the peer address.
+func clientIP(r *http.Request) string {
+	if trustProxyHeaders {
+		for _, hop := range strings.Split(r.Header.Get("X-Forwarded-For"), ",") {
+			ip := net.ParseIP(strings.TrimSpace(hop))
+			if ip != nil && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified() {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	saved := trustProxyHeaders
+	t.Cleanup(func() { trustProxyHeaders = saved })
+
+	tests := []struct {
+		trust     bool
+		forwarded string
+		want      string
+	}{
+		{false, "", "192.0.2.1"},
+		{false, "203.0.113.7", "192.0.2.1"},
+		{true, "", "192.0.2.1"},
+		{true, "203.0.113.7", "203.0.113.7"},
+		{true, "10.0.0.3, 203.0.113.7, 198.51.100.2", "203.0.113.7"},
+		{true, "127.0.0.1,fe80::1, 2001:db8::5", "2001:db8::5"},
+		{true, "unknown, 192.168.1.4", "192.0.2.1"},
+	}
+	for _, test := range tests {
+		trustProxyHeaders = test.trust
+		r := httptest.NewRequest("GET", "/decks", nil)
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := clientIP(r); got != test.want {
+			t.Errorf("trust %v, X-Forwarded-For %q: clientIP = %s, want %s", test.trust, test.forwarded, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// Every write of a deck checks that it still holds card_total cards, upcoming,
+// drawn and on piles together. Only operations that really add or remove cards (add,
+// clear-drawn, refills between decks) change card_total, so anything else that
+// changes the count is a bug. With STRICT_CONSERVATION=true the write is
+// refused instead of only being reported.
+var strictConservation = os.Getenv("STRICT_CONSERVATION") == "true"
+
+var errConservation = errors.New("Card conservation violated")
+
+// conservationViolations counts the writes that broke the invariant.
+var conservationViolations int64
+
+// adjustCardTotal records that delta cards were added to (or, if negative,
+// removed from) a deck. The caller must hold mu.
+func adjustCardTotal(exec execer, deckID string, delta int) error {
+	if _, err := exec.Exec("UPDATE decks SET card_total = card_total + ? WHERE id = ?", delta, deckID); err != nil {
+		return fmt.Errorf("Error updating deck")
+	}
+	return nil
+}
+
+// checkConservation compares the number of cards a deck is about to be written
+// with, plus the cards on its piles, against its card_total. Piles must be
+// written before the deck. The caller must hold mu.
+func checkConservation(exec execer, deckID string, upcoming, drawn int) error {
+	var expected sql.NullInt64
+	var stored, piled int
+	row := exec.QueryRow(`SELECT card_total, json_array_length(upcoming) + json_array_length(piged),
+		(SELECT COALESCE(SUM(json_array_length(cards)), 0) FROM piles WHERE deck_id = decks.id)
+		FROM decks WHERE id = ?`, deckID)
+	if err := row.Scan(&expected, &stored, &piled); err != nil || !expected.Valid {
+		return nil
+	}
+
+	after := upcoming + drawn + piled
+	if int64(after) == expected.Int64 {
+		return nil
+	}
+
+	atomic.AddInt64(&conservationViolations, 1)
+	log.Printf("ERROR deck %s should hold %d cards: %d before, %d after (%d upcoming, %d drawn, %d on piles)", deckID, expected.Int64, stored+piled, after, upcoming, drawn, piled)
+	if strictConservation {
+		return errConservation
+	}
+	return nil
+}
+
+// showMetrics exposes the invariant, fault injection and sweeper counters in the Prometheus text format.
+func showMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP deck_conservation_violations_total Deck writes whose card count did not match the cards added and removed.")
+	fmt.Fprintln(w, "# TYPE deck_conservation_violations_total counter")
+	fmt.Fprintf(w, "deck_conservation_violations_total %d\n", atomic.LoadInt64(&conservationViolations))
+	writeFaultMetrics(w)
+	writeSweeperMetrics(w)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// injectExtraCard simulates the "my deck has 53 cards now" bug by slipping a
+// card into the upcoming cards behind the server's back.
+func injectExtraCard(t *testing.T, deckID string) {
+	t.Helper()
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := db.Exec(`UPDATE decks SET upcoming = json_insert(upcoming, '$[#]', json('{"code":"as","rank":"a","suit":"s"}')) WHERE id = ?`, deckID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getStatus(t *testing.T, method, url string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestConservationHoldsForNormalOperations(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	sourceID := newTestDeck(t, server, 1)
+	before := atomic.LoadInt64(&conservationViolations)
+
+	for _, step := range []struct{ method, path string }{
+		{"GET", "/deck/" + deckID + "/draw/5"},
+		{"GET", "/deck/" + deckID + "/shuffle"},
+		{"POST", "/deck/" + deckID + "/add?cards=ah,kd"},
+		{"GET", "/deck/" + deckID + "/draw/distinct/3"},
+		{"POST", "/deck/" + deckID + "/shuffle-deal/2/3"},
+		{"POST", "/deck/" + deckID + "/play/4/to/table"},
+		{"POST", "/deck/" + deckID + "/clear-drawn"},
+		{"POST", "/deck/" + deckID + "/refill-from?refill_from=" + sourceID},
+		{"GET", "/deck/" + deckID + "/draw/50"},
+	} {
+		if status := getStatus(t, step.method, server.URL+step.path); status != http.StatusOK {
+			t.Fatalf("%s %s returned %d", step.method, step.path, status)
+		}
+	}
+
+	if after := atomic.LoadInt64(&conservationViolations); after != before {
+		t.Fatalf("%d violations reported for valid operations", after-before)
+	}
+}
+
+func TestConservationViolationIsDetected(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	injectExtraCard(t, deckID)
+	before := atomic.LoadInt64(&conservationViolations)
+
+	if status := getStatus(t, "GET", server.URL+"/deck/"+deckID+"/draw/1"); status != http.StatusOK {
+		t.Fatalf("draw returned %d", status)
+	}
+	if after := atomic.LoadInt64(&conservationViolations); after != before+1 {
+		t.Fatalf("got %d new violations, want 1", after-before)
+	}
+}
+
+func TestStrictConservationRefusesWrite(t *testing.T) {
+	strictConservation = true
+	defer func() { strictConservation = false }()
+
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	injectExtraCard(t, deckID)
+
+	if status := getStatus(t, "GET", server.URL+"/deck/"+deckID+"/draw/1"); status != http.StatusInternalServerError {
+		t.Fatalf("draw returned %d, want 500", status)
+	}
+
+	mu.Lock()
+	upcomingCards, drawnHistory, err := readDeckState(deckID)
+	mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(upcomingCards) != 53 || len(drawnHistory) != 0 {
+		t.Fatalf("deck was written: %d upcoming, %d drawn", len(upcomingCards), len(drawnHistory))
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(templateFS, "templates/dashboard.html"))
+
+// DeckSummary represents one deck row on the operator dashboard.
+type DeckSummary struct {
+	ID           string
+	Remaining    int
+	LastActivity string
+}
+
+// dashboardData is the data rendered by the dashboard template.
+type dashboardData struct {
+	CSRFToken      string
+	ActionsEnabled bool
+	Message        string
+	Decks          []DeckSummary
+	Endpoints      []EndpointStat
+	QueueDepth     int64
+}
+
+// The dashboard is disabled unless ADMIN_TOKEN is set, and its purge/vacuum
+// buttons stay disabled unless DASHBOARD_ACTIONS=true.
+var (
+	adminToken       = os.Getenv("ADMIN_TOKEN")
+	dashboardActions = os.Getenv("DASHBOARD_ACTIONS") == "true"
+)
+
+func registerDashboard(mux *routeTable) {
+	mux.HandleFunc("/dashboard", instrument("dashboard", requireAdmin(showDashboard)))
+	mux.HandleFunc("/dashboard/login", instrument("dashboard.login", dashboardLogin))
+	mux.HandleFunc("/dashboard/purge", instrument("dashboard.purge", requireAdmin(dashboardPurge)))
+	mux.HandleFunc("/dashboard/vacuum", instrument("dashboard.vacuum", requireAdmin(dashboardVacuum)))
+}
+
+// adminCookie holds the dashboard session of a browser that logged in with
+// the admin token. Its value is derived from the token rather than the token
+// itself.
+const adminCookie = "admin_session"
+
+// adminDigest returns the hex HMAC of purpose under the admin token, used
+// for the session cookie and the CSRF token of the dashboard forms.
+func adminDigest(purpose string) string {
+	mac := hmac.New(sha256.New, []byte(adminToken))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// equalSecret compares a secret from a request in constant time.
+func equalSecret(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// isAdmin reports whether the request carries the admin token, either as
+// "Authorization: Bearer <token>" or in the X-Admin-Token header, or the
+// dashboard session cookie. The token is never read from the URL or a form,
+// where it would end up in logs and browser history.
+func isAdmin(r *http.Request) bool {
+	if adminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.Header.Get("X-Admin-Token")
+	}
+	if token != "" {
+		return equalSecret(token, adminToken)
+	}
+	cookie, err := r.Cookie(adminCookie)
+	return err == nil && equalSecret(cookie.Value, adminDigest("session"))
+}
+
+// requireAdmin rejects requests that are not authenticated by isAdmin.
+func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// dashboardLogin serves POST /dashboard/login with the admin token in the
+// token form value. It sets the session cookie and redirects to the
+// dashboard; GET shows the login form.
+func dashboardLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.ExecuteTemplate(w, "login", nil); err != nil {
+			log.Printf("Error rendering dashboard login: %v", err)
+		}
+	case http.MethodPost:
+		if adminToken == "" || !equalSecret(r.PostFormValue("token"), adminToken) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     adminCookie,
+			Value:    adminDigest("session"),
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func showDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	decks, err := recentDecks(20)
+	if err != nil {
+		http.Error(w, "Error loading decks", http.StatusInternalServerError)
+		return
+	}
+
+	data := dashboardData{
+		CSRFToken:      adminDigest("csrf"),
+		ActionsEnabled: dashboardActions,
+		Message:        r.URL.Query().Get("msg"),
+		Decks:          decks,
+		Endpoints:      metrics.Snapshot(),
+		QueueDepth:     atomic.LoadInt64(&queueDepth),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering dashboard: %v", err)
+	}
+}
+
+func dashboardPurge(w http.ResponseWriter, r *http.Request) {
+	if !dashboardActionAllowed(w, r) {
+		return
+	}
+
+	result, err := purgeEmptyDecks()
+	if err != nil {
+		http.Error(w, "Error purging decks", http.StatusInternalServerError)
+		return
+	}
+	redirectToDashboard(w, r, "Purged "+strconv.FormatInt(result.Purged, 10)+" empty decks")
+}
+
+func dashboardVacuum(w http.ResponseWriter, r *http.Request) {
+	if !dashboardActionAllowed(w, r) {
+		return
+	}
+
+	if err := vacuumDatabase(); err != nil {
+		http.Error(w, "Error vacuuming database", http.StatusInternalServerError)
+		return
+	}
+	redirectToDashboard(w, r, "Database vacuumed")
+}
+
+func dashboardActionAllowed(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !dashboardActions {
+		http.Error(w, "Dashboard actions are disabled", http.StatusForbidden)
+		return false
+	}
+	if !equalSecret(r.PostFormValue("csrf_token"), adminDigest("csrf")) {
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// redirectToDashboard completes a POST-redirect-GET cycle.
+func redirectToDashboard(w http.ResponseWriter, r *http.Request, msg string) {
+	query := url.Values{}
+	query.Set("msg", msg)
+	http.Redirect(w, r, "/dashboard?"+query.Encode(), http.StatusSeeOther)
+}
+
+// recentDecks returns the most recently active decks.
+func recentDecks(limit int) ([]DeckSummary, error) {
+	rows, err := readDB.Query("SELECT id, COALESCE(json_array_length(upcoming), 0), COALESCE(updated_at, '') FROM decks ORDER BY updated_at DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decks []DeckSummary
+	for rows.Next() {
+		var deck DeckSummary
+		if err := rows.Scan(&deck.ID, &deck.Remaining, &deck.LastActivity); err != nil {
+			return nil, err
+		}
+		decks = append(decks, deck)
+	}
+	return decks, rows.Err()
+}
+
+// vacuumDatabase reclaims the space left by deleted decks.
+func vacuumDatabase() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, err := db.Exec("VACUUM")
+	return err
+}
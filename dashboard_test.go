@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDashboardSession(t *testing.T) {
+	setupAdminToken(t)
+	savedActions := dashboardActions
+	dashboardActions = true
+	t.Cleanup(func() { dashboardActions = savedActions })
+	server := newTestServer(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	if status := getStatus(t, http.MethodGet, server.URL+"/dashboard?token="+adminToken); status != http.StatusForbidden {
+		t.Errorf("token in the query returned %d, want 403", status)
+	}
+	resp, err := client.PostForm(server.URL+"/dashboard/login", url.Values{"token": {"wrong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("login with a wrong token returned %d, want 403", resp.StatusCode)
+	}
+
+	resp, err = client.PostForm(server.URL+"/dashboard/login", url.Values{"token": {adminToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	cookies := resp.Cookies()
+	if resp.StatusCode != http.StatusSeeOther || len(cookies) != 1 || cookies[0].Value == adminToken || !cookies[0].HttpOnly {
+		t.Fatalf("login returned %d with cookies %v", resp.StatusCode, cookies)
+	}
+	session := cookies[0]
+
+	do := func(method, path string, form url.Values) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(session)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := do(http.MethodGet, "/dashboard", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("dashboard with the session cookie returned %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/dashboard/vacuum", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("vacuum without a CSRF token returned %d, want 403", resp.StatusCode)
+	}
+	resp = do(http.MethodPost, "/dashboard/vacuum", url.Values{"csrf_token": {adminDigest("csrf")}})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("vacuum with the CSRF token returned %d", resp.StatusCode)
+	}
+	if location := resp.Header.Get("Location"); strings.Contains(location, "token") {
+		t.Errorf("redirect to %s carries the token", location)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"TPReseau/deck"
+)
+
+var (
+	errDeckNotFound   = errors.New("Deck not found")
+	errNotEnoughCards = deck.ErrNotEnoughCards
+	errDeckEmpty      = deck.ErrEmpty
+
+	errNotEnoughDistinctRanks = deck.ErrNotEnoughDistinctRanks
+)
+
+// Card and DrawnCard live in the deck package with the draw, shuffle and add
+// logic; the server only persists and serves them.
+type (
+	Card      = deck.Card
+	DrawnCard = deck.DrawnCard
+)
+
+// Deck represents a card deck. Shuffled always tells whether the deck was
+// shuffled since its creation, even in the reply to a shuffle that had too
+// few cards to do anything and set ShuffleSkipped. OffCommitment is set by a
+// draw that did not take the top cards in order: the hashes published for
+// the deck no longer describe it, and the cards drawn do not verify against
+// them.
+type Deck struct {
+	ID              string           `json:"deck_id"`
+	Cards           []Card           `json:"cards,omitempty"`
+	Remaining       int              `json:"remaining"`
+	RemainingCounts *RemainingCounts `json:"remaining_counts,omitempty"`
+	Shuffled        *bool            `json:"shuffled,omitempty"`
+	LocksAt         string           `json:"locks_at,omitempty"`
+	Hands           [][]Card         `json:"hands,omitempty"`
+	Order           string           `json:"order,omitempty"`
+	Reshuffled      bool             `json:"reshuffled,omitempty"`
+	ShuffleSkipped  bool             `json:"shuffle_skipped,omitempty"` // shuffle of fewer than two cards
+	OffCommitment   bool             `json:"off_commitment,omitempty"`
+}
+
+// Orders of the cards returned by a draw or a deal. With orderTopFirst the
+// first card drawn comes first, which for a plain draw is the top of the
+// deck; orderBottomFirst is the reverse. A deal applies it to each hand.
+const (
+	orderTopFirst    = "top_first"
+	orderBottomFirst = "bottom_first"
+	orderCanonical   = "canonical"
+)
+
+// RemainingCounts represents the composition of the upcoming cards.
+type RemainingCounts struct {
+	ByRank map[string]int `json:"by_rank"`
+	BySuit map[string]int `json:"by_suit"`
+}
+
+// CardOrder represents the canonical order of a freshly generated deck. The
+// zero value groups cards by suit with aces high.
+type CardOrder struct {
+	RankFirst bool // group cards by rank instead of by suit
+	AceLow    bool // put aces before twos instead of after kings
+}
+
+// generateCards returns nbrPaquet packs of 52 cards, each followed by
+// jokersPerPack jokers.
+func generateCards(nbrPaquet, jokersPerPack int, order CardOrder) []Card {
+	var cards []Card
+	ranks := []string{"2", "3", "4", "5", "6", "7", "8", "9", "10", "j", "q", "k", "a"}
+	suits := []string{"h", "d", "c", "s"}
+	if order.AceLow {
+		ranks = append([]string{"a"}, ranks[:len(ranks)-1]...)
+	}
+
+	newCard := func(rank, suit string) Card {
+		code := rank + suit
+		return Card{
+			Code:  code,
+			Rank:  rank,
+			Suit:  suit,
+			Image: cardImage(code),
+		}
+	}
+
+	for i := 0; i < nbrPaquet; i++ {
+		if order.RankFirst {
+			for _, rank := range ranks {
+				for _, suit := range suits {
+					cards = append(cards, newCard(rank, suit))
+				}
+			}
+		} else {
+			for _, suit := range suits {
+				for _, rank := range ranks {
+					cards = append(cards, newCard(rank, suit))
+				}
+			}
+		}
+		cards = append(cards, packJokers(jokersPerPack)...)
+	}
+	return cards
+}
+
+// Codes of the jokers. A pack of four jokers holds two red and two black
+// ones, which have their own codes; smaller packs use plain jokers.
+const (
+	jokerCode      = "joker"
+	redJokerCode   = "joker-red"
+	blackJokerCode = "joker-black"
+)
+
+// jokerCardCounts are the allowed numbers of jokers per pack.
+var jokerCardCounts = []string{"0", "1", "2", "4"}
+
+// jokerCards returns n jokers.
+func jokerCards(n int) []Card {
+	cards := make([]Card, n)
+	for i := range cards {
+		cards[i] = jokerCard(jokerCode)
+	}
+	return cards
+}
+
+// packJokers returns the jokers of one pack: n plain jokers, or two red and
+// two black jokers when n is 4.
+func packJokers(n int) []Card {
+	if n == 4 {
+		return []Card{jokerCard(redJokerCode), jokerCard(redJokerCode), jokerCard(blackJokerCode), jokerCard(blackJokerCode)}
+	}
+	return jokerCards(n)
+}
+
+func jokerCard(code string) Card {
+	return Card{Code: code, Rank: "joker", Suit: "", Image: cardImage(code)}
+}
+
+// isJoker reports whether code is the code of a joker, of any color.
+func isJoker(code string) bool {
+	return code == jokerCode || code == redJokerCode || code == blackJokerCode
+}
+
+// imageRanks maps card ranks to the rank used in the static image file names.
+var imageRanks = map[string]string{
+	"a": "1", "2": "2", "3": "3", "4": "4", "5": "5", "6": "6", "7": "7",
+	"8": "8", "9": "9", "10": "10", "j": "11", "q": "12", "k": "13",
+}
+
+// imageBaseURL prefixes the image URL of every card, e.g. to serve the images
+// from a CDN. It comes from IMAGE_BASE_URL and is empty by default, which
+// keeps the URLs relative to this server.
+var imageBaseURL = strings.TrimSuffix(os.Getenv("IMAGE_BASE_URL"), "/")
+
+// cardImage returns the image URL of a card code.
+func cardImage(code string) string {
+	return imageBaseURL + cardImagePath(code)
+}
+
+// cardImagePath returns the path of the static image of a card code, or of a
+// generated image when the code is not a standard card.
+func cardImagePath(code string) string {
+	if isJoker(code) {
+		return "/static/joker.svg"
+	}
+	if len(code) >= 2 {
+		rank, suit := code[:len(code)-1], code[len(code)-1:]
+		if fileRank, ok := imageRanks[rank]; ok && strings.Contains("hdcs", suit) {
+			return fmt.Sprintf("/static/%s%s.svg", fileRank, suit)
+		}
+	}
+	return generatedImage(code)
+}
+
+// Image URLs are never stored: every card is encoded with the URL derived from
+// the current configuration, so a change of configuration applies to every
+// card.
+var (
+	cardType      = reflect.TypeOf(Card{})
+	drawnCardType = reflect.TypeOf(DrawnCard{})
+)
+
+// imageTypes caches whether a type can hold cards, by reflect.Type.
+var imageTypes sync.Map
+
+// withImages returns v with the image URL of every Card and DrawnCard it
+// holds derived from the card code. v itself is left alone: the cards are
+// copied along with whatever holds them.
+func withImages(v any) any {
+	if v == nil || !holdsCards(reflect.TypeOf(v)) {
+		return v
+	}
+	return setImages(reflect.ValueOf(v)).Interface()
+}
+
+// holdsCards reports whether a value of type t can hold cards that JSON
+// encodes. An interface may hold anything.
+func holdsCards(t reflect.Type) bool {
+	if held, ok := imageTypes.Load(t); ok {
+		return held.(bool)
+	}
+	// A recursive type holds cards through another of its fields, if at all.
+	imageTypes.Store(t, false)
+	held := false
+	switch t.Kind() {
+	case reflect.Interface:
+		held = true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		held = holdsCards(t.Elem())
+	case reflect.Struct:
+		held = t == cardType || t == drawnCardType
+		for i := 0; i < t.NumField() && !held; i++ {
+			held = t.Field(i).IsExported() && holdsCards(t.Field(i).Type)
+		}
+	}
+	imageTypes.Store(t, held)
+	return held
+}
+
+// setImages returns a copy of v with images, for withImages.
+func setImages(v reflect.Value) reflect.Value {
+	t := v.Type()
+	switch {
+	case t == cardType:
+		card := v.Interface().(Card)
+		card.Image = cardImage(card.Code)
+		return reflect.ValueOf(card)
+	case t == drawnCardType:
+		entry := v.Interface().(DrawnCard)
+		entry.Image = cardImage(entry.Code)
+		return reflect.ValueOf(entry)
+	case !holdsCards(t):
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(t.Elem())
+		out.Elem().Set(setImages(v.Elem()))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(t).Elem()
+		out.Set(setImages(v.Elem()))
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(setImages(v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(setImages(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(t, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			out.SetMapIndex(iter.Key(), setImages(iter.Value()))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(t).Elem()
+		out.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && holdsCards(t.Field(i).Type) {
+				out.Field(i).Set(setImages(v.Field(i)))
+			}
+		}
+		return out
+	}
+	return v
+}
+
+// drawnFromTop reports whether drawn are the top cards of upcoming, in
+// order, as a plain draw takes them. Only such draws keep the commitments of
+// GET /deck/{id}/upcoming/top/{n}/hashes.
+func drawnFromTop(upcoming, drawn []Card) bool {
+	if len(drawn) > len(upcoming) {
+		return false
+	}
+	for i, card := range drawn {
+		if upcoming[i].Code != card.Code {
+			return false
+		}
+	}
+	return true
+}
+
+// drawnEntries stamps cards with the current time for the drawn history.
+func drawnEntries(cards []Card) []DrawnCard {
+	return deck.Entries(cards, clock.Now())
+}
+
+// countCards counts the given cards by rank and by suit. Jokers have no suit
+// and are only counted by rank.
+func countCards(cards []Card) *RemainingCounts {
+	counts := &RemainingCounts{
+		ByRank: make(map[string]int),
+		BySuit: make(map[string]int),
+	}
+	for _, card := range cards {
+		counts.ByRank[card.Rank]++
+		if card.Suit != "" {
+			counts.BySuit[card.Suit]++
+		}
+	}
+	return counts
+}
+
+// rng is the random source behind weighted draws and card sampling. Shuffles
+// take their seeds from crypto/rand unless test mode has seeded rng.
+var rng = struct {
+	sync.Mutex
+	*rand.Rand
+	seeded bool
+}{Rand: rand.New(rand.NewSource(cryptoSeed()))}
+
+// cryptoSeed returns a seed below 2^53 read from crypto/rand, so that JSON
+// clients read it exactly.
+func cryptoSeed() int64 {
+	var b [8]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("reading random seed: %v", err))
+	}
+	return int64(binary.BigEndian.Uint64(b[:]) >> 11)
+}
+
+// shuffleCards shuffles cards in place with a new seed and returns the seed:
+// deck.NewRand(seed) shuffles the same cards the same way again.
+func shuffleCards(cards []Card) int64 {
+	rng.Lock()
+	var seed int64
+	if rng.seeded {
+		seed = rng.Int63n(1 << 53)
+	} else {
+		seed = cryptoSeed()
+	}
+	rng.Unlock()
+	deck.ShuffleCards(cards, deck.NewRand(seed))
+	return seed
+}
+
+// cardFromCode rebuilds the full card of a code such as "ah", "10d" or
+// "joker".
+func cardFromCode(code string) Card {
+	if isJoker(code) {
+		return jokerCard(code)
+	}
+	card := Card{Code: code, Image: cardImage(code)}
+	if len(code) >= 2 {
+		card.Rank, card.Suit = code[:len(code)-1], code[len(code)-1:]
+	}
+	return card
+}
+
+// customCard returns a card of a custom code, such as dragon, that names no
+// standard card. Its rank is the whole code and it has no suit; its image is
+// generated.
+func customCard(code string) Card {
+	return Card{Code: code, Rank: code, Image: cardImage(code)}
+}
+
+// validCustomCode reports whether code can name a custom card: 1 to
+// maxGeneratedCode printable characters, which leaves room for the
+// generated image to show it whole.
+func validCustomCode(code string) bool {
+	if code == "" || !utf8.ValidString(code) || utf8.RuneCountInString(code) > maxGeneratedCode {
+		return false
+	}
+	return strings.IndexFunc(code, func(r rune) bool { return !unicode.IsPrint(r) }) < 0
+}
+
+// cardSuit returns the suit of a card, reading it from the code for cards
+// added by code only. Jokers and custom cards have no suit.
+func cardSuit(card Card) string {
+	if card.Suit != "" || isJoker(card.Code) || card.Rank == "joker" || card.Rank == card.Code {
+		return card.Suit
+	}
+	if len(card.Code) >= 2 {
+		return card.Code[len(card.Code)-1:]
+	}
+	return ""
+}
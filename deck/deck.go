@@ -0,0 +1,272 @@
+// Package deck holds the card types and the pure deck operations behind the
+// HTTP server: drawing, shuffling, adding and clearing work on an in-memory
+// State and never touch the database. Persisting a State is the job of a
+// Store.
+package deck
+
+import (
+	"errors"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"time"
+)
+
+var (
+	// ErrNotEnoughCards is returned when a draw needs more cards than are left.
+	ErrNotEnoughCards = errors.New("Not enough cards")
+	// ErrEmpty is returned when drawing from a deck with no upcoming cards.
+	ErrEmpty = errors.New("Deck empty")
+	// ErrInvalidCount is returned for a draw of fewer than one card.
+	ErrInvalidCount = errors.New("Invalid number of cards")
+	// ErrNotEnoughDistinctRanks is returned when a distinct draw needs more
+	// ranks than the upcoming cards hold.
+	ErrNotEnoughDistinctRanks = errors.New("Not enough distinct ranks")
+)
+
+// Card represents a playing card.
+type Card struct {
+	Code  string `json:"code"`
+	Rank  string `json:"rank"`
+	Suit  string `json:"suit"`
+	Image string `json:"image"`
+	Value *int   `json:"value,omitempty"`
+}
+
+// DrawnCard represents a drawn card with the draw time. From is the fallback
+// deck the card was pulled from, if any, and To the deck a split moved it
+// to. Deal numbers the deals of a deck and Seat is the 1-based player the
+// deal gave the card to; Street is the board street a draw was labeled with,
+// such as flop. Table is the shoe table that drew the card and Session the
+// client session that asked for the draw. Label is the client's name for the
+// draw, such as question-7; several draws may share one. Card is the card as
+// it was upcoming, for a store to keep what the code alone does not say, such
+// as the rank of a custom card; it may be nil once stored and is never sent.
+type DrawnCard struct {
+	Code    string `json:"code"`
+	Time    string `json:"time"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Deal    int    `json:"deal,omitempty"`
+	Seat    int    `json:"seat,omitempty"`
+	Street  string `json:"street,omitempty"`
+	Table   string `json:"table,omitempty"`
+	Session string `json:"session,omitempty"`
+	Label   string `json:"label,omitempty"`
+	Image   string `json:"image,omitempty"`
+	Card    *Card  `json:"-"`
+}
+
+// State is the mutable part of a deck: the cards still to be drawn, top
+// first, and the history of the cards already drawn, oldest first.
+type State struct {
+	Upcoming []Card
+	Drawn    []DrawnCard
+}
+
+// Store loads and saves deck states by deck ID.
+type Store interface {
+	Load(deckID string) (State, error)
+	Save(deckID string, state State) error
+}
+
+// Update loads a deck from store, applies change to it and saves it. If
+// change fails, nothing is saved and its error is returned.
+func Update(store Store, deckID string, change func(*State) error) (State, error) {
+	state, err := store.Load(deckID)
+	if err != nil {
+		return State{}, err
+	}
+	if err := change(&state); err != nil {
+		return State{}, err
+	}
+	if err := store.Save(deckID, state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// Entries stamps cards with the given time for the drawn history. It returns
+// nil for no cards.
+func Entries(cards []Card, at time.Time) []DrawnCard {
+	if len(cards) == 0 {
+		return nil
+	}
+	entries := make([]DrawnCard, len(cards))
+	stamp := at.Format(time.RFC3339)
+	for i, card := range cards {
+		entries[i] = DrawnCard{Code: card.Code, Time: stamp, Card: &cards[i]}
+	}
+	return entries
+}
+
+// DrawN moves up to n cards from the top of the upcoming cards to the drawn
+// history and returns them in draw order. A deck with fewer than n cards
+// gives what it has; an empty deck gives ErrEmpty and is left unchanged.
+func DrawN(s *State, n int, at time.Time) ([]Card, error) {
+	if n < 1 {
+		return nil, ErrInvalidCount
+	}
+	if len(s.Upcoming) == 0 {
+		return nil, ErrEmpty
+	}
+	if n > len(s.Upcoming) {
+		n = len(s.Upcoming)
+	}
+
+	drawn := s.Upcoming[:n:n]
+	s.Upcoming = s.Upcoming[n:]
+	s.Drawn = append(s.Drawn, Entries(drawn, at)...)
+	return drawn, nil
+}
+
+// DrawExactly is DrawN without the shortfall: a deck with fewer than n cards
+// gives ErrNotEnoughCards and is left unchanged.
+func DrawExactly(s *State, n int, at time.Time) ([]Card, error) {
+	if n >= 1 && n > len(s.Upcoming) {
+		return nil, ErrNotEnoughCards
+	}
+	return DrawN(s, n, at)
+}
+
+// DrawPicked moves the upcoming cards at the given positions to the drawn
+// history, in the order the positions are given, and returns them. The other
+// upcoming cards keep their order. Positions must be distinct and in range.
+func DrawPicked(s *State, picked []int, at time.Time) []Card {
+	if len(picked) == 0 {
+		return nil
+	}
+	drawn := make([]Card, len(picked))
+	taken := make(map[int]bool, len(picked))
+	for i, pos := range picked {
+		drawn[i] = s.Upcoming[pos]
+		taken[pos] = true
+	}
+	kept := make([]Card, 0, len(s.Upcoming)-len(picked))
+	for i, card := range s.Upcoming {
+		if !taken[i] {
+			kept = append(kept, card)
+		}
+	}
+	s.Upcoming = kept
+	s.Drawn = append(s.Drawn, Entries(drawn, at)...)
+	return drawn
+}
+
+// DrawDistinct draws the first n cards of distinct ranks from the top. Cards
+// skipped because their rank was already drawn stay in the deck in their
+// order. A deck without n distinct ranks gives ErrNotEnoughDistinctRanks and
+// is left unchanged.
+func DrawDistinct(s *State, n int, at time.Time) ([]Card, error) {
+	if n < 1 {
+		return nil, ErrInvalidCount
+	}
+	if len(s.Upcoming) == 0 {
+		return nil, ErrEmpty
+	}
+
+	seen := make(map[string]bool)
+	var picked []int
+	for i, card := range s.Upcoming {
+		if len(picked) == n {
+			break
+		}
+		if !seen[card.Rank] {
+			seen[card.Rank] = true
+			picked = append(picked, i)
+		}
+	}
+	if len(picked) < n {
+		return nil, ErrNotEnoughDistinctRanks
+	}
+	return DrawPicked(s, picked, at), nil
+}
+
+// DrawAlternate draws up to n cards alternately from the top and the bottom,
+// starting with the top, and returns them in draw order.
+func DrawAlternate(s *State, n int, at time.Time) ([]Card, error) {
+	if n < 1 {
+		return nil, ErrInvalidCount
+	}
+	if len(s.Upcoming) == 0 {
+		return nil, ErrEmpty
+	}
+	if n > len(s.Upcoming) {
+		n = len(s.Upcoming)
+	}
+
+	picked := make([]int, n)
+	top, bottom := 0, len(s.Upcoming)-1
+	for i := range picked {
+		if i%2 == 0 {
+			picked[i] = top
+			top++
+		} else {
+			picked[i] = bottom
+			bottom--
+		}
+	}
+	return DrawPicked(s, picked, at), nil
+}
+
+// ShuffleCards shuffles cards in place using r.
+func ShuffleCards(cards []Card, r *rand.Rand) {
+	r.Shuffle(len(cards), func(i, j int) {
+		cards[i], cards[j] = cards[j], cards[i]
+	})
+}
+
+// NewRand returns a generator whose whole state comes from seed, so that
+// every seed gives a different sequence. rand.NewSource reduces its seed
+// modulo 2^31-1, which would leave about 2^31 possible shuffles.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(pcgSource{randv2.NewPCG(uint64(seed), 0)})
+}
+
+// pcgSource adapts a PCG generator to rand.Source64.
+type pcgSource struct{ *randv2.PCG }
+
+func (s pcgSource) Int63() int64    { return int64(s.Uint64() >> 1) }
+func (s pcgSource) Seed(seed int64) { s.PCG.Seed(uint64(seed), 0) }
+
+// Shuffle shuffles the upcoming cards in place using r. The drawn history is
+// left alone.
+func Shuffle(s *State, r *rand.Rand) {
+	ShuffleCards(s.Upcoming, r)
+}
+
+// AddCards puts cards at the bottom of the upcoming cards, in the given
+// order.
+func AddCards(s *State, cards []Card) {
+	if len(s.Upcoming)+len(cards) > cap(s.Upcoming) {
+		// Grow to the exact size rather than leave spare room.
+		s.Upcoming = append(make([]Card, 0, len(s.Upcoming)+len(cards)), s.Upcoming...)
+	}
+	s.Upcoming = append(s.Upcoming, cards...)
+}
+
+// RemoveCode takes every card with the given code out of the upcoming cards,
+// keeping the order of the others, and returns the positions from the top
+// the removed cards held. The drawn history is not touched.
+func RemoveCode(s *State, code string) []int {
+	var removed []int
+	kept := s.Upcoming[:0:0]
+	for i, card := range s.Upcoming {
+		if card.Code == code {
+			removed = append(removed, i)
+			continue
+		}
+		kept = append(kept, card)
+	}
+	if removed != nil {
+		s.Upcoming = kept
+	}
+	return removed
+}
+
+// ClearDrawn empties the drawn history without touching the upcoming cards
+// or their order, and returns how many entries were cleared.
+func ClearDrawn(s *State) int {
+	cleared := len(s.Drawn)
+	s.Drawn = []DrawnCard{}
+	return cleared
+}
@@ -0,0 +1,316 @@
+package deck
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+var drawTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func cards(codes ...string) []Card {
+	out := make([]Card, len(codes))
+	for i, code := range codes {
+		out[i] = Card{Code: code}
+	}
+	return out
+}
+
+func codes(cards []Card) []string {
+	out := make([]string, len(cards))
+	for i, card := range cards {
+		out[i] = card.Code
+	}
+	return out
+}
+
+func drawnCodes(drawn []DrawnCard) []string {
+	out := make([]string, len(drawn))
+	for i, entry := range drawn {
+		out[i] = entry.Code
+	}
+	return out
+}
+
+func TestDrawN(t *testing.T) {
+	tests := []struct {
+		name         string
+		upcoming     []string
+		drawn        []string
+		n            int
+		wantCards    []string
+		wantUpcoming []string
+		wantDrawn    []string
+		wantErr      error
+	}{
+		{"one", []string{"AS", "2S", "3S"}, nil, 1, []string{"AS"}, []string{"2S", "3S"}, []string{"AS"}, nil},
+		{"several", []string{"AS", "2S", "3S"}, nil, 2, []string{"AS", "2S"}, []string{"3S"}, []string{"AS", "2S"}, nil},
+		{"all", []string{"AS", "2S"}, nil, 2, []string{"AS", "2S"}, []string{}, []string{"AS", "2S"}, nil},
+		{"short deck gives what it has", []string{"AS", "2S"}, nil, 5, []string{"AS", "2S"}, []string{}, []string{"AS", "2S"}, nil},
+		{"history is appended", []string{"3S"}, []string{"AS", "2S"}, 1, []string{"3S"}, []string{}, []string{"AS", "2S", "3S"}, nil},
+		{"empty deck", nil, []string{"AS"}, 1, nil, []string{}, []string{"AS"}, ErrEmpty},
+		{"zero", []string{"AS"}, nil, 0, nil, []string{"AS"}, []string{}, ErrInvalidCount},
+		{"negative", []string{"AS"}, nil, -1, nil, []string{"AS"}, []string{}, ErrInvalidCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := State{Upcoming: cards(tt.upcoming...), Drawn: Entries(cards(tt.drawn...), drawTime)}
+			got, err := DrawN(&s, tt.n, drawTime)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantCards != nil && !reflect.DeepEqual(codes(got), tt.wantCards) {
+				t.Errorf("cards = %v, want %v", codes(got), tt.wantCards)
+			}
+			if !reflect.DeepEqual(codes(s.Upcoming), tt.wantUpcoming) {
+				t.Errorf("upcoming = %v, want %v", codes(s.Upcoming), tt.wantUpcoming)
+			}
+			if !reflect.DeepEqual(drawnCodes(s.Drawn), tt.wantDrawn) {
+				t.Errorf("drawn = %v, want %v", drawnCodes(s.Drawn), tt.wantDrawn)
+			}
+		})
+	}
+}
+
+func TestDrawNStampsHistory(t *testing.T) {
+	s := State{Upcoming: cards("AS", "2S")}
+	if _, err := DrawN(&s, 2, drawTime); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range s.Drawn {
+		if entry.Time != "2024-03-01T12:00:00Z" || entry.From != "" {
+			t.Errorf("entry = %+v", entry)
+		}
+	}
+}
+
+// Appending to the drawn cards must not overwrite the cards left in the deck.
+func TestDrawNResultDoesNotAliasUpcoming(t *testing.T) {
+	s := State{Upcoming: cards("AS", "2S", "3S")}
+	got, _ := DrawN(&s, 1, drawTime)
+	got = append(got, Card{Code: "XX"})
+	if !reflect.DeepEqual(codes(s.Upcoming), []string{"2S", "3S"}) {
+		t.Errorf("upcoming = %v after appending to the draw", codes(s.Upcoming))
+	}
+}
+
+func TestDrawExactly(t *testing.T) {
+	s := State{Upcoming: cards("AS", "2S")}
+	if _, err := DrawExactly(&s, 3, drawTime); err != ErrNotEnoughCards {
+		t.Fatalf("err = %v, want %v", err, ErrNotEnoughCards)
+	}
+	if len(s.Upcoming) != 2 || len(s.Drawn) != 0 {
+		t.Fatalf("failed draw changed the state: %+v", s)
+	}
+	got, err := DrawExactly(&s, 2, drawTime)
+	if err != nil || !reflect.DeepEqual(codes(got), []string{"AS", "2S"}) {
+		t.Fatalf("got %v, %v", codes(got), err)
+	}
+	if _, err := DrawExactly(&s, 1, drawTime); err != ErrNotEnoughCards {
+		t.Fatalf("err = %v on an empty deck, want %v", err, ErrNotEnoughCards)
+	}
+	if _, err := DrawExactly(&s, 0, drawTime); err != ErrInvalidCount {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidCount)
+	}
+}
+
+func TestDrawPicked(t *testing.T) {
+	s := State{Upcoming: cards("AS", "2S", "3S", "4S"), Drawn: Entries(cards("KH"), drawTime)}
+	got := DrawPicked(&s, []int{2, 0}, drawTime)
+	if !reflect.DeepEqual(codes(got), []string{"3S", "AS"}) {
+		t.Errorf("cards = %v, want [3S AS]", codes(got))
+	}
+	if !reflect.DeepEqual(codes(s.Upcoming), []string{"2S", "4S"}) {
+		t.Errorf("upcoming = %v, want [2S 4S]", codes(s.Upcoming))
+	}
+	if !reflect.DeepEqual(drawnCodes(s.Drawn), []string{"KH", "3S", "AS"}) {
+		t.Errorf("drawn = %v, want [KH 3S AS]", drawnCodes(s.Drawn))
+	}
+	if got := DrawPicked(&s, nil, drawTime); got != nil || len(s.Upcoming) != 2 {
+		t.Errorf("picking nothing drew %v and left %v", codes(got), codes(s.Upcoming))
+	}
+}
+
+// ranked gives cards their rank, the code without its suit letter.
+func ranked(codes ...string) []Card {
+	out := cards(codes...)
+	for i := range out {
+		out[i].Rank = out[i].Code[:len(out[i].Code)-1]
+	}
+	return out
+}
+
+func TestDrawDistinct(t *testing.T) {
+	tests := []struct {
+		name         string
+		upcoming     []string
+		n            int
+		wantCards    []string
+		wantUpcoming []string
+		wantErr      error
+	}{
+		{"no repeats", []string{"AS", "2S", "3S"}, 2, []string{"AS", "2S"}, []string{"3S"}, nil},
+		{"repeats are skipped and kept", []string{"AS", "AH", "2S", "AD", "3S"}, 3, []string{"AS", "2S", "3S"}, []string{"AH", "AD"}, nil},
+		{"stops at n", []string{"AS", "2S", "2H", "3S"}, 2, []string{"AS", "2S"}, []string{"2H", "3S"}, nil},
+		{"too few ranks", []string{"AS", "AH", "2S"}, 3, nil, []string{"AS", "AH", "2S"}, ErrNotEnoughDistinctRanks},
+		{"empty deck", nil, 1, nil, []string{}, ErrEmpty},
+		{"zero", []string{"AS"}, 0, nil, []string{"AS"}, ErrInvalidCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := State{Upcoming: ranked(tt.upcoming...)}
+			got, err := DrawDistinct(&s, tt.n, drawTime)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(codes(got), codes(ranked(tt.wantCards...))) {
+				t.Errorf("cards = %v, want %v", codes(got), tt.wantCards)
+			}
+			if !reflect.DeepEqual(codes(s.Upcoming), tt.wantUpcoming) {
+				t.Errorf("upcoming = %v, want %v", codes(s.Upcoming), tt.wantUpcoming)
+			}
+			if !reflect.DeepEqual(drawnCodes(s.Drawn), codes(got)) {
+				t.Errorf("drawn = %v, want %v", drawnCodes(s.Drawn), codes(got))
+			}
+		})
+	}
+}
+
+func TestDrawAlternate(t *testing.T) {
+	tests := []struct {
+		name         string
+		upcoming     []string
+		n            int
+		wantCards    []string
+		wantUpcoming []string
+		wantErr      error
+	}{
+		{"top then bottom", []string{"AS", "2S", "3S", "4S", "5S"}, 3, []string{"AS", "5S", "2S"}, []string{"3S", "4S"}, nil},
+		{"one", []string{"AS", "2S"}, 1, []string{"AS"}, []string{"2S"}, nil},
+		{"clamped to the deck", []string{"AS", "2S", "3S"}, 5, []string{"AS", "3S", "2S"}, []string{}, nil},
+		{"empty deck", nil, 1, nil, []string{}, ErrEmpty},
+		{"zero", []string{"AS"}, 0, nil, []string{"AS"}, ErrInvalidCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := State{Upcoming: cards(tt.upcoming...)}
+			got, err := DrawAlternate(&s, tt.n, drawTime)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(codes(got), codes(cards(tt.wantCards...))) {
+				t.Errorf("cards = %v, want %v", codes(got), tt.wantCards)
+			}
+			if !reflect.DeepEqual(codes(s.Upcoming), tt.wantUpcoming) {
+				t.Errorf("upcoming = %v, want %v", codes(s.Upcoming), tt.wantUpcoming)
+			}
+			if !reflect.DeepEqual(drawnCodes(s.Drawn), codes(got)) {
+				t.Errorf("drawn = %v, want %v", drawnCodes(s.Drawn), codes(got))
+			}
+		})
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	s := State{Upcoming: cards("AS", "2S", "3S", "4S", "5S", "6S", "7S", "8S"), Drawn: Entries(cards("KH"), drawTime)}
+	before := codes(s.Upcoming)
+	Shuffle(&s, rand.New(rand.NewSource(1)))
+
+	after := codes(s.Upcoming)
+	if reflect.DeepEqual(after, before) {
+		t.Errorf("order unchanged after shuffle: %v", after)
+	}
+	sort.Strings(after)
+	sort.Strings(before)
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("shuffle changed the cards: %v, want %v", after, before)
+	}
+	if !reflect.DeepEqual(drawnCodes(s.Drawn), []string{"KH"}) {
+		t.Errorf("shuffle touched the history: %v", drawnCodes(s.Drawn))
+	}
+}
+
+func TestShuffleIsDeterministicForASeed(t *testing.T) {
+	a := State{Upcoming: cards("AS", "2S", "3S", "4S", "5S")}
+	b := State{Upcoming: cards("AS", "2S", "3S", "4S", "5S")}
+	Shuffle(&a, rand.New(rand.NewSource(42)))
+	Shuffle(&b, rand.New(rand.NewSource(42)))
+	if !reflect.DeepEqual(codes(a.Upcoming), codes(b.Upcoming)) {
+		t.Errorf("same seed gave %v and %v", codes(a.Upcoming), codes(b.Upcoming))
+	}
+}
+
+func TestShuffleSmallDecks(t *testing.T) {
+	for _, upcoming := range [][]Card{nil, cards("AS")} {
+		s := State{Upcoming: upcoming}
+		Shuffle(&s, rand.New(rand.NewSource(1)))
+		if !reflect.DeepEqual(s.Upcoming, upcoming) {
+			t.Errorf("shuffle of %v gave %v", upcoming, s.Upcoming)
+		}
+	}
+}
+
+func TestAddCards(t *testing.T) {
+	s := State{Upcoming: cards("AS"), Drawn: Entries(cards("KH"), drawTime)}
+	AddCards(&s, cards("2S", "3S"))
+	if !reflect.DeepEqual(codes(s.Upcoming), []string{"AS", "2S", "3S"}) {
+		t.Errorf("upcoming = %v", codes(s.Upcoming))
+	}
+	AddCards(&s, nil)
+	if len(s.Upcoming) != 3 || len(s.Drawn) != 1 {
+		t.Errorf("adding nothing changed the state: %+v", s)
+	}
+
+	empty := State{}
+	AddCards(&empty, cards("AS"))
+	if !reflect.DeepEqual(codes(empty.Upcoming), []string{"AS"}) {
+		t.Errorf("upcoming = %v", codes(empty.Upcoming))
+	}
+}
+
+func TestRemoveCode(t *testing.T) {
+	s := State{Upcoming: cards("AS", "KH", "AS", "2S"), Drawn: Entries(cards("AS"), drawTime)}
+	upcoming := s.Upcoming
+	if removed := RemoveCode(&s, "AS"); !reflect.DeepEqual(removed, []int{0, 2}) {
+		t.Errorf("removed = %v, want [0 2]", removed)
+	}
+	if !reflect.DeepEqual(codes(s.Upcoming), []string{"KH", "2S"}) || len(s.Drawn) != 1 {
+		t.Errorf("state = %+v", s)
+	}
+	if !reflect.DeepEqual(codes(upcoming), []string{"AS", "KH", "AS", "2S"}) {
+		t.Errorf("removing rewrote the old upcoming cards: %v", codes(upcoming))
+	}
+	if removed := RemoveCode(&s, "QD"); removed != nil || len(s.Upcoming) != 2 {
+		t.Errorf("removing a missing code removed %v", removed)
+	}
+}
+
+func TestClearDrawn(t *testing.T) {
+	s := State{Upcoming: cards("3S", "AS"), Drawn: Entries(cards("KH", "QH"), drawTime)}
+	if cleared := ClearDrawn(&s); cleared != 2 {
+		t.Errorf("cleared = %d, want 2", cleared)
+	}
+	if s.Drawn == nil || len(s.Drawn) != 0 {
+		t.Errorf("drawn = %#v, want an empty non-nil history", s.Drawn)
+	}
+	if !reflect.DeepEqual(codes(s.Upcoming), []string{"3S", "AS"}) {
+		t.Errorf("upcoming = %v", codes(s.Upcoming))
+	}
+	if cleared := ClearDrawn(&s); cleared != 0 {
+		t.Errorf("second clear cleared %d", cleared)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	if Entries(nil, drawTime) != nil {
+		t.Error("entries of no cards should be nil")
+	}
+	drawn := cards("AS", "2S")
+	got := Entries(drawn, drawTime)
+	want := []DrawnCard{{Code: "AS", Time: "2024-03-01T12:00:00Z", Card: &drawn[0]}, {Code: "2S", Time: "2024-03-01T12:00:00Z", Card: &drawn[1]}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build testonly
+
+package deck
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrUnknownDeck is returned by MockStore.Load for a deck it does not hold.
+var ErrUnknownDeck = errors.New("Deck not found")
+
+// MockStore is an in-memory Store for tests that do not need SQLite. It
+// keeps a copy of every state it is given and hands out copies, so a caller
+// changing a loaded state does not change the stored one until it saves.
+type MockStore struct {
+	mu     sync.Mutex
+	states map[string]*State
+	calls  map[string]int
+}
+
+// NewMockStore returns a MockStore holding the given states by deck ID.
+func NewMockStore(states map[string]State) *MockStore {
+	m := &MockStore{states: map[string]*State{}, calls: map[string]int{}}
+	for deckID, state := range states {
+		m.states[deckID] = copyState(state)
+	}
+	return m
+}
+
+func (m *MockStore) Load(deckID string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls["Load"]++
+	state, ok := m.states[deckID]
+	if !ok {
+		return State{}, ErrUnknownDeck
+	}
+	return *copyState(*state), nil
+}
+
+func (m *MockStore) Save(deckID string, state State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls["Save"]++
+	m.states[deckID] = copyState(state)
+	return nil
+}
+
+// CallCount returns how many times a method of the store, such as "Load",
+// was called.
+func (m *MockStore) CallCount(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+func copyState(s State) *State {
+	return &State{Upcoming: slices.Clone(s.Upcoming), Drawn: slices.Clone(s.Drawn)}
+}
@@ -0,0 +1,99 @@
+//go:build testonly
+
+package deck
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// drawFrom is how a caller draws through a Store.
+func drawFrom(store Store, deckID string, n int) ([]Card, error) {
+	var drawn []Card
+	_, err := Update(store, deckID, func(s *State) (err error) {
+		drawn, err = DrawN(s, n, drawTime)
+		return err
+	})
+	return drawn, err
+}
+
+func TestMockStore(t *testing.T) {
+	store := NewMockStore(map[string]State{"d1": {Upcoming: cards("AS", "2S", "3S")}})
+
+	drawn, err := drawFrom(store, "d1", 2)
+	if err != nil || !reflect.DeepEqual(codes(drawn), []string{"AS", "2S"}) {
+		t.Fatalf("draw = %v, %v", codes(drawn), err)
+	}
+	state, _ := store.Load("d1")
+	if !reflect.DeepEqual(codes(state.Upcoming), []string{"3S"}) || !reflect.DeepEqual(drawnCodes(state.Drawn), []string{"AS", "2S"}) {
+		t.Errorf("stored state = %v and %v", codes(state.Upcoming), drawnCodes(state.Drawn))
+	}
+
+	// A loaded state is a copy until it is saved.
+	state.Upcoming[0].Code = "XX"
+	if again, _ := store.Load("d1"); again.Upcoming[0].Code != "3S" {
+		t.Error("changing a loaded state changed the store")
+	}
+
+	if _, err := drawFrom(store, "missing", 1); !errors.Is(err, ErrUnknownDeck) {
+		t.Errorf("draw from a missing deck returned %v", err)
+	}
+	if _, err := drawFrom(store, "d1", 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drawFrom(store, "d1", 1); err != ErrEmpty {
+		t.Errorf("draw from an empty deck returned %v", err)
+	}
+	if got := [2]int{store.CallCount("Load"), store.CallCount("Save")}; got != [2]int{6, 2} {
+		t.Errorf("Load and Save called %v times, want 6 and 2", got)
+	}
+}
+
+func TestUpdateAddsAndClears(t *testing.T) {
+	store := NewMockStore(map[string]State{"d1": {Upcoming: cards("AS"), Drawn: Entries(cards("KH"), drawTime)}})
+
+	state, err := Update(store, "d1", func(s *State) error {
+		AddCards(s, cards("2S", "3S"))
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(codes(state.Upcoming), []string{"AS", "2S", "3S"}) {
+		t.Fatalf("add = %v, %v", codes(state.Upcoming), err)
+	}
+
+	var cleared int
+	if _, err := Update(store, "d1", func(s *State) error {
+		cleared = ClearDrawn(s)
+		return nil
+	}); err != nil || cleared != 1 {
+		t.Fatalf("clear = %d, %v", cleared, err)
+	}
+	stored, _ := store.Load("d1")
+	if !reflect.DeepEqual(codes(stored.Upcoming), []string{"AS", "2S", "3S"}) || len(stored.Drawn) != 0 {
+		t.Errorf("stored state = %v and %v", codes(stored.Upcoming), drawnCodes(stored.Drawn))
+	}
+}
+
+func TestUpdateSavesNothingOnError(t *testing.T) {
+	store := NewMockStore(map[string]State{"d1": {Upcoming: cards("AS", "2S")}})
+	refused := errors.New("refused")
+
+	_, err := Update(store, "d1", func(s *State) error {
+		AddCards(s, cards("3S"))
+		return refused
+	})
+	if err != refused {
+		t.Fatalf("Update returned %v, want the error of the change", err)
+	}
+	if store.CallCount("Save") != 0 {
+		t.Error("a failed change was saved")
+	}
+	if stored, _ := store.Load("d1"); !reflect.DeepEqual(codes(stored.Upcoming), []string{"AS", "2S"}) {
+		t.Errorf("upcoming = %v", codes(stored.Upcoming))
+	}
+
+	called := false
+	if _, err := Update(store, "missing", func(*State) error { called = true; return nil }); !errors.Is(err, ErrUnknownDeck) || called {
+		t.Errorf("Update of a missing deck returned %v and called the change: %v", err, called)
+	}
+}
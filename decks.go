@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Decks listed per page by GET /decks.
+const (
+	defaultDeckPage = 50
+	maxDeckPage     = 500
+)
+
+// DeckListing represents one page of GET /decks.
+type DeckListing struct {
+	Decks      []DeckListEntry `json:"decks"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// DeckListEntry represents one deck of the listing.
+type DeckListEntry struct {
+	ID        string `json:"deck_id"`
+	CreatedAt string `json:"created_at"`
+	Remaining int    `json:"remaining"`
+	Frozen    bool   `json:"frozen"`
+}
+
+// encodeDeckCursor returns the opaque cursor pointing after a deck.
+func encodeDeckCursor(createdAt, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt + "|" + id))
+}
+
+func decodeDeckCursor(cursor string) (createdAt, id string, ok bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(raw), "|")
+}
+
+// listDecks serves GET /decks, the decks in creation order. Pages are keyed
+// on (created_at, id) rather than an offset, so a client following
+// ?cursor=next_cursor never skips or repeats a deck when decks are created or
+// deleted between two pages. The response carries the change sequence, and
+// is a 304 when it has not moved since the client's ETag.
+func listDecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	v := &Validator{}
+	limit := v.OptionalInt("limit", r.URL.Query().Get("limit"), defaultDeckPage, 1, maxDeckPage)
+	var createdAt, afterID string
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		var ok bool
+		createdAt, afterID, ok = decodeDeckCursor(cursor)
+		v.Check(ok, "cursor", "invalid_cursor", "cursor must be a next_cursor returned by /decks")
+	}
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	seq, err := changeSequence()
+	if err != nil {
+		http.Error(w, "Error reading decks", http.StatusInternalServerError)
+		return
+	}
+	if setChangeSequence(w, r, seq, fmt.Sprintf("%s %d", r.URL.Query().Get("cursor"), limit)) {
+		return
+	}
+
+	// One extra row tells whether there is a next page.
+	rows, err := readDB.Query(`SELECT id, created_at, COALESCE(json_array_length(upcoming), 0), frozen FROM decks
+		WHERE (created_at, id) > (?, ?) ORDER BY created_at, id LIMIT ?`, createdAt, afterID, limit+1)
+	if err != nil {
+		http.Error(w, "Error reading decks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	listing := DeckListing{Decks: []DeckListEntry{}}
+	for rows.Next() {
+		var deck DeckListEntry
+		if err := rows.Scan(&deck.ID, &deck.CreatedAt, &deck.Remaining, &deck.Frozen); err != nil {
+			http.Error(w, "Error reading decks", http.StatusInternalServerError)
+			return
+		}
+		listing.Decks = append(listing.Decks, deck)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error reading decks", http.StatusInternalServerError)
+		return
+	}
+	if len(listing.Decks) > limit {
+		listing.Decks = listing.Decks[:limit]
+		last := listing.Decks[limit-1]
+		listing.NextCursor = encodeDeckCursor(last.CreatedAt, last.ID)
+	}
+
+	writeJSON(w, listing)
+}
+
+// Every write to the decks table is recorded in deck_changes by triggers, so
+// that no code path can forget to. Only the latest change of a deck is kept;
+// a deleted deck keeps a tombstone. Sequence numbers come from AUTOINCREMENT
+// and so keep growing across restarts, even when the latest rows are removed.
+func createChangeTable() {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS deck_changes (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			deck_id TEXT NOT NULL,
+			deleted INTEGER NOT NULL DEFAULT 0 -- Tombstone of a deleted deck
+		)`,
+		`CREATE INDEX IF NOT EXISTS deck_changes_deck_id ON deck_changes (deck_id)`,
+		`CREATE TRIGGER IF NOT EXISTS decks_changed_insert AFTER INSERT ON decks BEGIN
+			DELETE FROM deck_changes WHERE deck_id = NEW.id;
+			INSERT INTO deck_changes (deck_id) VALUES (NEW.id);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS decks_changed_update AFTER UPDATE ON decks BEGIN
+			DELETE FROM deck_changes WHERE deck_id = NEW.id;
+			INSERT INTO deck_changes (deck_id) VALUES (NEW.id);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS decks_changed_delete AFTER DELETE ON decks BEGIN
+			DELETE FROM deck_changes WHERE deck_id = OLD.id;
+			INSERT INTO deck_changes (deck_id, deleted) VALUES (OLD.id, 1);
+		END`,
+		// Decks created before the change feed existed count as changed once.
+		`INSERT INTO deck_changes (deck_id) SELECT id FROM decks WHERE id NOT IN (SELECT deck_id FROM deck_changes)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("Error creating change feed: %v", err)
+		}
+	}
+}
+
+// Changes listed per page by GET /decks/changes.
+const (
+	defaultChangePage = 500
+	maxChangePage     = 5000
+)
+
+// DeckChange represents the latest change of one deck.
+type DeckChange struct {
+	DeckID   string `json:"deck_id"`
+	Sequence int64  `json:"sequence"`
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+// DeckChanges represents one page of GET /decks/changes. Sequence is what to
+// pass as ?since= next time; More is set when changes remain past it.
+type DeckChanges struct {
+	Sequence int64        `json:"sequence"`
+	Changes  []DeckChange `json:"changes"`
+	More     bool         `json:"more"`
+}
+
+// changeSequence returns the sequence number of the latest change.
+func changeSequence() (int64, error) {
+	var seq int64
+	err := readDB.QueryRow("SELECT COALESCE(MAX(seq), 0) FROM deck_changes").Scan(&seq)
+	return seq, err
+}
+
+// setChangeSequence sets the X-Deck-Sequence header and reports whether the
+// client's If-None-Match already names this sequence and page, in which case
+// a 304 has been written. page identifies the page asked for, such as its
+// cursor and limit, so that the ETag of one page never matches another.
+func setChangeSequence(w http.ResponseWriter, r *http.Request, seq int64, page string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(page))
+	etag := fmt.Sprintf(`"seq-%d-%08x"`, seq, h.Sum32())
+	w.Header().Set("X-Deck-Sequence", strconv.FormatInt(seq, 10))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// listDeckChanges serves GET /decks/changes?since=N, the decks created,
+// changed or deleted after sequence N, each listed once with its latest
+// change.
+func listDeckChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	v := &Validator{}
+	since := v.OptionalInt("since", r.URL.Query().Get("since"), 0, 0, math.MaxInt)
+	limit := v.OptionalInt("limit", r.URL.Query().Get("limit"), defaultChangePage, 1, maxChangePage)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	seq, err := changeSequence()
+	if err != nil {
+		http.Error(w, "Error reading changes", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := readDB.Query("SELECT deck_id, seq, deleted FROM deck_changes WHERE seq > ? ORDER BY seq LIMIT ?", since, limit+1)
+	if err != nil {
+		http.Error(w, "Error reading changes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	changes := DeckChanges{Sequence: seq, Changes: []DeckChange{}}
+	for rows.Next() {
+		var change DeckChange
+		if err := rows.Scan(&change.DeckID, &change.Sequence, &change.Deleted); err != nil {
+			http.Error(w, "Error reading changes", http.StatusInternalServerError)
+			return
+		}
+		changes.Changes = append(changes.Changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error reading changes", http.StatusInternalServerError)
+		return
+	}
+	if len(changes.Changes) > limit {
+		changes.Changes = changes.Changes[:limit]
+		changes.Sequence = changes.Changes[limit-1].Sequence
+		changes.More = true
+	}
+
+	if setChangeSequence(w, r, changes.Sequence, fmt.Sprintf("%d %d", since, limit)) {
+		return
+	}
+	writeJSON(w, changes)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// Decks created while a client pages through the listing land after its
+// cursor, so every deck that existed when it started is seen exactly once.
+func TestListDecksCursor(t *testing.T) {
+	savedToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = savedToken })
+
+	server := newTestServer(t)
+	want := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		want[newTestDeck(t, server, 1)] = true
+	}
+
+	seen := map[string]int{}
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		resp := adminRequest(t, http.MethodGet, server.URL+"/decks?limit=2&cursor="+url.QueryEscape(cursor), "")
+		var listing DeckListing
+		err := json.NewDecoder(resp.Body).Decode(&listing)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, deck := range listing.Decks {
+			seen[deck.ID]++
+		}
+		if listing.NextCursor == "" {
+			break
+		}
+		cursor = listing.NextCursor
+		newTestDeck(t, server, 1)
+	}
+
+	for id := range want {
+		if seen[id] != 1 {
+			t.Errorf("deck %s listed %d times, want once", id, seen[id])
+		}
+	}
+	for id, n := range seen {
+		if n > 1 {
+			t.Errorf("deck %s listed %d times", id, n)
+		}
+	}
+
+	resp := adminRequest(t, http.MethodGet, server.URL+"/decks?cursor=!!", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad cursor returned %d, want 400", resp.StatusCode)
+	}
+}
+
+func fetchChanges(t *testing.T, server string, since int64) DeckChanges {
+	t.Helper()
+	resp := adminRequest(t, http.MethodGet, fmt.Sprintf("%s/decks/changes?since=%d", server, since), "")
+	defer resp.Body.Close()
+	var changes DeckChanges
+	if err := json.NewDecoder(resp.Body).Decode(&changes); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("X-Deck-Sequence"); got != fmt.Sprint(changes.Sequence) {
+		t.Errorf("X-Deck-Sequence is %s, body sequence is %d", got, changes.Sequence)
+	}
+	return changes
+}
+
+func TestDeckChanges(t *testing.T) {
+	savedToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = savedToken })
+
+	server := newTestServer(t)
+	mutated := newTestDeck(t, server, 1)
+	deleted := newTestDeck(t, server, 1)
+	since := fetchChanges(t, server.URL, 0).Sequence
+
+	created := newTestDeck(t, server, 1)
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+mutated+"/draw/1")
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+mutated+"/draw/1")
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deleted+"/draw/52")
+	resp := adminRequest(t, http.MethodPost, server.URL+"/admin/decks/purge-empty", "")
+	resp.Body.Close()
+
+	changes := fetchChanges(t, server.URL, since)
+	got := map[string]int{}
+	for _, change := range changes.Changes {
+		got[change.DeckID]++
+		if change.Deleted != (change.DeckID == deleted) {
+			t.Errorf("change %+v has the wrong tombstone", change)
+		}
+		if change.Sequence <= since || change.Sequence > changes.Sequence {
+			t.Errorf("change %+v outside (%d, %d]", change, since, changes.Sequence)
+		}
+	}
+	want := map[string]int{created: 1, mutated: 1, deleted: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes since %d: got %v, want each deck once: %v", since, got, want)
+	}
+
+	if later := fetchChanges(t, server.URL, changes.Sequence); len(later.Changes) != 0 || later.Sequence != changes.Sequence {
+		t.Errorf("changes since the latest sequence: %+v", later)
+	}
+
+	listStatus := func(query, etag string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/decks"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("ETag")
+	}
+	_, etag := listStatus("?limit=1", "")
+	if status, _ := listStatus("?limit=1", etag); status != http.StatusNotModified {
+		t.Errorf("unchanged deck list returned %d, want 304", status)
+	}
+	// The ETag of a page does not match another page of the same sequence.
+	if status, _ := listStatus("?limit=2", etag); status != http.StatusOK {
+		t.Errorf("deck list with another limit returned %d, want 200", status)
+	}
+	_, firstPage := listStatus("", "")
+	var listing DeckListing
+	resp = adminRequest(t, http.MethodGet, server.URL+"/decks?limit=1", "")
+	json.NewDecoder(resp.Body).Decode(&listing)
+	resp.Body.Close()
+	if status, _ := listStatus("?cursor="+listing.NextCursor, firstPage); status != http.StatusOK {
+		t.Errorf("second page with the first page's ETag returned %d, want 200", status)
+	}
+
+	resp = adminRequest(t, http.MethodGet, fmt.Sprintf("%s/decks/changes?since=%d&limit=1", server.URL, since), "")
+	resp.Body.Close()
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/decks/changes?since=%d&limit=2", server.URL, since), nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("changes with another limit returned %d, want 200", resp.StatusCode)
+	}
+}
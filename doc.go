@@ -0,0 +1,27 @@
+// The TPReseau server serves decks of playing cards over HTTP.
+//
+// Everything is in package main, split by concern:
+//
+//   - main.go starts the server: it opens the database, creates the tables
+//     and starts the request worker and the background loops.
+//   - deck.go holds the server's view of a deck: the Deck response, card
+//     generation, jokers, image URLs and card helpers. The cards themselves
+//     and the draw, shuffle and add rules are in the deck package.
+//   - store.go holds the SQLite access: the read and write connections, the
+//     decks table and its migrations, and reading and writing a deck's
+//     upcoming cards and drawn history.
+//   - worker.go holds the request worker. Draws, shuffles and deals are sent
+//     as a Request on requestChannel and run one at a time by handleRequests,
+//     which replies with a Response.
+//   - handler.go registers the routes and holds the /deck/ handlers, which
+//     validate the input, submit work to the worker or read the store, and
+//     write the response.
+//
+// Other features, such as piles, pools, shoes and the admin endpoints, each
+// have their own file with their handlers and tables.
+// A table whose rows belong to a deck is listed in deckDependents, in gc.go,
+// so that deleting the deck deletes them too.
+//
+// Writes go through db under mu, on a single connection; read endpoints use
+// readDB and never take mu.
+package main
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcurrentDraw(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 52)
+	for i := 0; i < 52; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(base + "/draw/1")
+			if err != nil {
+				errs <- err
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("draw returned %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info DeckInfo
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Drawn != 52 || info.Remaining != 0 {
+		t.Errorf("deck has %d drawn and %d remaining, want 52 and 0", info.Drawn, info.Remaining)
+	}
+
+	resp, err = http.Get(base + "/show/0/52")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var drawn []DrawnCard
+	err = json.NewDecoder(resp.Body).Decode(&drawn)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, card := range drawn {
+		if seen[card.Code] {
+			t.Errorf("%s drawn twice", card.Code)
+		}
+		seen[card.Code] = true
+	}
+	if len(seen) != 52 {
+		t.Errorf("drawn history holds %d distinct cards, want 52", len(seen))
+	}
+}
+
+func TestAutoReshuffle(t *testing.T) {
+	server := newTestServer(t)
+	resp, err := http.Get(server.URL + "/deck/new/1?reshuffle_at=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deck Deck
+	err = json.NewDecoder(resp.Body).Decode(&deck)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := server.URL + "/deck/" + deck.ID
+	violations := atomic.LoadInt64(&conservationViolations)
+
+	if got := fetchDeck(t, http.MethodGet, base+"/draw/26"); got.Reshuffled || got.Remaining != 26 {
+		t.Fatalf("draw down to half: reshuffled %v with %d left, want no reshuffle and 26 left", got.Reshuffled, got.Remaining)
+	}
+	// Below half, the 26 cards drawn before go back; the card just drawn
+	// stays drawn.
+	got := fetchDeck(t, http.MethodGet, base+"/draw/1")
+	if !got.Reshuffled || got.Remaining != 51 || len(got.Cards) != 1 {
+		t.Fatalf("draw below half: reshuffled %v with %d left, want a reshuffle and 51 left", got.Reshuffled, got.Remaining)
+	}
+
+	resp, err = http.Get(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info DeckInfo
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Drawn != 1 || !info.Shuffled {
+		t.Errorf("deck has %d drawn and shuffled %v, want 1 drawn and shuffled", info.Drawn, info.Shuffled)
+	}
+	if atomic.LoadInt64(&conservationViolations) != violations {
+		t.Error("reshuffle broke card conservation")
+	}
+}
+
+// TestShuffleDealAutoReshuffle puts the cards drawn before a shuffle-deal
+// back once the deal leaves the deck below ?reshuffle_at, and keeps the
+// dealt cards drawn.
+func TestShuffleDealAutoReshuffle(t *testing.T) {
+	server := newTestServer(t)
+	resp, err := http.Get(server.URL + "/deck/new/1?reshuffle_at=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created Deck
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := server.URL + "/deck/" + created.ID
+	violations := atomic.LoadInt64(&conservationViolations)
+
+	fetchDeck(t, http.MethodGet, base+"/draw/20")
+	got := fetchDeck(t, http.MethodPost, base+"/shuffle-deal/2/4")
+	if !got.Reshuffled || got.Remaining != 44 || len(got.Hands) != 2 {
+		t.Fatalf("deal below half: reshuffled %v with %d left, want a reshuffle and 44 left", got.Reshuffled, got.Remaining)
+	}
+	drawn, err := loadDrawnCards(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drawn) != 8 || drawn[0].Deal != 1 || drawn[7].Seat != 2 {
+		t.Errorf("history after the deal = %+v, want the 8 dealt cards", drawn)
+	}
+	if atomic.LoadInt64(&conservationViolations) != violations {
+		t.Error("shuffle-deal reshuffle broke card conservation")
+	}
+}
+
+func TestDrawVariantsAreTagged(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	for _, path := range []string{"/draw/alternate/2", "/draw/distinct/2"} {
+		fetchDeck(t, http.MethodGet, base+path+"?street=flop&session=alice&label=question-7")
+	}
+	if status := getStatus(t, http.MethodPost, base+"/draw/2/split-by-suit?street=flop&session=alice&label=question-7"); status != http.StatusOK {
+		t.Fatalf("split-by-suit draw: status %d", status)
+	}
+	collected := fetchCollect(t, base+"/draw/collect?suit=h&count=1&street=flop&session=alice&label=question-7")
+	drawn, err := loadDrawnCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 6 + len(collected.Cards); len(drawn) != want {
+		t.Fatalf("drawn history holds %d cards, want %d", len(drawn), want)
+	}
+	for _, entry := range drawn {
+		if entry.Street != "flop" || entry.Session != "alice" || entry.Label != "question-7" {
+			t.Errorf("card %s recorded as street %q, session %q, label %q", entry.Code, entry.Street, entry.Session, entry.Label)
+		}
+	}
+}
+
+// A standard deck holds thirteen ranks, so a fourteenth distinct card is a
+// conflict with the deck rather than a server error, and nothing is drawn.
+func TestDistinctDrawPastTheRanks(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	resp, err := http.Get(base + "/draw/distinct/14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(string(body), `"code":"NOT_ENOUGH_DISTINCT_RANKS"`) {
+		t.Errorf("got %d %s, want 409 NOT_ENOUGH_DISTINCT_RANKS", resp.StatusCode, body)
+	}
+	if info := fetchDeckInfo(t, base); info.Remaining != 52 {
+		t.Errorf("deck has %d cards left, want 52", info.Remaining)
+	}
+}
+
+// A shuffle with too few cards says it was skipped, but its shuffled field
+// keeps meaning "shuffled since creation", like GET /deck/{id}.
+func TestSkippedShuffleKeepsShuffledState(t *testing.T) {
+	server := newTestServer(t)
+	for _, shuffledFirst := range []bool{false, true} {
+		deckID := newTestDeck(t, server, 1)
+		base := server.URL + "/deck/" + deckID
+		if shuffledFirst {
+			fetchDeck(t, http.MethodGet, base+"/shuffle")
+		}
+		fetchDeck(t, http.MethodGet, base+"/draw/51")
+
+		deck := fetchDeck(t, http.MethodGet, base+"/shuffle")
+		if !deck.ShuffleSkipped || deck.Shuffled == nil || *deck.Shuffled != shuffledFirst {
+			t.Errorf("shuffled first %v: skipped %v, shuffled %v", shuffledFirst, deck.ShuffleSkipped, deck.Shuffled)
+		}
+		if info := fetchDeckInfo(t, base); info.Shuffled != shuffledFirst {
+			t.Errorf("shuffled first %v: deck info says shuffled %v", shuffledFirst, info.Shuffled)
+		}
+	}
+}
+
+// TestCollectDraw draws until a count of hearts is reached, then asks for
+// more hearts than the deck has left, which empties it.
+func TestCollectDraw(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	upcoming, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fifthHeart, hearts := 0, 0
+	for fifthHeart < len(upcoming) && hearts < 5 {
+		if upcoming[fifthHeart].Suit == "h" {
+			hearts++
+		}
+		fifthHeart++
+	}
+
+	got := fetchCollect(t, base+"/draw/collect?suit=h&count=5")
+	if got.Target != 5 || got.Collected != 5 || got.Remaining != 52-fifthHeart || !slices.Equal(cardCodes(got.Cards), cardCodes(upcoming[:fifthHeart])) {
+		t.Errorf("first collect: %+v, want the first %d cards with 5 hearts", got, fifthHeart)
+	}
+
+	got = fetchCollect(t, base+"/draw/collect?suit=h&count=13")
+	if got.Collected != 8 || got.Remaining != 0 || len(got.Cards) != 52-fifthHeart {
+		t.Errorf("second collect: collected %d of %d with %d cards left, want 8 of 13 with the deck emptied", got.Collected, got.Target, got.Remaining)
+	}
+	if info := fetchDeckInfo(t, base); info.Drawn != 52 {
+		t.Errorf("history holds %d cards, want 52", info.Drawn)
+	}
+
+	for _, path := range []string{"/draw/collect?suit=x&count=1", "/draw/collect?suit=h&count=0"} {
+		if status := getStatus(t, http.MethodGet, base+path); status != http.StatusBadRequest {
+			t.Errorf("%s returned %d, want 400", path, status)
+		}
+	}
+}
+
+func fetchCollect(t *testing.T, url string) CollectDraw {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var collect CollectDraw
+	if err := json.NewDecoder(resp.Body).Decode(&collect); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d, %v", url, resp.StatusCode, err)
+	}
+	return collect
+}
+
+// TestAlternateDraw takes an odd count alternately from the top and the
+// bottom, then asks for more cards than are left.
+func TestAlternateDraw(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/shuffle")
+
+	upcoming, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cardCodes([]Card{upcoming[0], upcoming[51], upcoming[1], upcoming[50], upcoming[2]})
+	drawn := fetchDeck(t, http.MethodGet, base+"/draw/alternate/5")
+	if got := cardCodes(drawn.Cards); !slices.Equal(got, want) || drawn.Remaining != 47 {
+		t.Errorf("drew %v with %d left, want %v with 47", got, drawn.Remaining, want)
+	}
+	left, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cardCodes(left), cardCodes(upcoming[3:50])) {
+		t.Errorf("upcoming after the draw is not the middle of the deck in order")
+	}
+
+	drawn = fetchDeck(t, http.MethodGet, base+"/draw/alternate/100")
+	if len(drawn.Cards) != 47 || drawn.Remaining != 0 {
+		t.Errorf("clamped draw gave %d cards with %d left, want 47 with 0", len(drawn.Cards), drawn.Remaining)
+	}
+	history, err := loadDrawnCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 52 {
+		t.Fatalf("history holds %d cards, want 52", len(history))
+	}
+	for i, code := range append(want, cardCodes(drawn.Cards)...) {
+		if history[i].Code != code {
+			t.Errorf("history[%d] = %s, want %s", i, history[i].Code, code)
+		}
+	}
+}
+
+// TestAutoReshuffleKeepsCustomCards recycles custom cards with the rank and
+// suit they were added with, not the ones their codes would give.
+func TestAutoReshuffleKeepsCustomCards(t *testing.T) {
+	server := newTestServer(t)
+	deckID := fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?reshuffle_at=50").ID
+	base := server.URL + "/deck/" + deckID
+	if status := getStatus(t, http.MethodPost, base+"/add?custom=dragon,tiger"); status != http.StatusOK {
+		t.Fatalf("add custom cards: status %d", status)
+	}
+
+	// The custom cards go to the bottom: the first draw takes dragon, and
+	// the next puts it back.
+	fetchDeck(t, http.MethodGet, base+"/draw/53")
+	if got := fetchDeck(t, http.MethodGet, base+"/draw/1"); !got.Reshuffled || got.Remaining != 53 {
+		t.Fatalf("last draw: reshuffled %v with %d left, want a reshuffle and 53 left", got.Reshuffled, got.Remaining)
+	}
+	upcoming, _, err := readDeckState(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, card := range upcoming {
+		if card.Code == "dragon" {
+			if card.Rank != "dragon" || card.Suit != "" {
+				t.Errorf("recycled dragon has rank %q and suit %q, want rank dragon and no suit", card.Rank, card.Suit)
+			}
+			return
+		}
+	}
+	t.Errorf("dragon is not back in the deck: %v", cardCodes(upcoming))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// dumpProgress, when set, is called after each deck written by GET
+// /admin/dump with the number of decks written so far. Tests use it to
+// watch the dump as it goes.
+var dumpProgress func(written int)
+
+// dumpBatch is how many decks GET /admin/dump reads per query.
+const dumpBatch = 100
+
+// adminDump serves GET /admin/dump: every live deck as newline-delimited
+// JSON, one export document per line, in deck ID order. ?since= (RFC 3339)
+// keeps the decks modified at or after that time, for incremental dumps;
+// decks that predate the updated_at column are then left out.
+//
+// The decks are read from readDB in batches of dumpBatch by ID, and the piles
+// and shuffle log of a batch are only read once its cursor is closed, so the
+// dump never holds more than one connection of the pool. Each line is
+// flushed as it is written. It stops as soon as the client goes away. Once
+// the first line is out the status is sent, so an error ends the dump early
+// and is only logged.
+func adminDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		v := &Validator{}
+		v.Check(err == nil, "since", "invalid", "since must be an RFC 3339 time")
+		if err := v.Err(); err != nil {
+			writeValidationErrors(w, err)
+			return
+		}
+		since = t.Truncate(time.Second)
+	}
+
+	ctx := r.Context()
+	docs, err := readDumpBatch(ctx, "", since)
+	if err != nil {
+		http.Error(w, "Error reading decks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	for len(docs) > 0 {
+		for _, doc := range docs {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := loadDeckPiles(ctx, readDB, &doc); err != nil {
+				log.Printf("dump deck %s: %v", doc.DeckID, err)
+				return
+			}
+			if doc.ShuffleLog, err = readShuffleLog(readDB, doc.DeckID); err != nil {
+				log.Printf("dump deck %s: %v", doc.DeckID, err)
+				return
+			}
+			if err := writeJSONLine(w, doc); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			written++
+			if dumpProgress != nil {
+				dumpProgress(written)
+			}
+		}
+		if len(docs) < dumpBatch {
+			return
+		}
+		if docs, err = readDumpBatch(ctx, docs[len(docs)-1].DeckID, since); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("dump: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// readDumpBatch reads up to dumpBatch decks with an ID after the given one,
+// modified at or after since unless it is zero, and closes its cursor before
+// returning.
+func readDumpBatch(ctx context.Context, after string, since time.Time) ([]ArchivedDeck, error) {
+	query := "SELECT * FROM decks WHERE id > ?"
+	args := []any{after}
+	if !since.IsZero() {
+		query += " AND unixepoch(updated_at) >= ?"
+		args = append(args, since.Unix())
+	}
+	rows, err := readDB.QueryContext(ctx, query+" ORDER BY id LIMIT ?", append(args, dumpBatch)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []ArchivedDeck
+	for rows.Next() {
+		doc, err := scanDeckDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
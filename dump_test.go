@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// insertTestDecks stores n single-pack decks straight into the database.
+func insertTestDecks(t *testing.T, n int) {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	cards := generateCards(1, 0, CardOrder{})
+	for i := 0; i < n; i++ {
+		if _, err := insertDeck(tx, cards, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupAdminToken sets the admin token adminRequest sends for the test.
+func setupAdminToken(t *testing.T) {
+	t.Helper()
+	savedToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() {
+		adminToken = savedToken
+		dumpProgress = nil
+	})
+}
+
+func TestAdminDumpStreams(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	insertTestDecks(t, 1000)
+
+	// The dump stops after ten decks until the client has read them, which
+	// it can only do if they were sent before the rest was read.
+	// The wait gives up after a while so that a broken test cannot hang the
+	// server; the test then fails once it is done reading.
+	reached, release, timedOut := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	dumpProgress = func(written int) {
+		if written == 10 {
+			close(reached)
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+				close(timedOut)
+			}
+		}
+	}
+
+	resp := adminRequest(t, http.MethodGet, server.URL+"/admin/dump", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("dump: status %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	lines := 0
+	seen := map[string]bool{}
+	for scanner.Scan() {
+		var doc ArchivedDeck
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("line %d: %v", lines+1, err)
+		}
+		if doc.Status != "active" || len(doc.Upcoming) != 52 || seen[doc.DeckID] {
+			t.Fatalf("line %d: deck %s, %s with %d cards", lines+1, doc.DeckID, doc.Status, len(doc.Upcoming))
+		}
+		seen[doc.DeckID] = true
+		lines++
+		if lines == 10 {
+			<-reached
+			close(release)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-timedOut:
+		t.Fatal("the dump was not waiting for the client after ten decks")
+	default:
+	}
+	if lines != 1000 {
+		t.Errorf("dump has %d lines, want 1000", lines)
+	}
+}
+
+func TestAdminDumpClientGone(t *testing.T) {
+	setupAdminToken(t)
+	newTestServer(t)
+	insertTestDecks(t, 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	last := 0
+	dumpProgress = func(written int) {
+		last = written
+		if written == 100 {
+			cancel()
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/dump", nil).WithContext(ctx)
+	adminDump(httptest.NewRecorder(), req)
+	if last != 100 {
+		t.Errorf("dump went on to %d decks after the client left at 100", last)
+	}
+}
+
+func TestAdminDumpSince(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	old := newTestDeck(t, server, 1)
+	recent := newTestDeck(t, server, 1)
+	past := time.Now().Add(-2 * time.Hour).Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE decks SET updated_at = ? WHERE id = ?", past, old); err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	resp := adminRequest(t, http.MethodGet, server.URL+"/admin/dump?since="+since, "")
+	var docs []ArchivedDeck
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var doc ArchivedDeck
+		if err := decoder.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	resp.Body.Close()
+	if len(docs) != 1 || docs[0].DeckID != recent {
+		t.Errorf("dump since an hour ago = %d decks, want only %s", len(docs), recent)
+	}
+
+	resp = adminRequest(t, http.MethodGet, server.URL+"/admin/dump?since=yesterday", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("dump with an invalid since returned %d", resp.StatusCode)
+	}
+	if resp, err := http.Get(server.URL + "/admin/dump"); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dump without a token: %v, %v", resp.StatusCode, err)
+	}
+}
+
+func TestAdminDumpOnOneReadConnection(t *testing.T) {
+	setupAdminToken(t)
+	newTestServer(t)
+	insertTestDecks(t, dumpBatch+50)
+	readDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { readDB.SetMaxOpenConns(envInt("READ_POOL_SIZE", 4)) })
+
+	// Piles read while the decks cursor is open would wait for a second
+	// connection forever.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	adminDump(rec, httptest.NewRequest(http.MethodGet, "/admin/dump", nil).WithContext(ctx))
+	if ctx.Err() != nil {
+		t.Fatal("the dump did not finish on a single read connection")
+	}
+	if lines := bytes.Count(rec.Body.Bytes(), []byte{'\n'}); lines != dumpBatch+50 {
+		t.Errorf("dump has %d lines, want %d", lines, dumpBatch+50)
+	}
+}
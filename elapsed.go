@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// SessionDuration represents how long ago a deck was created and last drawn
+// from. Decks made before creation times were kept have no elapsed time, and
+// decks never drawn from no time since the last draw.
+type SessionDuration struct {
+	CreatedAt                   string `json:"created_at,omitempty"`
+	Now                         string `json:"now"`
+	ElapsedSeconds              *int64 `json:"elapsed_seconds,omitempty"`
+	ElapsedHuman                string `json:"elapsed_human,omitempty"`
+	LastDrawAt                  string `json:"last_draw_at,omitempty"`
+	ElapsedSinceLastDrawSeconds *int64 `json:"elapsed_since_last_draw_seconds,omitempty"`
+}
+
+// showSessionDuration serves GET /deck/{id}/session-duration. It only reads
+// the stored times and compares them with the clock.
+func showSessionDuration(w http.ResponseWriter, deckID string) {
+	var createdAt, lastDrawAt string
+	row := readDB.QueryRow("SELECT COALESCE(created_at, ''), COALESCE(last_draw_at, '') FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&createdAt, &lastDrawAt); err != nil {
+		writeError(w, errDeckNotFound)
+		return
+	}
+
+	now := clock.Now()
+	since := func(stamp string) (time.Duration, bool) {
+		t, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil {
+			return 0, false
+		}
+		return now.Sub(t), true
+	}
+	seconds := func(d time.Duration) *int64 {
+		s := int64(d / time.Second)
+		return &s
+	}
+
+	duration := SessionDuration{CreatedAt: createdAt, Now: now.UTC().Format(time.RFC3339), LastDrawAt: lastDrawAt}
+	if elapsed, ok := since(createdAt); ok {
+		duration.ElapsedSeconds = seconds(elapsed)
+		duration.ElapsedHuman = elapsed.Round(time.Second).String()
+	}
+	if elapsed, ok := since(lastDrawAt); ok {
+		duration.ElapsedSinceLastDrawSeconds = seconds(elapsed)
+	}
+
+	writeJSON(w, duration)
+}
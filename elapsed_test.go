@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSessionDuration(t *testing.T) {
+	server := newTestServer(t)
+	fake := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	clock = fake
+	t.Cleanup(func() { clock = realClock{} })
+
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	if _, err := db.Exec("UPDATE decks SET created_at = '2024-01-01T09:00:00Z' WHERE id = ?", deckID); err != nil {
+		t.Fatal(err)
+	}
+
+	duration := func() SessionDuration {
+		t.Helper()
+		resp, err := http.Get(base + "/session-duration")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var d SessionDuration
+		json.NewDecoder(resp.Body).Decode(&d)
+		return d
+	}
+
+	d := duration()
+	if d.ElapsedSeconds == nil || *d.ElapsedSeconds != 3600 || d.ElapsedHuman != "1h0m0s" || d.Now != "2024-01-01T10:00:00Z" {
+		t.Errorf("before any draw: %+v", d)
+	}
+	if d.ElapsedSinceLastDrawSeconds != nil {
+		t.Errorf("time since the last draw of an undrawn deck = %d", *d.ElapsedSinceLastDrawSeconds)
+	}
+
+	fetchDeck(t, http.MethodGet, base+"/draw/1")
+	fake.now = fake.now.Add(90 * time.Second)
+	d = duration()
+	if d.ElapsedSinceLastDrawSeconds == nil || *d.ElapsedSinceLastDrawSeconds != 90 || *d.ElapsedSeconds != 3690 {
+		t.Errorf("after a draw: %+v", d)
+	}
+
+	if resp, _ := http.Get(server.URL + "/deck/missing/session-duration"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing deck returned %d", resp.StatusCode)
+	}
+}
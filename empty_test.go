@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestEmptyDeck runs every deck endpoint against a deck with no upcoming
+// cards left.
+func TestEmptyDeck(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/52")
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string // expected in the response body
+	}{
+		{"GET", "", 200, `"remaining":0`},
+		{"GET", "/draw/1", 409, `"code":"DECK_EMPTY"`},
+		{"GET", "/draw/distinct/1", 409, `"code":"DECK_EMPTY"`},
+		{"GET", "/draw/alternate/1", 409, `"code":"DECK_EMPTY"`},
+		{"GET", "/draw/1?withRemaining=true", 409, `"code":"DECK_EMPTY"`},
+		{"GET", "/draw/1?exact=true", 409, "Not enough cards"},
+		{"GET", "/draw/1?lenient=true", 200, `"cards":[],"drawn":0,"remaining":0`},
+		{"GET", "/draw/distinct/1?lenient=true", 200, `"cards":[],"drawn":0`},
+		{"GET", "/draw/alternate/1?lenient=true", 200, `"cards":[],"drawn":0`},
+		{"GET", "/draw/1?split-by-suit=true&lenient=true", 200, `"total_drawn":0`},
+		{"POST", "/draw/1/split-by-suit", 409, `"code":"DECK_EMPTY"`},
+		{"POST", "/draw/1/split-by-suit?lenient=true", 200, `"h":[]`},
+		{"GET", "/shuffle", 200, `"remaining":0`},
+		{"GET", "/show/1/0", 200, "[]"},
+		{"GET", "/show/1/1", 400, "out_of_range"},
+		{"GET", "/upcoming/next-of-suit/h", 200, `"next_position":null`},
+		{"GET", "/upcoming/longest-run-without-suit/h", 200, `"longest_run":0`},
+		{"GET", "/upcoming/fingerprint", 200, `"card_count":0`},
+		{"GET", "/upcoming/count-above-rank/5", 200, `"count":0`},
+		{"GET", "/upcoming/top/1/hashes", 400, "out_of_range"},
+		{"GET", "/entropy", 200, `"cards":0`},
+		{"GET", "/card/ah/remaining-count", 200, `"remaining_in_upcoming":0`},
+		{"GET", "/draw-stream?count=2", 200, ""},
+		{"POST", "/shuffle-deal/2/1", 409, "Not enough cards"},
+		{"POST", "/play/1/to/table", 409, "Not enough cards"},
+		{"POST", "/transact", 409, `"step":0`},
+		{"DELETE", "/cards/ah/upcoming", 200, `"removed":0,"remaining":0`},
+	}
+	for _, tt := range tests {
+		var body io.Reader
+		if tt.path == "/transact" {
+			body = strings.NewReader(`[{"op": "draw"}]`)
+		}
+		req, err := http.NewRequest(tt.method, base+tt.path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status || !strings.Contains(string(got), tt.body) {
+			t.Errorf("%s %s: got %d %s, want %d containing %s", tt.method, tt.path, resp.StatusCode, got, tt.status, tt.body)
+		}
+		if strings.TrimSpace(string(got)) == "null" {
+			t.Errorf("%s %s: got null", tt.method, tt.path)
+		}
+	}
+}
+
+// Card lists are arrays even when nothing was ever stored in them.
+func TestCardListsAreNeverNull(t *testing.T) {
+	for _, cards := range []string{"[]", "null"} {
+		w := httptest.NewRecorder()
+		writeCardList(w, httptest.NewRequest(http.MethodGet, "/", nil), decodeCards(t, cards))
+		if got := strings.TrimSpace(w.Body.String()); got != "[]" {
+			t.Errorf("list stored as %s written as %s, want []", cards, got)
+		}
+	}
+}
+
+func decodeCards(t *testing.T, s string) []Card {
+	t.Helper()
+	var cards []Card
+	if err := json.Unmarshal([]byte(s), &cards); err != nil {
+		t.Fatal(err)
+	}
+	return cards
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+)
+
+// Entropy represents how far the upcoming cards of a deck are from the order
+// they were created in. Cards added after creation are not compared.
+//
+// InversionRatio is the share of card pairs in the wrong relative order: 0
+// for a deck in creation order, about 0.5 for a well shuffled deck and 1 for
+// a reversed one. AverageDisplacement is how many places a card is, on
+// average, from where creation order would put it among the upcoming cards.
+type Entropy struct {
+	DeckID              string  `json:"deck_id"`
+	Cards               int     `json:"cards"`
+	Inversions          int     `json:"inversions"`
+	MaxInversions       int     `json:"max_inversions"`
+	InversionRatio      float64 `json:"inversion_ratio"`
+	AverageDisplacement float64 `json:"average_displacement"`
+}
+
+// showEntropy serves GET /deck/{id}/entropy.
+func showEntropy(w http.ResponseWriter, deckID string) {
+	var originalJSON, upcomingJSON, scoring string
+	err := readDB.QueryRow("SELECT cards, upcoming, COALESCE(scoring, '') FROM decks WHERE id = ?", deckID).Scan(&originalJSON, &upcomingJSON, &scoring)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error reading deck", http.StatusInternalServerError)
+		return
+	}
+
+	var originalCards []Card
+	upcomingCards, err := unmarshalUpcoming([]byte(upcomingJSON), scoring)
+	if err != nil || json.Unmarshal([]byte(originalJSON), &originalCards) != nil {
+		http.Error(w, "Error parsing cards", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, measureEntropy(deckID, originalCards, upcomingCards))
+}
+
+// measureEntropy compares upcoming with the creation order in original.
+// Copies of the same code from several packs are matched in order.
+func measureEntropy(deckID string, original, upcoming []Card) Entropy {
+	positions := make(map[string][]int)
+	for i, card := range original {
+		positions[card.Code] = append(positions[card.Code], i)
+	}
+
+	var order []int
+	for _, card := range upcoming {
+		if p := positions[card.Code]; len(p) > 0 {
+			order = append(order, p[0])
+			positions[card.Code] = p[1:]
+		}
+	}
+
+	entropy := Entropy{DeckID: deckID, Cards: len(order)}
+	n := len(order)
+	if n < 2 {
+		return entropy
+	}
+
+	// rank[i] is where order[i] belongs among the compared cards.
+	displacement := 0
+	for i := range order {
+		rank := 0
+		for j := range order {
+			if order[j] < order[i] {
+				rank++
+			}
+			if j > i && order[j] < order[i] {
+				entropy.Inversions++
+			}
+		}
+		if rank > i {
+			displacement += rank - i
+		} else {
+			displacement += i - rank
+		}
+	}
+
+	entropy.MaxInversions = n * (n - 1) / 2
+	entropy.InversionRatio = float64(entropy.Inversions) / float64(entropy.MaxInversions)
+	entropy.AverageDisplacement = float64(displacement) / float64(n)
+	return entropy
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// TestEntropy measures a deck in creation order, then reversed, then with
+// cards drawn from the reversed deck.
+func TestEntropy(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	if got := fetchEntropy(t, base); got != (Entropy{DeckID: deckID, Cards: 52, MaxInversions: 1326}) {
+		t.Errorf("deck in creation order: %+v", got)
+	}
+
+	upcoming, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := cardCodes(upcoming)
+	slices.Reverse(order)
+	body, _ := json.Marshal(map[string][]string{"order": order})
+	if status := getStatusWithBody(t, http.MethodPatch, base+"/upcoming/reorder", string(body)); status != http.StatusOK {
+		t.Fatalf("reorder returned %d", status)
+	}
+	want := Entropy{DeckID: deckID, Cards: 52, Inversions: 1326, MaxInversions: 1326, InversionRatio: 1, AverageDisplacement: 26}
+	if got := fetchEntropy(t, base); got != want {
+		t.Errorf("reversed deck: got %+v, want %+v", got, want)
+	}
+
+	fetchDeck(t, http.MethodGet, base+"/draw/2")
+	want = Entropy{DeckID: deckID, Cards: 50, Inversions: 1225, MaxInversions: 1225, InversionRatio: 1, AverageDisplacement: 25}
+	if got := fetchEntropy(t, base); got != want {
+		t.Errorf("reversed deck after a draw: got %+v, want %+v", got, want)
+	}
+
+	if status := getStatus(t, http.MethodGet, server.URL+"/deck/missing/entropy"); status != http.StatusNotFound {
+		t.Errorf("missing deck: got %d, want 404", status)
+	}
+}
+
+func fetchEntropy(t *testing.T, base string) Entropy {
+	t.Helper()
+	resp, err := http.Get(base + "/entropy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var entropy Entropy
+	if err := json.NewDecoder(resp.Body).Decode(&entropy); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s/entropy: status %d, %v", base, resp.StatusCode, err)
+	}
+	return entropy
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// DeckEvent represents one change to a deck kept in the event log, such as
+// a reseed, a forced removal, a transaction or a labeled draw. Detail holds
+// the fields of the event type.
+type DeckEvent struct {
+	DeckID     string          `json:"-"`
+	EventType  string          `json:"event_type"`
+	RecordedAt string          `json:"recorded_at"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+func createEventTable() {
+	sqlStmt := `CREATE TABLE IF NOT EXISTS deck_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		deck_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		recorded_at TEXT NOT NULL,
+		detail TEXT NOT NULL -- JSON object
+	);
+	CREATE INDEX IF NOT EXISTS deck_events_deck_id ON deck_events (deck_id, id);`
+	if _, err := db.Exec(sqlStmt); err != nil {
+		log.Fatalf("Error creating event table: %v", err)
+	}
+}
+
+// recordEvent adds an event to the event log of a deck, through the
+// transaction of the change it records when there is one. The caller must
+// hold mu.
+func recordEvent(exec execer, deckID, eventType, recordedAt string, detail any) error {
+	encoded, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec("INSERT INTO deck_events (deck_id, event_type, recorded_at, detail) VALUES (?, ?, ?, ?)",
+		deckID, eventType, recordedAt, string(encoded))
+	return err
+}
+
+// readEvents returns the event log of a deck, oldest first.
+func readEvents(q *sql.DB, deckID string) ([]DeckEvent, error) {
+	rows, err := q.Query("SELECT event_type, recorded_at, detail FROM deck_events WHERE deck_id = ? ORDER BY id", deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []DeckEvent{}
+	for rows.Next() {
+		event := DeckEvent{DeckID: deckID}
+		var detail string
+		if err := rows.Scan(&event.EventType, &event.RecordedAt, &detail); err != nil {
+			return nil, err
+		}
+		event.Detail = json.RawMessage(detail)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// showEvents serves GET /deck/{id}/events, the event log of a deck, oldest
+// first, as a card list. It is for admins only.
+func showEvents(w http.ResponseWriter, r *http.Request, deckID string) {
+	if !deckExists(readDB, deckID) {
+		writeError(w, errDeckNotFound)
+		return
+	}
+	events, err := readEvents(readDB, deckID)
+	if err != nil {
+		http.Error(w, "Error reading event log", http.StatusInternalServerError)
+		return
+	}
+	writeCardList(w, r, events)
+}
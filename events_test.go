@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestForcedRemoveEvent records one forced_remove event per card a removal
+// took out of upcoming, and none for a removal that found nothing.
+func TestForcedRemoveEvent(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 2)
+	base := server.URL + "/deck/" + deckID
+
+	for _, code := range []string{"ah", "ah", "ace_of_spades"} {
+		if status := getStatus(t, http.MethodDelete, base+"/cards/"+code+"/upcoming"); status != http.StatusOK {
+			t.Fatalf("removing %s returned %d", code, status)
+		}
+	}
+
+	resp := adminRequest(t, http.MethodGet, base+"/events", "")
+	defer resp.Body.Close()
+	var events []struct {
+		EventType  string `json:"event_type"`
+		RecordedAt string `json:"recorded_at"`
+		Detail     struct {
+			Code     string `json:"code"`
+			Position *int   `json:"position"`
+		} `json:"detail"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4: %+v", len(events), events)
+	}
+	// Positions are the places the copies held before the removal.
+	for i, code := range []string{"ah", "ah", "as", "as"} {
+		event := events[i]
+		if event.EventType != "forced_remove" || event.RecordedAt == "" || event.Detail.Code != code || event.Detail.Position == nil {
+			t.Errorf("event %d = %+v, want forced_remove of %s", i, event, code)
+		}
+	}
+	if first, second := *events[0].Detail.Position, *events[1].Detail.Position; first >= second {
+		t.Errorf("ah removed from positions %d and %d, want them in deck order", first, second)
+	}
+}
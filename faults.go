@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault injection slows down or fails chosen endpoints on purpose, to show
+// timeouts and retries in class. It is off unless FAULT_INJECTION=true, in
+// which case the admin can configure faults on /admin/faults.
+var faultInjection = os.Getenv("FAULT_INJECTION") == "true"
+
+// maxFaultLatency bounds the delay a fault can add to a request.
+const maxFaultLatency = 60000
+
+// Fault represents the latency and failures injected into one endpoint.
+// Endpoint is an instrumented endpoint name (e.g. "deck.new") or a deck
+// action (e.g. "draw").
+type Fault struct {
+	Endpoint    string  `json:"endpoint"`
+	LatencyMs   int     `json:"latency_ms"`
+	ErrorRate   float64 `json:"error_rate"`
+	ErrorStatus int     `json:"error_status"`
+}
+
+// faultRegistry holds the configured faults and counts the failures they
+// injected, apart from the real ones.
+type faultRegistry struct {
+	mu       sync.Mutex
+	faults   map[string]Fault
+	injected map[string]int64
+}
+
+var faults = &faultRegistry{faults: make(map[string]Fault), injected: make(map[string]int64)}
+
+// match returns the fault configured for a request to endpoint, if any.
+func (f *faultRegistry) match(endpoint string, r *http.Request) (Fault, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.faults) == 0 {
+		return Fault{}, false
+	}
+	if fault, ok := f.faults[endpoint]; ok {
+		return fault, true
+	}
+	if endpoint == "deck" {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/deck/"), "/")
+		if fault, ok := f.faults[pathPart(parts, 1)]; ok {
+			return fault, true
+		}
+	}
+	return Fault{}, false
+}
+
+func (f *faultRegistry) set(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[fault.Endpoint] = fault
+}
+
+// clear removes the fault on endpoint, or every fault if endpoint is empty.
+func (f *faultRegistry) clear(endpoint string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if endpoint == "" {
+		f.faults = make(map[string]Fault)
+		return
+	}
+	delete(f.faults, endpoint)
+}
+
+// Snapshot returns the configured faults sorted by endpoint.
+func (f *faultRegistry) Snapshot() []Fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := make([]Fault, 0, len(f.faults))
+	for _, fault := range f.faults {
+		list = append(list, fault)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Endpoint < list[j].Endpoint })
+	return list
+}
+
+func (f *faultRegistry) recordInjected(endpoint string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.injected[endpoint]++
+}
+
+// injectFault applies the fault configured for endpoint, if any. It reports
+// whether it answered the request itself with an injected failure. Admin
+// endpoints are never faulted, so that a fault can always be cleared.
+func injectFault(endpoint string, w http.ResponseWriter, r *http.Request) bool {
+	if !faultInjection || strings.HasPrefix(endpoint, "admin.") {
+		return false
+	}
+	fault, ok := faults.match(endpoint, r)
+	if !ok {
+		return false
+	}
+
+	if fault.LatencyMs > 0 {
+		timer := time.NewTimer(time.Duration(fault.LatencyMs) * time.Millisecond)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return true
+		case <-timer.C:
+		}
+	}
+	if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+		faults.recordInjected(fault.Endpoint)
+		log.Printf("FAULT injected %d on %s %s from %s", fault.ErrorStatus, r.Method, r.URL.Path, clientIP(r))
+		http.Error(w, "Injected fault", fault.ErrorStatus)
+		return true
+	}
+	return false
+}
+
+func parseFault(r *http.Request) (Fault, error) {
+	v := &Validator{}
+	fault := Fault{ErrorStatus: http.StatusServiceUnavailable}
+	if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+		v.Add("body", "invalid_json", "body must be a JSON fault")
+		return fault, v.Err()
+	}
+	v.Check(fault.Endpoint != "", "endpoint", "missing", "endpoint is required")
+	v.Check(fault.LatencyMs >= 0 && fault.LatencyMs <= maxFaultLatency, "latency_ms", "out_of_range", "latency_ms must be between 0 and %d", maxFaultLatency)
+	v.Check(fault.ErrorRate >= 0 && fault.ErrorRate <= 1, "error_rate", "out_of_range", "error_rate must be between 0 and 1")
+	v.Check(fault.ErrorStatus >= 400 && fault.ErrorStatus <= 599, "error_status", "out_of_range", "error_status must be between 400 and 599")
+	return fault, v.Err()
+}
+
+// adminFaults serves /admin/faults: GET lists the faults, PUT sets the fault
+// of one endpoint and DELETE clears the fault of ?endpoint=, or all of them.
+func adminFaults(w http.ResponseWriter, r *http.Request) {
+	if !faultInjection {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		fault, err := parseFault(r)
+		if err != nil {
+			writeValidationErrors(w, err)
+			return
+		}
+		faults.set(fault)
+		log.Printf("FAULT configured on %s: %d ms, %.2f errors with status %d", fault.Endpoint, fault.LatencyMs, fault.ErrorRate, fault.ErrorStatus)
+	case http.MethodDelete:
+		faults.clear(r.URL.Query().Get("endpoint"))
+		log.Printf("FAULT cleared on %q", r.URL.Query().Get("endpoint"))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, faults.Snapshot())
+}
+
+// writeFaultMetrics exposes the injected failures per endpoint, so that they
+// are not mistaken for real ones.
+func writeFaultMetrics(w http.ResponseWriter) {
+	faults.mu.Lock()
+	defer faults.mu.Unlock()
+
+	endpoints := make([]string, 0, len(faults.injected))
+	for endpoint := range faults.injected {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	fmt.Fprintln(w, "# HELP deck_injected_faults_total Requests failed on purpose by fault injection.")
+	fmt.Fprintln(w, "# TYPE deck_injected_faults_total counter")
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "deck_injected_faults_total{endpoint=%q} %d\n", endpoint, faults.injected[endpoint])
+	}
+}
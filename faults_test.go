@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func adminRequest(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// adminStatus sends an admin request and returns its status code.
+func adminStatus(t *testing.T, method, url string) int {
+	t.Helper()
+	resp := adminRequest(t, method, url, "")
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// endpointRequests returns the number of requests metrics counted for
+// endpoint.
+func endpointRequests(endpoint string) int64 {
+	for _, stat := range metrics.Snapshot() {
+		if stat.Endpoint == endpoint {
+			return stat.Requests
+		}
+	}
+	return 0
+}
+
+func TestFaultInjection(t *testing.T) {
+	savedToken, savedEnabled := adminToken, faultInjection
+	adminToken, faultInjection = "secret", true
+	t.Cleanup(func() {
+		adminToken, faultInjection = savedToken, savedEnabled
+		faults.clear("")
+	})
+
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	draw := server.URL + "/deck/" + deckID + "/draw/1"
+
+	resp := adminRequest(t, http.MethodPut, server.URL+"/admin/faults", `{"endpoint": "draw", "error_rate": 1, "error_status": 503}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /admin/faults returned %d", resp.StatusCode)
+	}
+
+	requests := endpointRequests("deck")
+	resp, err := http.Get(draw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("faulted draw returned %d, want 503", resp.StatusCode)
+	}
+	if got := endpointRequests("deck"); got != requests {
+		t.Errorf("faulted draw counted as %d deck requests, want none", got-requests)
+	}
+	if deck := fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID); deck.Remaining != 52 {
+		t.Errorf("faulted draw left %d cards, want 52", deck.Remaining)
+	}
+
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `deck_injected_faults_total{endpoint="draw"} 1`) {
+		t.Errorf("metrics do not count the injected fault:\n%s", body)
+	}
+
+	resp = adminRequest(t, http.MethodDelete, server.URL+"/admin/faults", "")
+	resp.Body.Close()
+	if deck := fetchDeck(t, http.MethodGet, draw); len(deck.Cards) != 1 {
+		t.Errorf("draw after clearing the fault returned %d cards, want 1", len(deck.Cards))
+	}
+}
+
+func TestFaultInjectionDisabled(t *testing.T) {
+	savedToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = savedToken })
+
+	server := newTestServer(t)
+	resp := adminRequest(t, http.MethodPut, server.URL+"/admin/faults", `{"endpoint": "draw", "error_rate": 1}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("PUT /admin/faults without FAULT_INJECTION returned %d, want 404", resp.StatusCode)
+	}
+}
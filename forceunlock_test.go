@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestForceUnlock(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	unlock := server.URL + "/admin/deck/" + deckID + "/force-unlock"
+
+	if status := adminStatus(t, http.MethodPost, base+"/freeze"); status != http.StatusOK {
+		t.Fatalf("freeze returned %d", status)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE decks SET locks_at = ? WHERE id = ?", past, deckID); err != nil {
+		t.Fatal(err)
+	}
+	if status := getStatus(t, http.MethodGet, base+"/draw/1"); status != http.StatusLocked {
+		t.Fatalf("draw from a stuck deck returned %d", status)
+	}
+
+	if status := getStatus(t, http.MethodPost, unlock); status != http.StatusForbidden {
+		t.Errorf("force-unlock without a token returned %d", status)
+	}
+	resp := adminRequest(t, http.MethodGet, unlock, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET force-unlock returned %d", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, http.MethodPost, unlock, "")
+	var result ForceUnlock
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	want := ForceUnlock{DeckID: deckID, WasFrozen: true, WasLocked: true, LocksAt: past}
+	if resp.StatusCode != http.StatusOK || result != want {
+		t.Fatalf("force-unlock: status %d, %+v", resp.StatusCode, result)
+	}
+	if _, info := deckStatus(t, base); info.Frozen || info.Locked || info.LocksAt != "" {
+		t.Errorf("deck after force-unlock = %+v", info)
+	}
+	if status := getStatus(t, http.MethodGet, base+"/draw/1"); status != http.StatusOK {
+		t.Errorf("draw after force-unlock returned %d", status)
+	}
+
+	// Unlocking a deck that is not stuck changes nothing.
+	resp = adminRequest(t, http.MethodPost, unlock, "")
+	var again ForceUnlock
+	json.NewDecoder(resp.Body).Decode(&again)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || again != (ForceUnlock{DeckID: deckID}) {
+		t.Errorf("second force-unlock: status %d, %+v", resp.StatusCode, again)
+	}
+
+	for _, url := range []string{server.URL + "/admin/deck/missing/force-unlock", server.URL + "/admin/deck/" + deckID + "/unlock"} {
+		resp = adminRequest(t, http.MethodPost, url, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("POST %s returned %d", url, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"TPReseau/deck"
+)
+
+var errGameOver = errors.New("Game over: no more cards are dealt")
+
+// GameRule represents how POST /deck/{id}/deal/auto deals for a game. Cards
+// go one at a time to each player in turn until every hand holds HandSize
+// cards; the game then moves from the deal phase to the play phase, where a
+// player whose turn it is draws one card if Draws is set. Without Draws the
+// game is over once the hands are dealt.
+type GameRule struct {
+	Players  int // players when the game does not say
+	HandSize int
+	Draws    bool
+}
+
+// gameRules maps a game name to its rules.
+var gameRules = map[string]GameRule{
+	"holdem": {Players: 2, HandSize: 2},
+	"bridge": {Players: 4, HandSize: 13},
+	"gofish": {Players: 2, HandSize: 7, Draws: true},
+	"rummy":  {Players: 2, HandSize: 10, Draws: true},
+}
+
+// Phases of a game.
+const (
+	phaseDeal = "deal"
+	phasePlay = "play"
+	phaseOver = "over"
+)
+
+// GameState represents where a game dealt by POST /deck/{id}/deal/auto
+// stands. Turn is the 1-based player who gets the next card and Hands the
+// number of cards each player has been dealt. Deal is the deal number the
+// cards are recorded under in the drawn history.
+type GameState struct {
+	Game  string `json:"game"`
+	Phase string `json:"phase"`
+	Turn  int    `json:"turn"`
+	Hands []int  `json:"hands"`
+	Deal  int    `json:"deal"`
+}
+
+// AutoDeal represents the outcome of one step of POST /deck/{id}/deal/auto.
+type AutoDeal struct {
+	DeckID    string    `json:"deck_id"`
+	Card      Card      `json:"card"`
+	Player    int       `json:"player"`
+	State     GameState `json:"state"`
+	Remaining int       `json:"remaining"`
+}
+
+func gameNames() []string {
+	names := make([]string, 0, len(gameRules))
+	for name := range gameRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newGameState starts a game with players players, dealing under deal.
+func newGameState(game string, players, deal int) GameState {
+	return GameState{Game: game, Phase: phaseDeal, Turn: 1, Hands: make([]int, players), Deal: deal}
+}
+
+// advance records that the player whose turn it was got a card and moves
+// the turn and phase on.
+func (s *GameState) advance(rule GameRule) {
+	s.Hands[s.Turn-1]++
+	s.Turn = s.Turn%len(s.Hands) + 1
+	if s.Phase != phaseDeal {
+		return
+	}
+	for _, n := range s.Hands {
+		if n < rule.HandSize {
+			return
+		}
+	}
+	s.Phase = phasePlay
+	if !rule.Draws {
+		s.Phase = phaseOver
+	}
+}
+
+// loadGameState returns the game of a deck, or ok false when none started.
+func loadGameState(exec execer, deckID string) (state GameState, ok bool) {
+	var stateJSON string
+	exec.QueryRow("SELECT COALESCE(game_state, '') FROM decks WHERE id = ?", deckID).Scan(&stateJSON)
+	if stateJSON == "" || json.Unmarshal([]byte(stateJSON), &state) != nil {
+		return GameState{}, false
+	}
+	return state, true
+}
+
+// dealAuto serves POST /deck/{id}/deal/auto, which deals one card to the
+// player whose turn it is and advances the game. The first call starts the
+// game named by ?game= with ?players= players, the rule's default if not
+// given; later calls may leave both out.
+func dealAuto(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	query := r.URL.Query()
+	game := v.OneOf("game", query.Get("game"), gameNames())
+	players := v.OptionalInt("players", query.Get("players"), 0, 1, maxPlayers)
+	v.Check(players == 0 || game != "", "players", "requires_game", "players requires game")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+	upcomingCards, drawnHistory, err := readDeckState(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	gameState, started := loadGameState(db, deckID)
+	switch {
+	case !started && game == "":
+		v.Add("game", "missing", "game is required to start a game")
+	case started && game != "" && game != gameState.Game:
+		v.Add("game", "conflict", "the deck is playing %s", gameState.Game)
+	case started && players != 0 && players != len(gameState.Hands):
+		v.Add("players", "conflict", "the game has %d players", len(gameState.Hands))
+	}
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+	if !started {
+		rule := gameRules[game]
+		if players == 0 {
+			players = rule.Players
+		}
+		gameState = newGameState(game, players, lastDeal(drawnHistory)+1)
+	}
+	if gameState.Phase == phaseOver {
+		http.Error(w, errGameOver.Error(), http.StatusConflict)
+		return
+	}
+
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	dealt, err := deck.DrawN(&state, 1, clock.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	entry := &state.Drawn[len(state.Drawn)-1]
+	entry.Deal, entry.Seat = gameState.Deal, gameState.Turn
+	player := gameState.Turn
+	gameState.advance(gameRules[gameState.Game])
+	stateJSON, err := json.Marshal(gameState)
+	if err != nil {
+		http.Error(w, "Error updating game", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	if err := paceDraw(tx, deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := writeDeckState(tx, deckID, state.Upcoming, state.Drawn); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE decks SET game_state = ? WHERE id = ?", string(stateJSON), deckID); err != nil {
+		http.Error(w, "Error updating game", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, AutoDeal{DeckID: deckID, Card: dealt[0], Player: player, State: gameState, Remaining: len(state.Upcoming)})
+}
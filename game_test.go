@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDealAuto(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	deal := func(query string) (int, AutoDeal) {
+		t.Helper()
+		resp, err := http.Post(base+"/deal/auto"+query, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var d AutoDeal
+		json.NewDecoder(resp.Body).Decode(&d)
+		return resp.StatusCode, d
+	}
+
+	if status, _ := deal(""); status != http.StatusBadRequest {
+		t.Errorf("deal without a game returned %d", status)
+	}
+	if status, _ := deal("?game=chess"); status != http.StatusBadRequest {
+		t.Errorf("deal of an unknown game returned %d", status)
+	}
+
+	var players []int
+	var last AutoDeal
+	for i := 0; i < 6; i++ {
+		query := ""
+		if i == 0 {
+			query = "?game=holdem&players=3"
+		}
+		status, d := deal(query)
+		if status != http.StatusOK {
+			t.Fatalf("deal %d returned %d", i+1, status)
+		}
+		players = append(players, d.Player)
+		last = d
+	}
+	if want := []int{1, 2, 3, 1, 2, 3}; !reflect.DeepEqual(players, want) {
+		t.Errorf("cards went to players %v, want %v", players, want)
+	}
+	want := GameState{Game: "holdem", Phase: phaseOver, Turn: 1, Hands: []int{2, 2, 2}, Deal: 1}
+	if !reflect.DeepEqual(last.State, want) || last.Remaining != 46 {
+		t.Errorf("state after the deal = %+v, %d remaining", last.State, last.Remaining)
+	}
+	if status, _ := deal(""); status != http.StatusConflict {
+		t.Errorf("deal after the game is over returned %d", status)
+	}
+	if status, _ := deal("?game=bridge"); status != http.StatusBadRequest {
+		t.Errorf("deal of another game returned %d", status)
+	}
+
+	drawn, _ := loadDrawnCards(deckID)
+	for i, entry := range drawn {
+		if entry.Deal != 1 || entry.Seat != players[i] {
+			t.Errorf("history entry %d: deal %d seat %d, want deal 1 seat %d", i, entry.Deal, entry.Seat, players[i])
+		}
+	}
+
+	// Clearing the drawn cards takes the hands away and ends the game.
+	if _, err := http.Post(base+"/clear-drawn", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadGameState(db, deckID); ok {
+		t.Fatal("clear-drawn kept the game")
+	}
+
+	// A game with draws keeps dealing to the player whose turn it is.
+	for i := 0; i < 14; i++ {
+		query := ""
+		if i == 0 {
+			query = "?game=gofish"
+		}
+		_, last = deal(query)
+	}
+	if last.State.Phase != phasePlay || last.State.Deal != 1 {
+		t.Errorf("go fish after the deal = %+v", last.State)
+	}
+	if status, d := deal(""); status != http.StatusOK || d.Player != 1 || d.State.Hands[0] != 8 {
+		t.Errorf("draw in play: status %d, %+v", status, d)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// deckDependents lists the tables whose rows belong to a deck, with the
+// column naming the deck. deleteDeck, deleteOrphans and the consistency
+// check all go through it, so a new table only needs adding here. The change
+// feed is left out: a deleted deck keeps its tombstone on purpose.
+var deckDependents = []struct {
+	Table, Column string
+}{
+	{"piles", "deck_id"},
+	{"shoe_tables", "shoe_id"},
+	{"pool_decks", "deck_id"},
+	{"shuffle_log", "deck_id"},
+	{"deck_events", "deck_id"},
+	{"deck_cards", "deck_id"},
+}
+
+// ConsistencyReport represents the rows of GET /admin/consistency that
+// belong to no deck, by table.
+type ConsistencyReport struct {
+	Orphans map[string]int64 `json:"orphans"`
+	Clean   bool             `json:"clean"`
+}
+
+// deleteDeck deletes a deck and every row that belongs to it, through the
+// transaction of the caller so that they go together. It returns
+// errDeckNotFound when there is no such deck. The caller must hold mu.
+func deleteDeck(exec execer, deckID string) error {
+	for _, dep := range deckDependents {
+		if _, err := exec.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", dep.Table, dep.Column), deckID); err != nil {
+			return err
+		}
+	}
+	result, err := exec.Exec("DELETE FROM decks WHERE id = ?", deckID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errDeckNotFound
+	}
+	invalidateUpcoming(deckID)
+	return nil
+}
+
+// deleteOrphans deletes the rows that belong to no deck, after decks were
+// deleted in bulk. The caller must hold mu.
+func deleteOrphans(exec execer) error {
+	for _, dep := range deckDependents {
+		if _, err := exec.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s NOT IN (SELECT id FROM decks)", dep.Table, dep.Column)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countOrphans counts the rows of each dependent table that belong to no
+// deck.
+func countOrphans() (ConsistencyReport, error) {
+	report := ConsistencyReport{Orphans: map[string]int64{}, Clean: true}
+	for _, dep := range deckDependents {
+		var n int64
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s NOT IN (SELECT id FROM decks)", dep.Table, dep.Column)
+		if err := readDB.QueryRow(query).Scan(&n); err != nil {
+			return ConsistencyReport{}, err
+		}
+		report.Orphans[dep.Table] = n
+		report.Clean = report.Clean && n == 0
+	}
+	return report, nil
+}
+
+// removeDeck serves DELETE /deck/{id}, for admins only.
+func removeDeck(w http.ResponseWriter, deckID string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error deleting deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	if err := deleteDeck(tx, deckID); err == errDeckNotFound {
+		writeError(w, err)
+		return
+	} else if err != nil {
+		http.Error(w, "Error deleting deck", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error deleting deck", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// showConsistency serves GET /admin/consistency.
+func showConsistency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	report, err := countOrphans()
+	if err != nil {
+		http.Error(w, "Error checking consistency", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
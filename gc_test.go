@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func consistency(t *testing.T, server string) ConsistencyReport {
+	t.Helper()
+	resp := adminRequest(t, http.MethodGet, server+"/admin/consistency", "")
+	defer resp.Body.Close()
+	var report ConsistencyReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	return report
+}
+
+// dependentRows counts the rows of each dependent table that belong to deckID.
+func dependentRows(t *testing.T, deckID string) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for _, dep := range deckDependents {
+		var n int
+		if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", dep.Table, dep.Column), deckID).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		counts[dep.Table] = n
+	}
+	return counts
+}
+
+func TestDeleteDeckCascades(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	// One of everything.
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID+"/shuffle")
+	if resp, err := http.Post(server.URL+"/deck/"+deckID+"/play/2/to/discard", "", nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("play to pile: %v", err)
+	}
+	if resp, err := http.Post(server.URL+"/shoe/"+deckID+"/table", "", nil); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("shoe table: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO pool_decks (pool_name, deck_id) VALUES ('class', ?)", deckID); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordEvent(db, deckID, "test", now(), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	for table, n := range dependentRows(t, deckID) {
+		if n == 0 {
+			t.Fatalf("the deck has no %s rows to delete", table)
+		}
+	}
+
+	if status := getStatus(t, http.MethodDelete, server.URL+"/deck/"+deckID); status != http.StatusForbidden {
+		t.Fatalf("delete without a token returned %d, want 403", status)
+	}
+	if !deckExists(db, deckID) {
+		t.Fatal("delete without a token removed the deck")
+	}
+	resp := adminRequest(t, http.MethodDelete, server.URL+"/deck/"+deckID, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete returned %d", resp.StatusCode)
+	}
+	for table, n := range dependentRows(t, deckID) {
+		if n != 0 {
+			t.Errorf("%d %s rows left after the delete", n, table)
+		}
+	}
+	if report := consistency(t, server.URL); !report.Clean {
+		t.Errorf("consistency after the delete = %+v", report)
+	}
+	resp = adminRequest(t, http.MethodDelete, server.URL+"/deck/"+deckID, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("second delete returned %d", resp.StatusCode)
+	}
+}
+
+func TestConsistencyReportsOrphans(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	for _, stmt := range []string{
+		"INSERT INTO piles (deck_id, name, cards) VALUES ('gone', 'discard', '[]')",
+		"INSERT INTO shuffle_log (deck_id, shuffled_at, kind, seed, before) VALUES ('gone', '', 'shuffle', 1, '[]')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report := consistency(t, server.URL)
+	if report.Clean || report.Orphans["piles"] != 1 || report.Orphans["shuffle_log"] != 1 || report.Orphans["shoe_tables"] != 0 {
+		t.Errorf("consistency = %+v", report)
+	}
+
+	// The purge of empty decks sweeps orphans along with the decks.
+	if _, err := purgeEmptyDecks(); err != nil {
+		t.Fatal(err)
+	}
+	if report := consistency(t, server.URL); !report.Clean {
+		t.Errorf("consistency after a purge = %+v", report)
+	}
+}
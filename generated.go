@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Cards with no static image, such as custom cards added by code, get a
+// simple SVG generated on the fly at /static/generated/{code}.svg.
+const (
+	generatedImagePrefix = "/static/generated/"
+	maxGeneratedCode     = 32   // longest code rendered, in characters
+	maxGeneratedCache    = 1024 // rendered images kept in memory
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$`)
+
+// envColor reads a "#rgb" or "#rrggbb" color from the environment, falling
+// back to def, so that a bad setting never ends up inside the SVG.
+func envColor(name, def string) string {
+	if c := os.Getenv(name); colorPattern.MatchString(c) {
+		return c
+	}
+	return def
+}
+
+// Colors of the generated images: hearts and diamonds are drawn in red,
+// everything else in black.
+var (
+	cardRedColor        = envColor("CARD_COLOR_RED", "#c00000")
+	cardBlackColor      = envColor("CARD_COLOR_BLACK", "#000000")
+	cardBackgroundColor = envColor("CARD_COLOR_BACKGROUND", "#ffffff")
+)
+
+var generatedImages = struct {
+	sync.Mutex
+	svgs map[string][]byte
+}{svgs: make(map[string][]byte)}
+
+// generatedImage returns the URL of the generated image of code.
+func generatedImage(code string) string {
+	return generatedImagePrefix + url.PathEscape(code) + ".svg"
+}
+
+// svgText escapes s for use as SVG text. Characters that are not allowed in
+// XML are replaced.
+func svgText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// renderCardSVG draws a card with its rank in the corners and its suit
+// symbol in the middle. A code that is not a rank and a suit is shown whole,
+// in the corners and in the middle.
+func renderCardSVG(code string) []byte {
+	corner, center, color := code, code, cardBlackColor
+	if runes := []rune(code); len(runes) >= 2 {
+		rank, suit := string(runes[:len(runes)-1]), string(runes[len(runes)-1])
+		if symbol, ok := suitSymbols[suit]; ok {
+			corner, center = strings.ToUpper(rank), symbol
+			if suit == "h" || suit == "d" {
+				color = cardRedColor
+			}
+		}
+	}
+	corner, center = svgText(corner), svgText(center)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="169" height="244" viewBox="0 0 169 244">`+"\n")
+	fmt.Fprintf(&b, `<rect x="1" y="1" width="167" height="242" rx="10" fill="%s" stroke="%s" stroke-width="2"/>`+"\n", cardBackgroundColor, cardBlackColor)
+	fmt.Fprintf(&b, `<g fill="%s" font-family="sans-serif">`+"\n", color)
+	fmt.Fprintf(&b, `<text x="12" y="30" font-size="22">%s</text>`+"\n", corner)
+	fmt.Fprintf(&b, `<text x="157" y="214" font-size="22" text-anchor="end" transform="rotate(180 157 214)">%s</text>`+"\n", corner)
+	fmt.Fprintf(&b, `<text x="84.5" y="122" font-size="48" text-anchor="middle" dominant-baseline="middle">%s</text>`+"\n", center)
+	fmt.Fprintf(&b, "</g>\n</svg>\n")
+	return b.Bytes()
+}
+
+// cachedCardSVG renders the image of code once and keeps it in memory. Once
+// the cache is full, new codes are rendered on every request.
+func cachedCardSVG(code string) []byte {
+	generatedImages.Lock()
+	defer generatedImages.Unlock()
+
+	if svg, ok := generatedImages.svgs[code]; ok {
+		return svg
+	}
+	svg := renderCardSVG(code)
+	if len(generatedImages.svgs) < maxGeneratedCache {
+		generatedImages.svgs[code] = svg
+	}
+	return svg
+}
+
+// serveGeneratedImage serves GET /static/generated/{code}.svg.
+func serveGeneratedImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, generatedImagePrefix), ".svg")
+	if !ok || code == "" || !utf8.ValidString(code) || utf8.RuneCountInString(code) > maxGeneratedCode {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Write(cachedCardSVG(code))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRenderCardSVGEscapesCode(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		notWant string
+	}{
+		{"ah", ">A<", ""},
+		{"10s", ">♠<", ""},
+		{"10♠", ">10♠<", ""},
+		{"<script>alert(1)</script>", "&lt;script&gt;", "<script>"},
+		{`"/><image href="x`, "&#34;/&gt;&lt;image", "<image"},
+		{"🂡dragon", ">🂡dragon<", ""},
+		{"bad\x00code", "bad\uFFFDcode", "\x00"},
+	}
+	for _, tt := range tests {
+		svg := string(renderCardSVG(tt.code))
+		if !strings.Contains(svg, tt.want) {
+			t.Errorf("%q: SVG does not contain %q:\n%s", tt.code, tt.want, svg)
+		}
+		if tt.notWant != "" && strings.Contains(svg, tt.notWant) {
+			t.Errorf("%q: SVG contains %q:\n%s", tt.code, tt.notWant, svg)
+		}
+		if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+			t.Errorf("%q: SVG is not well-formed: %v", tt.code, err)
+		}
+	}
+}
+
+func TestServeGeneratedImage(t *testing.T) {
+	server := newTestServer(t)
+
+	if got := cardImage("<b>"); got != "/static/generated/%3Cb%3E.svg" {
+		t.Fatalf("cardImage(%q) = %q", "<b>", got)
+	}
+	resp, err := http.Get(server.URL + cardImage("<b>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("got %d %q, want an SVG", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if strings.Contains(string(body), "<b>") || !strings.Contains(string(body), "&lt;b&gt;") {
+		t.Errorf("code is not escaped:\n%s", body)
+	}
+
+	resp, err = http.Get(server.URL + generatedImagePrefix + url.PathEscape(strings.Repeat("x", maxGeneratedCode+1)) + ".svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("overlong code returned %d, want 404", resp.StatusCode)
+	}
+}
+
+// Custom cards added by code keep their code through storage and draws and
+// point at their generated image.
+func TestAddCustomCards(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	custom := []string{"dragon", "<b>", "🂡joker"}
+	query := url.Values{"cards": {"ah"}, "custom": {strings.Join(custom, ",")}}
+	if status := getStatus(t, http.MethodPost, base+"/add?"+query.Encode()); status != http.StatusOK {
+		t.Fatalf("add returned %d", status)
+	}
+
+	drawn := fetchDeck(t, http.MethodGet, base+"/draw/56").Cards
+	if len(drawn) != 56 {
+		t.Fatalf("drew %d cards, want 56", len(drawn))
+	}
+	if drawn[52].Code != "ah" {
+		t.Errorf("first added card is %q, want ah", drawn[52].Code)
+	}
+	for i, code := range custom {
+		card := drawn[53+i]
+		if card.Code != code || card.Suit != "" || card.Image != generatedImage(code) {
+			t.Errorf("custom card %d drawn as %+v", i, card)
+			continue
+		}
+		resp, err := http.Get(server.URL + card.Image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || xml.Unmarshal(body, new(struct{})) != nil {
+			t.Errorf("image of %q: status %d, body %s", code, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// boardStreets are the streets a draw can be labeled with, in play order.
+var boardStreets = []string{"flop", "turn", "river"}
+
+// lastDeal returns the number of the last deal in a drawn history, or 0.
+func lastDeal(history []DrawnCard) int {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Deal > 0 {
+			return history[i].Deal
+		}
+	}
+	return 0
+}
+
+// PokerHand represents one hand rebuilt from a drawn history: the hole cards
+// of each seat from a deal, and the board cards of the draws labeled with a
+// street that followed it.
+type PokerHand struct {
+	Number    int
+	StartedAt string
+	Hole      [][]string          // card codes of seat i+1
+	Board     map[string][]string // card codes by street
+}
+
+// pokerHands groups a drawn history into hands. Each deal starts a hand;
+// draws before the first deal and draws without a street are left out.
+func pokerHands(history []DrawnCard) []PokerHand {
+	var hands []PokerHand
+	for _, entry := range history {
+		if entry.Deal > 0 && (len(hands) == 0 || entry.Deal != hands[len(hands)-1].Number) {
+			hands = append(hands, PokerHand{Number: entry.Deal, StartedAt: entry.Time, Board: map[string][]string{}})
+		}
+		if len(hands) == 0 {
+			continue
+		}
+		hand := &hands[len(hands)-1]
+		switch {
+		case entry.Deal == hand.Number && entry.Seat > 0:
+			for len(hand.Hole) < entry.Seat {
+				hand.Hole = append(hand.Hole, nil)
+			}
+			hand.Hole[entry.Seat-1] = append(hand.Hole[entry.Seat-1], entry.Code)
+		case entry.Street != "":
+			hand.Board[entry.Street] = append(hand.Board[entry.Street], entry.Code)
+		}
+	}
+	return hands
+}
+
+// pokerCard writes a card code the way hand histories do, e.g. Th for 10h.
+// Cards with no such notation, like jokers, are written ??.
+func pokerCard(code string) string {
+	ranks := map[string]string{"10": "T", "j": "J", "q": "Q", "k": "K", "a": "A"}
+	if len(code) < 2 || isJoker(code) {
+		return "??"
+	}
+	rank, suit := code[:len(code)-1], code[len(code)-1:]
+	if r, ok := ranks[rank]; ok {
+		rank = r
+	} else if len(rank) != 1 || rank < "2" || rank > "9" {
+		return "??"
+	}
+	if !strings.Contains("hdcs", suit) {
+		return "??"
+	}
+	return rank + suit
+}
+
+func pokerCards(codes []string, sep string) string {
+	cards := make([]string, len(codes))
+	for i, code := range codes {
+		cards[i] = pokerCard(code)
+	}
+	return strings.Join(cards, sep)
+}
+
+// writeHandHistoryText writes hands in the text layout of PokerStars hand
+// histories. There are no bets in a deck, so only the cards are written.
+func writeHandHistoryText(w io.Writer, deckID string, hands []PokerHand) {
+	for _, hand := range hands {
+		startedAt := hand.StartedAt
+		if t, err := time.Parse(time.RFC3339, hand.StartedAt); err == nil {
+			startedAt = t.UTC().Format("2006/01/02 15:04:05 UTC")
+		}
+		fmt.Fprintf(w, "Hand #%d: Hold'em No Limit - %s\n", hand.Number, startedAt)
+		fmt.Fprintf(w, "Table 'deck %s' %d-max\n", deckID, len(hand.Hole))
+		for seat := range hand.Hole {
+			fmt.Fprintf(w, "Seat %d: Player %d\n", seat+1, seat+1)
+		}
+		fmt.Fprintln(w, "*** HOLE CARDS ***")
+		for seat, cards := range hand.Hole {
+			fmt.Fprintf(w, "Dealt to Player %d [%s]\n", seat+1, pokerCards(cards, " "))
+		}
+
+		var board []string
+		for _, street := range boardStreets {
+			cards := hand.Board[street]
+			if len(cards) == 0 {
+				continue
+			}
+			if len(board) == 0 {
+				fmt.Fprintf(w, "*** %s *** [%s]\n", strings.ToUpper(street), pokerCards(cards, " "))
+			} else {
+				fmt.Fprintf(w, "*** %s *** [%s] [%s]\n", strings.ToUpper(street), pokerCards(board, " "), pokerCards(cards, " "))
+			}
+			board = append(board, cards...)
+		}
+		fmt.Fprintln(w, "*** SUMMARY ***")
+		if len(board) > 0 {
+			fmt.Fprintf(w, "Board [%s]\n", pokerCards(board, " "))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// PHHHand represents a hand in the poker hand history (PHH) format. Every
+// action is a deal: "d dh p1 AhKd" gives hole cards to player 1 and
+// "d db 7h8s9d" puts cards on the board.
+type PHHHand struct {
+	Variant string   `json:"variant"`
+	Table   string   `json:"table"`
+	Hand    int      `json:"hand"`
+	Time    string   `json:"time"`
+	Players []string `json:"players"`
+	Actions []string `json:"actions"`
+}
+
+func phhHands(deckID string, hands []PokerHand) []PHHHand {
+	result := make([]PHHHand, 0, len(hands))
+	for _, hand := range hands {
+		phh := PHHHand{Variant: "NT", Table: deckID, Hand: hand.Number, Time: hand.StartedAt, Players: []string{}, Actions: []string{}}
+		for seat, cards := range hand.Hole {
+			phh.Players = append(phh.Players, fmt.Sprintf("Player %d", seat+1))
+			phh.Actions = append(phh.Actions, fmt.Sprintf("d dh p%d %s", seat+1, pokerCards(cards, "")))
+		}
+		for _, street := range boardStreets {
+			if cards := hand.Board[street]; len(cards) > 0 {
+				phh.Actions = append(phh.Actions, "d db "+pokerCards(cards, ""))
+			}
+		}
+		result = append(result, phh)
+	}
+	return result
+}
+
+// exportHandHistory serves GET /deck/{id}/export/handhistory?format=text|phh.
+// Hands come from POST /deck/{id}/shuffle-deal, and their board from the
+// draws made with ?street=flop, turn or river until the next deal.
+func exportHandHistory(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	format := v.OneOf("format", r.URL.Query().Get("format"), []string{"text", "phh"})
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	drawnCards, err := loadDrawnCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	hands := pokerHands(drawnCards)
+
+	if format == "phh" {
+		writeJSON(w, phhHands(deckID, hands))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeHandHistoryText(w, deckID, hands)
+}
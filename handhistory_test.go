@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// scriptedHands is the drawn history of two hands: a heads-up hand played to
+// the river, then a three-handed deal that includes a joker.
+func scriptedHands() []DrawnCard {
+	at := "2024-03-01T12:00:00Z"
+	entry := func(code string, deal, seat int, street string) DrawnCard {
+		return DrawnCard{Code: code, Time: at, Deal: deal, Seat: seat, Street: street}
+	}
+	return []DrawnCard{
+		entry("5c", 0, 0, ""),
+		entry("ah", 1, 1, ""), entry("7c", 1, 2, ""), entry("kd", 1, 1, ""), entry("7d", 1, 2, ""),
+		entry("7h", 0, 0, "flop"), entry("8s", 0, 0, "flop"), entry("9d", 0, 0, "flop"),
+		entry("4c", 0, 0, ""),
+		entry("10c", 0, 0, "turn"),
+		entry("2s", 0, 0, "river"),
+		entry("joker", 2, 1, ""), entry("qs", 2, 2, ""), entry("3h", 2, 3, ""),
+	}
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	want, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\n got:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestHandHistoryText(t *testing.T) {
+	var out bytes.Buffer
+	writeHandHistoryText(&out, "deck-1", pokerHands(scriptedHands()))
+	checkGolden(t, "handhistory.txt", out.Bytes())
+}
+
+func TestHandHistoryPHH(t *testing.T) {
+	out, err := json.MarshalIndent(phhHands("deck-1", pokerHands(scriptedHands())), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "handhistory.phh.json", append(out, '\n'))
+}
+
+func TestPokerCard(t *testing.T) {
+	for code, want := range map[string]string{"ah": "Ah", "10s": "Ts", "2d": "2d", "qc": "Qc", "joker": "??", "joker-red": "??", "zz": "??", "1h": "??"} {
+		if got := pokerCard(code); got != want {
+			t.Errorf("pokerCard(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+// A hand played through the API comes out of the export.
+func TestExportHandHistory(t *testing.T) {
+	server := newTestServer(t)
+	base := server.URL + "/deck/" + newTestDeck(t, server, 1)
+
+	resp, err := http.Post(base+"/shuffle-deal/2/2", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	flop := fetchDeck(t, http.MethodGet, base+"/draw/3?street=flop")
+	fetchDeck(t, http.MethodGet, base+"/draw/1?street=turn")
+
+	resp, err = http.Get(base + "/export/handhistory?format=phh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hands []PHHHand
+	err = json.NewDecoder(resp.Body).Decode(&hands)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hands) != 1 || len(hands[0].Players) != 2 || len(hands[0].Actions) != 4 {
+		t.Fatalf("hands = %+v", hands)
+	}
+	if want := "d db " + pokerCards(cardCodes(flop.Cards), ""); hands[0].Actions[2] != want {
+		t.Errorf("flop action = %q, want %q", hands[0].Actions[2], want)
+	}
+
+	resp, err = http.Get(base + "/export/handhistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(text), "*** TURN ***") || strings.Contains(string(text), "*** RIVER ***") {
+		t.Errorf("text export:\n%s", text)
+	}
+
+	for _, url := range []string{base + "/export/handhistory?format=xml", base + "/draw/1?street=preflop"} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s returned %d, want 400", url, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,799 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"TPReseau/deck"
+)
+
+// routes returns the mux serving every endpoint of the API.
+func routes() *http.ServeMux {
+	mux := newRouteTable()
+	mux.HandleFunc("/deck/new/", instrument("deck.new", createDeck))
+	mux.HandleFunc("/deck/", instrument("deck", handleDeckRequests))
+	mux.HandleFunc("/decks", instrument("decks", requireAdmin(listDecks)))
+	mux.HandleFunc("/decks/changes", instrument("decks.changes", requireAdmin(listDeckChanges)))
+	mux.HandleFunc("/decks/with", instrument("decks.with", requireAdmin(listDecksWithCard)))
+	mux.HandleFunc("/decks/draw", instrument("decks.draw", drawMultipleDecks))
+	mux.HandleFunc("/pool/", instrument("pool", handlePoolRequests))
+	mux.HandleFunc("/shoe/", instrument("shoe", handleShoeRequests))
+	mux.HandleFunc("/cards/", instrument("cards.locate", locateCard))
+
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
+	mux.HandleFunc(generatedImagePrefix, serveGeneratedImage)
+	mux.HandleFunc("/debug/latency", instrument("debug.latency", showLatency))
+	mux.HandleFunc("/metrics", showMetrics)
+	mux.HandleFunc("/capabilities", instrument("capabilities", mux.showCapabilities))
+	mux.HandleFunc("/test/seed/", handleTestSeed)
+
+	registerDashboard(mux)
+	registerAdmin(mux)
+	return mux.ServeMux
+}
+
+// applyDrawOrder reverses the drawn cards of a successful response when the
+// client asked for bottom_first. It never changes which cards were drawn.
+func applyDrawOrder(resp *Response, order string) {
+	if resp.Error != nil || order != orderBottomFirst {
+		return
+	}
+	cards := resp.Deck.Cards
+	for i, j := 0, len(cards)-1; i < j; i, j = i+1, j-1 {
+		cards[i], cards[j] = cards[j], cards[i]
+	}
+	resp.Deck.Order = orderBottomFirst
+}
+
+// sortDrawnCards puts the drawn cards of a successful response in the order
+// of a fresh deck: by suit (hearts, diamonds, clubs, spades), aces high
+// within a suit, with jokers and other cards last by code. Only the response
+// is sorted; the drawn history keeps the draw order.
+func sortDrawnCards(resp *Response) {
+	if resp.Error != nil {
+		return
+	}
+	position := make(map[string]int)
+	for i, card := range generateCards(1, 0, CardOrder{}) {
+		position[card.Code] = i
+	}
+	sort.SliceStable(resp.Deck.Cards, func(i, j int) bool {
+		a, b := resp.Deck.Cards[i].Code, resp.Deck.Cards[j].Code
+		pa, aKnown := position[a]
+		pb, bKnown := position[b]
+		if aKnown != bKnown {
+			return aKnown
+		}
+		if !aKnown {
+			return a < b
+		}
+		return pa < pb
+	})
+	resp.Deck.Order = orderCanonical
+}
+
+// EmptyDraw represents a draw from an empty deck with ?lenient=true.
+type EmptyDraw struct {
+	DeckID    string `json:"deck_id"`
+	Cards     []Card `json:"cards"`
+	Drawn     int    `json:"drawn"`
+	Remaining int    `json:"remaining"`
+}
+
+// handleDrawResponse writes the response of a draw as params asks for. With
+// ?lenient=true, drawing from an empty deck is not an error: it draws
+// nothing.
+func handleDrawResponse(w http.ResponseWriter, r *http.Request, deckID string, resp Response, params DrawParams) {
+	if params.Lenient && resp.Error == errDeckEmpty {
+		if params.SplitBySuit {
+			handleSplitBySuit(w, Response{Deck: Deck{ID: deckID}})
+			return
+		}
+		writeJSON(w, EmptyDraw{DeckID: deckID, Cards: []Card{}})
+		return
+	}
+	applyDrawOrder(&resp, params.Order)
+	if params.Sort {
+		sortDrawnCards(&resp)
+	}
+	if params.SplitBySuit {
+		handleSplitBySuit(w, resp)
+		return
+	}
+	handleResponse(w, r, resp)
+}
+
+func createDeck(w http.ResponseWriter, r *http.Request) {
+	params, err := parseCreateParams(r)
+	if err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkRefillChain("", params.RefillFrom); err != nil {
+		v := &Validator{}
+		v.Add("refill_from", "invalid_deck", "%s", err.Error())
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	var cards []Card
+	if params.JokersTotal >= 0 {
+		cards = append(generateCards(params.Packs, 0, params.Order), jokerCards(params.JokersTotal)...)
+	} else {
+		jokersPerPack := 0
+		if params.Jokers {
+			jokersPerPack = params.JokerCount
+		}
+		cards = generateCards(params.Packs, jokersPerPack, params.Order)
+	}
+	applyScoring(cards, params.Scoring)
+	deckID, err := insertDeck(db, cards, params.LocksAt)
+	if err != nil {
+		http.Error(w, "Error creating deck", http.StatusInternalServerError)
+		return
+	}
+	if _, err := db.Exec("UPDATE decks SET refill_from = ?, scoring = ?, reshuffle_at = ?, shuffle_seed = ?, min_draw_interval = ? WHERE id = ?", params.RefillFrom, params.Scoring, params.ReshuffleAt, params.Seed, params.MinDrawInterval.Milliseconds(), deckID); err != nil {
+		http.Error(w, "Error creating deck", http.StatusInternalServerError)
+		return
+	}
+
+	response := Deck{
+		ID:        deckID,
+		Cards:     cards,
+		Remaining: len(cards),
+		LocksAt:   params.LocksAt,
+	}
+
+	writeJSON(w, response)
+}
+
+// pathPart returns parts[i], or "" if the path is too short.
+func pathPart(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return ""
+}
+
+func handleDeckRequests(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/deck/"), "/")
+
+	// Without this, /deck/ would look up a deck with an empty ID and answer
+	// as if a real deck were missing.
+	if parts[0] == "" {
+		v := &Validator{}
+		v.Add("deck_id", "missing", "deck ID required")
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	deckID := parts[0]
+
+	switch r.Method {
+	case http.MethodPost:
+		if len(parts) > 1 && parts[1] == "add" {
+			params, err := parseAddParams(r.URL.Query())
+			if err != nil {
+				writeValidationErrors(w, err)
+				return
+			}
+			addCards(w, deckID, params, unmodifiedSince(r))
+			return
+		}
+		if len(parts) == 2 && (parts[1] == "freeze" || parts[1] == "unfreeze") {
+			requireAdmin(func(w http.ResponseWriter, r *http.Request) { setDeckFrozen(w, deckID, parts[1] == "freeze") })(w, r)
+			return
+		}
+		if len(parts) > 1 && parts[1] == "locks-at" {
+			setDeckDeadline(w, r, deckID)
+			return
+		}
+		if len(parts) == 4 && parts[1] == "draw" && parts[3] == "atomic-log" {
+			drawWithAuditLog(w, r, deckID, parts[2])
+			return
+		}
+		if len(parts) == 3 && parts[1] == "deal" && parts[2] == "auto" {
+			dealAuto(w, r, deckID)
+			return
+		}
+		if len(parts) == 4 && parts[1] == "shuffle-deal" {
+			params, err := parseDealParams(parts[2], parts[3])
+			if err != nil {
+				writeValidationErrors(w, err)
+				return
+			}
+			resp := submit(Request{
+				Type:            "shuffle-deal",
+				DeckID:          deckID,
+				Deal:            params,
+				ReplyCh:         make(chan Response),
+				UnmodifiedSince: unmodifiedSince(r),
+			})
+			handleResponse(w, r, resp)
+			return
+		}
+		if len(parts) > 1 && parts[1] == "refill-from" {
+			setRefillSource(w, r, deckID)
+			return
+		}
+		if len(parts) > 1 && parts[1] == "inject-cheat" {
+			injectCheat(w, r, deckID)
+			return
+		}
+		if len(parts) == 5 && parts[1] == "play" && parts[3] == "to" {
+			playToPile(w, deckID, parts[2], parts[4])
+			return
+		}
+		if len(parts) == 2 && parts[1] == "transact" {
+			transactDeck(w, r, deckID)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "reseed" {
+			reseedDeck(w, r, deckID)
+			return
+		}
+		if len(parts) == 3 && parts[1] == "cards" && parts[2] == "validate" {
+			validateCardList(w, r, deckID)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "split" {
+			splitDeck(w, r, deckID)
+			return
+		}
+		if len(parts) > 1 && parts[1] == "clear-drawn" {
+			clearDrawnCards(w, deckID)
+			return
+		}
+		if len(parts) == 4 && parts[1] == "draw" && parts[2] == "teach" {
+			teachDraw(w, r, deckID, parts[3])
+			return
+		}
+		if len(parts) == 4 && parts[1] == "draw" && parts[3] == "weighted" {
+			weightedDraw(w, r, deckID, parts[2])
+			return
+		}
+		if len(parts) == 4 && parts[1] == "draw" && parts[3] == "split-by-suit" {
+			params, err := parseDrawParams(parts[2], r.URL.Query())
+			if err != nil {
+				writeValidationErrors(w, err)
+				return
+			}
+			params.SplitBySuit, params.WithRemaining = true, false
+			resp := submit(Request{
+				Type:            "draw",
+				DeckID:          deckID,
+				Draw:            params,
+				ReplyCh:         make(chan Response),
+				UnmodifiedSince: unmodifiedSince(r),
+			})
+			handleDrawResponse(w, r, deckID, resp, params)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	case http.MethodGet:
+		w = &lastModifiedWriter{ResponseWriter: w, deckID: deckID}
+		if len(parts) == 1 || parts[1] == "" {
+			showDeckInfo(w, deckID)
+			return
+		}
+		if len(parts) > 1 {
+			action := parts[1]
+			switch action {
+			case "draw":
+				if pathPart(parts, 2) == "alternate" {
+					params, err := parseDrawParams(pathPart(parts, 3), r.URL.Query())
+					if err != nil {
+						writeValidationErrors(w, err)
+						return
+					}
+					resp := submit(Request{
+						Type:            "draw-alternate",
+						DeckID:          deckID,
+						Draw:            params,
+						ReplyCh:         make(chan Response),
+						UnmodifiedSince: unmodifiedSince(r),
+					})
+					handleDrawResponse(w, r, deckID, resp, params)
+					return
+				}
+				if len(parts) == 3 && parts[2] == "collect" {
+					params, draw, err := parseCollectParams(r.URL.Query())
+					if err != nil {
+						writeValidationErrors(w, err)
+						return
+					}
+					resp := submit(Request{
+						Type:            "draw-collect",
+						DeckID:          deckID,
+						Collect:         params,
+						Draw:            draw,
+						ReplyCh:         make(chan Response),
+						UnmodifiedSince: unmodifiedSince(r),
+					})
+					handleCollectResponse(w, resp, params.Suit, params.Count)
+					return
+				}
+				if pathPart(parts, 2) == "distinct" {
+					params, err := parseDrawParams(pathPart(parts, 3), r.URL.Query())
+					if err != nil {
+						writeValidationErrors(w, err)
+						return
+					}
+					resp := submit(Request{
+						Type:            "draw-distinct",
+						DeckID:          deckID,
+						Draw:            params,
+						ReplyCh:         make(chan Response),
+						UnmodifiedSince: unmodifiedSince(r),
+					})
+					handleDrawResponse(w, r, deckID, resp, params)
+					return
+				}
+				params, err := parseDrawParams(pathPart(parts, 2), r.URL.Query())
+				if err != nil {
+					writeValidationErrors(w, err)
+					return
+				}
+				drawReq := Request{
+					Type:            "draw",
+					DeckID:          deckID,
+					Draw:            params,
+					ReplyCh:         make(chan Response),
+					UnmodifiedSince: unmodifiedSince(r),
+				}
+				resp := submit(drawReq)
+				handleDrawResponse(w, r, deckID, resp, params)
+				return
+			case "draw-stream":
+				params, err := parseStreamParams(r.URL.Query())
+				if err != nil {
+					writeValidationErrors(w, err)
+					return
+				}
+				streamDraw(w, r, deckID, params)
+				return
+			case "shuffle":
+				shuffleReq := Request{
+					Type:            "shuffle",
+					DeckID:          deckID,
+					ReplyCh:         make(chan Response),
+					UnmodifiedSince: unmodifiedSince(r),
+				}
+				resp := submit(shuffleReq)
+				handleResponse(w, r, resp)
+				return
+			case "view":
+				viewDeck(w, r, deckID)
+				return
+			case "share":
+				requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+					showViewShare(w, r, deckID)
+				})(w, r)
+				return
+			case "upcoming":
+				handleUpcomingRequests(w, r, deckID, parts[2:])
+				return
+			case "session":
+				if len(parts) == 4 && parts[3] == "drawn" {
+					showSessionDrawn(w, r, deckID, parts[2])
+					return
+				}
+			case "last":
+				showLastDrawn(w, deckID)
+				return
+			case "history":
+				if len(parts) == 3 && parts[2] == "export.csv" {
+					exportHistoryCSV(w, deckID)
+					return
+				}
+			case "export":
+				if len(parts) == 2 {
+					exportDeck(w, r, deckID)
+					return
+				}
+				if len(parts) == 3 && parts[2] == "handhistory" {
+					exportHandHistory(w, r, deckID)
+					return
+				}
+			case "fingerprint":
+				showFingerprint(w, deckID)
+				return
+			case "audit":
+				auditDeck(w, r, deckID)
+				return
+			case "session-duration":
+				showSessionDuration(w, deckID)
+				return
+			case "layout":
+				showDeckLayout(w, r, deckID)
+				return
+			case "shuffle-log":
+				requireAdmin(func(w http.ResponseWriter, r *http.Request) { showShuffleLog(w, r, deckID) })(w, r)
+				return
+			case "events":
+				requireAdmin(func(w http.ResponseWriter, r *http.Request) { showEvents(w, r, deckID) })(w, r)
+				return
+			case "advise":
+				showAdvice(w, r, deckID)
+				return
+			case "entropy":
+				showEntropy(w, deckID)
+				return
+			case "card":
+				if len(parts) == 4 && parts[3] == "remaining-count" {
+					showCardCount(w, deckID, parts[2])
+					return
+				}
+			case "commitment-salt":
+				showCommitmentSalt(w, deckID)
+				return
+			case "show":
+				params, err := parseShowParams(pathPart(parts, 2), pathPart(parts, 3), r.URL.Query())
+				if err != nil {
+					writeValidationErrors(w, err)
+					return
+				}
+				if params.Type == "0" {
+					showDrawnCards(w, r, deckID, params.Count, params.Label)
+				} else {
+					showUpcomingCards(w, r, deckID, params.Count)
+				}
+				return
+			}
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	case http.MethodDelete:
+		if len(parts) == 1 {
+			requireAdmin(func(w http.ResponseWriter, r *http.Request) { removeDeck(w, deckID) })(w, r)
+			return
+		}
+		if len(parts) == 4 && parts[1] == "cards" && parts[3] == "upcoming" {
+			removeUpcomingCopies(w, deckID, parts[2])
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	case http.MethodPatch:
+		if len(parts) == 1 {
+			requireAdmin(func(w http.ResponseWriter, r *http.Request) { setDrawInterval(w, r, deckID) })(w, r)
+			return
+		}
+		if len(parts) == 3 && parts[1] == "upcoming" && parts[2] == "reorder" {
+			reorderUpcoming(w, r, deckID)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CollectDraw represents the outcome of GET /deck/{id}/draw/collect.
+// Collected is below Target when the deck ran out first.
+type CollectDraw struct {
+	DeckID     string `json:"deck_id"`
+	Suit       string `json:"suit"`
+	Target     int    `json:"target"`
+	Collected  int    `json:"collected"`
+	Cards      []Card `json:"cards"`
+	Remaining  int    `json:"remaining"`
+	Reshuffled bool   `json:"reshuffled,omitempty"`
+}
+
+func handleCollectResponse(w http.ResponseWriter, resp Response, suit string, target int) {
+	if resp.Error != nil {
+		writeError(w, resp.Error)
+		return
+	}
+
+	collect := CollectDraw{
+		DeckID:     resp.Deck.ID,
+		Suit:       suit,
+		Target:     target,
+		Cards:      resp.Deck.Cards,
+		Remaining:  resp.Deck.Remaining,
+		Reshuffled: resp.Deck.Reshuffled,
+	}
+	for _, card := range collect.Cards {
+		if cardSuit(card) == suit {
+			collect.Collected++
+		}
+	}
+
+	writeJSON(w, collect)
+}
+
+// clearDrawnCards empties the drawn history without touching the upcoming
+// cards or their order, e.g. to start a new scoring period mid-game.
+func clearDrawnCards(w http.ResponseWriter, deckID string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusLocked)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var cleared int
+	state, err := deck.Update(sqlStore{tx}, deckID, func(s *deck.State) error {
+		cleared = deck.ClearDrawn(s)
+		return adjustCardTotal(tx, deckID, -cleared)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := rotateCommitmentKey(tx, deckID); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	// The hands of a game go with the drawn cards.
+	if _, err := tx.Exec("UPDATE decks SET game_state = NULL WHERE id = ?", deckID); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"deck_id":   deckID,
+		"cleared":   cleared,
+		"remaining": len(state.Upcoming),
+	})
+}
+
+func addCards(w http.ResponseWriter, deckID string, params AddParams, since time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var existingCards []Card
+	row := db.QueryRow("SELECT cards, COALESCE(scoring, '') FROM decks WHERE id = ?", deckID)
+	var cardsJSON, scoring string
+	if err := row.Scan(&cardsJSON, &scoring); err != nil {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	}
+	json.Unmarshal([]byte(cardsJSON), &existingCards)
+
+	newCards := params.Cards
+	applyScoring(newCards, scoring)
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error adding cards", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := checkUnmodifiedSince(tx, deckID, since); err != nil {
+		writeError(w, err)
+		return
+	}
+	state, err := deck.Update(sqlStore{tx}, deckID, func(s *deck.State) error {
+		deck.AddCards(s, newCards)
+		return adjustCardTotal(tx, deckID, len(newCards))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error adding cards", http.StatusInternalServerError)
+		return
+	}
+
+	allCards := make([]Card, 0, len(existingCards)+len(state.Upcoming))
+	allCards = append(append(allCards, existingCards...), state.Upcoming...)
+
+	response := Deck{
+		ID:        deckID,
+		Cards:     allCards,
+		Remaining: len(state.Upcoming),
+	}
+
+	writeJSON(w, response)
+}
+
+// RemovedCards represents the outcome of removing a card from upcoming.
+type RemovedCards struct {
+	Removed   int `json:"removed"`
+	Remaining int `json:"remaining"`
+}
+
+// errNothingRemoved stops removeUpcomingCopies from saving a deck none of
+// whose upcoming cards had the code.
+var errNothingRemoved = errors.New("nothing removed")
+
+// removeUpcomingCopies removes every copy of a card code from the upcoming
+// cards of a deck and records a forced_remove event for each, with the
+// position it held. Drawn copies are left alone, and a code with no upcoming
+// copy removes nothing, saves nothing and records no event.
+func removeUpcomingCopies(w http.ResponseWriter, deckID, rawCode string) {
+	code, err := resolveCardCode(rawCode)
+	if err != nil {
+		v := &Validator{}
+		v.Add("code", "unknown_card", "%s", err.Error())
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error removing cards", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var result RemovedCards
+	_, err = deck.Update(sqlStore{tx}, deckID, func(s *deck.State) error {
+		removed := deck.RemoveCode(s, code)
+		result = RemovedCards{Removed: len(removed), Remaining: len(s.Upcoming)}
+		if len(removed) == 0 {
+			return errNothingRemoved
+		}
+		recordedAt := now()
+		for _, position := range removed {
+			removal := map[string]any{"code": code, "position": position}
+			if err := recordEvent(tx, deckID, "forced_remove", recordedAt, removal); err != nil {
+				return fmt.Errorf("Error removing cards")
+			}
+		}
+		return adjustCardTotal(tx, deckID, -len(removed))
+	})
+	if err == errNothingRemoved {
+		writeJSON(w, result)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error removing cards", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+func showDrawnCards(w http.ResponseWriter, r *http.Request, deckID string, count int, label string) {
+	drawnCards, err := loadDrawnCards(deckID)
+	if err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if label != "" {
+		drawnCards = withLabel(drawnCards, label)
+	}
+
+	v := &Validator{}
+	v.Check(count <= len(drawnCards), "count", "out_of_range", "count exceeds the number of cards")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	response := drawnCards
+	if count > 0 {
+		response = drawnCards[len(drawnCards)-count:]
+	}
+
+	writeCardList(w, r, response)
+}
+
+func showUpcomingCards(w http.ResponseWriter, r *http.Request, deckID string, count int) {
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	v := &Validator{}
+	v.Check(count <= len(upcomingCards), "count", "out_of_range", "count exceeds the number of cards")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	response := upcomingCards
+	if count > 0 {
+		response = upcomingCards[:count]
+	}
+
+	writeCardList(w, r, response)
+}
+
+// SplitDraw represents drawn cards grouped by suit. Jokers are grouped under
+// "joker".
+type SplitDraw struct {
+	Drawn      map[string][]Card `json:"drawn"`
+	TotalDrawn int               `json:"total_drawn"`
+	Remaining  int               `json:"remaining"`
+}
+
+// handleSplitBySuit writes a draw response grouped by suit. Every group is
+// present, even when empty.
+func handleSplitBySuit(w http.ResponseWriter, resp Response) {
+	if resp.Error != nil {
+		writeError(w, resp.Error)
+		return
+	}
+
+	split := SplitDraw{
+		Drawn: map[string][]Card{
+			"h": {}, "d": {}, "c": {}, "s": {}, "joker": {},
+		},
+		TotalDrawn: len(resp.Deck.Cards),
+		Remaining:  resp.Deck.Remaining,
+	}
+	for _, card := range resp.Deck.Cards {
+		group := cardSuit(card)
+		if _, ok := split.Drawn[group]; !ok {
+			group = "joker"
+		}
+		split.Drawn[group] = append(split.Drawn[group], card)
+	}
+
+	writeJSON(w, split)
+}
+
+func handleResponse(w http.ResponseWriter, r *http.Request, resp Response) {
+	if resp.Error != nil {
+		writeError(w, resp.Error)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		perLine, err := strconv.Atoi(r.URL.Query().Get("cards_per_line"))
+		if err != nil || perLine < 1 {
+			perLine = defaultCardsPerLine
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, renderASCII(resp.Deck.Cards, perLine))
+		return
+	}
+	writeJSON(w, resp.Deck)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// exportHistoryCSV writes the drawn history of a deck as a CSV attachment,
+// one row per drawn card in draw order.
+func exportHistoryCSV(w http.ResponseWriter, deckID string) {
+	drawnCards, err := loadDrawnCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"deck_%s_history.csv\"", deckID))
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"sequence", "code", "rank", "suit", "drawn_at", "label"})
+	for i, drawn := range drawnCards {
+		card := cardFromCode(drawn.Code)
+		writer.Write([]string{strconv.Itoa(i + 1), drawn.Code, card.Rank, card.Suit, drawn.Time, drawn.Label})
+	}
+	writer.Flush()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+//go:embed words/*.txt
+var wordFS embed.FS
+
+var errNoFreeID = errors.New("Could not find a free deck ID")
+
+// newDeckIDAttempts bounds the IDs tried for a new deck before giving up.
+const newDeckIDAttempts = 10
+
+// IDGenerator makes the IDs of new decks. Tests can replace idGenerator to
+// get known IDs.
+type IDGenerator interface {
+	NewID() string
+}
+
+// idGenerator makes deck IDs in the style set by ID_STYLE: "uuid", the
+// default, "short" for 8 base62 characters or "words" for two words and a
+// number such as "amber-falcon-4821", easier to read aloud. Decks keep their ID whatever the
+// style, so existing UUID decks work the same under any of them.
+var idGenerator = newIDGenerator(os.Getenv("ID_STYLE"))
+
+// idStyles lists the values of ID_STYLE.
+var idStyles = []string{"uuid", "short", "words"}
+
+func newIDGenerator(style string) IDGenerator {
+	switch style {
+	case "", "uuid":
+		return uuidIDs{}
+	case "short":
+		return shortIDs{}
+	case "words":
+		return newWordIDs()
+	}
+	log.Printf("Unknown ID_STYLE %q (want one of %s), using uuid", style, strings.Join(idStyles, ", "))
+	return uuidIDs{}
+}
+
+type uuidIDs struct{}
+
+func (uuidIDs) NewID() string { return uuid.New().String() }
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// shortIDs makes 8 random base62 characters, about 2^47 IDs: collisions are
+// rare, but possible enough that newDeckID checks for them.
+type shortIDs struct{}
+
+func (shortIDs) NewID() string {
+	id := make([]byte, 8)
+	for i := range id {
+		id[i] = base62[randomIndex(len(base62))]
+	}
+	return string(id)
+}
+
+// wordIDs makes an adjective and an animal from the embedded word lists,
+// followed by a number below wordIDSuffixes. The 124 adjectives and 128
+// animals alone give about 16,000 IDs, few enough that a busy server would
+// run out of free ones; the number takes that to about 160 million.
+type wordIDs struct {
+	adjectives, nouns []string
+}
+
+const wordIDSuffixes = 10000
+
+func newWordIDs() wordIDs {
+	return wordIDs{adjectives: readWords("words/adjectives.txt"), nouns: readWords("words/nouns.txt")}
+}
+
+func readWords(name string) []string {
+	data, err := wordFS.ReadFile(name)
+	if err != nil {
+		log.Fatalf("Error reading word list: %v", err)
+	}
+	return strings.Fields(string(data))
+}
+
+func (g wordIDs) NewID() string {
+	return fmt.Sprintf("%s-%s-%04d", g.adjectives[randomIndex(len(g.adjectives))], g.nouns[randomIndex(len(g.nouns))], randomIndex(wordIDSuffixes))
+}
+
+// randomIndex returns a uniform random index below n.
+func randomIndex(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		log.Fatalf("Error reading random bytes: %v", err)
+	}
+	return int(i.Int64())
+}
+
+// newDeckID returns an ID from idGenerator that no deck has, live or
+// archived, trying again on a collision. The caller must hold mu.
+func newDeckID(exec execer) (string, error) {
+	for attempt := 0; attempt < newDeckIDAttempts; attempt++ {
+		id := idGenerator.NewID()
+		if !archiveIDPattern.MatchString(id) || deckExists(exec, id) {
+			continue
+		}
+		if _, err := os.Stat(archivePath(id)); err == nil {
+			continue
+		}
+		return id, nil
+	}
+	return "", errNoFreeID
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+// fixedIDs hands out its IDs in order, then repeats the last one.
+type fixedIDs struct {
+	ids []string
+}
+
+func (g *fixedIDs) NewID() string {
+	id := g.ids[0]
+	if len(g.ids) > 1 {
+		g.ids = g.ids[1:]
+	}
+	return id
+}
+
+func TestIDStyles(t *testing.T) {
+	shapes := map[string]*regexp.Regexp{
+		"uuid":  regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`),
+		"short": regexp.MustCompile(`^[0-9A-Za-z]{8}$`),
+		"words": regexp.MustCompile(`^[a-z]+-[a-z]+-[0-9]{4}$`),
+	}
+	for _, style := range idStyles {
+		generator := newIDGenerator(style)
+		for i := 0; i < 100; i++ {
+			id := generator.NewID()
+			if !shapes[style].MatchString(id) || !archiveIDPattern.MatchString(id) {
+				t.Fatalf("%s ID %q is malformed", style, id)
+			}
+		}
+	}
+	if _, ok := newIDGenerator("emoji").(uuidIDs); !ok {
+		t.Error("an unknown style does not fall back to uuid")
+	}
+}
+
+func TestInjectedIDGenerator(t *testing.T) {
+	server := newTestServer(t)
+	saved := idGenerator
+	t.Cleanup(func() { idGenerator = saved })
+
+	uuidDeck := newTestDeck(t, server, 1)
+	idGenerator = &fixedIDs{ids: []string{"amber-falcon", "amber-falcon", "quiet-otter"}}
+	first, second := newTestDeck(t, server, 1), newTestDeck(t, server, 1)
+	if first != "amber-falcon" || second != "quiet-otter" {
+		t.Fatalf("decks got %s and %s, want amber-falcon, then quiet-otter after the collision", first, second)
+	}
+	for _, id := range []string{uuidDeck, first} {
+		if drawn := fetchDeck(t, http.MethodGet, server.URL+"/deck/"+id+"/draw/2"); drawn.Remaining != 50 {
+			t.Errorf("deck %s: %d remaining after a draw of 2", id, drawn.Remaining)
+		}
+	}
+
+	// Every ID it gives is taken.
+	resp, err := http.Get(server.URL + "/deck/new/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("creating a deck with no free ID returned %d", resp.StatusCode)
+	}
+}
+
+// With one adjective and one animal, only the number tells IDs apart: new
+// decks still get free IDs, and a taken one is drawn again.
+func TestWordIDCollisions(t *testing.T) {
+	server := newTestServer(t)
+	saved := idGenerator
+	t.Cleanup(func() { idGenerator = saved })
+
+	idGenerator = wordIDs{adjectives: []string{"amber"}, nouns: []string{"falcon"}}
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		id := newTestDeck(t, server, 1)
+		if seen[id] || !regexp.MustCompile(`^amber-falcon-[0-9]{4}$`).MatchString(id) {
+			t.Fatalf("deck %d got ID %q", i, id)
+		}
+		seen[id] = true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	taken := &fixedIDs{ids: []string{}}
+	for id := range seen {
+		taken.ids = append(taken.ids, id)
+	}
+	idGenerator = taken
+	if id, err := newDeckID(db); err != errNoFreeID {
+		t.Errorf("newDeckID with only taken IDs = %q, %v", id, err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Image URLs follow the configured base URL, including for decks stored
+// before it changed and for decks stored with an image URL.
+func TestImageURLsFollowConfiguredBase(t *testing.T) {
+	server := newTestServer(t)
+	saved := imageBaseURL
+	t.Cleanup(func() { imageBaseURL = saved })
+
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/1")
+
+	// A deck stored by an older version still holds its image URLs.
+	stale := `[{"code":"ah","rank":"a","suit":"h","image":"/static/old/1h.svg"}]`
+	if _, err := db.Exec("INSERT INTO decks (id, cards, piged, upcoming, created_at, updated_at, card_total) VALUES ('old', ?, '[]', ?, '', '', 1)", stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	stripStoredImages()
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM decks WHERE cards LIKE '%"image":%' OR upcoming LIKE '%"image":%' OR piged LIKE '%"image":%'`).Scan(&stored)
+	if stored != 0 {
+		t.Fatalf("%d decks still store image URLs", stored)
+	}
+
+	imageBaseURL = "https://cdn.example.com"
+	checkImage := func(what, code, image string) {
+		t.Helper()
+		if want := "https://cdn.example.com" + cardImagePath(code); image != want {
+			t.Errorf("%s: image of %s = %q, want %q", what, code, image, want)
+		}
+	}
+
+	for _, card := range fetchDeck(t, http.MethodGet, base+"/draw/1").Cards {
+		checkImage("draw", card.Code, card.Image)
+	}
+	for _, card := range fetchDeck(t, http.MethodGet, server.URL+"/deck/old/draw/1").Cards {
+		checkImage("old deck", card.Code, card.Image)
+	}
+
+	resp, err := http.Get(base + "/show/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history []DrawnCard
+	err = json.NewDecoder(resp.Body).Decode(&history)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history has %d cards, want 2", len(history))
+	}
+	for _, entry := range history {
+		checkImage("history", entry.Code, entry.Image)
+	}
+
+	var upcoming string
+	db.QueryRow("SELECT upcoming FROM decks WHERE id = ?", deckID).Scan(&upcoming)
+	if strings.Contains(upcoming, "image") {
+		t.Error("draw stored image URLs")
+	}
+}
+
+// withImages reaches cards wherever a response holds them, and leaves the
+// value it was given alone.
+func TestWithImages(t *testing.T) {
+	type hand struct {
+		Cards  []Card            `json:"cards"`
+		Drawn  *DrawnCard        `json:"drawn"`
+		Piles  map[string][]Card `json:"piles"`
+		Detail any               `json:"detail"`
+		hidden []Card
+	}
+	original := hand{
+		Cards:  []Card{{Code: "ah"}},
+		Drawn:  &DrawnCard{Code: "2s"},
+		Piles:  map[string][]Card{"discard": {{Code: "kd"}}},
+		Detail: []any{Card{Code: "3c"}},
+		hidden: []Card{{Code: "4h"}},
+	}
+	encoded, err := json.Marshal(withImages(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"ah", "2s", "kd", "3c"} {
+		if !strings.Contains(string(encoded), `"image":"`+cardImage(code)+`"`) {
+			t.Errorf("no image for %s in %s", code, encoded)
+		}
+	}
+	if original.Cards[0].Image != "" || original.Drawn.Image != "" || original.Piles["discard"][0].Image != "" {
+		t.Errorf("withImages changed its argument: %+v", original)
+	}
+	if got := withImages(map[string]int{"a": 1}); !reflect.DeepEqual(got, map[string]int{"a": 1}) {
+		t.Errorf("value without cards = %v", got)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+// LabeledDraw represents a draw made with ?label= in the event log of a
+// deck, so that it can be found there by its label.
+type LabeledDraw struct {
+	Label   string   `json:"label"`
+	Session string   `json:"session,omitempty"`
+	Street  string   `json:"street,omitempty"`
+	Cards   []string `json:"cards"`
+}
+
+// recordLabeledDraw adds a labeled_draw event for the entries a draw
+// appended to the history, through the transaction that saves the draw. A
+// draw without a label records nothing. The caller must hold mu.
+func recordLabeledDraw(exec execer, deckID string, entries []DrawnCard) error {
+	if len(entries) == 0 || entries[0].Label == "" {
+		return nil
+	}
+	draw := LabeledDraw{Label: entries[0].Label, Session: entries[0].Session, Street: entries[0].Street, Cards: make([]string, len(entries))}
+	for i, entry := range entries {
+		draw.Cards[i] = entry.Code
+	}
+	return recordEvent(exec, deckID, "labeled_draw", entries[0].Time, draw)
+}
+
+// withLabel returns the entries of history drawn with label, in draw order.
+func withLabel(history []DrawnCard, label string) []DrawnCard {
+	labeled := []DrawnCard{}
+	for _, entry := range history {
+		if entry.Label == label {
+			labeled = append(labeled, entry)
+		}
+	}
+	return labeled
+}
+
+// labelCounts counts the entries of history by label, or returns nil when
+// none has one.
+func labelCounts(history []DrawnCard) map[string]int {
+	var counts map[string]int
+	for _, entry := range history {
+		if entry.Label == "" {
+			continue
+		}
+		if counts == nil {
+			counts = map[string]int{}
+		}
+		counts[entry.Label]++
+	}
+	return counts
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDrawLabels(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	draw := func(query string) []string {
+		t.Helper()
+		return cardCodes(fetchDeck(t, http.MethodGet, base+"/draw/2"+query).Cards)
+	}
+	question := draw("?label=question-7")
+	draw("")
+	question = append(question, draw("?label=question-7&session=alice")...)
+	answer := draw("?label=answer")
+
+	resp, err := http.Get(base + "/show/0/0?label=question-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labeled []DrawnCard
+	json.NewDecoder(resp.Body).Decode(&labeled)
+	resp.Body.Close()
+	codes := []string{}
+	for _, entry := range labeled {
+		codes = append(codes, entry.Code)
+		if entry.Label != "question-7" {
+			t.Errorf("card %s has label %q", entry.Code, entry.Label)
+		}
+	}
+	if !reflect.DeepEqual(codes, question) {
+		t.Errorf("question-7 drew %v, want %v", codes, question)
+	}
+	if last := fetchDrawn(t, base+"/show/0/1?label=answer"); len(last) != 1 || last[0].Code != answer[1] {
+		t.Errorf("last answer card = %+v, want %s", last, answer[1])
+	}
+
+	if _, info := deckStatus(t, base); !reflect.DeepEqual(info.Labels, map[string]int{"question-7": 4, "answer": 2}) {
+		t.Errorf("label counts = %v", info.Labels)
+	}
+
+	resp, err = http.Get(base + "/history/export.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || len(rows) != 9 || rows[0][5] != "label" || rows[1][5] != "question-7" || rows[3][5] != "" || rows[7][5] != "answer" {
+		t.Errorf("history export = %v, %v", rows, err)
+	}
+
+	for _, url := range []string{"/draw/1?label=bad%20label", "/show/0/0?label=" + strings.Repeat("x", 65), "/show/1/0?label=answer"} {
+		resp, err := http.Get(base + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", url, resp.StatusCode)
+		}
+	}
+}
+
+func fetchDrawn(t *testing.T, url string) []DrawnCard {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var cards []DrawnCard
+	json.NewDecoder(resp.Body).Decode(&cards)
+	return cards
+}
+
+func TestEveryDrawRouteTakesALabel(t *testing.T) {
+	server := newTestServer(t)
+	routes := []struct {
+		name, method, path, body string
+	}{
+		{"draw", http.MethodGet, "/draw/1", ""},
+		{"alternate", http.MethodGet, "/draw/alternate/1", ""},
+		{"distinct", http.MethodGet, "/draw/distinct/1", ""},
+		{"split-by-suit", http.MethodPost, "/draw/1/split-by-suit", ""},
+		{"collect", http.MethodGet, "/draw/collect?suit=h&count=1", ""},
+		{"teach", http.MethodPost, "/draw/teach/1", ""},
+		{"weighted", http.MethodPost, "/draw/1/weighted", `{"weights":{}}`},
+		{"stream", http.MethodGet, "/draw-stream?count=1", ""},
+	}
+	withLabel := func(path, label string) string {
+		if strings.Contains(path, "?") {
+			return path + "&label=" + label
+		}
+		return path + "?label=" + label
+	}
+	for _, route := range routes {
+		deckID := newTestDeck(t, server, 1)
+		base := server.URL + "/deck/" + deckID
+		if status := getStatusWithBody(t, route.method, base+withLabel(route.path, "bad%20label"), route.body); status != http.StatusBadRequest {
+			t.Errorf("%s with an invalid label: status %d, want 400", route.name, status)
+		}
+		if status := getStatusWithBody(t, route.method, base+withLabel(route.path, "question-7"), route.body); status != http.StatusOK {
+			t.Fatalf("%s: status %d", route.name, status)
+		}
+		drawn, _ := loadDrawnCards(deckID)
+		if len(drawn) == 0 {
+			t.Fatalf("%s drew nothing", route.name)
+		}
+		for _, entry := range drawn {
+			if entry.Label != "question-7" {
+				t.Errorf("%s recorded card %s with label %q", route.name, entry.Code, entry.Label)
+			}
+		}
+		events, err := readEvents(readDB, deckID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logged := 0
+		for _, event := range events {
+			var draw LabeledDraw
+			json.Unmarshal(event.Detail, &draw)
+			if event.EventType != "labeled_draw" || draw.Label != "question-7" {
+				t.Errorf("%s logged %s %s", route.name, event.EventType, event.Detail)
+			}
+			logged += len(draw.Cards)
+		}
+		if logged != len(drawn) {
+			t.Errorf("%s logged %d labeled cards, want %d", route.name, logged, len(drawn))
+		}
+	}
+
+	deckID := newTestDeck(t, server, 1)
+	body := `{"deck_ids":["` + deckID + `"],"count":2}`
+	if status := getStatusWithBody(t, http.MethodPost, server.URL+"/decks/draw?label=bad%20label", body); status != http.StatusBadRequest {
+		t.Errorf("multi-deck draw with an invalid label: status %d, want 400", status)
+	}
+	getStatusWithBody(t, http.MethodPost, server.URL+"/decks/draw?label=question-7", body)
+	if drawn, _ := loadDrawnCards(deckID); len(drawn) != 2 || drawn[0].Label != "question-7" || drawn[1].Label != "question-7" {
+		t.Errorf("multi-deck draw recorded %+v", drawn)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+)
+
+// LastDrawn represents the most recently drawn card of a deck.
+type LastDrawn struct {
+	Code string `json:"code"`
+	Card Card   `json:"card"`
+	Time string `json:"time"`
+}
+
+// showLastDrawn returns the last entry of the drawn history. Only the tail of
+// the piged array is extracted, so the cost does not grow with the history.
+func showLastDrawn(w http.ResponseWriter, deckID string) {
+	var lastJSON sql.NullString
+	err := readDB.QueryRow("SELECT json_extract(piged, '$[#-1]') FROM decks WHERE id = ?", deckID).Scan(&lastJSON)
+
+	if err == sql.ErrNoRows {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error reading drawn cards", http.StatusInternalServerError)
+		return
+	}
+	if !lastJSON.Valid {
+		http.Error(w, "No card drawn", http.StatusNotFound)
+		return
+	}
+
+	var last DrawnCard
+	if err := json.Unmarshal([]byte(lastJSON.String), &last); err != nil {
+		http.Error(w, "Error parsing drawn cards", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, LastDrawn{Code: last.Code, Card: cardFromCode(last.Code), Time: last.Time})
+}
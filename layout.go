@@ -0,0 +1,73 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+var layoutTemplate = template.Must(template.ParseFS(templateFS, "templates/layout.html"))
+
+// Columns of GET /deck/{id}/layout: a suit per row by default.
+const (
+	defaultLayoutCols = 13
+	maxLayoutCols     = 26
+)
+
+// LayoutCell represents one card of a printable layout.
+type LayoutCell struct {
+	Code  string `json:"code"`
+	Image string `json:"image"`
+}
+
+// DeckLayout represents the remaining cards of a deck as a grid, top of the
+// deck first, row by row.
+type DeckLayout struct {
+	DeckID    string         `json:"deck_id"`
+	Cols      int            `json:"cols"`
+	Remaining int            `json:"remaining"`
+	Rows      [][]LayoutCell `json:"rows"`
+}
+
+// layoutRows cuts cells into rows of cols cells; the last one may be short.
+func layoutRows(cells []LayoutCell, cols int) [][]LayoutCell {
+	rows := [][]LayoutCell{}
+	for start := 0; start < len(cells); start += cols {
+		rows = append(rows, cells[start:min(start+cols, len(cells))])
+	}
+	return rows
+}
+
+// showDeckLayout serves GET /deck/{id}/layout?cols=13, the remaining cards
+// as a grid of images labeled with their codes, to print. ?format=json gives
+// the grid itself instead of the HTML page.
+func showDeckLayout(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	query := r.URL.Query()
+	cols := v.OptionalInt("cols", query.Get("cols"), defaultLayoutCols, 1, maxLayoutCols)
+	format := v.OneOf("format", query.Get("format"), []string{"html", "json"})
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	cells := make([]LayoutCell, len(upcomingCards))
+	for i, card := range upcomingCards {
+		cells[i] = LayoutCell{Code: card.Code, Image: cardImage(card.Code)}
+	}
+	layout := DeckLayout{DeckID: deckID, Cols: cols, Remaining: len(upcomingCards), Rows: layoutRows(cells, cols)}
+
+	if format == "json" {
+		writeJSON(w, layout)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := layoutTemplate.Execute(w, layout); err != nil {
+		log.Printf("Error rendering deck layout: %v", err)
+	}
+}
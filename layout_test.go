@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeckLayout(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	drawn := fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID+"/draw/2")
+
+	resp, err := http.Get(server.URL + "/deck/" + deckID + "/layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	page := string(body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("layout: status %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if n := strings.Count(page, "<img"); n != 50 {
+		t.Errorf("layout shows %d images, want 50", n)
+	}
+	if n := strings.Count(page, `<div class="row">`); n != 4 {
+		t.Errorf("layout has %d rows, want 4", n)
+	}
+	for _, code := range cardCodes(drawn.Cards) {
+		if strings.Contains(page, `alt="`+code+`"`) {
+			t.Errorf("drawn card %s is in the layout", code)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "/deck/" + deckID + "/layout?cols=5&format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var layout DeckLayout
+	json.NewDecoder(resp.Body).Decode(&layout)
+	resp.Body.Close()
+	if layout.Cols != 5 || layout.Remaining != 50 || len(layout.Rows) != 10 || len(layout.Rows[9]) != 5 {
+		t.Fatalf("json layout: cols %d, remaining %d, %d rows", layout.Cols, layout.Remaining, len(layout.Rows))
+	}
+	if cell := layout.Rows[0][0]; cell.Code == "" || cell.Image != cardImage(cell.Code) {
+		t.Errorf("first cell = %+v", cell)
+	}
+
+	for url, want := range map[string]int{
+		"/deck/" + deckID + "/layout?cols=0":     http.StatusBadRequest,
+		"/deck/" + deckID + "/layout?cols=x":     http.StatusBadRequest,
+		"/deck/" + deckID + "/layout?format=pdf": http.StatusBadRequest,
+		"/deck/missing/layout":                   http.StatusNotFound,
+	} {
+		resp, err := http.Get(server.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", url, resp.StatusCode, want)
+		}
+	}
+}
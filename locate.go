@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Decks scanned per page when locating a card.
+const (
+	defaultLocateScan = 100
+	maxLocateScan     = 500
+)
+
+// CardLocation represents one copy of a card found in a deck: among its
+// upcoming or drawn cards, or on one of its piles. Position counts from the
+// top of the deck, the first drawn card or the bottom of the pile.
+type CardLocation struct {
+	DeckID   string `json:"deck_id"`
+	Where    string `json:"where"` // "upcoming", "drawn" or "pile"
+	Pile     string `json:"pile,omitempty"`
+	Position int    `json:"position"`
+}
+
+// LocateResponse represents one page of GET /cards/{code}/locate.
+type LocateResponse struct {
+	Code       string         `json:"code"`
+	Locations  []CardLocation `json:"locations"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// locateCard reports every copy of a card code across all decks, upcoming,
+// drawn or on a pile. Decks are stored as JSON blobs, so this is a bounded
+// scan: each call reads at most ?limit decks in ID order after ?cursor, with
+// their piles, and returns the cursor of the next page when more decks
+// remain.
+func locateCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/cards/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "locate" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	v := &Validator{}
+	code, err := resolveCardCode(parts[0])
+	if err != nil {
+		v.Add("code", "unknown_card", "%s", err.Error())
+	}
+	limit := v.OptionalInt("limit", r.URL.Query().Get("limit"), defaultLocateScan, 1, maxLocateScan)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+	cursor := r.URL.Query().Get("cursor")
+
+	rows, err := readDB.Query("SELECT id, upcoming, piged, COALESCE(scoring, '') FROM decks WHERE id > ? ORDER BY id LIMIT ?", cursor, limit)
+	if err != nil {
+		http.Error(w, "Error reading decks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type scannedDeck struct{ id, upcoming, drawn, scoring string }
+	var decks []scannedDeck
+	for rows.Next() {
+		var d scannedDeck
+		if err := rows.Scan(&d.id, &d.upcoming, &d.drawn, &d.scoring); err != nil {
+			http.Error(w, "Error reading decks", http.StatusInternalServerError)
+			return
+		}
+		decks = append(decks, d)
+	}
+	rows.Close()
+	scanned := len(decks)
+	lastID := cursor
+	if scanned > 0 {
+		lastID = decks[scanned-1].id
+	}
+
+	piles := map[string][]Pile{}
+	pileRows, err := readDB.Query("SELECT deck_id, name, cards FROM piles WHERE deck_id > ? AND deck_id <= ? ORDER BY deck_id, name", cursor, lastID)
+	if err != nil {
+		http.Error(w, "Error reading piles", http.StatusInternalServerError)
+		return
+	}
+	defer pileRows.Close()
+	for pileRows.Next() {
+		var pile Pile
+		var cardsJSON string
+		if err := pileRows.Scan(&pile.DeckID, &pile.Name, &cardsJSON); err != nil {
+			http.Error(w, "Error reading piles", http.StatusInternalServerError)
+			return
+		}
+		if err := json.Unmarshal([]byte(cardsJSON), &pile.Cards); err != nil {
+			http.Error(w, "Error parsing pile cards", http.StatusInternalServerError)
+			return
+		}
+		piles[pile.DeckID] = append(piles[pile.DeckID], pile)
+	}
+
+	response := LocateResponse{Code: code, Locations: []CardLocation{}}
+	for _, d := range decks {
+		upcomingCards, err := unmarshalUpcoming([]byte(d.upcoming), d.scoring)
+		if err != nil {
+			http.Error(w, "Error parsing upcoming cards", http.StatusInternalServerError)
+			return
+		}
+		for i, card := range upcomingCards {
+			if card.Code == code {
+				response.Locations = append(response.Locations, CardLocation{DeckID: d.id, Where: "upcoming", Position: i})
+			}
+		}
+
+		var drawnCards []DrawnCard
+		if err := json.Unmarshal([]byte(d.drawn), &drawnCards); err != nil {
+			http.Error(w, "Error parsing drawn cards", http.StatusInternalServerError)
+			return
+		}
+		for i, card := range drawnCards {
+			if card.Code == code {
+				response.Locations = append(response.Locations, CardLocation{DeckID: d.id, Where: "drawn", Position: i})
+			}
+		}
+
+		for _, pile := range piles[d.id] {
+			for i, card := range pile.Cards {
+				if card.Code == code {
+					response.Locations = append(response.Locations, CardLocation{DeckID: d.id, Where: "pile", Pile: pile.Name, Position: i})
+				}
+			}
+		}
+	}
+	if scanned == limit {
+		response.NextCursor = lastID
+	}
+
+	writeJSON(w, response)
+}
+
+// CardCount represents the copies of one card code in a deck.
+type CardCount struct {
+	Code                string `json:"code"`
+	RemainingInUpcoming int    `json:"remaining_in_upcoming"`
+	Drawn               int    `json:"drawn"`
+	TotalInOriginal     int    `json:"total_in_original"`
+}
+
+// showCardCount serves GET /deck/{id}/card/{code}/remaining-count. A code
+// missing from the deck counts zero everywhere, and so does a code that names
+// no card at all: it is echoed back lowercased.
+func showCardCount(w http.ResponseWriter, deckID, rawCode string) {
+	code, err := resolveCardCode(rawCode)
+	if err != nil {
+		code = strings.ToLower(strings.TrimSpace(rawCode))
+	}
+
+	count := CardCount{Code: code}
+	err = readDB.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM json_each(decks.upcoming) WHERE `+storedCodeSQL+` = ?1),
+		(SELECT COUNT(*) FROM json_each(decks.piged) WHERE json_extract(value, '$.code') = ?1),
+		(SELECT COUNT(*) FROM json_each(decks.cards) WHERE json_extract(value, '$.code') = ?1)
+		FROM decks WHERE id = ?2`, code, deckID).Scan(&count.RemainingInUpcoming, &count.Drawn, &count.TotalInOriginal)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error reading deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, count)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestCardCount counts a drawn card, a card the deck never held and a code
+// that names no card; only a missing deck is an error.
+func TestCardCount(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/52")
+
+	tests := []struct {
+		code string
+		want CardCount
+	}{
+		{"AH", CardCount{Code: "ah", Drawn: 1, TotalInOriginal: 1}},
+		{jokerCode, CardCount{Code: jokerCode}},
+		{"zz", CardCount{Code: "zz"}},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(base + "/card/" + tt.code + "/remaining-count")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CardCount
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || got != tt.want {
+			t.Errorf("%s: got %d %+v, want 200 %+v", tt.code, resp.StatusCode, got, tt.want)
+		}
+	}
+
+	if status := getStatus(t, http.MethodGet, server.URL+"/deck/missing/card/zz/remaining-count"); status != http.StatusNotFound {
+		t.Errorf("missing deck: got %d, want 404", status)
+	}
+}
+
+// TestLocateMultiPack finds every copy of a code in decks of several packs,
+// with most of each deck drawn, one deck per page.
+func TestLocateMultiPack(t *testing.T) {
+	server := newTestServer(t)
+	copies := map[string]int{}
+	for _, packs := range []int{2, 3} {
+		deckID := newTestDeck(t, server, packs)
+		fetchDeck(t, http.MethodGet, fmt.Sprintf("%s/deck/%s/draw/%d", server.URL, deckID, 40*packs))
+		copies[deckID] = packs
+	}
+
+	found := map[string]int{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(copies) {
+			t.Fatal("locate never ran out of pages")
+		}
+		resp, err := http.Get(server.URL + "/cards/AH/locate?limit=1&cursor=" + cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page LocateResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Code != "ah" {
+			t.Errorf("page code %q, want ah", page.Code)
+		}
+
+		for _, loc := range page.Locations {
+			found[loc.DeckID]++
+			var code string
+			switch loc.Where {
+			case "upcoming":
+				upcoming, err := loadUpcomingCards(loc.DeckID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				code = upcoming[loc.Position].Code
+			case "drawn":
+				drawn, err := loadDrawnCards(loc.DeckID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				code = drawn[loc.Position].Code
+			}
+			if code != "ah" {
+				t.Errorf("%+v holds %q, want ah", loc, code)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	for deckID, packs := range copies {
+		if found[deckID] != packs {
+			t.Errorf("deck of %d packs: located %d copies of ah, want %d", packs, found[deckID], packs)
+		}
+	}
+}
+
+func TestLocateOnPile(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	upcoming, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := 0
+	for upcoming[top].Code != "ah" {
+		top++
+	}
+	url := fmt.Sprintf("%s/deck/%s/play/%d/to/table", server.URL, deckID, top+1)
+	if status := getStatus(t, http.MethodPost, url); status != http.StatusOK {
+		t.Fatalf("POST %s: status %d", url, status)
+	}
+
+	resp, err := http.Get(server.URL + "/cards/ah/locate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page LocateResponse
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CardLocation{DeckID: deckID, Where: "pile", Pile: "table", Position: top}
+	if len(page.Locations) != 1 || page.Locations[0] != want {
+		t.Errorf("located ah at %+v, want %+v", page.Locations, want)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Clock tells the current time. Tests can replace clock to control deadlines.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+var clock Clock = realClock{}
+
+var (
+	errDeckLocked = errors.New("Deck locked")
+	errDeckFrozen = errors.New("Deck frozen")
+)
+
+// DeckInfo represents the metadata of a deck returned by GET /deck/{id}.
+type DeckInfo struct {
+	ID        string `json:"deck_id"`
+	Status    string `json:"status"` // "active", or "archived" once in cold storage
+	Remaining int    `json:"remaining"`
+	Drawn     int    `json:"drawn"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	LocksAt   string `json:"locks_at,omitempty"`
+	Locked    bool   `json:"locked"`
+	Shuffled  bool   `json:"shuffled"`
+	Frozen    bool   `json:"frozen"`
+
+	// MinDrawInterval is the pacing of draws, such as 5s, or "" for none.
+	MinDrawInterval string `json:"min_draw_interval,omitempty"`
+	// Labels counts the drawn cards of each draw label.
+	Labels map[string]int `json:"labels,omitempty"`
+}
+
+// errorStatus returns the HTTP status for an error returned by the worker.
+func errorStatus(err error) int {
+	switch err {
+	case errDeckNotFound:
+		return http.StatusNotFound
+	case errDeckLocked, errDeckFrozen:
+		return http.StatusLocked
+	case errNotEnoughCards, errDeckEmpty, errNotEnoughDistinctRanks:
+		return http.StatusConflict
+	case errDeckModified:
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+// errorCodes gives a machine-readable code to the errors that clients are
+// expected to handle rather than only display.
+var errorCodes = map[error]string{
+	errDeckEmpty:              "DECK_EMPTY",
+	errDeckModified:           "DECK_MODIFIED",
+	errNotEnoughDistinctRanks: "NOT_ENOUGH_DISTINCT_RANKS",
+}
+
+// ErrorBody represents an error that has a machine-readable code.
+type ErrorBody struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeError writes err with its errorStatus. Errors with a code are written
+// as an ErrorBody, the others as plain text.
+func writeError(w http.ResponseWriter, err error) {
+	var tooSoon *drawTooSoonError
+	if errors.As(err, &tooSoon) {
+		writeDrawTooSoon(w, tooSoon)
+		return
+	}
+	code, ok := errorCodes[err]
+	if !ok {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSONStatus(w, errorStatus(err), ErrorBody{Error: err.Error(), Code: code})
+}
+
+// parseDeadline parses a locks_at value. An empty value means no deadline.
+func parseDeadline(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", errors.New("Invalid locks_at")
+	}
+	return deadline.UTC().Format(time.RFC3339), nil
+}
+
+// deadlinePassed reports whether a stored locks_at value is in the past.
+func deadlinePassed(locksAt string) bool {
+	if locksAt == "" {
+		return false
+	}
+	deadline, err := time.Parse(time.RFC3339, locksAt)
+	return err == nil && !clock.Now().Before(deadline)
+}
+
+// checkDeckUnlocked returns errDeckLocked when the deck no longer accepts
+// mutations, or errDeckFrozen while it is frozen. Mutations call it once they
+// hold mu, so a request queued before the deadline or the freeze but executed
+// after it is still rejected. The caller must hold mu.
+func checkDeckUnlocked(deckID string) error {
+	return deckUnlocked(db, deckID)
+}
+
+// deckUnlocked is checkDeckUnlocked through q. Readers pass readDB and do not
+// take mu, at the cost of a state that may be slightly stale.
+func deckUnlocked(q *sql.DB, deckID string) error {
+	var locksAt sql.NullString
+	var frozen bool
+	if err := q.QueryRow("SELECT locks_at, frozen FROM decks WHERE id = ?", deckID).Scan(&locksAt, &frozen); err != nil {
+		return errDeckNotFound
+	}
+	if frozen {
+		return errDeckFrozen
+	}
+	if deadlinePassed(locksAt.String) {
+		return errDeckLocked
+	}
+	return nil
+}
+
+func showDeckInfo(w http.ResponseWriter, deckID string) {
+	var remaining int
+	var drawnJSON string
+	var createdAt, updatedAt, locksAt sql.NullString
+	var shuffled, frozen bool
+	var drawInterval int64
+	row := readDB.QueryRow("SELECT json_array_length(upcoming), piged, created_at, updated_at, locks_at, shuffled, frozen, min_draw_interval FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&remaining, &drawnJSON, &createdAt, &updatedAt, &locksAt, &shuffled, &frozen, &drawInterval); err != nil {
+		if doc, err := readArchiveFile(deckID); err == nil {
+			showArchivedDeckInfo(w, doc)
+			return
+		}
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	}
+
+	var drawnCards []DrawnCard
+	json.Unmarshal([]byte(drawnJSON), &drawnCards)
+
+	info := DeckInfo{
+		ID:        deckID,
+		Status:    "active",
+		Remaining: remaining,
+		Drawn:     len(drawnCards),
+		CreatedAt: createdAt.String,
+		UpdatedAt: updatedAt.String,
+		LocksAt:   locksAt.String,
+		Locked:    deadlinePassed(locksAt.String),
+		Shuffled:  shuffled,
+		Frozen:    frozen,
+
+		MinDrawInterval: formatDrawInterval(time.Duration(drawInterval) * time.Millisecond),
+		Labels:          labelCounts(drawnCards),
+	}
+
+	writeJSON(w, info)
+}
+
+// setDeckDeadline changes or clears (empty locks_at) the deadline of a deck.
+// Once the deadline has passed it can no longer be changed.
+func setDeckDeadline(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	locksAt, err := parseDeadline(r.URL.Query().Get("locks_at"))
+	v.Check(err == nil, "locks_at", "invalid_time", "locks_at must be an RFC 3339 time")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusLocked)
+		return
+	}
+
+	if _, err := db.Exec("UPDATE decks SET locks_at = ?, updated_at = ? WHERE id = ?", locksAt, now(), deckID); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"deck_id": deckID, "locks_at": locksAt})
+}
+
+// setDeckFrozen freezes or unfreezes a deck. While frozen every mutation is
+// refused with 423 and reads keep working, e.g. to back up or export a deck
+// in a known state. The flag is checked under mu like the deadline, so no
+// mutation runs after the freeze is acknowledged. It is for admins only, so
+// that a client cannot freeze a deck it does not run or lift a freeze.
+func setDeckFrozen(w http.ResponseWriter, deckID string, frozen bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result, err := db.Exec("UPDATE decks SET frozen = ? WHERE id = ?", frozen, deckID)
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, errDeckNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"deck_id": deckID, "frozen": frozen})
+}
+
+// ForceUnlock represents the outcome of POST /admin/deck/{id}/force-unlock,
+// with what held the deck before it was cleared.
+type ForceUnlock struct {
+	DeckID    string `json:"deck_id"`
+	WasFrozen bool   `json:"was_frozen"`
+	WasLocked bool   `json:"was_locked"`
+	LocksAt   string `json:"cleared_locks_at,omitempty"`
+}
+
+// handleAdminDeck serves POST /admin/deck/{id}/force-unlock, the recovery
+// for a deck left frozen by a client that never unfroze it or locked by a
+// deadline: it unfreezes the deck and clears its deadline, including one
+// that has passed, which setDeckDeadline refuses to change.
+func handleAdminDeck(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/deck"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "force-unlock" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	deckID := parts[0]
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var locksAt sql.NullString
+	result := ForceUnlock{DeckID: deckID}
+	if err := db.QueryRow("SELECT locks_at, frozen FROM decks WHERE id = ?", deckID).Scan(&locksAt, &result.WasFrozen); err != nil {
+		http.Error(w, errDeckNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	result.LocksAt, result.WasLocked = locksAt.String, deadlinePassed(locksAt.String)
+	if _, err := db.Exec("UPDATE decks SET frozen = 0, locks_at = NULL, updated_at = ? WHERE id = ?", now(), deckID); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("FORCE-UNLOCK deck %s from %s: frozen %t, locks_at %q", deckID, clientIP(r), result.WasFrozen, result.LocksAt)
+
+	writeJSON(w, result)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestDeadline moves the injected clock past a deck's locks_at: mutations and
+// deadline changes are then refused with 423 while reads keep working.
+func TestDeadline(t *testing.T) {
+	server := newTestServer(t)
+	fake := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	clock = fake
+	t.Cleanup(func() { clock = realClock{} })
+
+	deckID := fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?locks_at=2024-01-01T11:00:00Z").ID
+	base := server.URL + "/deck/" + deckID
+
+	if status := getStatus(t, http.MethodGet, base+"/draw/1"); status != http.StatusOK {
+		t.Fatalf("draw before the deadline returned %d", status)
+	}
+	if status := getStatus(t, http.MethodPost, base+"/locks-at?locks_at=2024-01-01T12:30:00%2B01:00"); status != http.StatusOK {
+		t.Fatalf("moving the deadline returned %d", status)
+	}
+	if info := fetchDeckInfo(t, base); info.Locked || info.LocksAt != "2024-01-01T11:30:00Z" {
+		t.Errorf("before the deadline: locked %v, locks_at %q, want unlocked at 2024-01-01T11:30:00Z", info.Locked, info.LocksAt)
+	}
+
+	fake.now = time.Date(2024, 1, 1, 11, 30, 0, 0, time.UTC)
+	for _, path := range []string{"/draw/1", "/shuffle", "/draw/distinct/1"} {
+		if status := getStatus(t, http.MethodGet, base+path); status != http.StatusLocked {
+			t.Errorf("%s at the deadline returned %d, want 423", path, status)
+		}
+	}
+	if status := getStatus(t, http.MethodPost, base+"/locks-at?locks_at=2024-01-01T13:00:00Z"); status != http.StatusLocked {
+		t.Errorf("moving a passed deadline returned %d, want 423", status)
+	}
+	if status := getStatus(t, http.MethodGet, base+"/upcoming/fingerprint"); status != http.StatusOK {
+		t.Errorf("read after the deadline returned %d", status)
+	}
+	if info := fetchDeckInfo(t, base); !info.Locked || info.Remaining != 51 || info.Drawn != 1 {
+		t.Errorf("after the deadline: locked %v with %d remaining and %d drawn, want locked with 51 and 1", info.Locked, info.Remaining, info.Drawn)
+	}
+}
+
+// TestFreeze refuses every mutation of a frozen deck with 423 and serves its
+// reads, until it is unfrozen.
+func TestFreeze(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	if status := adminStatus(t, http.MethodPost, base+"/freeze"); status != http.StatusOK {
+		t.Fatalf("freeze returned %d", status)
+	}
+	if info := fetchDeckInfo(t, base); !info.Frozen || info.Locked {
+		t.Errorf("frozen deck reported frozen %v, locked %v", info.Frozen, info.Locked)
+	}
+	mutations := []struct{ method, path string }{
+		{"GET", "/draw/1"},
+		{"GET", "/shuffle"},
+		{"GET", "/draw/alternate/1"},
+		{"POST", "/draw/1/split-by-suit"},
+		{"POST", "/locks-at?locks_at=2030-01-01T00:00:00Z"},
+	}
+	for _, m := range mutations {
+		if status := getStatus(t, m.method, base+m.path); status != http.StatusLocked {
+			t.Errorf("%s %s on a frozen deck returned %d, want 423", m.method, m.path, status)
+		}
+	}
+	if status := getStatus(t, http.MethodGet, base+"/upcoming/fingerprint"); status != http.StatusOK {
+		t.Errorf("read of a frozen deck returned %d", status)
+	}
+
+	if status := adminStatus(t, http.MethodPost, base+"/unfreeze"); status != http.StatusOK {
+		t.Fatalf("unfreeze returned %d", status)
+	}
+	if status := getStatus(t, http.MethodGet, base+"/draw/1"); status != http.StatusOK {
+		t.Errorf("draw after unfreeze returned %d", status)
+	}
+	if info := fetchDeckInfo(t, base); info.Frozen || info.Remaining != 51 {
+		t.Errorf("unfrozen deck reported frozen %v with %d remaining, want 51", info.Frozen, info.Remaining)
+	}
+
+	if status := adminStatus(t, http.MethodPost, server.URL+"/deck/missing/freeze"); status != http.StatusNotFound {
+		t.Errorf("freezing a missing deck returned %d, want 404", status)
+	}
+}
+
+// TestFreezeRequiresAdmin refuses to freeze or unfreeze a deck without the
+// admin token, and leaves the deck as it was.
+func TestFreezeRequiresAdmin(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	for _, action := range []string{"/freeze", "/unfreeze"} {
+		if status := getStatus(t, http.MethodPost, base+action); status != http.StatusForbidden {
+			t.Errorf("POST %s without a token returned %d, want 403", action, status)
+		}
+	}
+	if info := fetchDeckInfo(t, base); info.Frozen {
+		t.Error("deck frozen without a token")
+	}
+
+	if status := adminStatus(t, http.MethodPost, base+"/freeze"); status != http.StatusOK {
+		t.Fatalf("freeze returned %d", status)
+	}
+	if status := getStatus(t, http.MethodPost, base+"/unfreeze"); status != http.StatusForbidden {
+		t.Errorf("unfreeze without a token returned %d, want 403", status)
+	}
+	if info := fetchDeckInfo(t, base); !info.Frozen {
+		t.Error("deck unfrozen without a token")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var startWorker sync.Once
+
+// newTestServer serves the API from a fresh database.
+func newTestServer(tb testing.TB) *httptest.Server {
+	tb.Helper()
+
+	dir := tb.TempDir()
+	if err := openDatabases(filepath.Join(dir, "deck.db")); err != nil {
+		tb.Fatal(err)
+	}
+	// Purges archive decks; keep their documents out of the working tree.
+	savedArchiveDir := archiveDir
+	archiveDir = filepath.Join(dir, "archive")
+	createTable()
+	createPoolTables()
+	createPileTable()
+	createShoeTable()
+	createShuffleLogTable()
+	createEventTable()
+	createChangeTable()
+	createCardIndex()
+	stripStoredImages()
+	startWorker.Do(func() { go handleRequests() })
+
+	server := httptest.NewServer(routes())
+	writeDB, roDB := db, readDB
+	tb.Cleanup(func() {
+		server.Close()
+		writeDB.Close()
+		roDB.Close()
+		archiveDir = savedArchiveDir
+	})
+	return server
+}
+
+// newTestDeck creates a deck of packs packs and returns its ID.
+func newTestDeck(tb testing.TB, server *httptest.Server, packs int) string {
+	tb.Helper()
+
+	resp, err := http.Get(fmt.Sprintf("%s/deck/new/%d", server.URL, packs))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var deck Deck
+	if err := json.NewDecoder(resp.Body).Decode(&deck); err != nil {
+		tb.Fatal(err)
+	}
+	return deck.ID
+}
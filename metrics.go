@@ -0,0 +1,235 @@
+package main
+
+import (
+	"log"
+	"math/bits"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EndpointStat represents the request count and rate of one endpoint.
+type EndpointStat struct {
+	Endpoint      string  `json:"endpoint"`
+	Requests      int64   `json:"requests"`
+	RatePerMinute float64 `json:"rate_per_minute"`
+}
+
+// metricsRegistry counts requests per endpoint since the server started.
+type metricsRegistry struct {
+	mu      sync.Mutex
+	started time.Time
+	counts  map[string]int64
+}
+
+var metrics = &metricsRegistry{started: time.Now(), counts: make(map[string]int64)}
+
+// queueDepth is the number of requests waiting for the worker.
+var queueDepth int64
+
+func (m *metricsRegistry) record(endpoint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[endpoint]++
+}
+
+// Snapshot returns the endpoint stats sorted by endpoint name.
+func (m *metricsRegistry) Snapshot() []EndpointStat {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	minutes := time.Since(m.started).Minutes()
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	stats := make([]EndpointStat, 0, len(m.counts))
+	for endpoint, count := range m.counts {
+		stats = append(stats, EndpointStat{
+			Endpoint:      endpoint,
+			Requests:      count,
+			RatePerMinute: float64(count) / minutes,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Endpoint < stats[j].Endpoint })
+	return stats
+}
+
+// instrument wraps a handler so that every call is counted under endpoint,
+// logged with the client address when debugLogging is on, and speaks
+// MessagePack or indented JSON when the request asks for it.
+func instrument(endpoint string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if debugLogging {
+			log.Printf("DEBUG %s %s from %s", r.Method, r.URL.Path, clientIP(r))
+		}
+		w, finish := withResponseEncoding(w, r)
+		defer finish()
+		// A request answered by an injected fault never reached the endpoint,
+		// so it is not counted as one of its requests.
+		if injectFault(endpoint, w, r) {
+			return
+		}
+		metrics.record(endpoint)
+		if !decodeMsgpackRequest(w, r) {
+			return
+		}
+		h(w, r)
+	}
+}
+
+// submit sends a request to the worker and waits for its response.
+func submit(req Request) Response {
+	req.EnqueuedAt = time.Now()
+	atomic.AddInt64(&queueDepth, 1)
+	requestChannel <- req
+	return <-req.ReplyCh
+}
+
+// latencyWindow is the number of queue waits kept to compute percentiles.
+const latencyWindow = 1000
+
+// latencyWarnEvery is the least time between two queue-wait warnings.
+const latencyWarnEvery = time.Minute
+
+// latencyBuckets is the number of histogram buckets of latencyBucket.
+const latencyBuckets = 64 + 58*32
+
+// latencyTracker keeps the most recent queue waits in a ring buffer, and a
+// histogram of the same waits so that percentiles are read without sorting.
+type latencyTracker struct {
+	mu        sync.Mutex
+	samples   []int64
+	next      int
+	full      bool
+	histogram [latencyBuckets]int32
+	warnedAt  time.Time
+}
+
+// latencyBucket returns the histogram bucket of a wait: one per millisecond
+// below 64 ms, then 32 per doubling, so a percentile read from the histogram
+// is at most about 3% below the true one.
+func latencyBucket(ms int64) int {
+	if ms < 64 {
+		return int(max(ms, 0))
+	}
+	shift := bits.Len64(uint64(ms)) - 6
+	return 64 + (shift-1)*32 + int(ms>>shift) - 32
+}
+
+// latencyBucketFloor returns the smallest wait of a histogram bucket.
+func latencyBucketFloor(bucket int) int64 {
+	if bucket < 64 {
+		return int64(bucket)
+	}
+	shift := (bucket-64)/32 + 1
+	return int64((bucket-64)%32+32) << shift
+}
+
+// LatencyStats represents the queue-wait percentiles in milliseconds.
+type LatencyStats struct {
+	Samples int   `json:"samples"`
+	P50Ms   int64 `json:"p50_ms"`
+	P99Ms   int64 `json:"p99_ms"`
+}
+
+var queueLatency = &latencyTracker{samples: make([]int64, latencyWindow)}
+
+var (
+	debugLogging  = os.Getenv("DEBUG") == "true"
+	latencyWarnMs = envInt("LATENCY_WARN_MS", 100)
+)
+
+// envInt reads an integer from the environment, falling back to def.
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// observeQueueWait records how long req waited before the worker picked it
+// up, and warns when the P99 wait is over LATENCY_WARN_MS, at most once per
+// latencyWarnEvery.
+func observeQueueWait(req Request) {
+	queueWaitMs := time.Since(req.EnqueuedAt).Milliseconds()
+	if debugLogging {
+		log.Printf("DEBUG %s %s waited %d ms in queue", req.Type, req.DeckID, queueWaitMs)
+	}
+
+	stats := queueLatency.add(queueWaitMs)
+	if stats.P99Ms > int64(latencyWarnMs) && queueLatency.warnDue(clock.Now()) {
+		log.Printf("WARNING queue wait P99 is %d ms (threshold %d ms)", stats.P99Ms, latencyWarnMs)
+	}
+}
+
+func (t *latencyTracker) add(ms int64) LatencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.full {
+		t.histogram[latencyBucket(t.samples[t.next])]--
+	}
+	t.samples[t.next] = ms
+	t.histogram[latencyBucket(ms)]++
+	t.next = (t.next + 1) % len(t.samples)
+	if t.next == 0 {
+		t.full = true
+	}
+	return t.statsLocked()
+}
+
+// warnDue reports whether a warning may be logged at now, that is whether
+// none was in the last latencyWarnEvery, and if so counts it as logged.
+func (t *latencyTracker) warnDue(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.warnedAt.IsZero() && now.Sub(t.warnedAt) < latencyWarnEvery {
+		return false
+	}
+	t.warnedAt = now
+	return true
+}
+
+// Stats returns the current P50/P99 queue-wait latency.
+func (t *latencyTracker) Stats() LatencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.statsLocked()
+}
+
+func (t *latencyTracker) statsLocked() LatencyStats {
+	n := t.next
+	if t.full {
+		n = len(t.samples)
+	}
+	if n == 0 {
+		return LatencyStats{}
+	}
+	return LatencyStats{
+		Samples: n,
+		P50Ms:   t.percentileLocked((n - 1) * 50 / 100),
+		P99Ms:   t.percentileLocked((n - 1) * 99 / 100),
+	}
+}
+
+// percentileLocked returns the wait of the given rank, counted from 0 in
+// increasing order, as the floor of its histogram bucket.
+func (t *latencyTracker) percentileLocked(rank int) int64 {
+	seen := 0
+	for bucket, count := range t.histogram {
+		seen += int(count)
+		if seen > rank {
+			return latencyBucketFloor(bucket)
+		}
+	}
+	return 0
+}
+
+func showLatency(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, queueLatency.Stats())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	for _, ms := range []int64{-3, 0, 1, 63, 64, 65, 127, 128, 500, 1000, 99999, 1 << 40, 1<<63 - 1} {
+		bucket := latencyBucket(ms)
+		if bucket < 0 || bucket >= latencyBuckets {
+			t.Fatalf("%d ms in bucket %d of %d", ms, bucket, latencyBuckets)
+		}
+		floor := latencyBucketFloor(bucket)
+		if ms < 64 && floor != max(ms, 0) || floor > max(ms, 0) || float64(floor) < float64(ms)*0.96 {
+			t.Errorf("%d ms read back as %d", ms, floor)
+		}
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	tracker := &latencyTracker{samples: make([]int64, latencyWindow)}
+	if stats := tracker.Stats(); stats != (LatencyStats{}) {
+		t.Errorf("empty tracker = %+v", stats)
+	}
+	for ms := int64(1); ms <= 50; ms++ {
+		tracker.add(ms)
+	}
+	if stats := tracker.Stats(); stats != (LatencyStats{Samples: 50, P50Ms: 25, P99Ms: 49}) {
+		t.Errorf("stats of 1 to 50 ms = %+v", stats)
+	}
+
+	// Older waits leave the window as new ones come in.
+	for i := 0; i < latencyWindow; i++ {
+		tracker.add(500)
+	}
+	for i := 0; i < latencyWindow; i++ {
+		tracker.add(5)
+	}
+	if stats := tracker.Stats(); stats != (LatencyStats{Samples: latencyWindow, P50Ms: 5, P99Ms: 5}) {
+		t.Errorf("stats after the window moved = %+v", stats)
+	}
+}
+
+func TestLatencyWarningIsRateLimited(t *testing.T) {
+	tracker := &latencyTracker{samples: make([]int64, latencyWindow)}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, step := range []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},
+		{time.Second, false},
+		{latencyWarnEvery - time.Second, false},
+		{latencyWarnEvery, true},
+		{latencyWarnEvery + time.Second, false},
+	} {
+		if got := tracker.warnDue(start.Add(step.after)); got != step.want {
+			t.Errorf("warning due %v after the first: %v, want %v", step.after, got, step.want)
+		}
+	}
+}
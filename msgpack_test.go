@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMsgpackCodec(t *testing.T) {
+	values := []string{
+		`null`, `true`, `false`, `0`, `127`, `128`, `65536`, `-1`, `-33`, `-40000`,
+		`9007199254740993`, `-9223372036854775808`, `1.5`, `""`, `"ah"`,
+		`"` + strings.Repeat("x", 300) + `"`, `[]`, `[1,"two",[3]]`,
+		`{"deck_id":"abc","remaining":52,"cards":[{"code":"ah","value":"ACE"}]}`,
+	}
+	for _, value := range values {
+		packed, err := jsonToMsgpack([]byte(value))
+		if err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+		back, err := msgpackToJSON(packed)
+		if err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+		var want, got any
+		json.Unmarshal([]byte(value), &want)
+		json.Unmarshal(back, &got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s came back as %s", value, back)
+		}
+	}
+
+	if packed, _ := jsonToMsgpack([]byte(`{"seed":42}`)); !bytes.Equal(packed, []byte{0x81, 0xa4, 's', 'e', 'e', 'd', 42}) {
+		t.Errorf(`{"seed":42} encoded as % x`, packed)
+	}
+	for _, bad := range [][]byte{{}, {0xa4, 's'}, {0xc1}, {0xd4, 1, 2}, {0x81, 1, 2}, {0x01, 0x02}, {0xdd, 0xff, 0xff, 0xff, 0xff}} {
+		if _, err := msgpackToJSON(bad); err == nil {
+			t.Errorf("% x decoded without an error", bad)
+		}
+	}
+}
+
+func TestMsgpackEndpoints(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	do := func(method, url, contentType string, body []byte) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+		req.Header.Set("Accept", msgpackType)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+
+	_, plain := getBody(t, base)
+	resp, packed := do(http.MethodGet, base, "", nil)
+	decoded, err := msgpackToJSON(packed)
+	if err != nil || resp.Header.Get("Content-Type") != msgpackType {
+		t.Fatalf("GET with msgpack: %s, %v", resp.Header.Get("Content-Type"), err)
+	}
+	var want, got Deck
+	json.Unmarshal([]byte(plain), &want)
+	json.Unmarshal(decoded, &got)
+	if got.ID != deckID || !reflect.DeepEqual(got, want) {
+		t.Errorf("msgpack deck = %+v, want %+v", got, want)
+	}
+
+	resp, packed = do(http.MethodGet, base+"/draw/2", "", nil)
+	decoded, _ = msgpackToJSON(packed)
+	var drawn Deck
+	json.Unmarshal(decoded, &drawn)
+	if resp.StatusCode != http.StatusOK || len(drawn.Cards) != 2 || drawn.Cards[0].Image == "" {
+		t.Errorf("draw with msgpack: status %d, %+v", resp.StatusCode, drawn)
+	}
+
+	// A msgpack body is read as the same JSON object.
+	before, _ := loadUpcomingCards(deckID)
+	reversed := cardCodes(before)
+	slices.Reverse(reversed)
+	order, _ := json.Marshal(map[string][]string{"order": reversed})
+	body, _ := jsonToMsgpack(order)
+	if resp, _ := do(http.MethodPatch, base+"/upcoming/reorder", msgpackType, body); resp.StatusCode != http.StatusOK {
+		t.Fatalf("msgpack reorder returned %d", resp.StatusCode)
+	}
+	if after, _ := loadUpcomingCards(deckID); !reflect.DeepEqual(cardCodes(after), reversed) {
+		t.Errorf("upcoming after a msgpack reorder = %v", cardCodes(after))
+	}
+
+	resp, packed = do(http.MethodPatch, base+"/upcoming/reorder", msgpackType, []byte{0x81, 0xa5, 'o'})
+	decoded, _ = msgpackToJSON(packed)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(decoded), "invalid_msgpack") {
+		t.Errorf("invalid msgpack body: status %d, %s", resp.StatusCode, decoded)
+	}
+}
+
+// FuzzMsgpackFromJSON checks that any JSON value comes back from MessagePack
+// as encoding/json itself would read it.
+func FuzzMsgpackFromJSON(f *testing.F) {
+	for _, seed := range []string{`null`, `-0`, `1e21`, `18446744073709551615`, `-9223372036854775809`, `"\ud800"`, `{"a":1,"a":2}`, `[1.5,"x",{"y":[]}]`} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var want any
+		if err := json.Unmarshal(data, &want); err != nil {
+			return
+		}
+		packed, err := jsonToMsgpack(data)
+		if err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		back, err := msgpackToJSON(packed)
+		if err != nil {
+			t.Fatalf("%s: % x: %v", data, packed, err)
+		}
+		var got any
+		if err := json.Unmarshal(back, &got); err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s came back as %s (%v)", data, back, err)
+		}
+	})
+}
+
+// FuzzMsgpackToJSON checks that any MessagePack value either is refused or
+// gives JSON that goes through MessagePack and back unchanged.
+func FuzzMsgpackToJSON(f *testing.F) {
+	for _, seed := range [][]byte{{0xc0}, {0x81, 0xa1, 'a', 0x01}, {0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, {0xca, 0x7f, 0xc0, 0, 0}, {0xc4, 1, 0xff}, {0x92, 0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		first, err := msgpackToJSON(data)
+		if err != nil {
+			return
+		}
+		if !json.Valid(first) {
+			t.Fatalf("% x gave invalid JSON %s", data, first)
+		}
+		packed, err := jsonToMsgpack(first)
+		if err != nil {
+			t.Fatalf("%s: %v", first, err)
+		}
+		second, err := msgpackToJSON(packed)
+		if err != nil || !bytes.Equal(second, first) {
+			t.Fatalf("%s came back as %s (%v)", first, second, err)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// maxMultiDrawDecks caps the number of decks drawn from in one call.
+const maxMultiDrawDecks = 50
+
+// MultiDrawRequest represents the body of POST /decks/draw.
+type MultiDrawRequest struct {
+	DeckIDs []string `json:"deck_ids"`
+	Count   int      `json:"count"`
+}
+
+// MultiDrawResult represents the outcome of the draw on one deck.
+type MultiDrawResult struct {
+	Cards     []Card `json:"cards,omitempty"`
+	Remaining int    `json:"remaining"`
+	Error     string `json:"error,omitempty"`
+}
+
+// drawMultipleDecks draws the same number of cards from several decks.
+//
+// Each deck is drawn through the worker like a normal draw, so history is
+// recorded per deck and ?label= tags the cards drawn from each. The draws are
+// independent: there is no cross-deck atomicity, and a missing or empty
+// deck only fails its own entry.
+func drawMultipleDecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body MultiDrawRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		v := &Validator{}
+		v.Add("body", "invalid_json", "request body must be a JSON object")
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	v := &Validator{}
+	if len(body.DeckIDs) == 0 {
+		v.Add("deck_ids", "missing", "deck_ids is required")
+	} else {
+		v.Check(len(body.DeckIDs) <= maxMultiDrawDecks, "deck_ids", "too_many", "at most %d decks per call", maxMultiDrawDecks)
+		// Results are keyed by deck: a deck listed twice would be drawn
+		// twice and report only one of its draws.
+		seen := make(map[string]bool, len(body.DeckIDs))
+		for _, deckID := range body.DeckIDs {
+			if seen[deckID] {
+				v.Add("deck_ids", "duplicate", "deck %s is listed more than once", deckID)
+				break
+			}
+			seen[deckID] = true
+		}
+	}
+	if body.Count == 0 {
+		body.Count = 1
+	}
+	v.Check(body.Count >= 1 && body.Count <= maxDrawCount, "count", "out_of_range", "count must be between 1 and %d", maxDrawCount)
+	label := r.URL.Query().Get("label")
+	checkDrawTag(v, "label", label)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	results := make(map[string]MultiDrawResult, len(body.DeckIDs))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, deckID := range body.DeckIDs {
+		wg.Add(1)
+		go func(deckID string) {
+			defer wg.Done()
+			resp := submit(Request{
+				Type:    "draw",
+				DeckID:  deckID,
+				Draw:    DrawParams{Count: body.Count, Label: label},
+				ReplyCh: make(chan Response),
+			})
+
+			result := MultiDrawResult{Cards: resp.Deck.Cards, Remaining: resp.Deck.Remaining}
+			if resp.Error != nil {
+				result = MultiDrawResult{Error: resp.Error.Error()}
+			}
+
+			resultsMu.Lock()
+			results[deckID] = result
+			resultsMu.Unlock()
+		}(deckID)
+	}
+	wg.Wait()
+
+	writeJSON(w, map[string]map[string]MultiDrawResult{"results": results})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMultiDrawRejectsDuplicateDecks(t *testing.T) {
+	server := newTestServer(t)
+	first := newTestDeck(t, server, 1)
+	second := newTestDeck(t, server, 1)
+
+	body := `{"deck_ids":["` + first + `","` + second + `","` + first + `"],"count":2}`
+	if status := getStatusWithBody(t, http.MethodPost, server.URL+"/decks/draw", body); status != http.StatusBadRequest {
+		t.Errorf("duplicate deck_ids: status %d, want 400", status)
+	}
+	for _, deckID := range []string{first, second} {
+		if info := fetchDeckInfo(t, server.URL+"/deck/"+deckID); info.Remaining != 52 {
+			t.Errorf("deck %s drew on a rejected call: %d remaining", deckID, info.Remaining)
+		}
+	}
+
+	body = `{"deck_ids":["` + first + `","` + second + `"],"count":2}`
+	if status := getStatusWithBody(t, http.MethodPost, server.URL+"/decks/draw", body); status != http.StatusOK {
+		t.Fatalf("distinct deck_ids: status %d, want 200", status)
+	}
+	for _, deckID := range []string{first, second} {
+		if info := fetchDeckInfo(t, server.URL+"/deck/"+deckID); info.Remaining != 50 {
+			t.Errorf("deck %s: %d remaining, want 50", deckID, info.Remaining)
+		}
+	}
+}
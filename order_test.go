@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func fetchDeck(t *testing.T, method, url string) Deck {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s returned %d", method, url, resp.StatusCode)
+	}
+
+	var deck Deck
+	if err := json.NewDecoder(resp.Body).Decode(&deck); err != nil {
+		t.Fatal(err)
+	}
+	return deck
+}
+
+func cardCodes(cards []Card) []string {
+	codes := make([]string, len(cards))
+	for i, card := range cards {
+		codes[i] = card.Code
+	}
+	return codes
+}
+
+// A new deck is not shuffled, so its upcoming cards start 2h, 3h, 4h, ...
+func TestDrawOrder(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	tests := []struct {
+		path  string
+		codes []string
+		order string
+	}{
+		{"/draw/3", []string{"2h", "3h", "4h"}, orderTopFirst},
+		{"/draw/3?order=top_first", []string{"5h", "6h", "7h"}, orderTopFirst},
+		{"/draw/3?order=bottom_first", []string{"10h", "9h", "8h"}, orderBottomFirst},
+		{"/draw/distinct/2?order=bottom_first", []string{"qh", "jh"}, orderBottomFirst},
+		{"/draw/alternate/3", []string{"kh", "as", "ah"}, orderTopFirst},
+	}
+	for _, tt := range tests {
+		deck := fetchDeck(t, http.MethodGet, base+tt.path)
+		if got := cardCodes(deck.Cards); !reflect.DeepEqual(got, tt.codes) || deck.Order != tt.order {
+			t.Errorf("%s drew %v in %q order, want %v in %q order", tt.path, got, deck.Order, tt.codes, tt.order)
+		}
+	}
+
+	// bottom_first only reorders the response: the next card is still the
+	// one after the cards drawn.
+	deck := fetchDeck(t, http.MethodGet, base+"/draw/1")
+	if got := cardCodes(deck.Cards); !reflect.DeepEqual(got, []string{"2d"}) {
+		t.Errorf("next card is %v, want [2d]", got)
+	}
+}
+
+func TestDealOrder(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	deck := fetchDeck(t, http.MethodPost, server.URL+"/deck/"+deckID+"/shuffle-deal/2/3")
+	if deck.Order != orderTopFirst {
+		t.Errorf("deal order is %q, want %q", deck.Order, orderTopFirst)
+	}
+	if len(deck.Hands) != 2 || len(deck.Hands[0]) != 3 || len(deck.Hands[1]) != 3 {
+		t.Fatalf("dealt %v", deck.Hands)
+	}
+}
+
+func TestSortedDraw(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	// Put a known, unsorted order on top.
+	upcoming, _ := loadUpcomingCards(deckID)
+	top := []string{"as", "10h", "2c", "kh", "2h", "jd"}
+	order := append([]string{}, top...)
+	for _, card := range upcoming {
+		switch card.Code {
+		case "as", "10h", "2c", "kh", "2h", "jd":
+		default:
+			order = append(order, card.Code)
+		}
+	}
+	body, _ := json.Marshal(map[string][]string{"order": order})
+	req, _ := http.NewRequest(http.MethodPatch, base+"/upcoming/reorder", bytes.NewReader(body))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("reorder: %v", err)
+	}
+
+	deck := fetchDeck(t, http.MethodGet, base+"/draw/6?sort=true")
+	if got, want := cardCodes(deck.Cards), []string{"2h", "10h", "kh", "jd", "2c", "as"}; !reflect.DeepEqual(got, want) || deck.Order != orderCanonical {
+		t.Errorf("sorted draw gave %v in %q order, want %v", got, deck.Order, want)
+	}
+	drawn, _ := loadDrawnCards(deckID)
+	history := make([]string, len(drawn))
+	for i, entry := range drawn {
+		history[i] = entry.Code
+	}
+	if !reflect.DeepEqual(history, top) {
+		t.Errorf("history = %v, want the draw order %v", history, top)
+	}
+
+	resp, err := http.Get(base + "/draw/1?sort=true&order=bottom_first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("sort with order returned %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxDrawInterval caps the minimum interval between two draws of a deck.
+const maxDrawInterval = 24 * time.Hour
+
+// drawTooSoonError is returned by a draw that arrives less than the deck's
+// minimum draw interval after the previous one. Wait is what is left of the
+// interval.
+type drawTooSoonError struct {
+	Wait time.Duration
+}
+
+func (e *drawTooSoonError) Error() string {
+	return fmt.Sprintf("Draw too soon, retry in %s", e.Wait)
+}
+
+// DrawTooSoon represents the body of a paced draw refused with 429.
+type DrawTooSoon struct {
+	Error        string `json:"error"`
+	Code         string `json:"code"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+// writeDrawTooSoon writes a paced draw with 429. Retry-After has whole
+// seconds, so it is rounded up; retry_after_ms has the exact wait.
+func writeDrawTooSoon(w http.ResponseWriter, err *drawTooSoonError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.Wait.Seconds()))))
+	writeJSONStatus(w, http.StatusTooManyRequests, DrawTooSoon{Error: err.Error(), Code: "DRAW_TOO_SOON", RetryAfterMs: err.Wait.Milliseconds()})
+}
+
+// parseDrawInterval validates a min_draw_interval value such as 5s. An empty
+// value or 0 means no pacing.
+func parseDrawInterval(v *Validator, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	interval, err := time.ParseDuration(value)
+	v.Check(err == nil && interval >= 0 && interval <= maxDrawInterval, "min_draw_interval", "invalid_duration", "min_draw_interval must be a duration between 0s and %s", maxDrawInterval)
+	return interval
+}
+
+// formatDrawInterval writes an interval for the deck summary, or "" for none.
+func formatDrawInterval(interval time.Duration) string {
+	if interval == 0 {
+		return ""
+	}
+	return interval.String()
+}
+
+// paceDraw is the pacing of every path that takes cards out of a deck. It
+// refuses a draw that comes less than the deck's minimum draw interval after
+// the previous one, and otherwise stores the time of this one, to the
+// nanosecond, for the next. It runs in the transaction that saves the draw,
+// before the drawn history is written, so a draw that fails later leaves the
+// previous time in place. The time is stored with the deck, so the pacing
+// survives a restart; decks last drawn before it was stored fall back to the
+// last entry of their drawn history, which only has whole seconds. The
+// caller must hold mu.
+func paceDraw(exec execer, deckID string) error {
+	var ms int64
+	var lastDraw string
+	row := exec.QueryRow("SELECT min_draw_interval, COALESCE(last_draw_at, json_extract(piged, '$[#-1].time'), '') FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&ms, &lastDraw); err != nil {
+		return errDeckNotFound
+	}
+	if interval := time.Duration(ms) * time.Millisecond; interval > 0 {
+		if last, err := time.Parse(time.RFC3339Nano, lastDraw); err == nil {
+			if wait := last.Add(interval).Sub(clock.Now()); wait > 0 {
+				return &drawTooSoonError{Wait: wait}
+			}
+		}
+	}
+	_, err := exec.Exec("UPDATE decks SET last_draw_at = ? WHERE id = ?", clock.Now().UTC().Format(time.RFC3339Nano), deckID)
+	return err
+}
+
+// setDrawInterval serves PATCH /deck/{id}?min_draw_interval=5s, which changes
+// the minimum interval between two draws; an empty value or 0 turns pacing
+// off. It answers with the deck summary. It is for admins only, like the
+// other changes to how a deck may be used.
+func setDrawInterval(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	interval := parseDrawInterval(v, r.URL.Query().Get("min_draw_interval"))
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	if err := checkDeckUnlocked(deckID); err != nil {
+		mu.Unlock()
+		writeError(w, err)
+		return
+	}
+	_, err := db.Exec("UPDATE decks SET min_draw_interval = ?, updated_at = ? WHERE id = ?", interval.Milliseconds(), now(), deckID)
+	mu.Unlock()
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	showDeckInfo(w, deckID)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that tells a time the test sets.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestMinDrawInterval(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	fake := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	clock = fake
+	t.Cleanup(func() { clock = realClock{} })
+
+	resp, err := http.Get(server.URL + "/deck/new/1?min_draw_interval=5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created Deck
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	base := server.URL + "/deck/" + created.ID
+
+	draw := func() *http.Response {
+		t.Helper()
+		resp, err := http.Get(base + "/draw/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := draw(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first draw returned %d", resp.StatusCode)
+	}
+	fake.now = fake.now.Add(2500 * time.Millisecond)
+	resp = draw()
+	var body DrawTooSoon
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "3" || body.RetryAfterMs != 2500 || body.Code != "DRAW_TOO_SOON" {
+		t.Errorf("early draw: status %d, Retry-After %q, %+v", resp.StatusCode, resp.Header.Get("Retry-After"), body)
+	}
+	if resp := draw(); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("refused draw reset the interval: %d", resp.StatusCode)
+	}
+	fake.now = fake.now.Add(2500 * time.Millisecond)
+	if resp := draw(); resp.StatusCode != http.StatusOK {
+		t.Errorf("draw after the interval returned %d", resp.StatusCode)
+	}
+
+	info := fetchDeckInfo(t, base)
+	if info.MinDrawInterval != "5s" {
+		t.Errorf("summary min_draw_interval = %q, want 5s", info.MinDrawInterval)
+	}
+
+	patch := func(value string) int {
+		t.Helper()
+		return adminStatus(t, http.MethodPatch, base+"?min_draw_interval="+value)
+	}
+	if got := getStatus(t, http.MethodPatch, base+"?min_draw_interval=0"); got != http.StatusForbidden {
+		t.Errorf("PATCH without a token returned %d, want 403", got)
+	}
+	if info := fetchDeckInfo(t, base); info.MinDrawInterval != "5s" {
+		t.Errorf("PATCH without a token changed min_draw_interval to %q", info.MinDrawInterval)
+	}
+	if got := patch("soon"); got != http.StatusBadRequest {
+		t.Errorf("PATCH with an invalid interval returned %d", got)
+	}
+	if got := patch("0"); got != http.StatusOK {
+		t.Fatalf("PATCH returned %d", got)
+	}
+	if resp := draw(); resp.StatusCode != http.StatusOK {
+		t.Errorf("draw with pacing off returned %d", resp.StatusCode)
+	}
+	if info := fetchDeckInfo(t, base); info.MinDrawInterval != "" {
+		t.Errorf("summary min_draw_interval = %q after turning it off", info.MinDrawInterval)
+	}
+}
+
+func fetchDeckInfo(t *testing.T, url string) DeckInfo {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var info DeckInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	return info
+}
+
+// The last draw is stored to the nanosecond, so pacing holds below a second
+// and after the drawn cards are cleared.
+func TestDrawPaceUsesLastDrawTime(t *testing.T) {
+	server := newTestServer(t)
+	fake := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 700*int(time.Millisecond), time.UTC)}
+	clock = fake
+	t.Cleanup(func() { clock = realClock{} })
+
+	resp, err := http.Get(server.URL + "/deck/new/1?min_draw_interval=500ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created Deck
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	base := server.URL + "/deck/" + created.ID
+
+	draw := func() (int, DrawTooSoon) {
+		t.Helper()
+		resp, err := http.Get(base + "/draw/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body DrawTooSoon
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if status, _ := draw(); status != http.StatusOK {
+		t.Fatalf("first draw returned %d", status)
+	}
+	fake.now = fake.now.Add(400 * time.Millisecond)
+	if status, body := draw(); status != http.StatusTooManyRequests || body.RetryAfterMs != 100 {
+		t.Errorf("draw 400ms later: status %d, %+v", status, body)
+	}
+	if resp, err := http.Post(base+"/clear-drawn", "", nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("clear-drawn: %v", err)
+	}
+	if status, _ := draw(); status != http.StatusTooManyRequests {
+		t.Errorf("draw after clearing the drawn cards returned %d", status)
+	}
+	fake.now = fake.now.Add(100 * time.Millisecond)
+	if status, _ := draw(); status != http.StatusOK {
+		t.Errorf("draw after the interval returned %d", status)
+	}
+}
+
+// pacedDeck creates a deck drawn at most every 5s on a fake clock, and
+// returns its URL and the clock.
+func pacedDeck(t *testing.T, server string) (string, *fakeClock) {
+	t.Helper()
+	fake := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	clock = fake
+	t.Cleanup(func() { clock = realClock{} })
+	return server + "/deck/" + fetchDeck(t, http.MethodGet, server+"/deck/new/1?min_draw_interval=5s").ID, fake
+}
+
+func TestEveryDrawIsPaced(t *testing.T) {
+	server := newTestServer(t)
+	draws := []struct {
+		name, method, path, body string
+	}{
+		{"draw", http.MethodGet, "/draw/1", ""},
+		{"distinct", http.MethodGet, "/draw/distinct/2", ""},
+		{"alternate", http.MethodGet, "/draw/alternate/2", ""},
+		{"collect", http.MethodGet, "/draw/collect?suit=h&count=1", ""},
+		{"teach", http.MethodPost, "/draw/teach/1", ""},
+		{"weighted", http.MethodPost, "/draw/1/weighted", `{"weights": {"ah": 5}}`},
+		{"shuffle-deal", http.MethodPost, "/shuffle-deal/2/1", ""},
+		{"deal-auto", http.MethodPost, "/deal/auto?game=bridge", ""},
+		{"play-to-pile", http.MethodPost, "/play/1/to/discard", ""},
+		{"split", http.MethodPost, "/split?at=10&consume=true", ""},
+		{"transact", http.MethodPost, "/transact", `[{"op": "draw", "count": 1}]`},
+	}
+	// Every path that takes cards out is a draw: each pair of them is paced.
+	for _, first := range draws {
+		if first.name == "split" {
+			continue // it takes every card, leaving nothing to draw second
+		}
+		for _, second := range draws {
+			base, fake := pacedDeck(t, server.URL)
+			if status := getStatusWithBody(t, first.method, base+first.path, first.body); status != http.StatusOK {
+				t.Fatalf("%s: first draw returned %d", first.name, status)
+			}
+			remaining := fetchDeckInfo(t, base).Remaining
+			fake.now = fake.now.Add(time.Second)
+			if status := getStatusWithBody(t, second.method, base+second.path, second.body); status != http.StatusTooManyRequests {
+				t.Errorf("%s after %s: status %d, want 429", second.name, first.name, status)
+			}
+			if got := fetchDeckInfo(t, base).Remaining; got != remaining {
+				t.Errorf("%s after %s: refused draw left %d cards, want %d", second.name, first.name, got, remaining)
+			}
+			fake.now = fake.now.Add(5 * time.Second)
+			if status := getStatusWithBody(t, second.method, base+second.path, second.body); status != http.StatusOK {
+				t.Errorf("%s after %s and the interval: status %d", second.name, first.name, status)
+			}
+		}
+	}
+}
+
+func getStatusWithBody(t *testing.T, method, url, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
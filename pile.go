@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// pileNamePattern restricts pile names to something safe to put in a URL.
+var pileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Pile represents a named pile of cards played from a deck, e.g. the table.
+type Pile struct {
+	DeckID    string `json:"deck_id"`
+	Name      string `json:"pile"`
+	Cards     []Card `json:"cards"`
+	Remaining int    `json:"remaining"`
+}
+
+func createPileTable() {
+	sqlStmt := `CREATE TABLE IF NOT EXISTS piles (
+		deck_id TEXT,
+		name TEXT,
+		cards TEXT, -- Cards in the pile, oldest first
+		PRIMARY KEY (deck_id, name)
+	);`
+	if _, err := db.Exec(sqlStmt); err != nil {
+		log.Fatalf("Error creating pile table: %v", err)
+	}
+}
+
+// playToPile draws count cards from the top of a deck straight onto a named
+// pile. The move is all-or-nothing and does not touch the drawn history.
+func playToPile(w http.ResponseWriter, deckID, countStr, name string) {
+	v := &Validator{}
+	count := v.RequireInt("count", countStr, 1, maxDrawCount)
+	v.Check(pileNamePattern.MatchString(name), "pile", "invalid_name", "pile must be 1 to 64 letters, digits, - or _")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if count > len(upcomingCards) {
+		http.Error(w, errNotEnoughCards.Error(), http.StatusConflict)
+		return
+	}
+
+	pileCards, err := readPile(deckID, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pileCards = append(pileCards, upcomingCards[:count]...)
+	upcomingCards = upcomingCards[count:]
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := paceDraw(tx, deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+	// The pile goes first so that the conservation check of writeDeckState
+	// sees the played cards on the pile.
+	pileJSON, _ := marshalCards(pileCards)
+	if _, err := tx.Exec("INSERT OR REPLACE INTO piles (deck_id, name, cards) VALUES (?, ?, ?)", deckID, name, string(pileJSON)); err != nil {
+		http.Error(w, "Error updating pile", http.StatusInternalServerError)
+		return
+	}
+	if err := writeDeckState(tx, deckID, upcomingCards, drawnHistory); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, Pile{
+		DeckID:    deckID,
+		Name:      name,
+		Cards:     pileCards,
+		Remaining: len(upcomingCards),
+	})
+}
+
+// readPile returns the cards of a pile, or none if the pile does not exist
+// yet. The caller must hold mu.
+func readPile(deckID, name string) ([]Card, error) {
+	var pileJSON string
+	err := db.QueryRow("SELECT cards FROM piles WHERE deck_id = ? AND name = ?", deckID, name).Scan(&pileJSON)
+	if err == sql.ErrNoRows {
+		return []Card{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading pile")
+	}
+
+	var pileCards []Card
+	if err := json.Unmarshal([]byte(pileJSON), &pileCards); err != nil {
+		return nil, fmt.Errorf("Error parsing pile")
+	}
+	return pileCards, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxPoolSize caps the number of decks kept ready in one pool.
+const maxPoolSize = 100
+
+// poolRefillInterval is how often the background goroutine tops up pools.
+const poolRefillInterval = 5 * time.Second
+
+// poolRefillCh wakes the refill goroutine early, e.g. after an acquire.
+var poolRefillCh = make(chan struct{}, 1)
+
+// Pool represents a named pool of pre-created decks.
+type Pool struct {
+	Name      string `json:"name"`
+	Size      int    `json:"size"`
+	Available int    `json:"available"`
+}
+
+func createPoolTables() {
+	sqlStmt := `CREATE TABLE IF NOT EXISTS pools (
+		name TEXT PRIMARY KEY,
+		size INTEGER
+	);
+	CREATE TABLE IF NOT EXISTS pool_decks (
+		pool_name TEXT,
+		deck_id TEXT PRIMARY KEY
+	);`
+	if _, err := db.Exec(sqlStmt); err != nil {
+		log.Fatalf("Error creating pool tables: %v", err)
+	}
+}
+
+func handlePoolRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/pool/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "new":
+		createPool(w, r)
+	case len(parts) == 2 && parts[1] == "acquire":
+		acquireFromPool(w, parts[0])
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// createPool registers a pool and fills it up to its size.
+func createPool(w http.ResponseWriter, r *http.Request) {
+	v := &Validator{}
+	name := r.URL.Query().Get("name")
+	v.Check(name != "", "name", "missing", "name is required")
+	size := v.RequireInt("size", r.URL.Query().Get("size"), 1, maxPoolSize)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := db.Exec("INSERT OR REPLACE INTO pools (name, size) VALUES (?, ?)", name, size); err != nil {
+		http.Error(w, "Error creating pool", http.StatusInternalServerError)
+		return
+	}
+	available, err := fillPool(name, size)
+	if err != nil {
+		http.Error(w, "Error filling pool", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, Pool{Name: name, Size: size, Available: available})
+}
+
+// acquireFromPool claims one deck from a pool and returns its ID.
+func acquireFromPool(w http.ResponseWriter, name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var deckID string
+	row := db.QueryRow("SELECT deck_id FROM pool_decks WHERE pool_name = ? LIMIT 1", name)
+	if err := row.Scan(&deckID); err == sql.ErrNoRows {
+		http.Error(w, "Pool empty", http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		http.Error(w, "Error acquiring deck", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM pool_decks WHERE deck_id = ?", deckID); err != nil {
+		http.Error(w, "Error acquiring deck", http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case poolRefillCh <- struct{}{}:
+	default:
+	}
+
+	writeJSON(w, map[string]string{"deck_id": deckID})
+}
+
+// fillPool creates standard decks until the pool holds size decks and returns
+// the number available. The caller must hold mu.
+func fillPool(name string, size int) (int, error) {
+	var available int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pool_decks WHERE pool_name = ?", name).Scan(&available); err != nil {
+		return 0, err
+	}
+
+	for ; available < size; available++ {
+		deckID, err := insertDeck(db, generateCards(1, 0, CardOrder{}), "")
+		if err != nil {
+			return available, err
+		}
+		if _, err := db.Exec("INSERT INTO pool_decks (pool_name, deck_id) VALUES (?, ?)", name, deckID); err != nil {
+			return available, err
+		}
+	}
+	return available, nil
+}
+
+// refillPools keeps every pool topped up to its configured size.
+func refillPools() {
+	ticker := time.NewTicker(poolRefillInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-poolRefillCh:
+		}
+
+		mu.Lock()
+		rows, err := db.Query("SELECT name, size FROM pools")
+		if err != nil {
+			mu.Unlock()
+			log.Printf("Error listing pools: %v", err)
+			continue
+		}
+		var pools []Pool
+		for rows.Next() {
+			var pool Pool
+			if err := rows.Scan(&pool.Name, &pool.Size); err == nil {
+				pools = append(pools, pool)
+			}
+		}
+		rows.Close()
+
+		for _, pool := range pools {
+			if _, err := fillPool(pool.Name, pool.Size); err != nil {
+				log.Printf("Error refilling pool %s: %v", pool.Name, err)
+			}
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// writeJSON writes v as the JSON body of a 200 response.
+func writeJSON(w http.ResponseWriter, v any) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+// writeJSONStatus writes v as the JSON body of a response with status. Every
+// JSON body goes through it, so that ?pretty=true and msgpack apply to all.
+func writeJSONStatus(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(withImages(v))
+}
+
+// writeJSONLine writes v as one line of a newline-delimited JSON stream.
+func writeJSONLine(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(withImages(v))
+}
+
+// jsonBodyWriter rewrites the JSON body of a response once the handler is
+// done with it, for ?pretty=true or Accept: application/msgpack. A JSON body
+// is held until the handler returns and then written through convert; any
+// other body, such as a stream of NDJSON, goes through as it is written.
+type jsonBodyWriter struct {
+	http.ResponseWriter
+	// convert returns the body to send and its content type, or ok false to
+	// send the JSON as it is.
+	convert   func(body []byte) (converted []byte, contentType string, ok bool)
+	status    int
+	decided   bool
+	buffering bool
+	body      bytes.Buffer
+}
+
+// withResponseEncoding wraps w for ?pretty=true or Accept:
+// application/msgpack, the latter winning. The caller must call finish once
+// the handler has returned.
+func withResponseEncoding(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	var convert func([]byte) ([]byte, string, bool)
+	switch {
+	case acceptsMsgpack(r):
+		convert = func(body []byte) ([]byte, string, bool) {
+			converted, err := jsonToMsgpack(body)
+			return converted, msgpackType, err == nil
+		}
+	case r.URL.Query().Get("pretty") == "true":
+		convert = func(body []byte) ([]byte, string, bool) {
+			var indented bytes.Buffer
+			err := json.Indent(&indented, body, "", "  ")
+			return indented.Bytes(), "application/json", err == nil
+		}
+	default:
+		return w, func() {}
+	}
+	jw := &jsonBodyWriter{ResponseWriter: w, convert: convert, status: http.StatusOK}
+	return jw, jw.finish
+}
+
+func (w *jsonBodyWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		w.buffering = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+}
+
+func (w *jsonBodyWriter) WriteHeader(status int) {
+	w.decide()
+	if w.buffering {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *jsonBodyWriter) Write(b []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streamed responses working through the wrapper. A held JSON
+// body is only written by finish.
+func (w *jsonBodyWriter) Flush() {
+	w.decide()
+	if w.buffering {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish writes a held JSON body converted, or as it is if it cannot be.
+func (w *jsonBodyWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	body := w.body.Bytes()
+	if converted, contentType, ok := w.convert(body); ok {
+		body = converted
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func getBody(t *testing.T, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestPrettyJSON(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	_, compact := getBody(t, server.URL+"/deck/"+deckID)
+	resp, pretty := getBody(t, server.URL+"/deck/"+deckID+"?pretty=true")
+	if strings.Count(strings.TrimSpace(compact), "\n") != 0 {
+		t.Errorf("compact response spans lines:\n%s", compact)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" || !strings.Contains(pretty, "\n  \"deck_id\": \""+deckID+"\"") {
+		t.Errorf("pretty response (%s):\n%s", resp.Header.Get("Content-Type"), pretty)
+	}
+	var a, b map[string]any
+	json.Unmarshal([]byte(compact), &a)
+	json.Unmarshal([]byte(pretty), &b)
+	if len(a) == 0 || len(a) != len(b) {
+		t.Errorf("pretty response decodes to %v, want %v", b, a)
+	}
+
+	// Errors keep their status.
+	resp, body := getBody(t, server.URL+"/deck/"+deckID+"/draw/0?pretty=true")
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "\n  \"") {
+		t.Errorf("pretty error: status %d\n%s", resp.StatusCode, body)
+	}
+
+	// Routes that build their own responses are pretty too.
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/upcoming/fingerprint"},
+		{http.MethodPost, "/clear-drawn"},
+	} {
+		req, _ := http.NewRequest(route.method, server.URL+"/deck/"+deckID+route.path+"?pretty=true", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "\n  \"") {
+			t.Errorf("%s %s with ?pretty=true: status %d\n%s", route.method, route.path, resp.StatusCode, body)
+		}
+	}
+
+	// A stream is still one card per line, sent as drawn.
+	resp, err := http.Get(server.URL + "/deck/" + deckID + "/draw-stream?count=3&pretty=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	lines := 0
+	for scanner.Scan() {
+		var card Card
+		if err := json.Unmarshal(scanner.Bytes(), &card); err != nil || card.Code == "" {
+			t.Errorf("stream line %q: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Errorf("stream has %d lines, want 3", lines)
+	}
+}
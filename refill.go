@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+var errRefillCycle = errors.New("Circular refill chain")
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// refillSource returns the fallback deck configured for a deck, or "". The
+// caller must hold mu.
+func refillSource(deckID string) string {
+	var source sql.NullString
+	db.QueryRow("SELECT refill_from FROM decks WHERE id = ?", deckID).Scan(&source)
+	return source.String
+}
+
+// checkRefillChain validates that deckID may refill from source: the source
+// must exist and following its own refill chain must never lead back to
+// deckID. The caller must hold mu.
+func checkRefillChain(deckID, source string) error {
+	if source == "" {
+		return nil
+	}
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM decks WHERE id = ?", source).Scan(&exists); err != nil || exists == 0 {
+		return errors.New("Refill deck not found")
+	}
+
+	seen := map[string]bool{deckID: true}
+	for current := source; current != ""; current = refillSource(current) {
+		if seen[current] {
+			return errRefillCycle
+		}
+		seen[current] = true
+	}
+	return nil
+}
+
+// fallbackPull represents the cards a draw takes from one deck of a refill
+// chain, with the state that deck is left in.
+type fallbackPull struct {
+	source   string
+	pulled   []Card
+	upcoming []Card
+	history  []DrawnCard
+}
+
+// pullFromFallbacks takes up to n cards for a draw from deckID by following
+// its refill chain: the top cards of its fallback deck, then of that deck's
+// own fallback when it runs short, and so on. It returns what each deck gave,
+// in chain order, with the state to store in the same transaction as the
+// draw. A missing, locked or empty deck gives no cards but the walk goes on
+// past it. All decks share mu, so every deck of the chain is locked together
+// and in the same order. The caller must hold mu.
+func pullFromFallbacks(deckID string, n int) []fallbackPull {
+	var pulls []fallbackPull
+	seen := map[string]bool{deckID: true}
+	for source := refillSource(deckID); source != "" && n > 0 && !seen[source]; source = refillSource(source) {
+		seen[source] = true
+		if checkDeckUnlocked(source) != nil {
+			continue
+		}
+		upcoming, history, err := readDeckState(source)
+		if err != nil || len(upcoming) == 0 {
+			continue
+		}
+		take := min(n, len(upcoming))
+		pulls = append(pulls, fallbackPull{
+			source:   source,
+			pulled:   append([]Card(nil), upcoming[:take]...),
+			upcoming: upcoming[take:],
+			history:  history,
+		})
+		n -= take
+	}
+	return pulls
+}
+
+// setRefillSource configures (or clears, with an empty refill_from) the
+// fallback deck used when a draw finds the deck empty.
+func setRefillSource(w http.ResponseWriter, r *http.Request, deckID string) {
+	source := r.URL.Query().Get("refill_from")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusLocked)
+		return
+	}
+	if err := checkRefillChain(deckID, source); err != nil {
+		v := &Validator{}
+		v.Add("refill_from", "invalid_deck", "%s", err.Error())
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	if _, err := db.Exec("UPDATE decks SET refill_from = ?, updated_at = ? WHERE id = ?", source, now(), deckID); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"deck_id": deckID, "refill_from": source})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestRefillChain draws from a deck whose fallback is itself short, so the
+// draw walks two levels of refill_from and records where each card came
+// from.
+func TestRefillChain(t *testing.T) {
+	server := newTestServer(t)
+	a, b, c := newTestDeck(t, server, 1), newTestDeck(t, server, 1), newTestDeck(t, server, 1)
+	for _, link := range [][2]string{{a, b}, {b, c}} {
+		if status := getStatus(t, http.MethodPost, server.URL+"/deck/"+link[0]+"/refill-from?refill_from="+link[1]); status != http.StatusOK {
+			t.Fatalf("refill-from returned %d", status)
+		}
+	}
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+a+"/draw/52")
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+b+"/draw/51")
+
+	drawn := fetchDeck(t, http.MethodGet, server.URL+"/deck/"+a+"/draw/3")
+	if len(drawn.Cards) != 3 {
+		t.Fatalf("drew %d cards, want 3", len(drawn.Cards))
+	}
+	history, err := loadDrawnCards(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var from []string
+	for _, entry := range history[52:] {
+		from = append(from, entry.From)
+	}
+	if len(from) != 3 || from[0] != b || from[1] != c || from[2] != c {
+		t.Errorf("cards drawn from %v, want [%s %s %s]", from, b, c, c)
+	}
+	for deckID, want := range map[string]int{a: 0, b: 0, c: 50} {
+		if got := fetchDeckInfo(t, server.URL+"/deck/"+deckID).Remaining; got != want {
+			t.Errorf("deck %s has %d cards left, want %d", deckID, got, want)
+		}
+	}
+
+	if status := getStatus(t, http.MethodPost, server.URL+"/deck/"+c+"/refill-from?refill_from="+a); status != http.StatusBadRequest {
+		t.Errorf("closing the chain into a cycle returned %d, want 400", status)
+	}
+
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+a+"/draw/50")
+	if status := getStatus(t, http.MethodGet, server.URL+"/deck/"+a+"/draw/1"); status != http.StatusConflict {
+		t.Errorf("draw with the whole chain empty returned %d, want 409", status)
+	}
+}
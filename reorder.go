@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// reorderUpcoming serves PATCH /deck/{id}/upcoming/reorder with a body such
+// as {"order": ["kd", "ah", "2c"]}, which must list every upcoming card once,
+// copies included, in the new order from the top. Any card missing from the
+// list or not in the deck is reported with a 422 and nothing changes.
+func reorderUpcoming(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	var body struct {
+		Order []string `json:"order"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		v.Add("body", "invalid_json", `body must be a JSON object such as {"order": ["kd", "ah"]}`)
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+	upcomingCards, drawnHistory, err := readDeckState(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Each code takes the next unused copy of that card, which keeps the
+	// values the deck gave its cards.
+	copies := make(map[string][]Card)
+	for _, card := range upcomingCards {
+		copies[card.Code] = append(copies[card.Code], card)
+	}
+	reordered := make([]Card, 0, len(body.Order))
+	for i, token := range body.Order {
+		code, err := resolveCardCode(token)
+		if err != nil || len(copies[code]) == 0 {
+			v.Add(fmt.Sprintf("order[%d]", i), "extra_card", "%s is not an upcoming card of this deck, or is listed too often", token)
+			continue
+		}
+		reordered = append(reordered, copies[code][0])
+		copies[code] = copies[code][1:]
+	}
+	for _, card := range upcomingCards {
+		if left := copies[card.Code]; len(left) > 0 {
+			v.Add("order", "missing_card", "%s is missing %d time(s)", card.Code, len(left))
+			delete(copies, card.Code)
+		}
+	}
+	if err := v.Err(); err != nil {
+		writeFieldErrors(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := writeDeckState(tx, deckID, reordered, drawnHistory); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, Deck{
+		ID:        deckID,
+		Cards:     reordered,
+		Remaining: len(reordered),
+	})
+}
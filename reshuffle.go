@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+// autoReshuffle implements ?reshuffle_at=N: once a draw leaves fewer than N%
+// of its cards in a deck, the drawn cards go back into the deck and the deck
+// is shuffled, like a casino shoe reaching its cut card. The last keep
+// entries of drawnHistory, the cards just drawn, stay drawn, and so do cards
+// a split moved to another deck: they are no longer this deck's to recycle.
+// It is called by draws before writeDeckState, and reports whether it
+// reshuffled. The caller must hold mu.
+func autoReshuffle(exec execer, deckID string, upcomingCards []Card, drawnHistory []DrawnCard, keep int) ([]Card, []DrawnCard, bool, error) {
+	var threshold, total int
+	var scoring string
+	row := exec.QueryRow("SELECT reshuffle_at, COALESCE(card_total, 0), COALESCE(scoring, '') FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&threshold, &total, &scoring); err != nil {
+		return nil, nil, false, errDeckNotFound
+	}
+	recycled := len(drawnHistory) - keep
+	if threshold <= 0 || recycled <= 0 || len(upcomingCards)*100 >= threshold*total {
+		return upcomingCards, drawnHistory, false, nil
+	}
+
+	cards := make([]Card, 0, len(upcomingCards)+recycled)
+	cards = append(cards, upcomingCards...)
+	var moved []DrawnCard
+	for _, entry := range drawnHistory[:recycled] {
+		if entry.To != "" {
+			moved = append(moved, entry)
+			continue
+		}
+		cards = append(cards, recycledCard(entry))
+	}
+	if len(cards) == len(upcomingCards) {
+		return upcomingCards, drawnHistory, false, nil
+	}
+	applyScoring(cards[len(upcomingCards):], scoring)
+	shuffle, err := shuffleDeckCards(exec, deckID, cards)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if err := logShuffle(exec, "reshuffle", shuffle); err != nil {
+		return nil, nil, false, fmt.Errorf("Error updating deck")
+	}
+
+	if _, err := exec.Exec("UPDATE decks SET shuffled = 1 WHERE id = ?", deckID); err != nil {
+		return nil, nil, false, fmt.Errorf("Error updating deck")
+	}
+	return cards, append(moved, drawnHistory[recycled:]...), true, nil
+}
+
+// recycledCard returns the card of a drawn history entry as it was upcoming:
+// the card the history kept, or else the card its code stands for. Entries
+// stored before the history kept cards fall back to the custom card of a
+// code that names no standard card.
+func recycledCard(entry DrawnCard) Card {
+	if entry.Card != nil {
+		card := *entry.Card
+		card.Image = ""
+		return card
+	}
+	if _, err := resolveCardCode(entry.Code); err != nil {
+		return customCard(entry.Code)
+	}
+	return cardFromCode(entry.Code)
+}
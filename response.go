@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// responseBudget is the largest card-list response, in bytes of encoded
+// JSON, sent in one piece. It is measured before any compression.
+var responseBudget = envInt("RESPONSE_BUDGET_BYTES", 1<<20)
+
+// TruncatedList represents a card-list response cut down to the budget.
+// Clients fetch the rest by repeating the request with ?cursor=NextCursor.
+type TruncatedList[T any] struct {
+	Cards      []T    `json:"cards"`
+	Truncated  bool   `json:"truncated"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// writeCardList writes items as a JSON array, starting at ?cursor. When the
+// encoded array would exceed responseBudget, only the leading items that fit
+// are written, wrapped in a TruncatedList. A page always has at least one
+// item, even one larger than the budget, so that following NextCursor gets
+// through the list. Admins can bypass the budget with ?no_truncate=true.
+func writeCardList[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	v := &Validator{}
+	start := v.OptionalInt("cursor", r.URL.Query().Get("cursor"), 0, 0, len(items))
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+	// A nil slice would be encoded as null: lists are always arrays.
+	items = items[start:]
+	if items == nil {
+		items = []T{}
+	}
+
+	if r.URL.Query().Get("no_truncate") == "true" && isAdmin(r) {
+		writeJSON(w, items)
+		return
+	}
+
+	// Size the array element by element: brackets, items and commas.
+	size := 2
+	fit := 0
+	for i, item := range items {
+		encoded, err := json.Marshal(withImages(item))
+		if err != nil {
+			http.Error(w, "Error encoding cards", http.StatusInternalServerError)
+			return
+		}
+		itemSize := len(encoded)
+		if i > 0 {
+			itemSize++
+		}
+		if size+itemSize > responseBudget && fit > 0 {
+			break
+		}
+		size += itemSize
+		fit++
+	}
+
+	if fit == len(items) {
+		writeJSON(w, items)
+		return
+	}
+
+	writeJSON(w, TruncatedList[T]{
+		Cards:      items[:fit],
+		Truncated:  true,
+		NextCursor: strconv.Itoa(start + fit),
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Following next_cursor must get through a list whose items are each larger
+// than the budget.
+func TestCardListPagesPastLargeItems(t *testing.T) {
+	saved := responseBudget
+	responseBudget = 16
+	t.Cleanup(func() { responseBudget = saved })
+
+	items := []string{strings.Repeat("a", 20), strings.Repeat("b", 20), "c"}
+	var got []string
+	cursor := "0"
+	for pages := 0; cursor != ""; pages++ {
+		if pages > len(items) {
+			t.Fatalf("still paging after %d pages, at cursor %s", pages, cursor)
+		}
+		w := httptest.NewRecorder()
+		writeCardList(w, httptest.NewRequest(http.MethodGet, "/?cursor="+cursor, nil), items)
+		if w.Code != http.StatusOK {
+			t.Fatalf("cursor %s: status %d", cursor, w.Code)
+		}
+		if strings.HasPrefix(w.Body.String(), "[") {
+			var page []string
+			json.Unmarshal(w.Body.Bytes(), &page)
+			got, cursor = append(got, page...), ""
+			continue
+		}
+		var page TruncatedList[string]
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if len(page.Cards) == 0 || page.NextCursor == cursor {
+			t.Fatalf("cursor %s: empty page %+v", cursor, page)
+		}
+		got, cursor = append(got, page.Cards...), page.NextCursor
+	}
+	if strings.Join(got, ",") != strings.Join(items, ",") {
+		t.Errorf("pages gave %v, want %v", got, items)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+// scoringSchemes maps a scoring scheme name to the value of each rank. Ranks
+// missing from a scheme (such as jokers) have no value.
+var scoringSchemes = map[string]map[string]int{
+	"blackjack": {
+		"2": 2, "3": 3, "4": 4, "5": 5, "6": 6, "7": 7, "8": 8, "9": 9, "10": 10,
+		"j": 10, "q": 10, "k": 10, "a": 11,
+	},
+	"high_card": {
+		"2": 2, "3": 3, "4": 4, "5": 5, "6": 6, "7": 7, "8": 8, "9": 9, "10": 10,
+		"j": 11, "q": 12, "k": 13, "a": 14,
+	},
+}
+
+// validateScoring checks that a scoring scheme exists. An empty name means
+// the deck has no card values.
+func validateScoring(scoring string) error {
+	if scoring == "" {
+		return nil
+	}
+	if _, ok := scoringSchemes[scoring]; !ok {
+		return fmt.Errorf("Invalid scoring")
+	}
+	return nil
+}
+
+// applyScoring sets the value of each card according to a scoring scheme.
+func applyScoring(cards []Card, scoring string) {
+	values, ok := scoringSchemes[scoring]
+	if !ok {
+		return
+	}
+	for i := range cards {
+		rank := cards[i].Rank
+		if rank == "" {
+			rank = cardFromCode(cards[i].Code).Rank
+		}
+		if value, ok := values[rank]; ok {
+			cards[i].Value = &value
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"TPReseau/deck"
+)
+
+// shuffleDeckCards shuffles cards of a deck in place and returns the shuffle
+// to record with logShuffle. A deck created with ?seed=N shuffles with
+// deck.NewRand(shuffleSeed(N, k)) for its k-th shuffle, as the README
+// documents for clients, so the same seed and the same cards always give the
+// same sequence of orders, e.g. to replay a tournament, while each reshuffle
+// still gives a new order; other decks shuffle with a new seed each time.
+// The caller must hold mu.
+func shuffleDeckCards(exec execer, deckID string, cards []Card) (ShuffleLogEntry, error) {
+	var seed sql.NullInt64
+	var shuffles int64
+	if err := exec.QueryRow("SELECT shuffle_seed, (SELECT COUNT(*) FROM shuffle_log WHERE deck_id = decks.id) FROM decks WHERE id = ?", deckID).Scan(&seed, &shuffles); err != nil {
+		return ShuffleLogEntry{}, errDeckNotFound
+	}
+	entry := ShuffleLogEntry{DeckID: deckID, ShuffledAt: clock.Now().UTC().Format(time.RFC3339Nano), Seeded: seed.Valid, Before: make([]string, len(cards))}
+	for i, card := range cards {
+		entry.Before[i] = card.Code
+	}
+	if !seed.Valid {
+		entry.Seed = shuffleCards(cards)
+		return entry, nil
+	}
+	entry.Seed = shuffleSeed(seed.Int64, shuffles)
+	deck.ShuffleCards(cards, deck.NewRand(entry.Seed))
+	return entry, nil
+}
+
+// shuffleSeed returns the seed of shuffle number n, counting from 0, of a
+// deck seeded with seed. The first shuffle uses seed itself; the others a
+// hash of the two, kept below 2^53 like every logged seed.
+func shuffleSeed(seed, n int64) int64 {
+	if n == 0 {
+		return seed
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(seed))
+	binary.BigEndian.PutUint64(b[8:], uint64(n))
+	sum := sha256.Sum256(b[:])
+	return int64(binary.BigEndian.Uint64(sum[:8]) >> 11)
+}
+
+// reseedDeck serves POST /deck/{id}/reseed with a body such as {"seed": 42}.
+// It changes the seed of the following shuffles of a seeded deck; a deck
+// shuffled at random has no seed to change and gets 400. The response gives
+// the seed the next shuffle will use, derived as the README describes, so
+// that a client can reproduce it.
+func reseedDeck(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	var body struct {
+		Seed *int64 `json:"seed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		v.Add("body", "invalid_json", `body must be a JSON object such as {"seed": 42}`)
+	} else {
+		v.Check(body.Seed != nil, "seed", "missing", "seed is required")
+	}
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var previous sql.NullInt64
+	var shuffles int64
+	if err := db.QueryRow("SELECT shuffle_seed, (SELECT COUNT(*) FROM shuffle_log WHERE deck_id = decks.id) FROM decks WHERE id = ?", deckID).Scan(&previous, &shuffles); err != nil {
+		writeError(w, errDeckNotFound)
+		return
+	}
+	if !previous.Valid {
+		v.Add("seed", "random_mode", "deck shuffles at random; create it with ?seed=N to use a seed")
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	changedAt := now()
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE decks SET shuffle_seed = ?, updated_at = ? WHERE id = ?", *body.Seed, changedAt, deckID); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	change := map[string]int64{"seed": *body.Seed, "previous_seed": previous.Int64}
+	if err := recordEvent(tx, deckID, "reseed", changedAt, change); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"deck_id":           deckID,
+		"seed":              *body.Seed,
+		"previous_seed":     previous.Int64,
+		"next_shuffle_seed": shuffleSeed(*body.Seed, shuffles),
+		"reseeded_at":       changedAt,
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func reseed(t *testing.T, url, body string) int {
+	t.Helper()
+	resp, err := http.Post(url+"/reseed", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSeededShuffle(t *testing.T) {
+	server := newTestServer(t)
+	seeded := func(seed string) string {
+		return server.URL + "/deck/" + fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?seed="+seed).ID
+	}
+
+	first := cardCodes(fetchDeck(t, http.MethodGet, seeded("42")+"/shuffle").Cards)
+	second := cardCodes(fetchDeck(t, http.MethodGet, seeded("42")+"/shuffle").Cards)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("two decks with the same seed shuffled differently")
+	}
+
+	base := seeded("42")
+	if status := reseed(t, base, `{"seed": 7}`); status != http.StatusOK {
+		t.Fatalf("reseed returned %d", status)
+	}
+	if got := cardCodes(fetchDeck(t, http.MethodGet, base+"/shuffle").Cards); reflect.DeepEqual(got, first) {
+		t.Error("shuffle after reseed still used the old seed")
+	}
+	want := cardCodes(fetchDeck(t, http.MethodGet, seeded("7")+"/shuffle").Cards)
+	if got := cardCodes(fetchDeck(t, http.MethodGet, seeded("42")+"/shuffle").Cards); reflect.DeepEqual(got, want) {
+		t.Error("seed 42 and seed 7 gave the same order")
+	}
+}
+
+// readmeSource and readmeShuffle follow the README, with the standard
+// library alone, to check that seeded shuffles can be reproduced outside the
+// server.
+type readmeSource struct{ *randv2.PCG }
+
+func (s readmeSource) Int63() int64    { return int64(s.Uint64() >> 1) }
+func (s readmeSource) Seed(seed int64) { s.PCG.Seed(uint64(seed), 0) }
+
+func readmeShuffle(codes []string, seed, k int64) []string {
+	if k > 0 {
+		var b [16]byte
+		binary.BigEndian.PutUint64(b[:8], uint64(seed))
+		binary.BigEndian.PutUint64(b[8:], uint64(k))
+		sum := sha256.Sum256(b[:])
+		seed = int64(binary.BigEndian.Uint64(sum[:8]) >> 11)
+	}
+	shuffled := append([]string(nil), codes...)
+	r := rand.New(readmeSource{randv2.NewPCG(uint64(seed), 0)})
+	r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return shuffled
+}
+
+func TestSeededShuffleFollowsReadme(t *testing.T) {
+	server := newTestServer(t)
+	base := server.URL + "/deck/" + fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?seed=42").ID
+
+	want := cardCodes(generateCards(1, 0, CardOrder{}))
+	for k := int64(0); k < 2; k++ {
+		want = readmeShuffle(want, 42, k)
+		if got := cardCodes(fetchDeck(t, http.MethodGet, base+"/shuffle").Cards); !reflect.DeepEqual(got, want) {
+			t.Fatalf("shuffle %d = %v, want %v", k, got, want)
+		}
+	}
+
+	resp, err := http.Post(base+"/reseed", "application/json", strings.NewReader(`{"seed": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reseeded struct {
+		NextShuffleSeed int64 `json:"next_shuffle_seed"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reseeded)
+	resp.Body.Close()
+	if reseeded.NextShuffleSeed != shuffleSeed(7, 2) {
+		t.Errorf("next_shuffle_seed = %d, want %d", reseeded.NextShuffleSeed, shuffleSeed(7, 2))
+	}
+	want = readmeShuffle(want, 7, 2)
+	if got := cardCodes(fetchDeck(t, http.MethodGet, base+"/shuffle").Cards); !reflect.DeepEqual(got, want) {
+		t.Errorf("shuffle after reseed = %v, want %v", got, want)
+	}
+}
+
+func TestSeededReshuffles(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	shuffles := func() [][]string {
+		base := server.URL + "/deck/" + fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?seed=42").ID
+		var orders [][]string
+		for i := 0; i < 3; i++ {
+			orders = append(orders, cardCodes(fetchDeck(t, http.MethodGet, base+"/shuffle").Cards))
+		}
+		entries := fetchShuffleLog(t, base+"/shuffle-log")
+		if len(entries) != 3 || entries[0].Seed != 42 || entries[1].Seed == 42 || entries[1].Seed == entries[2].Seed {
+			t.Errorf("seeds logged = %+v", entries)
+		}
+		for i, entry := range entries {
+			if got := replayShuffle(entry); !reflect.DeepEqual(got, orders[i]) {
+				t.Errorf("replaying shuffle %d gives %v, want %v", i, got, orders[i])
+			}
+		}
+		return orders
+	}
+
+	first := shuffles()
+	// Applying the permutation of the first shuffle again would give this.
+	position := map[string]int{}
+	for i, code := range cardCodes(generateCards(1, 0, CardOrder{})) {
+		position[code] = i
+	}
+	again := make([]string, len(first[0]))
+	for i, code := range first[0] {
+		again[i] = first[0][position[code]]
+	}
+	if reflect.DeepEqual(first[1], again) {
+		t.Error("the second shuffle repeated the permutation of the first")
+	}
+	if second := shuffles(); !reflect.DeepEqual(first, second) {
+		t.Error("two decks with the same seed reshuffled differently")
+	}
+}
+
+func TestReseedEvent(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	base := server.URL + "/deck/" + fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?seed=42").ID
+	if status := reseed(t, base, `{"seed": 7}`); status != http.StatusOK {
+		t.Fatalf("reseed returned %d", status)
+	}
+
+	resp := adminRequest(t, http.MethodGet, base+"/events", "")
+	defer resp.Body.Close()
+	var events []struct {
+		EventType  string           `json:"event_type"`
+		RecordedAt string           `json:"recorded_at"`
+		Detail     map[string]int64 `json:"detail"`
+	}
+	json.NewDecoder(resp.Body).Decode(&events)
+	if len(events) != 1 || events[0].EventType != "reseed" || events[0].RecordedAt == "" || events[0].Detail["seed"] != 7 || events[0].Detail["previous_seed"] != 42 {
+		t.Errorf("events = %+v", events)
+	}
+	if status := getStatus(t, http.MethodGet, base+"/events"); status != http.StatusForbidden {
+		t.Errorf("events without a token returned %d, want 403", status)
+	}
+}
+
+func TestReseedErrors(t *testing.T) {
+	server := newTestServer(t)
+	random := server.URL + "/deck/" + newTestDeck(t, server, 1)
+	seeded := server.URL + "/deck/" + fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?seed=1").ID
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		want int
+	}{
+		{"random deck", random, `{"seed": 42}`, http.StatusBadRequest},
+		{"missing seed", seeded, `{}`, http.StatusBadRequest},
+		{"not json", seeded, `seed=42`, http.StatusBadRequest},
+		{"unknown deck", server.URL + "/deck/missing", `{"seed": 42}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := reseed(t, tt.url, tt.body); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+
+	resp, err := http.Get(server.URL + "/deck/new/1?seed=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("create with seed=abc returned %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "net/http"
+
+// showSessionDrawn serves GET /deck/{id}/session/{sid}/drawn: the cards drawn
+// with ?session={sid}, oldest first, as a card list.
+func showSessionDrawn(w http.ResponseWriter, r *http.Request, deckID, sessionID string) {
+	v := &Validator{}
+	checkDrawTag(v, "session", sessionID)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	drawnCards, err := loadDrawnCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var sessionCards []DrawnCard
+	for _, entry := range drawnCards {
+		if entry.Session == sessionID {
+			sessionCards = append(sessionCards, entry)
+		}
+	}
+	writeCardList(w, r, sessionCards)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSessionDrawn(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	draw := func(query string) []string {
+		t.Helper()
+		return cardCodes(fetchDeck(t, http.MethodGet, base+"/draw/2"+query).Cards)
+	}
+	sessionDrawn := func(sessionID string) (int, []DrawnCard) {
+		t.Helper()
+		resp, err := http.Get(base + "/session/" + sessionID + "/drawn")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var cards []DrawnCard
+		json.NewDecoder(resp.Body).Decode(&cards)
+		return resp.StatusCode, cards
+	}
+
+	alice := draw("?session=alice")
+	draw("")
+	bob := draw("?session=bob")
+	alice = append(alice, draw("?session=alice")...)
+
+	for sessionID, want := range map[string][]string{"alice": alice, "bob": bob, "carol": {}} {
+		status, cards := sessionDrawn(sessionID)
+		codes := []string{}
+		for _, card := range cards {
+			codes = append(codes, card.Code)
+			if card.Session != sessionID {
+				t.Errorf("%s: card %s has session %q", sessionID, card.Code, card.Session)
+			}
+		}
+		if status != http.StatusOK || !reflect.DeepEqual(codes, want) {
+			t.Errorf("%s drew %v (status %d), want %v", sessionID, codes, status, want)
+		}
+	}
+
+	if status, _ := sessionDrawn("bad%20id"); status != http.StatusBadRequest {
+		t.Errorf("invalid session ID returned %d", status)
+	}
+	resp, err := http.Get(base + "/draw/1?session=bad%20id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("draw with an invalid session returned %d", resp.StatusCode)
+	}
+	if resp, _ := http.Get(server.URL + "/deck/missing/session/alice/drawn"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing deck returned %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var errTableNotFound = errors.New("Table not found")
+
+// ShoeTable represents a table session drawing from a shared shoe. The shoe
+// is an ordinary deck; every table bound to it draws from its upcoming cards.
+type ShoeTable struct {
+	ID        string `json:"table_id"`
+	ShoeID    string `json:"shoe_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+func createShoeTable() {
+	sqlStmt := `CREATE TABLE IF NOT EXISTS shoe_tables (
+		id TEXT PRIMARY KEY,
+		shoe_id TEXT,
+		created_at TEXT
+	);`
+	if _, err := db.Exec(sqlStmt); err != nil {
+		log.Fatalf("Error creating shoe tables table: %v", err)
+	}
+}
+
+func handleShoeRequests(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/shoe/"), "/")
+	if parts[0] == "" {
+		v := &Validator{}
+		v.Add("shoe_id", "missing", "shoe ID required")
+		writeValidationErrors(w, v.Err())
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "table" && r.Method == http.MethodPost:
+		createShoeTableSession(w, parts[0])
+	case len(parts) >= 4 && parts[1] == "table" && parts[3] == "draw" && r.Method == http.MethodGet:
+		drawAtTable(w, r, parts[0], parts[2], pathPart(parts, 4))
+	case len(parts) == 2 && parts[1] == "table", len(parts) >= 4 && parts[1] == "table" && parts[3] == "draw":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// createShoeTableSession serves POST /shoe/{id}/table, binding a new table to
+// the shoe deck.
+func createShoeTableSession(w http.ResponseWriter, shoeID string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var exists int
+	if err := db.QueryRow("SELECT 1 FROM decks WHERE id = ?", shoeID).Scan(&exists); err == sql.ErrNoRows {
+		writeError(w, errDeckNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error creating table", http.StatusInternalServerError)
+		return
+	}
+
+	table := ShoeTable{ID: uuid.New().String(), ShoeID: shoeID, CreatedAt: now()}
+	if _, err := db.Exec("INSERT INTO shoe_tables (id, shoe_id, created_at) VALUES (?, ?, ?)", table.ID, table.ShoeID, table.CreatedAt); err != nil {
+		http.Error(w, "Error creating table", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONStatus(w, http.StatusCreated, table)
+}
+
+// drawAtTable serves GET /shoe/{id}/table/{table}/draw/{count}. The draw goes
+// through the worker like any draw from the shoe, so draws from different
+// tables never hand out the same card; each drawn card is recorded in the
+// shoe's history with the table that drew it.
+func drawAtTable(w http.ResponseWriter, r *http.Request, shoeID, tableID, countStr string) {
+	params, err := parseDrawParams(countStr, r.URL.Query())
+	if err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	var boundTo string
+	if err := readDB.QueryRow("SELECT shoe_id FROM shoe_tables WHERE id = ?", tableID).Scan(&boundTo); err != nil || boundTo != shoeID {
+		http.Error(w, errTableNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	params.Table = tableID
+	resp := submit(Request{
+		Type:            "draw",
+		DeckID:          shoeID,
+		Draw:            params,
+		ReplyCh:         make(chan Response),
+		UnmodifiedSince: unmodifiedSince(r),
+	})
+	handleDrawResponse(w, r, shoeID, resp, params)
+}
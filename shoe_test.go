@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestShoeTables(t *testing.T) {
+	server := newTestServer(t)
+	shoeID := newTestDeck(t, server, 2)
+
+	newTable := func(shoeID string) (int, ShoeTable) {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/shoe/"+shoeID+"/table", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var table ShoeTable
+		json.NewDecoder(resp.Body).Decode(&table)
+		return resp.StatusCode, table
+	}
+
+	var tables []ShoeTable
+	for range 4 {
+		status, table := newTable(shoeID)
+		if status != http.StatusCreated || table.ShoeID != shoeID {
+			t.Fatalf("new table: status %d, %+v", status, table)
+		}
+		tables = append(tables, table)
+	}
+	if status, _ := newTable("missing"); status != http.StatusNotFound {
+		t.Errorf("table on a missing shoe returned %d", status)
+	}
+
+	// Every table draws a quarter of the shoe at once.
+	var wg sync.WaitGroup
+	for _, table := range tables {
+		for range 13 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := http.Get(server.URL + "/shoe/" + shoeID + "/table/" + table.ID + "/draw/2")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("table draw returned %d", resp.StatusCode)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if upcoming, _ := loadUpcomingCards(shoeID); len(upcoming) != 0 {
+		t.Errorf("shoe still has %d cards", len(upcoming))
+	}
+	drawn, _ := loadDrawnCards(shoeID)
+	copies := map[string]int{}
+	byTable := map[string]int{}
+	for _, entry := range drawn {
+		copies[entry.Code]++
+		byTable[entry.Table]++
+	}
+	for code, n := range copies {
+		if n != 2 {
+			t.Errorf("%s drawn %d times from a two-pack shoe", code, n)
+		}
+	}
+	for _, table := range tables {
+		if byTable[table.ID] != 26 {
+			t.Errorf("table %s drew %d cards, want 26", table.ID, byTable[table.ID])
+		}
+	}
+
+	otherShoe := newTestDeck(t, server, 1)
+	for _, tt := range []struct {
+		url  string
+		want int
+	}{
+		{server.URL + "/shoe/" + otherShoe + "/table/" + tables[0].ID + "/draw/1", http.StatusNotFound},
+		{server.URL + "/shoe/" + shoeID + "/table/missing/draw/1", http.StatusNotFound},
+		{server.URL + "/shoe/" + shoeID + "/table/" + tables[0].ID + "/draw/0", http.StatusBadRequest},
+		{server.URL + "/shoe/" + shoeID + "/table/" + tables[0].ID + "/draw/1", http.StatusConflict},
+	} {
+		resp, err := http.Get(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s returned %d, want %d", tt.url, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ShuffleLogEntry represents one shuffle of a deck, kept so that a game can
+// be audited: shuffling the Before codes with deck.NewRand(Seed) through
+// deck.ShuffleCards gives the order the shuffle produced. Seeded is
+// set when the seed is the deck's own ?seed= rather than a new random one.
+type ShuffleLogEntry struct {
+	DeckID     string   `json:"-"`
+	ShuffledAt string   `json:"shuffled_at"`
+	Kind       string   `json:"kind"` // "shuffle", "shuffle-deal" or "reshuffle"
+	Seed       int64    `json:"seed"`
+	Seeded     bool     `json:"seeded"`
+	Before     []string `json:"before"`
+}
+
+func createShuffleLogTable() {
+	sqlStmt := `CREATE TABLE IF NOT EXISTS shuffle_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		deck_id TEXT NOT NULL,
+		shuffled_at TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		seed INTEGER NOT NULL,
+		seeded INTEGER NOT NULL DEFAULT 0,
+		before TEXT NOT NULL -- Codes of the cards before the shuffle, top first
+	);
+	CREATE INDEX IF NOT EXISTS shuffle_log_deck_id ON shuffle_log (deck_id, id);`
+	if _, err := db.Exec(sqlStmt); err != nil {
+		log.Fatalf("Error creating shuffle log table: %v", err)
+	}
+}
+
+// logShuffle records a shuffle returned by shuffleDeckCards, through the
+// transaction that saves the shuffled cards, and rotates the commitment key
+// of the deck. The caller must hold mu.
+func logShuffle(exec execer, kind string, entry ShuffleLogEntry) error {
+	if err := rotateCommitmentKey(exec, entry.DeckID); err != nil {
+		return err
+	}
+	return insertShuffleLog(exec, kind, entry)
+}
+
+// insertShuffleLog adds an entry to the shuffle log, as logShuffle without
+// touching the deck, e.g. to restore the log of an archived deck.
+func insertShuffleLog(exec execer, kind string, entry ShuffleLogEntry) error {
+	before, err := json.Marshal(entry.Before)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec("INSERT INTO shuffle_log (deck_id, shuffled_at, kind, seed, seeded, before) VALUES (?, ?, ?, ?, ?, ?)",
+		entry.DeckID, entry.ShuffledAt, kind, entry.Seed, entry.Seeded, string(before))
+	return err
+}
+
+// readShuffleLog returns the shuffles of a deck, oldest first.
+func readShuffleLog(q *sql.DB, deckID string) ([]ShuffleLogEntry, error) {
+	rows, err := q.Query("SELECT shuffled_at, kind, seed, seeded, before FROM shuffle_log WHERE deck_id = ? ORDER BY id", deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ShuffleLogEntry{}
+	for rows.Next() {
+		entry := ShuffleLogEntry{DeckID: deckID}
+		var before string
+		if err := rows.Scan(&entry.ShuffledAt, &entry.Kind, &entry.Seed, &entry.Seeded, &before); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(before), &entry.Before)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// showShuffleLog serves GET /deck/{id}/shuffle-log, the shuffles of a deck,
+// oldest first, as a card list. Replaying an entry gives the order of the
+// upcoming cards, so the log is for admins only.
+func showShuffleLog(w http.ResponseWriter, r *http.Request, deckID string) {
+	if !deckExists(readDB, deckID) {
+		writeError(w, errDeckNotFound)
+		return
+	}
+	entries, err := readShuffleLog(readDB, deckID)
+	if err != nil {
+		http.Error(w, "Error reading shuffle log", http.StatusInternalServerError)
+		return
+	}
+	writeCardList(w, r, entries)
+}
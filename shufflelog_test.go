@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"TPReseau/deck"
+)
+
+func fetchShuffleLog(t *testing.T, url string) []ShuffleLogEntry {
+	t.Helper()
+	resp := adminRequest(t, http.MethodGet, url, "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s returned %d", url, resp.StatusCode)
+	}
+	var entries []ShuffleLogEntry
+	json.NewDecoder(resp.Body).Decode(&entries)
+	return entries
+}
+
+// replayShuffle shuffles the cards an entry started from with its seed.
+func replayShuffle(entry ShuffleLogEntry) []string {
+	cards := make([]Card, len(entry.Before))
+	for i, code := range entry.Before {
+		cards[i] = cardFromCode(code)
+	}
+	deck.ShuffleCards(cards, deck.NewRand(entry.Seed))
+	return cardCodes(cards)
+}
+
+func TestShuffleLog(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	if entries := fetchShuffleLog(t, server.URL+"/deck/"+deckID+"/shuffle-log"); len(entries) != 0 {
+		t.Fatalf("new deck has %d shuffles logged", len(entries))
+	}
+
+	var shuffles [][]string
+	for i := 0; i < 2; i++ {
+		shuffles = append(shuffles, cardCodes(fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID+"/shuffle").Cards))
+	}
+	entries := fetchShuffleLog(t, server.URL+"/deck/"+deckID+"/shuffle-log")
+	if len(entries) != 2 {
+		t.Fatalf("%d shuffles logged, want 2", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Kind != "shuffle" || entry.Seeded || entry.ShuffledAt == "" {
+			t.Errorf("entry %d = %+v", i, entry)
+		}
+		if got := replayShuffle(entry); !reflect.DeepEqual(got, shuffles[i]) {
+			t.Errorf("replaying shuffle %d gives %v, want %v", i, got, shuffles[i])
+		}
+	}
+	if !reflect.DeepEqual(entries[1].Before, shuffles[0]) {
+		t.Error("the second shuffle did not start from the first one's order")
+	}
+
+	seeded := fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?seed=42").ID
+	fetchDeck(t, http.MethodPost, server.URL+"/deck/"+seeded+"/shuffle-deal/2/3")
+	entries = fetchShuffleLog(t, server.URL+"/deck/"+seeded+"/shuffle-log")
+	if len(entries) != 1 || entries[0].Kind != "shuffle-deal" || !entries[0].Seeded || entries[0].Seed != 42 {
+		t.Errorf("seeded deck log = %+v", entries)
+	}
+
+	if resp := adminRequest(t, http.MethodGet, server.URL+"/deck/missing/shuffle-log", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("log of a missing deck: %d", resp.StatusCode)
+	}
+}
+
+func TestShuffleLogNeedsAdmin(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID+"/shuffle")
+
+	resp, err := http.Get(server.URL + "/deck/" + deckID + "/shuffle-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("shuffle log without a token returned %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestShuffleSeedsDiffer(t *testing.T) {
+	// rand.NewSource keeps only the seed modulo 2^31-1; deck.NewRand must
+	// not, or seeds 2^31-1 apart would shuffle alike.
+	a, b := generateCards(1, 0, CardOrder{}), generateCards(1, 0, CardOrder{})
+	deck.ShuffleCards(a, deck.NewRand(5))
+	deck.ShuffleCards(b, deck.NewRand(5+(1<<31-1)))
+	if reflect.DeepEqual(cardCodes(a), cardCodes(b)) {
+		t.Error("seeds 2^31-1 apart gave the same shuffle")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DeckSplit represents the decks made from the upcoming cards of a deck.
+type DeckSplit struct {
+	DeckID   string      `json:"deck_id"`
+	Decks    []SplitPart `json:"decks"`
+	Consumed bool        `json:"consumed"`
+	Deleted  bool        `json:"deleted,omitempty"`
+}
+
+// SplitPart represents one deck made by a split and the cards it got. Part
+// names the suit or rank of a split by suit or rank; cards with none, such
+// as jokers, go to part "none".
+type SplitPart struct {
+	ID        string `json:"deck_id"`
+	Part      string `json:"part,omitempty"`
+	Cards     []Card `json:"cards"`
+	Remaining int    `json:"remaining"`
+}
+
+// SplitParams represents the validated input of POST /deck/{id}/split.
+type SplitParams struct {
+	At      int    // cut after this many cards, or 0 for half
+	By      string // "suit", "rank" or "count", or "" to cut in two
+	Size    int    // cards per deck with By "count"
+	Consume bool
+	Delete  bool
+}
+
+func parseSplitParams(query url.Values) (SplitParams, error) {
+	v := &Validator{}
+	get := query.Get
+	params := SplitParams{
+		At:      v.OptionalInt("at", get("at"), 0, 1, maxDrawCount*maxPacks),
+		Consume: v.Bool("consume", get("consume")),
+		Delete:  v.Bool("delete_source", get("delete_source")),
+	}
+	if by := get("by"); by != "" {
+		if sizeStr, ok := strings.CutPrefix(by, "count:"); ok {
+			params.By, params.Size = "count", v.RequireInt("by", sizeStr, 1, maxDrawCount*maxPacks)
+		} else {
+			params.By = v.RequireOneOf("by", by, []string{"suit", "rank", "count:N"})
+		}
+		v.Check(params.At == 0, "by", "conflict", "by and at cannot be combined")
+		// Partitioning always empties the source.
+		params.Consume = true
+	}
+	if params.Delete {
+		params.Consume = true
+	}
+	return params, v.Err()
+}
+
+// splitParts partitions cards as params asks, keeping the order of the
+// cards within each part. Suits and ranks come in the order they first
+// appear in cards.
+func splitParts(cards []Card, params SplitParams) ([]SplitPart, error) {
+	switch params.By {
+	case "suit", "rank":
+		var parts []SplitPart
+		index := map[string]int{}
+		for _, card := range cards {
+			key := cardSuit(card)
+			if params.By == "rank" {
+				key = card.Rank
+			}
+			if key == "" {
+				key = "none"
+			}
+			i, ok := index[key]
+			if !ok {
+				i = len(parts)
+				index[key] = i
+				parts = append(parts, SplitPart{Part: key})
+			}
+			parts[i].Cards = append(parts[i].Cards, card)
+		}
+		if len(parts) == 0 {
+			return nil, errNotEnoughCards
+		}
+		return parts, nil
+	case "count":
+		var parts []SplitPart
+		for start := 0; start < len(cards); start += params.Size {
+			end := min(start+params.Size, len(cards))
+			parts = append(parts, SplitPart{Part: strconv.Itoa(len(parts) + 1), Cards: cards[start:end]})
+		}
+		if len(parts) == 0 {
+			return nil, errNotEnoughCards
+		}
+		return parts, nil
+	}
+
+	at := params.At
+	if at == 0 {
+		at = len(cards) / 2
+	}
+	// Both parts must hold a card.
+	if at < 1 || at >= len(cards) {
+		return nil, errNotEnoughCards
+	}
+	return []SplitPart{{Cards: cards[:at]}, {Cards: cards[at:]}}, nil
+}
+
+// splitDeck serves POST /deck/{id}/split. By default the upcoming cards are
+// cut in two after ?at=N cards, or in half. ?by=suit and ?by=rank make one
+// deck per suit or rank, and ?by=count:N decks of N cards, the last one
+// holding what is left. Each new deck is made of its part, so resetting it
+// gives back the same cards in the same order.
+//
+// A plain cut leaves the source as it was unless ?consume=true; a partition
+// always empties it. The cards that leave the source go to its drawn history
+// with the new deck they went to, unless ?delete_source=true deletes the
+// source and its piles. Everything is written in one transaction.
+func splitDeck(w http.ResponseWriter, r *http.Request, deckID string) {
+	params, err := parseSplitParams(r.URL.Query())
+	if err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if params.Consume {
+		if err := checkDeckUnlocked(deckID); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	upcomingCards, drawnHistory, err := readDeckState(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	parts, err := splitParts(upcomingCards, params)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var scoring string
+	if err := db.QueryRow("SELECT COALESCE(scoring, '') FROM decks WHERE id = ?", deckID).Scan(&scoring); err != nil {
+		http.Error(w, "Error splitting deck", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error splitting deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Consuming the source takes its cards out: it is a draw.
+	if params.Consume {
+		if err := paceDraw(tx, deckID); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	split := DeckSplit{DeckID: deckID, Consumed: params.Consume, Deleted: params.Delete}
+	for _, part := range parts {
+		newID, err := insertDeck(tx, part.Cards, "")
+		if err != nil {
+			http.Error(w, "Error splitting deck", http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec("UPDATE decks SET scoring = ? WHERE id = ?", scoring, newID); err != nil {
+			http.Error(w, "Error splitting deck", http.StatusInternalServerError)
+			return
+		}
+		part.ID, part.Remaining = newID, len(part.Cards)
+		split.Decks = append(split.Decks, part)
+		for _, entry := range drawnEntries(part.Cards) {
+			entry.To = newID
+			drawnHistory = append(drawnHistory, entry)
+		}
+	}
+
+	switch {
+	case params.Delete:
+		if err := deleteDeck(tx, deckID); err != nil {
+			http.Error(w, "Error splitting deck", http.StatusInternalServerError)
+			return
+		}
+	case params.Consume:
+		if err := writeDeckState(tx, deckID, []Card{}, drawnHistory); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error splitting deck", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, split)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSplitDeck(t *testing.T) {
+	server := newTestServer(t)
+	violations := atomic.LoadInt64(&conservationViolations)
+
+	split := func(url string) (int, DeckSplit) {
+		t.Helper()
+		resp, err := http.Post(url, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var s DeckSplit
+		json.NewDecoder(resp.Body).Decode(&s)
+		return resp.StatusCode, s
+	}
+	upcoming := func(deckID string) []string {
+		t.Helper()
+		cards, err := loadUpcomingCards(deckID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cardCodes(cards)
+	}
+
+	deckID := newTestDeck(t, server, 1)
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID+"/draw/2")
+	original := upcoming(deckID)
+
+	status, s := split(server.URL + "/deck/" + deckID + "/split")
+	if status != http.StatusOK || len(s.Decks) != 2 || s.Consumed {
+		t.Fatalf("split: status %d, %+v", status, s)
+	}
+	if got := upcoming(s.Decks[0].ID); !reflect.DeepEqual(got, original[:25]) {
+		t.Errorf("top half = %v, want %v", got, original[:25])
+	}
+	if got := upcoming(s.Decks[1].ID); !reflect.DeepEqual(got, original[25:]) {
+		t.Errorf("bottom half = %v, want %v", got, original[25:])
+	}
+	if !reflect.DeepEqual(upcoming(deckID), original) {
+		t.Error("split without consume changed the deck")
+	}
+
+	status, s = split(server.URL + "/deck/" + deckID + "/split?at=10&consume=true")
+	if status != http.StatusOK || !s.Consumed || s.Decks[0].Remaining != 10 || s.Decks[1].Remaining != 40 {
+		t.Fatalf("split at 10: status %d, %+v", status, s)
+	}
+	if got := upcoming(deckID); len(got) != 0 {
+		t.Errorf("consumed deck still has %d cards", len(got))
+	}
+	drawn, _ := loadDrawnCards(deckID)
+	if len(drawn) != 52 {
+		t.Fatalf("consumed deck has %d drawn cards, want 52", len(drawn))
+	}
+	for i, entry := range drawn[2:] {
+		if want := s.Decks[min(i/10, 1)].ID; entry.To != want || entry.Code != original[i] {
+			t.Errorf("history entry %d = %s to %q, want %s to %q", i+2, entry.Code, entry.To, original[i], want)
+		}
+	}
+
+	for _, tt := range []struct {
+		url  string
+		want int
+	}{
+		{server.URL + "/deck/" + deckID + "/split", http.StatusConflict},
+		{server.URL + "/deck/" + s.Decks[0].ID + "/split?at=10", http.StatusConflict},
+		{server.URL + "/deck/" + s.Decks[0].ID + "/split?at=0", http.StatusBadRequest},
+		{server.URL + "/deck/missing/split", http.StatusNotFound},
+	} {
+		if status, _ := split(tt.url); status != tt.want {
+			t.Errorf("POST %s returned %d, want %d", tt.url, status, tt.want)
+		}
+	}
+	if atomic.LoadInt64(&conservationViolations) != violations {
+		t.Error("split broke card conservation")
+	}
+}
+
+func TestSplitDeckBy(t *testing.T) {
+	server := newTestServer(t)
+	violations := atomic.LoadInt64(&conservationViolations)
+
+	split := func(url string) (int, DeckSplit) {
+		t.Helper()
+		resp, err := http.Post(url, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var s DeckSplit
+		json.NewDecoder(resp.Body).Decode(&s)
+		return resp.StatusCode, s
+	}
+
+	tests := []struct {
+		by    string
+		parts int
+		size  int
+	}{
+		{"suit", 4, 13},
+		{"rank", 13, 4},
+		{"count:26", 2, 26},
+	}
+	for _, tt := range tests {
+		deckID := newTestDeck(t, server, 1)
+		status, s := split(server.URL + "/deck/" + deckID + "/split?by=" + tt.by)
+		if status != http.StatusOK || !s.Consumed || len(s.Decks) != tt.parts {
+			t.Fatalf("by=%s: status %d, %d decks", tt.by, status, len(s.Decks))
+		}
+		seen := map[string]bool{}
+		for _, part := range s.Decks {
+			if part.Remaining != tt.size || seen[part.Part] {
+				t.Errorf("by=%s: part %q has %d cards", tt.by, part.Part, part.Remaining)
+			}
+			seen[part.Part] = true
+			for _, card := range part.Cards {
+				if (tt.by == "suit" && cardSuit(card) != part.Part) || (tt.by == "rank" && card.Rank != part.Part) {
+					t.Errorf("by=%s: %s went to part %q", tt.by, card.Code, part.Part)
+				}
+			}
+		}
+		if left, _ := loadUpcomingCards(deckID); len(left) != 0 {
+			t.Errorf("by=%s left %d cards in the source", tt.by, len(left))
+		}
+	}
+
+	deckID := newTestDeck(t, server, 1)
+	status, s := split(server.URL + "/deck/" + deckID + "/split?by=suit&delete_source=true")
+	if status != http.StatusOK || !s.Deleted || len(s.Decks) != 4 {
+		t.Fatalf("delete_source: status %d, %+v", status, s)
+	}
+	if _, err := loadUpcomingCards(deckID); err != errDeckNotFound {
+		t.Errorf("source deck still loads after delete_source: %v", err)
+	}
+
+	for _, url := range []string{
+		server.URL + "/deck/" + s.Decks[0].ID + "/split?by=colour",
+		server.URL + "/deck/" + s.Decks[0].ID + "/split?by=count:0",
+		server.URL + "/deck/" + s.Decks[0].ID + "/split?by=suit&at=3",
+	} {
+		if status, _ := split(url); status != http.StatusBadRequest {
+			t.Errorf("POST %s returned %d, want 400", url, status)
+		}
+	}
+	if atomic.LoadInt64(&conservationViolations) != violations {
+		t.Error("split broke card conservation")
+	}
+}
+
+// TestSplitThenAutoReshuffle checks that an auto-reshuffle of a split deck
+// leaves the cards the split moved away in the decks they went to.
+func TestSplitThenAutoReshuffle(t *testing.T) {
+	server := newTestServer(t)
+	violations := atomic.LoadInt64(&conservationViolations)
+
+	fallbackID := newTestDeck(t, server, 1)
+	resp, err := http.Get(server.URL + "/deck/new/1?reshuffle_at=50&refill_from=" + fallbackID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deck Deck
+	err = json.NewDecoder(resp.Body).Decode(&deck)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := server.URL + "/deck/" + deck.ID
+
+	fetchDeck(t, http.MethodGet, base+"/draw/20")
+	resp, err = http.Post(base+"/split?at=16&consume=true", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s DeckSplit
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	resp.Body.Close()
+	if err != nil || len(s.Decks) != 2 {
+		t.Fatalf("split: %v, %+v", err, s)
+	}
+
+	// The source is empty: the draw takes its cards from the fallback deck
+	// and leaves the source below the reshuffle threshold.
+	got := fetchDeck(t, http.MethodGet, base+"/draw/5")
+	if !got.Reshuffled || got.Remaining != 20 {
+		t.Fatalf("draw past empty: reshuffled %v with %d left, want a reshuffle and the 20 cards drawn before the split", got.Reshuffled, got.Remaining)
+	}
+
+	var held []Card
+	for _, id := range []string{deck.ID, s.Decks[0].ID, s.Decks[1].ID, fallbackID} {
+		doc, err := loadDeckDocument(readDB, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, heldCards(doc)...)
+	}
+	if audit := auditCards(held, generateCards(2, 0, CardOrder{})); !audit.Matches {
+		t.Errorf("the four decks do not hold two packs: missing %v, extra %v, wrong count %v", audit.Missing, audit.Extra, audit.WrongCount)
+	}
+	if atomic.LoadInt64(&conservationViolations) != violations {
+		t.Error("split and reshuffle broke card conservation")
+	}
+}
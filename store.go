@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"TPReseau/deck"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// readDB serves the read-only endpoints. Writes go through db, a single
+// connection so that SQLite never sees two writers, and keep taking mu; reads
+// use a pool of read-only connections that WAL mode lets run alongside a
+// write, never take mu, and may see data one write behind. READ_REPLICA_DSN
+// points readDB at a replica of the database instead of the main file.
+var readDB *sql.DB
+
+// openDatabases opens the write and read handles on the SQLite file at path.
+func openDatabases(path string) error {
+	var err error
+	db, err = sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(1)
+	// The read-only connections cannot switch the file to WAL themselves.
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	readDSN := os.Getenv("READ_REPLICA_DSN")
+	if readDSN == "" {
+		readDSN = "file:" + path + "?mode=ro&_busy_timeout=5000"
+	}
+	readDB, err = sql.Open("sqlite3", readDSN)
+	if err != nil {
+		return err
+	}
+	readDB.SetMaxOpenConns(envInt("READ_POOL_SIZE", 4))
+	return nil
+}
+
+// sqlStore is the deck.Store of the decks table. Load and Save go through
+// exec, which is db or the transaction of the caller. The caller must hold
+// mu.
+type sqlStore struct {
+	exec execer
+}
+
+func (s sqlStore) Load(deckID string) (deck.State, error) {
+	upcomingCards, drawnHistory, err := readDeckStateFrom(s.exec, deckID)
+	if err != nil {
+		return deck.State{}, err
+	}
+	return deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}, nil
+}
+
+func (s sqlStore) Save(deckID string, state deck.State) error {
+	return writeDeckState(s.exec, deckID, state.Upcoming, state.Drawn)
+}
+
+// storedCard is a Card as kept in the database. Image URLs depend on the
+// configuration, so they are not stored but derived whenever a card is
+// encoded for a client.
+type storedCard struct {
+	Code  string `json:"code"`
+	Rank  string `json:"rank"`
+	Suit  string `json:"suit"`
+	Value *int   `json:"value,omitempty"`
+}
+
+// storedDrawnCard is a DrawnCard as kept in the database. Like the upcoming
+// column, the history keeps a card as its code alone when the card is the one
+// its code stands for; Card holds any other card, such as a custom card,
+// whose rank and suit the code does not give.
+type storedDrawnCard struct {
+	Code    string      `json:"code"`
+	Time    string      `json:"time"`
+	From    string      `json:"from,omitempty"`
+	To      string      `json:"to,omitempty"`
+	Deal    int         `json:"deal,omitempty"`
+	Seat    int         `json:"seat,omitempty"`
+	Street  string      `json:"street,omitempty"`
+	Table   string      `json:"table,omitempty"`
+	Session string      `json:"session,omitempty"`
+	Label   string      `json:"label,omitempty"`
+	Card    *storedCard `json:"card,omitempty"`
+}
+
+// marshalCards encodes cards for the cards, upcoming and pile columns.
+func marshalCards(cards []Card) ([]byte, error) {
+	stored := make([]storedCard, len(cards))
+	for i, card := range cards {
+		stored[i] = storedCard{Code: card.Code, Rank: card.Rank, Suit: card.Suit, Value: card.Value}
+	}
+	return json.Marshal(stored)
+}
+
+// The upcoming column holds a card as its code alone, such as "ah", when the
+// card is the one its code stands for under the deck's scoring, which is the
+// case for every card the server deals out; any other card is kept as a full
+// storedCard. Decks written before codes were stored hold objects only, and
+// both forms may share an array.
+
+// storedCodeSQL is the code of a card of the upcoming column in SQL, for a
+// row of json_each over the column.
+const storedCodeSQL = `CASE type WHEN 'text' THEN value ELSE json_extract(value, '$.code') END`
+
+// codeCards caches the card each code stands for under each scoring scheme.
+var codeCards = struct {
+	sync.RWMutex
+	m map[string]map[string]Card
+}{m: map[string]map[string]Card{}}
+
+// codeCard returns the card a code stands for in the upcoming column of a
+// deck with the given scoring.
+func codeCard(code, scoring string) Card {
+	codeCards.RLock()
+	card, ok := codeCards.m[scoring][code]
+	codeCards.RUnlock()
+	if ok {
+		return card
+	}
+	cards := []Card{cardFromCode(code)}
+	cards[0].Image = ""
+	applyScoring(cards, scoring)
+	codeCards.Lock()
+	defer codeCards.Unlock()
+	if codeCards.m[scoring] == nil {
+		codeCards.m[scoring] = map[string]Card{}
+	}
+	codeCards.m[scoring][code] = cards[0]
+	return cards[0]
+}
+
+// storedAsCode reports whether a card can be stored as its code alone.
+func storedAsCode(card Card, scoring string) bool {
+	for i := 0; i < len(card.Code); i++ {
+		if c := card.Code[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	want := codeCard(card.Code, scoring)
+	if card.Rank != want.Rank || card.Suit != want.Suit || (card.Value == nil) != (want.Value == nil) {
+		return false
+	}
+	return card.Value == nil || *card.Value == *want.Value
+}
+
+// marshalUpcoming encodes cards for the upcoming column of a deck with the
+// given scoring.
+func marshalUpcoming(cards []Card, scoring string) ([]byte, error) {
+	buf := make([]byte, 0, 2+6*len(cards))
+	buf = append(buf, '[')
+	for i, card := range cards {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		if storedAsCode(card, scoring) {
+			buf = append(buf, '"')
+			buf = append(buf, card.Code...)
+			buf = append(buf, '"')
+			continue
+		}
+		encoded, err := json.Marshal(storedCard{Code: card.Code, Rank: card.Rank, Suit: card.Suit, Value: card.Value})
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, encoded...)
+	}
+	return append(buf, ']'), nil
+}
+
+// unmarshalUpcoming decodes the upcoming column of a deck with the given
+// scoring.
+func unmarshalUpcoming(data []byte, scoring string) ([]Card, error) {
+	if cards, ok := unmarshalCodes(data, scoring); ok {
+		return cards, nil
+	}
+	var stored []json.RawMessage
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	cards := make([]Card, len(stored))
+	for i, raw := range stored {
+		var code string
+		if json.Unmarshal(raw, &code) == nil {
+			cards[i] = codeCard(code, scoring)
+		} else if err := json.Unmarshal(raw, &cards[i]); err != nil {
+			return nil, err
+		}
+	}
+	return cards, nil
+}
+
+// unmarshalCodes decodes an upcoming column of plain codes, as
+// marshalUpcoming writes it, without allocating for each card. It reports
+// false for any other array, which unmarshalUpcoming decodes in full.
+func unmarshalCodes(data []byte, scoring string) ([]Card, bool) {
+	if len(data) < 2 || data[0] != '[' || data[len(data)-1] != ']' {
+		return nil, false
+	}
+	body := data[1 : len(data)-1]
+	cards := make([]Card, 0, bytes.Count(body, []byte{','})+1)
+	for len(body) > 0 {
+		if body[0] != '"' {
+			return nil, false
+		}
+		end := bytes.IndexByte(body[1:], '"') + 1
+		if end == 0 {
+			return nil, false
+		}
+		code := body[1:end]
+		if bytes.IndexByte(code, '\\') >= 0 {
+			return nil, false
+		}
+		codeCards.RLock()
+		card, ok := codeCards.m[scoring][string(code)]
+		codeCards.RUnlock()
+		if !ok {
+			card = codeCard(string(code), scoring)
+		}
+		cards = append(cards, card)
+
+		body = body[end+1:]
+		if len(body) > 0 {
+			if body[0] != ',' || len(body) == 1 {
+				return nil, false
+			}
+			body = body[1:]
+		}
+	}
+	return cards, true
+}
+
+// marshalHistory encodes a drawn history for the piged column.
+func marshalHistory(history []DrawnCard) ([]byte, error) {
+	stored := make([]storedDrawnCard, len(history))
+	for i, entry := range history {
+		stored[i] = storedDrawnCard{Code: entry.Code, Time: entry.Time, From: entry.From, To: entry.To, Deal: entry.Deal, Seat: entry.Seat, Street: entry.Street, Table: entry.Table, Session: entry.Session, Label: entry.Label}
+		if card := entry.Card; card != nil && !standsForItself(*card) {
+			stored[i].Card = &storedCard{Code: card.Code, Rank: card.Rank, Suit: card.Suit, Value: card.Value}
+		}
+	}
+	return json.Marshal(stored)
+}
+
+// unmarshalHistory decodes the piged column, with the cards the history
+// keeps for its entries.
+func unmarshalHistory(data []byte) ([]DrawnCard, error) {
+	var stored []storedDrawnCard
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	history := make([]DrawnCard, len(stored))
+	for i, entry := range stored {
+		history[i] = DrawnCard{Code: entry.Code, Time: entry.Time, From: entry.From, To: entry.To, Deal: entry.Deal, Seat: entry.Seat, Street: entry.Street, Table: entry.Table, Session: entry.Session, Label: entry.Label}
+		if card := entry.Card; card != nil {
+			history[i].Card = &Card{Code: card.Code, Rank: card.Rank, Suit: card.Suit, Value: card.Value}
+		}
+	}
+	return history, nil
+}
+
+// standsForItself reports whether card is the card its code stands for, up
+// to the value a scoring scheme gives it.
+func standsForItself(card Card) bool {
+	std := cardFromCode(card.Code)
+	return card.Rank == std.Rank && card.Suit == std.Suit
+}
+
+// stripStoredImages drops the image URLs that decks and piles created before
+// they were derived at encoding time still hold, so that no stale URL is left
+// in the database. Rows without one are not touched.
+func stripStoredImages() {
+	strip := func(cardsJSON string) string {
+		var cards []Card
+		if err := json.Unmarshal([]byte(cardsJSON), &cards); err != nil {
+			return cardsJSON
+		}
+		stripped, _ := marshalCards(cards)
+		return string(stripped)
+	}
+
+	type row struct{ key, name, cards, upcoming string }
+	var decks, piles []row
+	rows, err := db.Query(`SELECT id, COALESCE(cards, '[]'), COALESCE(upcoming, '[]') FROM decks WHERE cards LIKE '%"image":%' OR upcoming LIKE '%"image":%'`)
+	if err != nil {
+		log.Fatalf("Error reading stored images: %v", err)
+	}
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.key, &r.cards, &r.upcoming); err != nil {
+			log.Fatalf("Error reading stored images: %v", err)
+		}
+		decks = append(decks, r)
+	}
+	rows.Close()
+	rows, err = db.Query(`SELECT deck_id, name, cards FROM piles WHERE cards LIKE '%"image":%'`)
+	if err != nil {
+		log.Fatalf("Error reading stored images: %v", err)
+	}
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.key, &r.name, &r.cards); err != nil {
+			log.Fatalf("Error reading stored images: %v", err)
+		}
+		piles = append(piles, r)
+	}
+	rows.Close()
+
+	for _, r := range decks {
+		if _, err := db.Exec("UPDATE decks SET cards = ?, upcoming = ? WHERE id = ?", strip(r.cards), strip(r.upcoming), r.key); err != nil {
+			log.Fatalf("Error stripping stored images: %v", err)
+		}
+	}
+	for _, r := range piles {
+		if _, err := db.Exec("UPDATE piles SET cards = ? WHERE deck_id = ? AND name = ?", strip(r.cards), r.key, r.name); err != nil {
+			log.Fatalf("Error stripping stored images: %v", err)
+		}
+	}
+}
+
+var (
+	db *sql.DB
+	mu sync.Mutex
+)
+
+func createTable() {
+	sqlStmt := `CREATE TABLE IF NOT EXISTS decks (
+		id TEXT PRIMARY KEY,
+		cards TEXT,
+		piged TEXT,  -- Drawn cards
+		upcoming TEXT, -- Upcoming cards to be drawn
+		created_at TEXT,
+		updated_at TEXT, -- Last activity on the deck
+		commitment_salt TEXT, -- Salt for the upcoming card hashes
+		locks_at TEXT, -- Deadline after which the deck refuses mutations
+		refill_from TEXT, -- Deck drawn from once this one is empty
+		scoring TEXT, -- Scoring scheme giving card values
+		shuffled INTEGER NOT NULL DEFAULT 0, -- Whether the deck was shuffled since creation
+		card_total INTEGER, -- Cards the deck should hold, upcoming and drawn
+		frozen INTEGER NOT NULL DEFAULT 0, -- Whether mutations are paused
+		revision INTEGER NOT NULL DEFAULT 0, -- Bumped by every write of the cards
+		reshuffle_at INTEGER NOT NULL DEFAULT 0, -- Percentage of cards left below which draws reshuffle, or 0
+		shuffle_seed INTEGER -- Seed of every shuffle of the deck, or NULL for random shuffles
+	);`
+	_, err := db.Exec(sqlStmt)
+	if err != nil {
+		log.Fatalf("Error creating table: %v", err)
+	}
+
+	// Decks created before these columns existed are migrated in place.
+	ensureColumn("decks", "created_at", "TEXT")
+	ensureColumn("decks", "updated_at", "TEXT")
+	ensureColumn("decks", "commitment_salt", "TEXT")
+	ensureColumn("decks", "locks_at", "TEXT")
+	ensureColumn("decks", "refill_from", "TEXT")
+	ensureColumn("decks", "scoring", "TEXT")
+	ensureColumn("decks", "shuffled", "INTEGER NOT NULL DEFAULT 0")
+	ensureColumn("decks", "card_total", "INTEGER")
+	ensureColumn("decks", "frozen", "INTEGER NOT NULL DEFAULT 0")
+	ensureColumn("decks", "revision", "INTEGER NOT NULL DEFAULT 0")
+	ensureColumn("decks", "reshuffle_at", "INTEGER NOT NULL DEFAULT 0")
+	ensureColumn("decks", "shuffle_seed", "INTEGER")
+	ensureColumn("decks", "min_draw_interval", "INTEGER NOT NULL DEFAULT 0")
+	ensureColumn("decks", "game_state", "TEXT")
+	ensureColumn("decks", "last_draw_at", "TEXT")
+
+	// Commitment readers never write, so every deck needs its key up front.
+	if _, err := db.Exec("UPDATE decks SET commitment_salt = lower(hex(randomblob(16))) WHERE commitment_salt IS NULL OR commitment_salt = ''"); err != nil {
+		log.Fatalf("Error initializing commitment keys: %v", err)
+	}
+
+	// Existing decks are trusted to hold the right number of cards.
+	if _, err := db.Exec("UPDATE decks SET card_total = json_array_length(upcoming) + json_array_length(piged) WHERE card_total IS NULL"); err != nil {
+		log.Fatalf("Error initializing card totals: %v", err)
+	}
+
+	// The deck listing pages through decks by creation time, and needs every
+	// deck to have one.
+	if _, err := db.Exec("UPDATE decks SET created_at = '' WHERE created_at IS NULL"); err != nil {
+		log.Fatalf("Error initializing creation times: %v", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS decks_created_at ON decks (created_at, id)"); err != nil {
+		log.Fatalf("Error creating index: %v", err)
+	}
+}
+
+// ensureColumn adds a column to a table if it does not already exist.
+func ensureColumn(table, column, definition string) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		log.Fatalf("Error reading table %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			log.Fatalf("Error reading table %s: %v", table, err)
+		}
+		if name == column {
+			return
+		}
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		log.Fatalf("Error adding column %s.%s: %v", table, column, err)
+	}
+}
+
+// now returns the current time in the format stored in the database.
+func now() string {
+	return time.Now().Format(time.RFC3339)
+}
+
+// insertDeck stores a new deck holding cards through db or a transaction and
+// returns its ID. locksAt is the optional RFC 3339 deadline of the deck. The
+// caller must hold mu.
+func insertDeck(exec execer, cards []Card, locksAt string) (string, error) {
+	deckID, err := newDeckID(exec)
+	if err != nil {
+		return "", err
+	}
+	cardsJSON, _ := marshalCards(cards)
+	createdAt := now()
+	_, err = exec.Exec("INSERT INTO decks (id, cards, piged, upcoming, created_at, updated_at, commitment_salt, locks_at, card_total) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", deckID, string(cardsJSON), "[]", string(cardsJSON), createdAt, createdAt, newCommitmentSalt(), locksAt, len(cards))
+	if err != nil {
+		return "", err
+	}
+	return deckID, nil
+}
+
+// readDeckState loads the upcoming cards and drawn history of a deck. The
+// caller must hold mu.
+func readDeckState(deckID string) ([]Card, []DrawnCard, error) {
+	return readDeckStateFrom(db, deckID)
+}
+
+// readDeckStateFrom is readDeckState through db or a transaction.
+func readDeckStateFrom(exec execer, deckID string) ([]Card, []DrawnCard, error) {
+	var upcomingJSON, drawnJSON []byte
+	var scoring string
+	row := exec.QueryRow("SELECT upcoming, piged, COALESCE(scoring, '') FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&upcomingJSON, &drawnJSON, &scoring); err != nil {
+		return nil, nil, errDeckNotFound
+	}
+
+	upcomingCards, err := unmarshalUpcoming(upcomingJSON, scoring)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing upcoming cards")
+	}
+
+	drawnHistory, err := unmarshalHistory(drawnJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing drawn cards")
+	}
+	return upcomingCards, drawnHistory, nil
+}
+
+// writeDeckState stores the upcoming cards and drawn history of a deck through
+// db or a transaction, after checking that no card appeared or vanished. The
+// caller must hold mu.
+func writeDeckState(exec execer, deckID string, upcomingCards []Card, drawnHistory []DrawnCard) error {
+	return appendDeckState(exec, deckID, upcomingCards, drawnHistory, -1)
+}
+
+// appendDeckState is writeDeckState for a drawn history whose first stored
+// entries are the ones read from the deck, unchanged: only the entries after
+// them are encoded, and appended to the stored JSON without decoding it. If
+// the deck no longer holds stored entries, or stored is negative, the whole
+// history is written. The caller must hold mu.
+func appendDeckState(exec execer, deckID string, upcomingCards []Card, drawnHistory []DrawnCard, stored int) error {
+	if err := checkConservation(exec, deckID, len(upcomingCards), len(drawnHistory)); err != nil {
+		return err
+	}
+
+	var scoring string
+	var current int
+	row := exec.QueryRow("SELECT COALESCE(scoring, ''), COALESCE(json_array_length(piged), -1) FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&scoring, &current); err != nil {
+		return errDeckNotFound
+	}
+	if stored != current || stored > len(drawnHistory) {
+		stored = 0
+	}
+	updatedUpcomingJSON, err := marshalUpcoming(upcomingCards, scoring)
+	if err != nil {
+		return fmt.Errorf("Error marshalling upcoming cards")
+	}
+	appendedJSON, err := marshalHistory(drawnHistory[stored:])
+	if err != nil {
+		return fmt.Errorf("Error marshalling drawn cards")
+	}
+
+	switch {
+	case stored == 0:
+		_, err = exec.Exec("UPDATE decks SET upcoming = ?, piged = ?, updated_at = ?, revision = revision + 1 WHERE id = ?", string(updatedUpcomingJSON), string(appendedJSON), now(), deckID)
+	case stored == len(drawnHistory):
+		_, err = exec.Exec("UPDATE decks SET upcoming = ?, updated_at = ?, revision = revision + 1 WHERE id = ?", string(updatedUpcomingJSON), now(), deckID)
+	default:
+		// The stored array loses its closing bracket and takes the new
+		// entries, which keep theirs.
+		_, err = exec.Exec("UPDATE decks SET upcoming = ?, piged = substr(piged, 1, length(piged) - 1) || ',' || ?, updated_at = ?, revision = revision + 1 WHERE id = ?", string(updatedUpcomingJSON), string(appendedJSON[1:]), now(), deckID)
+	}
+	if err != nil {
+		return fmt.Errorf("Error updating deck")
+	}
+	invalidateUpcoming(deckID)
+	return nil
+}
+
+// deckShuffled reports whether a deck was shuffled since its creation. The
+// caller must hold mu.
+func deckShuffled(deckID string) bool {
+	var shuffled bool
+	db.QueryRow("SELECT shuffled FROM decks WHERE id = ?", deckID).Scan(&shuffled)
+	return shuffled
+}
+
+// loadDrawnCards returns the drawn history of a deck, oldest first.
+func loadDrawnCards(deckID string) ([]DrawnCard, error) {
+	var drawnJSON string
+	row := readDB.QueryRow("SELECT piged FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&drawnJSON); err != nil {
+		return nil, errDeckNotFound
+	}
+
+	var drawnCards []DrawnCard
+	if err := json.Unmarshal([]byte(drawnJSON), &drawnCards); err != nil {
+		return nil, fmt.Errorf("Error parsing drawn cards")
+	}
+	return drawnCards, nil
+}
+
+// loadUpcomingCards returns the cards still to be drawn from a deck, top first.
+func loadUpcomingCards(deckID string) ([]Card, error) {
+	var upcomingJSON []byte
+	var scoring string
+	row := readDB.QueryRow("SELECT upcoming, COALESCE(scoring, '') FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&upcomingJSON, &scoring); err != nil {
+		return nil, errDeckNotFound
+	}
+
+	upcomingCards, err := unmarshalUpcoming(upcomingJSON, scoring)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing upcoming cards")
+	}
+	return upcomingCards, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"TPReseau/deck"
+)
+
+// TestReadsDuringLongWrite holds mu and an open write transaction, as a slow
+// mutation would, and checks that the read endpoints still answer with the
+// last committed state.
+func TestReadsDuringLongWrite(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE decks SET upcoming = '[]' WHERE id = ?", deckID); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	for _, path := range []string{"", "/show/1/3", "/show/0/0", "/upcoming/next-of-suit/s", "/upcoming/count-above-rank/9", "/history/export.csv",
+		"/upcoming/top/3/hashes", "/commitment-salt", "/view?share=" + shareToken(deckID)} {
+		resp, err := client.Get(server.URL + "/deck/" + deckID + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s returned %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := client.Get(server.URL + "/deck/" + deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var info DeckInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Remaining != 52 {
+		t.Fatalf("read saw %d remaining cards, want the committed 52", info.Remaining)
+	}
+}
+
+func TestUpcomingStoredAsCodes(t *testing.T) {
+	ten, eleven := 10, 11
+	cards := []Card{
+		codeCard("ah", "blackjack"),
+		codeCard("10d", "blackjack"),
+		codeCard("joker-red", "blackjack"),
+		{Code: "ks", Rank: "k", Suit: "s", Value: &eleven}, // scored elsewhere
+		{Code: "qh", Rank: "q", Suit: "h"},                 // not scored
+		{Code: `a"b`, Value: &ten},
+	}
+	stored, err := marshalUpcoming(cards, "blackjack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `["ah","10d","joker-red",{"code":"ks","rank":"k","suit":"s","value":11},{"code":"qh","rank":"q","suit":"h"},{"code":"a\"b","rank":"","suit":"","value":10}]`
+	if string(stored) != want {
+		t.Errorf("stored as %s\nwant %s", stored, want)
+	}
+	back, err := unmarshalUpcoming(stored, "blackjack")
+	if err != nil || !reflect.DeepEqual(back, cards) {
+		t.Errorf("read back as %+v, %v", back, err)
+	}
+	if cards, ok := unmarshalCodes(stored[:len(`["ah","10d"`)], "blackjack"); ok {
+		t.Errorf("truncated array read as %+v", cards)
+	}
+	for _, empty := range []string{"[]", "null"} {
+		if cards, err := unmarshalUpcoming([]byte(empty), ""); err != nil || len(cards) != 0 {
+			t.Errorf("%s read as %+v, %v", empty, cards, err)
+		}
+	}
+}
+
+// Responses are the same for a deck stored with full card objects, as
+// before codes were stored, and once a write has stored it as codes.
+func TestUpcomingCodesKeepResponses(t *testing.T) {
+	server := newTestServer(t)
+	deckID := fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1?scoring=blackjack").ID
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/3")
+	if resp, err := http.Post(base+"/add?cards=ah,kd", "", nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("add: %v", err)
+	}
+
+	upcoming, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, _ := marshalCards(upcoming)
+	if _, err := db.Exec("UPDATE decks SET upcoming = ? WHERE id = ?", string(objects), deckID); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"/show/1/51", "/show/0/3", "/upcoming/count-above-rank/9", "/upcoming/next-of-suit/s", "/card/ah/remaining-count", "/entropy"}
+	responses := func() []string {
+		var bodies []string
+		for _, path := range paths {
+			resp, err := http.Get(base + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET %s returned %d", path, resp.StatusCode)
+			}
+			bodies = append(bodies, string(body))
+		}
+		return bodies
+	}
+	before := responses()
+
+	drawn, err := loadDrawnCards(deckID)
+	if err == nil {
+		mu.Lock()
+		err = writeDeckState(db, deckID, upcoming, drawn)
+		mu.Unlock()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	db.QueryRow("SELECT upcoming FROM decks WHERE id = ?", deckID).Scan(&stored)
+	if want, _ := marshalUpcoming(upcoming, "blackjack"); stored != string(want) || stored[1] != '"' {
+		t.Fatalf("deck stored as %.60s", stored)
+	}
+	for i, after := range responses() {
+		if after != before[i] {
+			t.Errorf("GET %s changed:\n%s\nwant\n%s", paths[i], after, before[i])
+		}
+	}
+}
+
+// A saved drawn history is stored as its JSON encoding, including after an
+// edit of an older entry or a rolled back write.
+func TestHistoryStoredAsJSON(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	mu.Lock()
+	defer mu.Unlock()
+
+	storedHistory := func(want []DrawnCard) {
+		t.Helper()
+		var stored string
+		db.QueryRow("SELECT piged FROM decks WHERE id = ?", deckID).Scan(&stored)
+		if encoded, _ := marshalHistory(want); stored != string(encoded) {
+			t.Fatalf("stored history %s\nwant %s", stored, encoded)
+		}
+	}
+	draw := func(edit func(*deck.State)) deck.State {
+		t.Helper()
+		state, err := sqlStore{db}.Load(deckID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit(&state)
+		deck.DrawN(&state, 2, clock.Now())
+		return state
+	}
+
+	state := draw(func(*deck.State) {})
+	if err := (sqlStore{db}).Save(deckID, state); err != nil {
+		t.Fatal(err)
+	}
+	storedHistory(state.Drawn)
+
+	state = draw(func(s *deck.State) { s.Drawn[0].Label = "first" })
+	if err := (sqlStore{db}).Save(deckID, state); err != nil {
+		t.Fatal(err)
+	}
+	storedHistory(state.Drawn)
+
+	state = draw(func(*deck.State) {})
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (sqlStore{tx}).Save(deckID, state); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	deck.DrawN(&state, 1, clock.Now())
+	if err := (sqlStore{db}).Save(deckID, state); err != nil {
+		t.Fatal(err)
+	}
+	storedHistory(state.Drawn)
+}
+
+// A history appended to the stored JSON reads back as if it had been written
+// whole, and a stored count the deck no longer matches writes it whole.
+func TestHistoryAppended(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	mu.Lock()
+	defer mu.Unlock()
+
+	storedHistory := func(want []DrawnCard) {
+		t.Helper()
+		var stored string
+		db.QueryRow("SELECT piged FROM decks WHERE id = ?", deckID).Scan(&stored)
+		if encoded, _ := marshalHistory(want); stored != string(encoded) {
+			t.Fatalf("stored history %s\nwant %s", stored, encoded)
+		}
+	}
+	drawAndAppend := func(n, stored int) deck.State {
+		t.Helper()
+		state, err := sqlStore{db}.Load(deckID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deck.DrawN(&state, n, clock.Now())
+		state.Drawn[len(state.Drawn)-1].Label = `"quoted"`
+		if err := appendDeckState(db, deckID, state.Upcoming, state.Drawn, stored); err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+
+	storedHistory(drawAndAppend(2, 0).Drawn)
+	storedHistory(drawAndAppend(3, 2).Drawn)
+	storedHistory(drawAndAppend(1, 4).Drawn)
+	storedHistory(drawAndAppend(1, -1).Drawn)
+
+	state, err := sqlStore{db}.Load(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := appendDeckState(db, deckID, state.Upcoming, state.Drawn, len(state.Drawn)); err != nil {
+		t.Fatal(err)
+	}
+	storedHistory(state.Drawn)
+	if drawn, _ := loadDrawnCards(deckID); len(drawn) != 7 || drawn[6].Label != `"quoted"` {
+		t.Errorf("history read back as %+v", drawn)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// streamDraw deals up to params.Count cards one at a time, waiting
+// params.Interval between two cards. Each card is written as one line of
+// JSON and flushed right away, so the client sees it as soon as it is drawn.
+// The stream ends early when the deck runs out or the client goes away.
+func streamDraw(w http.ResponseWriter, r *http.Request, deckID string, params StreamParams) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+
+	for i := 0; i < params.Count; i++ {
+		if i > 0 && params.Interval > 0 {
+			timer := time.NewTimer(params.Interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		resp := submit(Request{
+			Type:    "draw",
+			DeckID:  deckID,
+			Draw:    DrawParams{Count: 1, Label: params.Label},
+			ReplyCh: make(chan Response),
+		})
+		// Once the first card is out the status is already sent, so running
+		// out of cards or failing just ends the stream. An empty deck gives
+		// an empty stream.
+		if resp.Error != nil && (i > 0 || !errors.Is(resp.Error, errDeckEmpty)) {
+			if i == 0 {
+				writeError(w, resp.Error)
+			}
+			return
+		}
+		if i == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Transfer-Encoding", "chunked")
+			w.WriteHeader(http.StatusOK)
+		}
+		if resp.Error != nil {
+			return
+		}
+		for _, card := range resp.Deck.Cards {
+			writeJSONLine(w, card)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDrawStream(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	resp, err := http.Get(server.URL + "/deck/" + deckID + "/draw-stream?count=3&interval_ms=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("got status %d and transfer encoding %v, want a chunked 200", resp.StatusCode, resp.TransferEncoding)
+	}
+
+	var codes []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var card Card
+		if err := json.Unmarshal(scanner.Bytes(), &card); err != nil {
+			t.Fatalf("line %q is not a card: %v", scanner.Text(), err)
+		}
+		codes = append(codes, card.Code)
+	}
+	if want := []string{"2h", "3h", "4h"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("streamed %v, want %v", codes, want)
+	}
+
+	deck := fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID)
+	if deck.Remaining != 49 {
+		t.Errorf("deck has %d cards left after the stream, want 49", deck.Remaining)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Background cleanups run as tasks of a single sweep scheduler, so that they
+// can all be inspected on GET /admin/sweeper and triggered on POST
+// /admin/sweeper/run. Each feature registers its own tasks.
+
+// sweepJitter is the largest fraction of its interval by which a task run is
+// moved, so that tasks with the same interval do not all run at once.
+const sweepJitter = 0.1
+
+// SweepResult represents what one run of a sweep task went through.
+type SweepResult struct {
+	Examined int64 `json:"examined"`
+	Deleted  int64 `json:"deleted"`
+}
+
+// SweepStatus represents the state of one sweep task. A task with no
+// interval only runs when triggered, and has no next run.
+type SweepStatus struct {
+	Task          string      `json:"task"`
+	Interval      string      `json:"interval,omitempty"`
+	Timeout       string      `json:"timeout"`
+	Running       bool        `json:"running"`
+	LastRun       string      `json:"last_run,omitempty"`
+	LastDuration  string      `json:"last_duration,omitempty"`
+	LastResult    SweepResult `json:"last_result"`
+	LastError     string      `json:"last_error,omitempty"`
+	NextRun       string      `json:"next_run,omitempty"`
+	Runs          int64       `json:"runs"`
+	Failures      int64       `json:"failures"`
+	TotalExamined int64       `json:"total_examined"`
+	TotalDeleted  int64       `json:"total_deleted"`
+}
+
+type sweepTask struct {
+	name     string
+	interval time.Duration
+	timeout  time.Duration
+	run      func(ctx context.Context) (SweepResult, error)
+
+	status SweepStatus
+	next   time.Time
+}
+
+// sweepScheduler runs the registered tasks from one goroutine. A task that
+// times out or panics is recorded as failed without stopping the others.
+type sweepScheduler struct {
+	mu    sync.Mutex
+	tasks []*sweepTask
+	wake  chan struct{}
+}
+
+var sweeps = &sweepScheduler{wake: make(chan struct{}, 1)}
+
+// register adds a task run every interval, or only on demand if interval is
+// 0. A run taking longer than timeout is reported as failed.
+func (s *sweepScheduler) register(name string, interval, timeout time.Duration, run func(ctx context.Context) (SweepResult, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task := &sweepTask{name: name, interval: interval, timeout: timeout, run: run}
+	task.status.Task = name
+	task.status.Timeout = timeout.String()
+	if interval > 0 {
+		task.status.Interval = interval.String()
+		task.schedule(time.Now())
+	}
+	s.tasks = append(s.tasks, task)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule sets the next run of a periodic task, jittered.
+func (t *sweepTask) schedule(from time.Time) {
+	jitter := time.Duration((rand.Float64()*2 - 1) * sweepJitter * float64(t.interval))
+	t.next = from.Add(t.interval + jitter)
+	t.status.NextRun = t.next.UTC().Format(time.RFC3339)
+}
+
+// loop runs the periodic tasks when they are due.
+func (s *sweepScheduler) loop() {
+	for {
+		s.mu.Lock()
+		var due []*sweepTask
+		wait := time.Hour
+		now := time.Now()
+		for _, task := range s.tasks {
+			if task.interval <= 0 {
+				continue
+			}
+			if !task.next.After(now) {
+				due = append(due, task)
+				task.schedule(now)
+			}
+			if d := task.next.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		s.mu.Unlock()
+
+		for _, task := range due {
+			s.runTask(task)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// runAll runs every task now, one after the other, and returns their status.
+func (s *sweepScheduler) runAll() []SweepStatus {
+	s.mu.Lock()
+	tasks := append([]*sweepTask(nil), s.tasks...)
+	s.mu.Unlock()
+
+	for _, task := range tasks {
+		s.runTask(task)
+	}
+	return s.Snapshot()
+}
+
+// runTask runs one task with its timeout. A task still running from a
+// previous run, e.g. after a timeout, is skipped.
+func (s *sweepScheduler) runTask(task *sweepTask) {
+	s.mu.Lock()
+	if task.status.Running {
+		s.mu.Unlock()
+		return
+	}
+	task.status.Running = true
+	s.mu.Unlock()
+
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), task.timeout)
+	defer cancel()
+
+	type outcome struct {
+		result SweepResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", p)}
+			}
+		}()
+		result, err := task.run(ctx)
+		done <- outcome{result, err}
+	}()
+
+	var out outcome
+	finished := true
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = fmt.Errorf("timed out after %s", task.timeout)
+		finished = false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	task.status.Runs++
+	task.status.LastRun = started.UTC().Format(time.RFC3339)
+	task.status.LastDuration = time.Since(started).String()
+	task.status.LastResult = out.result
+	task.status.TotalExamined += out.result.Examined
+	task.status.TotalDeleted += out.result.Deleted
+	task.status.LastError = ""
+	if out.err != nil {
+		task.status.Failures++
+		task.status.LastError = out.err.Error()
+		log.Printf("Sweep task %s failed: %v", task.name, out.err)
+	}
+
+	if finished {
+		task.status.Running = false
+		return
+	}
+	// The task keeps running in the background; it can run again once it
+	// is done.
+	go func() {
+		<-done
+		s.mu.Lock()
+		task.status.Running = false
+		s.mu.Unlock()
+	}()
+}
+
+// Snapshot returns the status of every task in registration order.
+func (s *sweepScheduler) Snapshot() []SweepStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]SweepStatus, len(s.tasks))
+	for i, task := range s.tasks {
+		statuses[i] = task.status
+	}
+	return statuses
+}
+
+// showSweeper serves GET /admin/sweeper.
+func showSweeper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, sweeps.Snapshot())
+}
+
+// runSweeper serves POST /admin/sweeper/run, which runs every task now and
+// returns once they are done.
+func runSweeper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, sweeps.runAll())
+}
+
+// writeSweeperMetrics exposes the runs of each sweep task.
+func writeSweeperMetrics(w http.ResponseWriter) {
+	statuses := sweeps.Snapshot()
+	metrics := []struct {
+		name, help string
+		value      func(SweepStatus) int64
+	}{
+		{"deck_sweeper_runs_total", "Runs of a sweep task.", func(s SweepStatus) int64 { return s.Runs }},
+		{"deck_sweeper_failures_total", "Runs of a sweep task that failed, timed out or panicked.", func(s SweepStatus) int64 { return s.Failures }},
+		{"deck_sweeper_examined_total", "Items examined by a sweep task.", func(s SweepStatus) int64 { return s.TotalExamined }},
+		{"deck_sweeper_deleted_total", "Items deleted by a sweep task.", func(s SweepStatus) int64 { return s.TotalDeleted }},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", m.name)
+		for _, status := range statuses {
+			fmt.Fprintf(w, "%s{task=%q} %d\n", m.name, status.Task, m.value(status))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// One task panicking or hanging must not keep the others from running.
+func TestSweeperIsolatesTasks(t *testing.T) {
+	s := &sweepScheduler{wake: make(chan struct{}, 1)}
+	s.register("panics", 0, time.Second, func(ctx context.Context) (SweepResult, error) {
+		panic("boom")
+	})
+	s.register("hangs", 0, 10*time.Millisecond, func(ctx context.Context) (SweepResult, error) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return SweepResult{}, ctx.Err()
+	})
+	s.register("works", 0, time.Second, func(ctx context.Context) (SweepResult, error) {
+		return SweepResult{Examined: 3, Deleted: 1}, nil
+	})
+
+	statuses := s.runAll()
+	if len(statuses) != 3 {
+		t.Fatalf("got %d statuses, want 3", len(statuses))
+	}
+	if got := statuses[0]; got.Failures != 1 || got.LastError != "panic: boom" {
+		t.Errorf("panicking task: %+v", got)
+	}
+	if got := statuses[1]; got.Failures != 1 || !got.Running {
+		t.Errorf("hanging task: %+v", got)
+	}
+	if got := statuses[2]; got.Runs != 1 || got.Failures != 0 || got.TotalExamined != 3 || got.TotalDeleted != 1 || got.NextRun != "" {
+		t.Errorf("working task: %+v", got)
+	}
+
+	// The hanging task is skipped while its previous run is still going.
+	s.runTask(s.tasks[1])
+	if got := s.Snapshot()[1].Runs; got != 1 {
+		t.Errorf("hanging task ran %d times, want 1", got)
+	}
+}
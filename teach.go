@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"TPReseau/deck"
+)
+
+// DrawOdds represents one card of a teaching draw with the odds, just before
+// it was drawn, of drawing a card with its code, its rank and its suit.
+type DrawOdds struct {
+	Card            Card    `json:"card"`
+	CardsLeft       int     `json:"cards_left"`
+	Probability     float64 `json:"probability"`
+	RankProbability float64 `json:"rank_probability"`
+	SuitProbability float64 `json:"suit_probability"`
+}
+
+// TeachDraw represents the outcome of POST /deck/{id}/draw/teach/{n}.
+type TeachDraw struct {
+	DeckID     string     `json:"deck_id"`
+	Steps      []DrawOdds `json:"steps"`
+	Remaining  int        `json:"remaining"`
+	Reshuffled bool       `json:"reshuffled,omitempty"`
+}
+
+// drawOdds computes the odds of each of the first n cards of upcoming as
+// they are drawn one by one from the top.
+func drawOdds(upcoming []Card, n int) []DrawOdds {
+	codes := make(map[string]int)
+	ranks := make(map[string]int)
+	suits := make(map[string]int)
+	for _, card := range upcoming {
+		codes[card.Code]++
+		ranks[card.Rank]++
+		suits[cardSuit(card)]++
+	}
+
+	steps := make([]DrawOdds, n)
+	for i, card := range upcoming[:n] {
+		left := float64(len(upcoming) - i)
+		steps[i] = DrawOdds{
+			Card:            card,
+			CardsLeft:       len(upcoming) - i,
+			Probability:     float64(codes[card.Code]) / left,
+			RankProbability: float64(ranks[card.Rank]) / left,
+			SuitProbability: float64(suits[cardSuit(card)]) / left,
+		}
+		codes[card.Code]--
+		ranks[card.Rank]--
+		suits[cardSuit(card)]--
+	}
+	return steps
+}
+
+// drawTeachCards draws up to Draw.Count cards from the top of the deck and
+// returns the odds of each one.
+func drawTeachCards(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nbrCarte := req.Draw.Count
+	if nbrCarte < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid number of cards")}
+		return
+	}
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	drawnCards, err := deck.DrawN(&state, nbrCarte, clock.Now())
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	odds := drawOdds(upcomingCards, len(drawnCards))
+	tagDrawn(state.Drawn[len(drawnHistory):], req.Draw)
+	upcomingCards, reshuffled, err := saveDraw(req.DeckID, state.Upcoming, state.Drawn, len(drawnCards), req.UnmodifiedSince)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	req.ReplyCh <- Response{
+		Deck: Deck{ID: req.DeckID, Cards: drawnCards, Remaining: len(upcomingCards), Reshuffled: reshuffled},
+		Odds: odds,
+	}
+}
+
+// teachDraw serves POST /deck/{id}/draw/teach/{n}. ?label= tags the drawn
+// cards as for any draw.
+func teachDraw(w http.ResponseWriter, r *http.Request, deckID, countStr string) {
+	v := &Validator{}
+	count := v.RequireInt("count", countStr, 1, maxDrawCount)
+	label := r.URL.Query().Get("label")
+	checkDrawTag(v, "label", label)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	resp := submit(Request{
+		Type:    "draw-teach",
+		DeckID:  deckID,
+		Draw:    DrawParams{Count: count, Label: label},
+		ReplyCh: make(chan Response),
+	})
+	if resp.Error != nil {
+		writeError(w, resp.Error)
+		return
+	}
+
+	writeJSON(w, TeachDraw{DeckID: deckID, Steps: resp.Odds, Remaining: resp.Deck.Remaining, Reshuffled: resp.Deck.Reshuffled})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+// TestTeachDraw checks the odds of each step against the deck as it was just
+// before that card was drawn, then draws past the end of the deck.
+func TestTeachDraw(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 2)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/shuffle")
+
+	upcoming, err := loadUpcomingCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fetchTeachDraw(t, base+"/draw/teach/3")
+	if len(got.Steps) != 3 || got.Remaining != 101 {
+		t.Fatalf("got %d steps with %d remaining, want 3 with 101", len(got.Steps), got.Remaining)
+	}
+	for i, step := range got.Steps {
+		left := upcoming[i:]
+		var code, rank, suit int
+		for _, card := range left {
+			if card.Code == upcoming[i].Code {
+				code++
+			}
+			if card.Rank == upcoming[i].Rank {
+				rank++
+			}
+			if card.Suit == upcoming[i].Suit {
+				suit++
+			}
+		}
+		n := float64(len(left))
+		if step.Card.Code != upcoming[i].Code || step.CardsLeft != len(left) ||
+			!closeTo(step.Probability, float64(code)/n) || !closeTo(step.RankProbability, float64(rank)/n) || !closeTo(step.SuitProbability, float64(suit)/n) {
+			t.Errorf("step %d = %+v, want %s with %d cards left and odds %d, %d, %d out of %d", i, step, upcoming[i].Code, len(left), code, rank, suit, len(left))
+		}
+	}
+
+	got = fetchTeachDraw(t, base+"/draw/teach/200")
+	if len(got.Steps) != 101 || got.Remaining != 0 {
+		t.Fatalf("got %d steps with %d remaining, want 101 with 0", len(got.Steps), got.Remaining)
+	}
+	if last := got.Steps[100]; last.CardsLeft != 1 || last.Probability != 1 || last.RankProbability != 1 || last.SuitProbability != 1 {
+		t.Errorf("last step = %+v, want certain odds", last)
+	}
+	if info := fetchDeckInfo(t, base); info.Drawn != 104 {
+		t.Errorf("history holds %d cards, want 104", info.Drawn)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPost, "/draw/teach/0", http.StatusBadRequest},
+		{http.MethodPost, "/draw/teach/1", http.StatusConflict},
+	} {
+		if status := getStatus(t, tt.method, base+tt.path); status != tt.status {
+			t.Errorf("%s %s returned %d, want %d", tt.method, tt.path, status, tt.status)
+		}
+	}
+}
+
+func closeTo(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func fetchTeachDraw(t *testing.T, url string) TeachDraw {
+	t.Helper()
+	resp, err := http.Post(url, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var teach TeachDraw
+	if err := json.NewDecoder(resp.Body).Decode(&teach); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: status %d, %v", url, resp.StatusCode, err)
+	}
+	return teach
+}
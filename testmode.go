@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Test mode exposes endpoints that make the server deterministic for
+// end-to-end tests. It is off unless DECK_TEST_MODE is set; while it is off
+// the endpoints do not exist.
+var testMode = os.Getenv("DECK_TEST_MODE") != ""
+
+// seedRNG makes the following shuffles reproducible.
+func seedRNG(seed int64) {
+	rng.Lock()
+	defer rng.Unlock()
+	rng.Seed(seed)
+	rng.seeded = true
+}
+
+// handleTestSeed serves POST /test/seed/{n}.
+func handleTestSeed(w http.ResponseWriter, r *http.Request) {
+	if !testMode {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	v := &Validator{}
+	seedStr := strings.TrimPrefix(r.URL.Path, "/test/seed/")
+	seed, err := strconv.ParseInt(seedStr, 10, 64)
+	v.Check(err == nil, "seed", "invalid_integer", "seed must be an integer")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	seedRNG(seed)
+
+	writeJSON(w, map[string]int64{"seed": seed})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSeedEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	if status := getStatus(t, http.MethodPost, server.URL+"/test/seed/42"); status != http.StatusNotFound {
+		t.Errorf("seed outside test mode: status %d, want 404", status)
+	}
+
+	testMode = true
+	t.Cleanup(func() {
+		testMode = false
+		rng.Lock()
+		rng.seeded = false
+		rng.Unlock()
+	})
+	if status := getStatus(t, http.MethodPost, server.URL+"/test/seed/x"); status != http.StatusBadRequest {
+		t.Errorf("seed x: status %d, want 400", status)
+	}
+
+	shuffledAfterSeed := func() []string {
+		t.Helper()
+		if status := getStatus(t, http.MethodPost, server.URL+"/test/seed/42"); status != http.StatusOK {
+			t.Fatalf("seed: status %d", status)
+		}
+		deckID := newTestDeck(t, server, 1)
+		return cardCodes(fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID+"/shuffle").Cards)
+	}
+	first, second := shuffledAfterSeed(), shuffledAfterSeed()
+	if len(first) != 52 || !reflect.DeepEqual(first, second) {
+		t.Errorf("the same seed shuffled\n%v\nand\n%v", first, second)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"TPReseau/deck"
+)
+
+// maxTransactSteps caps the sub-operations of one transaction.
+const maxTransactSteps = 32
+
+// TransactStep represents one sub-operation of POST /deck/{id}/transact:
+//
+//	draw            draws Count cards from the top of the deck
+//	draw-into-pile  plays Count cards from the top of the deck onto Pile
+//	move            moves the Count top cards of pile From onto pile To
+//	flip            turns pile Pile over, so its top card becomes its bottom
+//
+// Count defaults to 1.
+type TransactStep struct {
+	Op    string `json:"op"`
+	Count int    `json:"count,omitempty"`
+	Pile  string `json:"pile,omitempty"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+// TransactStepResult represents the outcome of one step. Cards are the
+// cards the step drew or moved, and PileSize the size of the pile it
+// changed.
+type TransactStepResult struct {
+	Op       string `json:"op"`
+	Cards    []Card `json:"cards,omitempty"`
+	Pile     string `json:"pile,omitempty"`
+	PileSize *int   `json:"pile_size,omitempty"`
+}
+
+// TransactResult represents the outcome of a whole transaction. Reshuffled
+// reports that the draws left the deck below its ?reshuffle_at threshold and
+// the cards drawn before the transaction went back into it.
+type TransactResult struct {
+	DeckID     string               `json:"deck_id"`
+	Steps      []TransactStepResult `json:"steps"`
+	Remaining  int                  `json:"remaining"`
+	Reshuffled bool                 `json:"reshuffled,omitempty"`
+}
+
+// TransactEvent represents a committed transaction in the event log of a
+// deck: its steps, the tags of its draws and the number of cards they drew.
+type TransactEvent struct {
+	Steps      []TransactStep `json:"steps"`
+	Drawn      int            `json:"drawn"`
+	Street     string         `json:"street,omitempty"`
+	Session    string         `json:"session,omitempty"`
+	Label      string         `json:"label,omitempty"`
+	Reshuffled bool           `json:"reshuffled,omitempty"`
+}
+
+// TransactFailure represents the step that made a transaction roll back.
+type TransactFailure struct {
+	Error string `json:"error"`
+	Step  int    `json:"step"`
+	Op    string `json:"op"`
+}
+
+var transactOps = []string{"draw", "draw-into-pile", "move", "flip"}
+
+// parseTransactSteps reads the steps of a transaction from the body, and the
+// street, session and label its draws record from the query.
+func parseTransactSteps(r *http.Request) ([]TransactStep, DrawParams, error) {
+	v := &Validator{}
+	tags := parseDrawTags(v, r.URL.Query())
+	var steps []TransactStep
+	if err := json.NewDecoder(r.Body).Decode(&steps); err != nil {
+		v.Add("body", "invalid_json", "body must be a JSON array of steps")
+		return nil, tags, v.Err()
+	}
+	v.Check(len(steps) > 0, "steps", "missing", "at least one step is required")
+	v.Check(len(steps) <= maxTransactSteps, "steps", "too_many_steps", "a transaction has at most %d steps", maxTransactSteps)
+
+	for i := range steps {
+		step := &steps[i]
+		field := fmt.Sprintf("steps[%d]", i)
+		v.Check(step.Op != "transact", field+".op", "nested", "transactions cannot be nested")
+		if step.Op == "transact" {
+			continue
+		}
+		v.RequireOneOf(field+".op", step.Op, transactOps)
+		if step.Count == 0 {
+			step.Count = 1
+		}
+		v.Check(step.Count >= 1 && step.Count <= maxDrawCount, field+".count", "out_of_range", "%s.count must be between 1 and %d", field, maxDrawCount)
+
+		var piles []string
+		switch step.Op {
+		case "draw-into-pile", "flip":
+			piles = []string{"pile", step.Pile}
+		case "move":
+			piles = []string{"from", step.From, "to", step.To}
+			v.Check(step.From != step.To, field+".to", "same_pile", "%s.to must differ from %s.from", field, field)
+		}
+		for j := 0; j < len(piles); j += 2 {
+			v.Check(pileNamePattern.MatchString(piles[j+1]), field+"."+piles[j], "invalid_name", "%s.%s must be 1 to 64 letters, digits, - or _", field, piles[j])
+		}
+	}
+	return steps, tags, v.Err()
+}
+
+// transactDeck applies a list of steps to a deck under one lock acquisition.
+// The steps run in order on an in-memory copy of the deck and its piles, and
+// everything is written in one database transaction only if every step
+// succeeds; otherwise nothing is written and the failing step is reported
+// with a 409. Draws are saved like any other draw: tagged with the query's
+// street, session and label, refused by If-Unmodified-Since and draw pacing,
+// and followed by an auto-reshuffle. The committed transaction is recorded
+// in the deck's event log.
+func transactDeck(w http.ResponseWriter, r *http.Request, deckID string) {
+	steps, tags, err := parseTransactSteps(r)
+	if err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(deckID); err != nil {
+		writeError(w, err)
+		return
+	}
+	upcomingCards, drawnHistory, err := readDeckState(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Every pile a step touches is read before the transaction starts.
+	piles := make(map[string][]Card)
+	for _, step := range steps {
+		for _, name := range []string{step.Pile, step.From, step.To} {
+			if _, ok := piles[name]; name == "" || ok {
+				continue
+			}
+			if piles[name], err = readPile(deckID, name); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	firstEntry := len(drawnHistory)
+	tookCards := false
+	result := TransactResult{DeckID: deckID, Steps: make([]TransactStepResult, len(steps))}
+	for i, step := range steps {
+		stepResult := TransactStepResult{Op: step.Op}
+		var stepErr error
+		switch step.Op {
+		case "draw":
+			state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+			if stepResult.Cards, stepErr = deck.DrawExactly(&state, step.Count, clock.Now()); stepErr != nil {
+				break
+			}
+			tagDrawn(state.Drawn[len(drawnHistory):], tags)
+			upcomingCards, drawnHistory = state.Upcoming, state.Drawn
+			tookCards = true
+		case "draw-into-pile":
+			if step.Count > len(upcomingCards) {
+				stepErr = errNotEnoughCards
+				break
+			}
+			stepResult.Cards = upcomingCards[:step.Count:step.Count]
+			upcomingCards = upcomingCards[step.Count:]
+			piles[step.Pile] = append(piles[step.Pile], stepResult.Cards...)
+			stepResult.Pile = step.Pile
+			tookCards = true
+		case "move":
+			from := piles[step.From]
+			if step.Count > len(from) {
+				stepErr = fmt.Errorf("Not enough cards on pile %s", step.From)
+				break
+			}
+			stepResult.Cards = append([]Card(nil), from[len(from)-step.Count:]...)
+			piles[step.From] = from[:len(from)-step.Count]
+			piles[step.To] = append(piles[step.To], stepResult.Cards...)
+			stepResult.Pile = step.To
+		case "flip":
+			pile := piles[step.Pile]
+			flipped := make([]Card, len(pile))
+			for j, card := range pile {
+				flipped[len(pile)-1-j] = card
+			}
+			piles[step.Pile] = flipped
+			stepResult.Pile = step.Pile
+		}
+		if stepErr != nil {
+			writeJSONStatus(w, http.StatusConflict, TransactFailure{Error: stepErr.Error(), Step: i, Op: step.Op})
+			return
+		}
+		if stepResult.Pile != "" {
+			size := len(piles[stepResult.Pile])
+			stepResult.PileSize = &size
+		}
+		result.Steps[i] = stepResult
+	}
+	drawn := len(drawnHistory) - firstEntry
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := checkUnmodifiedSince(tx, deckID, unmodifiedSince(r)); err != nil {
+		writeError(w, err)
+		return
+	}
+	if tookCards {
+		if err := paceDraw(tx, deckID); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	// The piles go first so that the conservation check of writeDeckState
+	// sees the cards played onto them.
+	names := make([]string, 0, len(piles))
+	for name := range piles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pileJSON, _ := marshalCards(piles[name])
+		if _, err := tx.Exec("INSERT OR REPLACE INTO piles (deck_id, name, cards) VALUES (?, ?, ?)", deckID, name, string(pileJSON)); err != nil {
+			http.Error(w, "Error updating pile", http.StatusInternalServerError)
+			return
+		}
+	}
+	stored := firstEntry
+	if tookCards {
+		upcomingCards, drawnHistory, result.Reshuffled, err = autoReshuffle(tx, deckID, upcomingCards, drawnHistory, drawn)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if result.Reshuffled {
+			stored = -1
+		}
+	}
+	if err := appendDeckState(tx, deckID, upcomingCards, drawnHistory, stored); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	event := TransactEvent{Steps: steps, Drawn: drawn, Street: tags.Street, Session: tags.Session, Label: tags.Label, Reshuffled: result.Reshuffled}
+	if err := recordEvent(tx, deckID, "transact", now(), event); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Error updating deck", http.StatusInternalServerError)
+		return
+	}
+
+	result.Remaining = len(upcomingCards)
+	writeJSON(w, result)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func postTransact(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestTransact(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	url := server.URL + "/deck/" + deckID + "/transact"
+
+	resp := postTransact(t, url, `[
+		{"op": "draw-into-pile", "pile": "alice"},
+		{"op": "draw-into-pile", "pile": "bob"},
+		{"op": "draw"},
+		{"op": "move", "from": "alice", "to": "discard"}
+	]`)
+	var result TransactResult
+	err := json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("transaction returned %d: %v", resp.StatusCode, err)
+	}
+	if result.Remaining != 49 || len(result.Steps) != 4 {
+		t.Fatalf("got %+v, want 4 steps and 49 cards left", result)
+	}
+	if got := result.Steps[3].Cards; len(got) != 1 || got[0].Code != "2h" || *result.Steps[3].PileSize != 1 {
+		t.Errorf("move step = %+v, want 2h onto a pile of 1", result.Steps[3])
+	}
+
+	// The last step fails, so the draws before it must not be kept.
+	resp = postTransact(t, url, `[{"op": "draw", "count": 2}, {"op": "move", "from": "bob", "to": "alice", "count": 5}]`)
+	var failure TransactFailure
+	json.NewDecoder(resp.Body).Decode(&failure)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict || failure.Step != 1 || failure.Op != "move" {
+		t.Errorf("failed transaction returned %d %+v, want 409 on step 1", resp.StatusCode, failure)
+	}
+	if deck := fetchDeck(t, http.MethodGet, server.URL+"/deck/"+deckID); deck.Remaining != 49 {
+		t.Errorf("failed transaction left %d cards, want 49", deck.Remaining)
+	}
+
+	for _, body := range []string{`[{"op": "transact"}]`, `[]`, `[{"op": "move", "from": "a", "to": "a"}]`, "[" + strings.Repeat(`{"op": "draw"},`, maxTransactSteps) + `{"op": "draw"}]`} {
+		resp = postTransact(t, url, body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%.40s returned %d, want 400", body, resp.StatusCode)
+		}
+	}
+}
+
+// TestTransactTagsDraws records the query's tags on the cards a transaction
+// draws, and nothing on the cards it plays onto piles.
+func TestTransactTagsDraws(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	url := server.URL + "/deck/" + deckID + "/transact?street=flop&session=alice&label=question-7"
+
+	resp := postTransact(t, url, `[{"op": "draw", "count": 2}, {"op": "draw-into-pile", "pile": "table"}, {"op": "draw"}]`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("transaction returned %d", resp.StatusCode)
+	}
+	drawn, err := loadDrawnCards(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drawn) != 3 {
+		t.Fatalf("history holds %d cards, want 3", len(drawn))
+	}
+	for _, entry := range drawn {
+		if entry.Street != "flop" || entry.Session != "alice" || entry.Label != "question-7" {
+			t.Errorf("entry %+v is not tagged flop, alice, question-7", entry)
+		}
+	}
+
+	resp = postTransact(t, server.URL+"/deck/"+deckID+"/transact?label=bad%20label", `[{"op": "draw"}]`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid label returned %d, want 400", resp.StatusCode)
+	}
+}
+
+// TestTransactAutoReshuffle puts the cards drawn before a transaction back
+// once its draws leave the deck below ?reshuffle_at, and keeps its own.
+func TestTransactAutoReshuffle(t *testing.T) {
+	server := newTestServer(t)
+	resp, err := http.Get(server.URL + "/deck/new/1?reshuffle_at=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created Deck
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := server.URL + "/deck/" + created.ID
+	violations := atomic.LoadInt64(&conservationViolations)
+
+	fetchDeck(t, http.MethodGet, base+"/draw/20")
+	resp = postTransact(t, base+"/transact", `[{"op": "draw", "count": 5}, {"op": "draw-into-pile", "pile": "table", "count": 2}]`)
+	var result TransactResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("transaction returned %d: %v", resp.StatusCode, err)
+	}
+	if !result.Reshuffled || result.Remaining != 45 {
+		t.Errorf("got reshuffled %v with %d left, want a reshuffle and 45 left", result.Reshuffled, result.Remaining)
+	}
+	if drawn, _ := loadDrawnCards(created.ID); len(drawn) != 5 {
+		t.Errorf("history holds %d cards, want the 5 the transaction drew", len(drawn))
+	}
+	if atomic.LoadInt64(&conservationViolations) != violations {
+		t.Error("transaction broke card conservation")
+	}
+}
+
+// TestTransactUnmodifiedSince refuses a transaction with a 412 when the deck
+// changed after If-Unmodified-Since, and writes nothing.
+func TestTransactUnmodifiedSince(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	if _, err := db.Exec("UPDATE decks SET updated_at = '2024-01-01T10:00:00Z' WHERE id = ?", deckID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		since string
+		want  int
+	}{
+		{"Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"Mon, 01 Jan 2024 10:00:00 GMT", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/deck/"+deckID+"/transact", strings.NewReader(`[{"op": "draw-into-pile", "pile": "table"}]`))
+		req.Header.Set("If-Unmodified-Since", tt.since)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("If-Unmodified-Since %s returned %d, want %d", tt.since, resp.StatusCode, tt.want)
+		}
+	}
+	if pile, _ := readPile(deckID, "table"); len(pile) != 1 {
+		t.Errorf("pile holds %d cards, want 1 from the accepted transaction only", len(pile))
+	}
+}
+
+// TestTransactEvent records one transact event per committed transaction,
+// and none for a transaction that rolled back.
+func TestTransactEvent(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	resp := postTransact(t, base+"/transact?label=round-1", `[{"op": "draw", "count": 2}, {"op": "draw-into-pile", "pile": "table"}]`)
+	resp.Body.Close()
+	resp = postTransact(t, base+"/transact", `[{"op": "move", "from": "table", "to": "discard", "count": 5}]`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("failing transaction returned %d, want 409", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, http.MethodGet, base+"/events", "")
+	defer resp.Body.Close()
+	var events []struct {
+		EventType string        `json:"event_type"`
+		Detail    TransactEvent `json:"detail"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1: %+v", len(events), events)
+	}
+	if event := events[0]; event.EventType != "transact" || event.Detail.Drawn != 2 || event.Detail.Label != "round-1" || len(event.Detail.Steps) != 2 {
+		t.Errorf("event = %+v, want a transact of 2 steps drawing 2 cards labeled round-1", event)
+	}
+}
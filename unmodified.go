@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var errDeckModified = errors.New("Deck modified since the given time")
+
+// unmodifiedSince returns the time of the If-Unmodified-Since header of r.
+// A missing or invalid date gives the zero time, which disables the check:
+// HTTP asks servers to ignore a date they cannot parse.
+func unmodifiedSince(r *http.Request) time.Time {
+	since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+	if err != nil {
+		return time.Time{}
+	}
+	return since
+}
+
+// deckModifiedAt returns the last mutation time of a deck, kept in its
+// updated_at column, or the zero time for a deck that predates the column.
+func deckModifiedAt(exec execer, deckID string) (time.Time, error) {
+	var updatedAt string
+	if err := exec.QueryRow("SELECT COALESCE(updated_at, '') FROM decks WHERE id = ?", deckID).Scan(&updatedAt); err != nil {
+		return time.Time{}, errDeckNotFound
+	}
+	modifiedAt, _ := time.Parse(time.RFC3339, updatedAt)
+	return modifiedAt, nil
+}
+
+// checkUnmodifiedSince implements If-Unmodified-Since on draw, shuffle and
+// add: it fails with errDeckModified, a 412, when the deck was modified after
+// since. HTTP dates have no fraction of a second, so both times are compared
+// truncated to the second and a change in the very second of since does not
+// count as after it; clients whose clock runs behind the server see their
+// changes as later than they are, never the other way round. It runs before
+// any write, usually on the transaction of the mutation. The caller must hold
+// mu.
+func checkUnmodifiedSince(exec execer, deckID string, since time.Time) error {
+	if since.IsZero() {
+		return nil
+	}
+	modifiedAt, err := deckModifiedAt(exec, deckID)
+	if err != nil {
+		return err
+	}
+	if modifiedAt.Truncate(time.Second).After(since.Truncate(time.Second)) {
+		return errDeckModified
+	}
+	return nil
+}
+
+// lastModifiedWriter sets the Last-Modified header of a successful deck
+// response from the deck as it is when the response starts, i.e. after any
+// mutation the request made. Error responses do not describe the deck and
+// get none.
+type lastModifiedWriter struct {
+	http.ResponseWriter
+	deckID  string
+	started bool
+}
+
+func (w *lastModifiedWriter) WriteHeader(status int) {
+	if !w.started {
+		w.started = true
+		if status >= 200 && status <= 299 {
+			if modifiedAt, err := deckModifiedAt(readDB, w.deckID); err == nil && !modifiedAt.IsZero() {
+				w.Header().Set("Last-Modified", modifiedAt.UTC().Format(http.TimeFormat))
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *lastModifiedWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streamed responses working through the wrapper.
+func (w *lastModifiedWriter) Flush() {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
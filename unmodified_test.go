@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIfUnmodifiedSince(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	// Pin the last mutation, with a fraction of a second that HTTP dates
+	// cannot express.
+	setModified := func() {
+		t.Helper()
+		if _, err := db.Exec("UPDATE decks SET updated_at = '2024-01-01T10:00:00.9Z' WHERE id = ?", deckID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	request := func(method, url, since string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, nil)
+		if since != "" {
+			req.Header.Set("If-Unmodified-Since", since)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	var revision int
+	readRevision := func() int {
+		t.Helper()
+		var r int
+		db.QueryRow("SELECT revision FROM decks WHERE id = ?", deckID).Scan(&r)
+		return r
+	}
+
+	tests := []struct {
+		name, method, path, since string
+		want                      int
+	}{
+		{"draw after a change", http.MethodGet, "/draw/1", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"shuffle after a change", http.MethodGet, "/shuffle", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"add after a change", http.MethodPost, "/add?cards=ah", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"alternate draw after a change", http.MethodGet, "/draw/alternate/2", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"distinct draw after a change", http.MethodGet, "/draw/distinct/2", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"alternate draw with no change since", http.MethodGet, "/draw/alternate/2", "Mon, 01 Jan 2024 11:00:00 GMT", http.StatusOK},
+		{"distinct draw with no change since", http.MethodGet, "/draw/distinct/2", "Mon, 01 Jan 2024 11:00:00 GMT", http.StatusOK},
+		{"split-by-suit draw after a change", http.MethodPost, "/draw/2/split-by-suit", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"collect after a change", http.MethodGet, "/draw/collect?suit=h&count=1", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"shuffle-deal after a change", http.MethodPost, "/shuffle-deal/2/1", "Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"shuffle-deal with no change since", http.MethodPost, "/shuffle-deal/2/1", "Mon, 01 Jan 2024 11:00:00 GMT", http.StatusOK},
+		{"collect with no change since", http.MethodGet, "/draw/collect?suit=h&count=1", "Mon, 01 Jan 2024 11:00:00 GMT", http.StatusOK},
+		{"change in the same second", http.MethodGet, "/draw/1", "Mon, 01 Jan 2024 10:00:00 GMT", http.StatusOK},
+		{"no change since", http.MethodGet, "/shuffle", "Mon, 01 Jan 2024 11:00:00 GMT", http.StatusOK},
+		{"add with no change since", http.MethodPost, "/add?cards=ah", "Mon, 01 Jan 2024 11:00:00 GMT", http.StatusOK},
+		{"invalid date is ignored", http.MethodGet, "/draw/1", "yesterday", http.StatusOK},
+		{"no header", http.MethodGet, "/draw/1", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		setModified()
+		revision = readRevision()
+		if got := request(tt.method, base+tt.path, tt.since); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+		if changed := readRevision() != revision; changed != (tt.want == http.StatusOK) {
+			t.Errorf("%s: deck changed = %v", tt.name, changed)
+		}
+	}
+}
+
+// TestIfUnmodifiedSinceSkippedShuffle checks the precondition of a shuffle
+// that has too few cards to shuffle like that of any other.
+func TestIfUnmodifiedSinceSkippedShuffle(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/51")
+	if _, err := db.Exec("UPDATE decks SET updated_at = '2024-01-01T10:00:00Z' WHERE id = ?", deckID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		since string
+		want  int
+	}{
+		{"Mon, 01 Jan 2024 09:59:59 GMT", http.StatusPreconditionFailed},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, base+"/shuffle", nil)
+		req.Header.Set("If-Unmodified-Since", tt.since)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("shuffle of one card since %s: status %d, want %d", tt.since, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	if _, err := db.Exec("UPDATE decks SET updated_at = '2024-01-01T10:00:00+02:00' WHERE id = ?", deckID); err != nil {
+		t.Fatal(err)
+	}
+
+	lastModified := func(url string) string {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Last-Modified")
+	}
+
+	if got := lastModified(base); got != "Mon, 01 Jan 2024 08:00:00 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+	if got := lastModified(base + "/upcoming/fingerprint"); got == "" {
+		t.Errorf("no Last-Modified on a sub-resource")
+	}
+	if got := lastModified(base + "/upcoming/count"); got != "" {
+		t.Errorf("Last-Modified of an unknown sub-resource = %q", got)
+	}
+
+	// A mutating GET reports the time of its own change.
+	got, err := http.ParseTime(lastModified(base + "/draw/1"))
+	if err != nil || time.Since(got) > time.Minute {
+		t.Errorf("Last-Modified after a draw = %v, %v", got, err)
+	}
+	if got := lastModified(server.URL + "/deck/missing"); got != "" {
+		t.Errorf("Last-Modified of a missing deck = %q", got)
+	}
+	if got := lastModified(base + "/draw/0"); got != "" {
+		t.Errorf("Last-Modified of a rejected draw = %q", got)
+	}
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// handleUpcomingRequests serves the read-only analysis endpoints under
+// GET /deck/{id}/upcoming/. None of them modify the deck.
+func handleUpcomingRequests(w http.ResponseWriter, r *http.Request, deckID string, parts []string) {
+	switch {
+	case len(parts) == 3 && parts[0] == "top" && parts[2] == "hashes":
+		showUpcomingHashes(w, deckID, parts[1])
+	case len(parts) == 2 && parts[0] == "next-of-suit":
+		showNextOfSuit(w, deckID, parts[1])
+	case len(parts) == 2 && parts[0] == "longest-run-without-suit":
+		showRunWithoutSuit(w, deckID, parts[1])
+	case len(parts) == 1 && parts[0] == "fingerprint":
+		showFingerprint(w, deckID)
+	case len(parts) == 2 && parts[0] == "position-of":
+		showPositionOf(w, r, deckID, parts[1])
+	case len(parts) == 2 && parts[0] == "count-above-rank":
+		showCountAboveRank(w, deckID, parts[1])
+	case len(parts) == 2 && parts[0] == "sample":
+		showUpcomingSample(w, deckID, parts[1])
+	case len(parts) == 1 && parts[0] == "top-card-probability":
+		showTopCardProbability(w, r, deckID)
+	case len(parts) == 1 && parts[0] == "repeating-pairs":
+		showRepeatingPairs(w, deckID)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// newCommitmentSalt returns a random hex key for the commitments of a deck.
+func newCommitmentSalt() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// errNoCommitmentKey is returned for a deck stored without a commitment key,
+// which the startup migration gives to every deck.
+var errNoCommitmentKey = errors.New("Deck has no commitment key")
+
+// deckCommitment holds what the commitments of a deck are computed from,
+// read in one statement so that the parts belong to the same revision.
+type deckCommitment struct {
+	Key      string
+	Drawn    int
+	Upcoming []Card
+	Revision int64
+}
+
+// readCommitment reads the commitment key of a deck, which is never revealed,
+// along with its drawn count, upcoming cards and revision. It reads through
+// readDB and never takes mu, so the result may be slightly stale.
+func readCommitment(deckID string) (deckCommitment, error) {
+	var c deckCommitment
+	var salt sql.NullString
+	var upcomingJSON []byte
+	var scoring string
+	row := readDB.QueryRow("SELECT commitment_salt, json_array_length(piged), upcoming, COALESCE(scoring, ''), revision FROM decks WHERE id = ?", deckID)
+	if err := row.Scan(&salt, &c.Drawn, &upcomingJSON, &scoring, &c.Revision); err != nil {
+		return c, errDeckNotFound
+	}
+	if !salt.Valid || salt.String == "" {
+		return c, errNoCommitmentKey
+	}
+	c.Key = salt.String
+	upcomingCards, err := unmarshalUpcoming(upcomingJSON, scoring)
+	if err != nil {
+		return c, fmt.Errorf("Error parsing upcoming cards")
+	}
+	c.Upcoming = upcomingCards
+	return c, nil
+}
+
+// rotateCommitmentKey gives a deck a new commitment key. Every shuffle and
+// every reset of the drawn history rotates it: the hashes given before no
+// longer describe the order, and positions whose nonces were revealed are
+// about to hold undrawn cards again. The caller must hold mu.
+func rotateCommitmentKey(exec execer, deckID string) error {
+	_, err := exec.Exec("UPDATE decks SET commitment_salt = ? WHERE id = ?", newCommitmentSalt(), deckID)
+	return err
+}
+
+// positionNonce returns the nonce of the card drawn at position, counting
+// the drawn history from 0.
+func positionNonce(key string, position int) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strconv.Itoa(position)))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// hashCard returns the hex SHA-256 of a card code concatenated with nonce.
+func hashCard(code, nonce string) string {
+	sum := sha256.Sum256([]byte(code + nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// showUpcomingHashes commits to the order of the next N cards by returning
+// their hashes, each salted with the nonce of the position the card will be
+// drawn at: the first hash belongs to the position after the drawn history.
+// GET /deck/{id}/commitment-salt reveals a nonce once its card is drawn, so
+// players can verify the order was fixed. That holds for draws from the top:
+// a draw that picks its cards elsewhere, such as a distinct, alternate or
+// weighted draw, says so with off_commitment, and the hashes must be fetched
+// again.
+func showUpcomingHashes(w http.ResponseWriter, deckID string, countStr string) {
+	v := &Validator{}
+	count := v.RequireInt("count", countStr, 1, maxDrawCount*maxPacks)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	commitment, err := readCommitment(deckID)
+	if err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error reading commitment salt", http.StatusInternalServerError)
+		return
+	}
+
+	v.Check(count <= len(commitment.Upcoming), "count", "out_of_range", "count exceeds the number of cards")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	// A shuffle rotates the key and bumps the revision, so hashes cached for
+	// a revision stay right for it.
+	cacheKey := "hashes/" + strconv.Itoa(count)
+	result, ok := cachedUpcoming(deckID, cacheKey, commitment.Revision)
+	if !ok {
+		hashes := make([]string, count)
+		for i, card := range commitment.Upcoming[:count] {
+			hashes[i] = hashCard(card.Code, positionNonce(commitment.Key, commitment.Drawn+i))
+		}
+		result = hashes
+		cacheUpcoming(deckID, cacheKey, commitment.Revision, result)
+	}
+	writeJSON(w, result)
+}
+
+// Fingerprint represents the order of the upcoming cards of a deck.
+type Fingerprint struct {
+	Fingerprint string `json:"fingerprint"`
+	Algorithm   string `json:"algorithm"`
+	CardCount   int    `json:"card_count"`
+}
+
+// showFingerprint returns the SHA-256 of the comma-separated upcoming card
+// codes, so two decks with the same upcoming order share a fingerprint. It is
+// served at /deck/{id}/fingerprint and /deck/{id}/upcoming/fingerprint.
+func showFingerprint(w http.ResponseWriter, deckID string) {
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	codes := make([]string, len(upcomingCards))
+	for i, card := range upcomingCards {
+		codes[i] = card.Code
+	}
+	sum := sha256.Sum256([]byte(strings.Join(codes, ",")))
+
+	writeJSON(w, Fingerprint{
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Algorithm:   "sha256",
+		CardCount:   len(upcomingCards),
+	})
+}
+
+// CommitmentNonces holds the nonces of the drawn cards of a deck: Nonces[k]
+// salts the hash of the card at position k of the drawn history.
+type CommitmentNonces struct {
+	DeckID string   `json:"deck_id"`
+	Nonces []string `json:"nonces"`
+}
+
+// showCommitmentSalt serves GET /deck/{id}/commitment-salt. It reveals the
+// nonces of the drawn positions only; the nonce of an undrawn card would let
+// anyone try the 54 codes against its hash.
+func showCommitmentSalt(w http.ResponseWriter, deckID string) {
+	commitment, err := readCommitment(deckID)
+	if err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error reading commitment salt", http.StatusInternalServerError)
+		return
+	}
+
+	nonces := CommitmentNonces{DeckID: deckID, Nonces: make([]string, commitment.Drawn)}
+	for k := range nonces.Nonces {
+		nonces.Nonces[k] = positionNonce(commitment.Key, k)
+	}
+	writeJSON(w, nonces)
+}
+
+// CardPositions represents where the copies of a card are in upcoming,
+// counting from 0 at the top.
+type CardPositions struct {
+	Code      string `json:"code"`
+	Positions []int  `json:"positions"`
+}
+
+// FirstPosition represents where the first copy of a card is in upcoming, or
+// a nil Position if there is none.
+type FirstPosition struct {
+	Code     string `json:"code"`
+	Position *int   `json:"position"`
+}
+
+func showPositionOf(w http.ResponseWriter, r *http.Request, deckID, rawCode string) {
+	v := &Validator{}
+	code, err := resolveCardCode(rawCode)
+	if err != nil {
+		v.Add("code", "unknown_card", "%s", err.Error())
+	}
+	firstOnly := v.Bool("first_only", r.URL.Query().Get("first_only"))
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	revision, err := deckRevision(deckID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	key := "position-of/" + code
+	result, ok := cachedUpcoming(deckID, key, revision)
+	if !ok {
+		upcomingCards, err := loadUpcomingCards(deckID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		positions := CardPositions{Code: code, Positions: []int{}}
+		for i, card := range upcomingCards {
+			if card.Code == code {
+				positions.Positions = append(positions.Positions, i)
+			}
+		}
+		result = positions
+		cacheUpcoming(deckID, key, revision, result)
+	}
+
+	if firstOnly {
+		first := FirstPosition{Code: code}
+		if positions := result.(CardPositions).Positions; len(positions) > 0 {
+			first.Position = &positions[0]
+		}
+		writeJSON(w, first)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// NextOfSuit represents the position of the next card of a suit in upcoming.
+type NextOfSuit struct {
+	Suit         string `json:"suit"`
+	NextPosition *int   `json:"next_position"`
+	Card         *Card  `json:"card,omitempty"`
+}
+
+// upcomingEntry holds the cached results computed from one revision of a
+// deck.
+type upcomingEntry struct {
+	revision int64
+	values   map[string]interface{}
+}
+
+// upcomingCache holds analysis results per deck until the deck is mutated.
+// Reads do not hold mu, so a result may be computed from a revision that is
+// already stale; tagging entries with their revision keeps such a result
+// from being served once the newer revision is visible.
+var upcomingCache = struct {
+	sync.Mutex
+	entries map[string]upcomingEntry
+}{entries: make(map[string]upcomingEntry)}
+
+func cachedUpcoming(deckID, key string, revision int64) (interface{}, bool) {
+	upcomingCache.Lock()
+	defer upcomingCache.Unlock()
+	entry := upcomingCache.entries[deckID]
+	if entry.revision != revision {
+		return nil, false
+	}
+	value, ok := entry.values[key]
+	return value, ok
+}
+
+func cacheUpcoming(deckID, key string, revision int64, value interface{}) {
+	upcomingCache.Lock()
+	defer upcomingCache.Unlock()
+	entry, ok := upcomingCache.entries[deckID]
+	if !ok || entry.revision != revision {
+		entry = upcomingEntry{revision: revision, values: make(map[string]interface{})}
+		upcomingCache.entries[deckID] = entry
+	}
+	entry.values[key] = value
+}
+
+// deckRevision returns the revision of a deck's cards.
+func deckRevision(deckID string) (int64, error) {
+	var revision int64
+	if err := readDB.QueryRow("SELECT revision FROM decks WHERE id = ?", deckID).Scan(&revision); err != nil {
+		return 0, errDeckNotFound
+	}
+	return revision, nil
+}
+
+// invalidateUpcoming drops the cached results of a deck. Every code path that
+// changes the upcoming cards must call it.
+func invalidateUpcoming(deckID string) {
+	upcomingCache.Lock()
+	defer upcomingCache.Unlock()
+	delete(upcomingCache.entries, deckID)
+}
+
+// invalidateAllUpcoming drops the cached results of every deck.
+func invalidateAllUpcoming() {
+	upcomingCache.Lock()
+	defer upcomingCache.Unlock()
+	upcomingCache.entries = make(map[string]upcomingEntry)
+}
+
+// showNextOfSuit returns the 0-based position of the next card of a suit.
+func showNextOfSuit(w http.ResponseWriter, deckID string, suit string) {
+	v := &Validator{}
+	v.RequireOneOf("suit", suit, suitCodes)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	revision, err := deckRevision(deckID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	key := "next-of-suit/" + suit
+	result, ok := cachedUpcoming(deckID, key, revision)
+	if !ok {
+		upcomingCards, err := loadUpcomingCards(deckID)
+		if err == errDeckNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		next := NextOfSuit{Suit: suit}
+		for i, card := range upcomingCards {
+			if cardSuit(card) == suit {
+				position, found := i, card
+				next.NextPosition = &position
+				next.Card = &found
+				break
+			}
+		}
+		result = next
+		cacheUpcoming(deckID, key, revision, result)
+	}
+
+	writeJSON(w, result)
+}
+
+// RunWithoutSuit represents the run of cards at the top of the deck that
+// contains no card of a suit.
+type RunWithoutSuit struct {
+	Suit          string `json:"suit"`
+	LongestRun    int    `json:"longest_run"`
+	StartsAt      int    `json:"starts_at"`
+	SuitRemaining int    `json:"suit_remaining"`
+}
+
+// showRunWithoutSuit counts the cards drawn before the first card of a suit
+// would appear. The run always starts at the top of the deck, so it is 0 when
+// the top card has the suit and covers the whole deck when no card of the
+// suit remains (suit_remaining is then 0).
+func showRunWithoutSuit(w http.ResponseWriter, deckID string, suit string) {
+	v := &Validator{}
+	v.RequireOneOf("suit", suit, suitCodes)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	run := RunWithoutSuit{Suit: suit, LongestRun: len(upcomingCards)}
+	found := false
+	for i, card := range upcomingCards {
+		if cardSuit(card) != suit {
+			continue
+		}
+		if !found {
+			run.LongestRun = i
+			found = true
+		}
+		run.SuitRemaining++
+	}
+
+	writeJSON(w, run)
+}
+
+// RankBucket represents the upcoming cards on one side of a rank threshold.
+type RankBucket struct {
+	Count    int     `json:"count"`
+	Fraction float64 `json:"fraction"`
+}
+
+// RankCount represents the upcoming cards valued above, equal to and below
+// the value of a rank.
+type RankCount struct {
+	Rank    string     `json:"rank"`
+	Scoring string     `json:"scoring"`
+	Above   RankBucket `json:"above"`
+	Equal   RankBucket `json:"equal"`
+	Below   RankBucket `json:"below"`
+}
+
+// showCountAboveRank compares the value of every upcoming card with the value
+// of rank, using the deck's scoring scheme or blackjack values if it has
+// none. Cards without a value, such as jokers, are not counted.
+func showCountAboveRank(w http.ResponseWriter, deckID string, rank string) {
+	v := &Validator{}
+	rankCode, ok := rankAliases[strings.ToLower(rank)]
+	v.Check(ok, "rank", "invalid_choice", "rank must be one of 2-10, j, q, k, a")
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	var upcomingJSON []byte
+	var scoring string
+	if err := readDB.QueryRow("SELECT upcoming, COALESCE(scoring, '') FROM decks WHERE id = ?", deckID).Scan(&upcomingJSON, &scoring); err != nil {
+		http.Error(w, errDeckNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	upcomingCards, err := unmarshalUpcoming(upcomingJSON, scoring)
+	if err != nil {
+		http.Error(w, "Error parsing upcoming cards", http.StatusInternalServerError)
+		return
+	}
+
+	if scoring == "" {
+		scoring = "blackjack"
+	}
+	values := scoringSchemes[scoring]
+	threshold := values[rankCode]
+
+	count := RankCount{Rank: rankCode, Scoring: scoring}
+	total := 0
+	for _, card := range upcomingCards {
+		value, ok := values[card.Rank]
+		if !ok {
+			continue
+		}
+		total++
+		switch {
+		case value > threshold:
+			count.Above.Count++
+		case value == threshold:
+			count.Equal.Count++
+		default:
+			count.Below.Count++
+		}
+	}
+	if total > 0 {
+		count.Above.Fraction = float64(count.Above.Count) / float64(total)
+		count.Equal.Fraction = float64(count.Equal.Count) / float64(total)
+		count.Below.Fraction = float64(count.Below.Count) / float64(total)
+	}
+
+	writeJSON(w, count)
+}
+
+// TopCardProbability represents the odds that the next card drawn meets a
+// condition of a game.
+type TopCardProbability struct {
+	Condition      string  `json:"condition"`
+	Probability    float64 `json:"probability"`
+	CardsThatBust  int     `json:"cards_that_bust"`
+	TotalRemaining int     `json:"total_remaining"`
+}
+
+// showTopCardProbability serves GET /deck/{id}/upcoming/top-card-probability
+// ?target=blackjack&hand=N: the odds that the next card takes a blackjack
+// hand worth N over 21. Cards have their blackjack values whatever the
+// deck's scoring, an ace counting 1 since that is how it is played when 11
+// would bust. Cards with no value, such as jokers, never bust.
+func showTopCardProbability(w http.ResponseWriter, r *http.Request, deckID string) {
+	v := &Validator{}
+	query := r.URL.Query()
+	v.RequireOneOf("target", query.Get("target"), []string{"blackjack"})
+	hand := v.RequireInt("hand", query.Get("hand"), 2, 21)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	odds := TopCardProbability{Condition: "bust_on_draw", TotalRemaining: len(upcomingCards)}
+	for _, card := range upcomingCards {
+		if hand+hardValue(card.Rank) > 21 {
+			odds.CardsThatBust++
+		}
+	}
+	if odds.TotalRemaining > 0 {
+		odds.Probability = float64(odds.CardsThatBust) / float64(odds.TotalRemaining)
+	}
+
+	writeJSON(w, odds)
+}
+
+// hardValue returns the blackjack value of a rank with an ace counting 1,
+// whatever the deck's scoring. Cards with no value, such as jokers, are 0.
+func hardValue(rank string) int {
+	if rank == "a" {
+		return 1
+	}
+	return scoringSchemes["blackjack"][rank]
+}
+
+// UpcomingSample represents cards picked at random from the upcoming cards.
+type UpcomingSample struct {
+	Sample         []Card `json:"sample"`
+	TotalRemaining int    `json:"total_remaining"`
+}
+
+// showUpcomingSample picks n distinct upcoming cards at random, or every
+// card when fewer are left, without drawing them or changing their order:
+// a partial Fisher-Yates shuffle runs on a copy of the card indexes.
+func showUpcomingSample(w http.ResponseWriter, deckID string, countStr string) {
+	v := &Validator{}
+	count := v.RequireInt("count", countStr, 1, maxDrawCount)
+	if err := v.Err(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if count > len(upcomingCards) {
+		count = len(upcomingCards)
+	}
+
+	indexes := make([]int, len(upcomingCards))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sample := UpcomingSample{Sample: make([]Card, count), TotalRemaining: len(upcomingCards)}
+	rng.Lock()
+	for i := 0; i < count; i++ {
+		j := i + rng.Intn(len(indexes)-i)
+		indexes[i], indexes[j] = indexes[j], indexes[i]
+		sample.Sample[i] = upcomingCards[indexes[i]]
+	}
+	rng.Unlock()
+
+	writeJSON(w, sample)
+}
+
+// RankPair represents two consecutive upcoming cards of the same rank, the
+// first at Position counting from 0 at the top.
+type RankPair struct {
+	Position int    `json:"position"`
+	Card1    string `json:"card1"`
+	Card2    string `json:"card2"`
+}
+
+// RepeatingPairs represents the back-to-back cards of the same rank in
+// upcoming, against the number a random order gives on average.
+type RepeatingPairs struct {
+	Pairs          []RankPair `json:"pairs"`
+	PairCount      int        `json:"pair_count"`
+	Expected       float64    `json:"expected"`
+	TotalRemaining int        `json:"total_remaining"`
+}
+
+// showRepeatingPairs serves GET /deck/{id}/upcoming/repeating-pairs, a check
+// of the shuffle: far more pairs than expected means the cards were not
+// mixed. Each of the n-1 neighbours of a random order has the same rank with
+// probability sum(c*(c-1)) / (n*(n-1)) over the count c of each rank, so the
+// expected count is sum(c*(c-1)) / n; that is about (n-1)/13 in a large shoe
+// and 3 in a full 52-card deck.
+func showRepeatingPairs(w http.ResponseWriter, deckID string) {
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rank := func(card Card) string {
+		if card.Rank == "" {
+			return cardFromCode(card.Code).Rank
+		}
+		return card.Rank
+	}
+	pairs := RepeatingPairs{Pairs: []RankPair{}, TotalRemaining: len(upcomingCards)}
+	counts := map[string]int{}
+	for i, card := range upcomingCards {
+		counts[rank(card)]++
+		if i > 0 && rank(card) == rank(upcomingCards[i-1]) {
+			pairs.Pairs = append(pairs.Pairs, RankPair{Position: i - 1, Card1: upcomingCards[i-1].Code, Card2: card.Code})
+		}
+	}
+	pairs.PairCount = len(pairs.Pairs)
+	if n := len(upcomingCards); n > 0 {
+		same := 0
+		for _, c := range counts {
+			same += c * (c - 1)
+		}
+		pairs.Expected = float64(same) / float64(n)
+	}
+
+	writeJSON(w, pairs)
+}
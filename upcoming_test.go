@@ -0,0 +1,440 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUpcomingSample(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/2")
+
+	sample := func(n string) (int, UpcomingSample) {
+		t.Helper()
+		resp, err := http.Get(base + "/upcoming/sample/" + n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var s UpcomingSample
+		json.NewDecoder(resp.Body).Decode(&s)
+		return resp.StatusCode, s
+	}
+	upcoming := func() []string {
+		t.Helper()
+		cards, err := loadUpcomingCards(deckID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cardCodes(cards)
+	}
+	before := upcoming()
+
+	status, s := sample("5")
+	if status != http.StatusOK || len(s.Sample) != 5 || s.TotalRemaining != 50 {
+		t.Fatalf("sample of 5: status %d, %d cards of %d", status, len(s.Sample), s.TotalRemaining)
+	}
+	seen := map[string]bool{}
+	remaining := map[string]bool{}
+	for _, code := range before {
+		remaining[code] = true
+	}
+	for _, card := range s.Sample {
+		if seen[card.Code] || !remaining[card.Code] {
+			t.Errorf("sampled %s twice or from outside the upcoming cards", card.Code)
+		}
+		seen[card.Code] = true
+	}
+
+	if _, s := sample("100"); len(s.Sample) != 50 {
+		t.Errorf("sample larger than the deck gave %d cards, want 50", len(s.Sample))
+	}
+	if status, _ := sample("0"); status != http.StatusBadRequest {
+		t.Errorf("sample of 0 returned %d", status)
+	}
+	if !reflect.DeepEqual(upcoming(), before) {
+		t.Error("sampling changed the upcoming cards")
+	}
+}
+
+func TestReorderUpcoming(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/49")
+	if _, err := http.Post(base+"/add?cards=ah,ah", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	// Upcoming: the last three cards of the pack, then two added aces.
+	before, _ := loadUpcomingCards(deckID)
+	codes := cardCodes(before)
+
+	patch := func(body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPatch, base+"/upcoming/reorder", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	order := func(codes ...string) string {
+		encoded, _ := json.Marshal(map[string][]string{"order": codes})
+		return string(encoded)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"missing card", order(codes[1:]...), http.StatusUnprocessableEntity},
+		{"extra card", order(append(codes, "2c")...), http.StatusUnprocessableEntity},
+		{"too many copies", order(codes[0], codes[1], codes[2], "ah", "ah", "ah"), http.StatusUnprocessableEntity},
+		{"not a card", order(codes[0], codes[1], codes[2], "ah", "xx"), http.StatusUnprocessableEntity},
+		{"not json", `order=ah`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := patch(tt.body); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if after, _ := loadUpcomingCards(deckID); !reflect.DeepEqual(cardCodes(after), codes) {
+		t.Fatalf("rejected reorders changed the deck: %v", cardCodes(after))
+	}
+
+	want := []string{"ah", codes[2], "ace_of_hearts", codes[0], codes[1]}
+	if got := patch(order(want...)); got != http.StatusOK {
+		t.Fatalf("reorder returned %d", got)
+	}
+	want[2] = "ah"
+	if after, _ := loadUpcomingCards(deckID); !reflect.DeepEqual(cardCodes(after), want) {
+		t.Errorf("upcoming = %v, want %v", cardCodes(after), want)
+	}
+}
+
+func TestTopCardProbability(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID + "/upcoming/top-card-probability"
+
+	odds := func(query string) (int, TopCardProbability) {
+		t.Helper()
+		resp, err := http.Get(base + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var p TopCardProbability
+		json.NewDecoder(resp.Body).Decode(&p)
+		return resp.StatusCode, p
+	}
+
+	tests := []struct {
+		hand, bust int
+	}{
+		{15, 28}, // 7 to king
+		{11, 0},
+		{12, 16}, // the tens and faces
+		{20, 48}, // all but the aces
+		{21, 52},
+	}
+	for _, tt := range tests {
+		status, p := odds("?target=blackjack&hand=" + strconv.Itoa(tt.hand))
+		if status != http.StatusOK || p.Condition != "bust_on_draw" || p.CardsThatBust != tt.bust || p.TotalRemaining != 52 {
+			t.Errorf("hand %d: status %d, %+v", tt.hand, status, p)
+		}
+		if want := float64(tt.bust) / 52; p.Probability != want {
+			t.Errorf("hand %d: probability %v, want %v", tt.hand, p.Probability, want)
+		}
+	}
+
+	for _, query := range []string{"?target=poker&hand=15", "?target=blackjack", "?target=blackjack&hand=22"} {
+		if status, _ := odds(query); status != http.StatusBadRequest {
+			t.Errorf("%s returned %d, want 400", query, status)
+		}
+	}
+}
+
+func TestRepeatingPairs(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	pairs := func() RepeatingPairs {
+		t.Helper()
+		resp, err := http.Get(base + "/upcoming/repeating-pairs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var p RepeatingPairs
+		json.NewDecoder(resp.Body).Decode(&p)
+		return p
+	}
+
+	if p := pairs(); p.Expected != 3 || p.TotalRemaining != 52 || p.PairCount != len(p.Pairs) {
+		t.Errorf("full deck: %+v", p)
+	}
+
+	fetchDeck(t, http.MethodGet, base+"/draw/52")
+	if _, err := http.Post(base+"/add?cards=ah,ad,2c,2s,2h,kd", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []RankPair{{0, "ah", "ad"}, {2, "2c", "2s"}, {3, "2s", "2h"}}
+	p := pairs()
+	if !reflect.DeepEqual(p.Pairs, want) || p.PairCount != 3 || p.TotalRemaining != 6 {
+		t.Errorf("pairs = %+v, want %+v", p, want)
+	}
+	if want := 8.0 / 6; p.Expected != want {
+		t.Errorf("expected %v pairs, want %v", p.Expected, want)
+	}
+
+	if resp, err := http.Get(server.URL + "/deck/missing/upcoming/repeating-pairs"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing deck: %v, %v", resp.StatusCode, err)
+	}
+}
+
+func TestCommitmentNonces(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/draw/1")
+
+	get := func(path string, v interface{}) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s returned %d", path, resp.StatusCode)
+		}
+		json.NewDecoder(resp.Body).Decode(v)
+	}
+	nonces := func() []string {
+		t.Helper()
+		var n CommitmentNonces
+		get("/commitment-salt", &n)
+		return n.Nonces
+	}
+
+	var hashes []string
+	get("/upcoming/top/3/hashes", &hashes)
+	if n := nonces(); len(n) != 1 {
+		t.Fatalf("%d nonces revealed with one card drawn, want 1", len(n))
+	}
+
+	drawn := cardCodes(fetchDeck(t, http.MethodGet, base+"/draw/2").Cards)
+	revealed := nonces()
+	if len(revealed) != 3 {
+		t.Fatalf("%d nonces revealed with three cards drawn, want 3", len(revealed))
+	}
+	for i, code := range drawn {
+		if hashCard(code, revealed[1+i]) != hashes[i] {
+			t.Errorf("card %s drawn at position %d does not match its hash", code, 1+i)
+		}
+	}
+
+	// A shuffle rotates the key, so the nonces of the positions still to
+	// draw change as well.
+	fetchDeck(t, http.MethodGet, base+"/shuffle")
+	if nonces()[0] == revealed[0] {
+		t.Error("shuffle kept the commitment key")
+	}
+	var after []string
+	get("/upcoming/top/1/hashes", &after)
+	cards, _ := loadUpcomingCards(deckID)
+	if hashCard(cards[0].Code, positionNonce(mustCommitmentKey(t, deckID), 3)) != after[0] {
+		t.Error("hash after the shuffle does not use the new key")
+	}
+}
+
+// TestCommitmentOffTop draws away from the top of a deck whose hashes were
+// published: the draw is flagged, the cards do not verify against the hashes,
+// and the hashes published afterwards hold again for draws from the top.
+func TestCommitmentOffTop(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+	base := server.URL + "/deck/" + deckID
+
+	hashes := func(n string) []string {
+		t.Helper()
+		resp, err := http.Get(base + "/upcoming/top/" + n + "/hashes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var h []string
+		json.NewDecoder(resp.Body).Decode(&h)
+		return h
+	}
+	nonces := func() []string {
+		t.Helper()
+		resp, err := http.Get(base + "/commitment-salt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var n CommitmentNonces
+		json.NewDecoder(resp.Body).Decode(&n)
+		return n.Nonces
+	}
+
+	hashes("2")
+	if d := fetchDeck(t, http.MethodGet, base+"/draw/distinct/2"); d.OffCommitment {
+		t.Error("distinct draw of the top cards flagged as off the commitment")
+	}
+	published := hashes("2")
+	alternate := fetchDeck(t, http.MethodGet, base+"/draw/alternate/2")
+	if !alternate.OffCommitment {
+		t.Fatal("alternate draw not flagged as off the commitment")
+	}
+	if revealed := nonces(); hashCard(alternate.Cards[1].Code, revealed[3]) == published[1] {
+		t.Error("bottom card verifies against the hash of the second card")
+	}
+
+	published = hashes("1")
+	plain := fetchDeck(t, http.MethodGet, base+"/draw/1")
+	if plain.OffCommitment {
+		t.Error("plain draw flagged as off the commitment")
+	}
+	if revealed := nonces(); hashCard(plain.Cards[0].Code, revealed[4]) != published[0] {
+		t.Error("plain draw after republishing does not verify")
+	}
+}
+
+func mustCommitmentKey(t *testing.T, deckID string) string {
+	t.Helper()
+	commitment, err := readCommitment(deckID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commitment.Key
+}
+
+// TestPositionOf finds every copy of a card in a multi-pack deck, and the
+// positions move once cards are drawn above them.
+func TestPositionOf(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 4)
+	base := server.URL + "/deck/" + deckID
+	fetchDeck(t, http.MethodGet, base+"/shuffle")
+
+	wantPositions := func() []int {
+		upcoming, err := loadUpcomingCards(deckID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		positions := []int{}
+		for i, card := range upcoming {
+			if card.Code == "ah" {
+				positions = append(positions, i)
+			}
+		}
+		return positions
+	}
+
+	for round := 0; round < 2; round++ {
+		want := wantPositions()
+		var all CardPositions
+		fetchUpcoming(t, base+"/upcoming/position-of/AH", &all)
+		if all.Code != "ah" || !reflect.DeepEqual(all.Positions, want) {
+			t.Errorf("round %d: got %+v, want positions %v", round, all, want)
+		}
+		var first FirstPosition
+		fetchUpcoming(t, base+"/upcoming/position-of/ah?first_only=true", &first)
+		if first.Position == nil || *first.Position != want[0] {
+			t.Errorf("round %d: first position %v, want %d", round, first.Position, want[0])
+		}
+		fetchDeck(t, http.MethodGet, base+"/draw/"+strconv.Itoa(want[0]+1))
+	}
+
+	var absent CardPositions
+	fetchUpcoming(t, base+"/upcoming/position-of/"+jokerCode, &absent)
+	if absent.Positions == nil || len(absent.Positions) != 0 {
+		t.Errorf("absent card: %+v, want no positions", absent)
+	}
+	var absentFirst FirstPosition
+	fetchUpcoming(t, base+"/upcoming/position-of/"+jokerCode+"?first_only=true", &absentFirst)
+	if absentFirst.Position != nil {
+		t.Errorf("absent card: first position %d, want null", *absentFirst.Position)
+	}
+
+	for url, want := range map[string]int{
+		base + "/upcoming/position-of/zz":                    http.StatusBadRequest,
+		base + "/upcoming/position-of/ah?first_only=perhaps": http.StatusBadRequest,
+		server.URL + "/deck/missing/upcoming/position-of/ah": http.StatusNotFound,
+	} {
+		if status := getStatus(t, http.MethodGet, url); status != want {
+			t.Errorf("GET %s returned %d, want %d", url, status, want)
+		}
+	}
+}
+
+// fetchUpcoming decodes the answer of one of the /upcoming endpoints into v.
+func fetchUpcoming(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d, %v", url, resp.StatusCode, err)
+	}
+}
+
+// TestFingerprint hashes the upcoming order: two fresh decks share it, both
+// routes serve it, and a shuffle or a draw changes it.
+func TestFingerprint(t *testing.T) {
+	server := newTestServer(t)
+	first, second := newTestDeck(t, server, 1), newTestDeck(t, server, 1)
+
+	upcoming, err := loadUpcomingCards(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(cardCodes(upcoming), ",")))
+	want := Fingerprint{Fingerprint: hex.EncodeToString(sum[:]), Algorithm: "sha256", CardCount: 52}
+	for _, url := range []string{
+		server.URL + "/deck/" + first + "/upcoming/fingerprint",
+		server.URL + "/deck/" + first + "/fingerprint",
+		server.URL + "/deck/" + second + "/upcoming/fingerprint",
+	} {
+		if got := fetchFingerprint(t, url); got != want {
+			t.Errorf("GET %s = %+v, want %+v", url, got, want)
+		}
+	}
+
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+second+"/shuffle")
+	shuffled := fetchFingerprint(t, server.URL+"/deck/"+second+"/upcoming/fingerprint")
+	if shuffled.Fingerprint == want.Fingerprint || shuffled.CardCount != 52 {
+		t.Errorf("shuffled deck: %+v", shuffled)
+	}
+	fetchDeck(t, http.MethodGet, server.URL+"/deck/"+second+"/draw/1")
+	if drawn := fetchFingerprint(t, server.URL+"/deck/"+second+"/upcoming/fingerprint"); drawn.Fingerprint == shuffled.Fingerprint || drawn.CardCount != 51 {
+		t.Errorf("after a draw: %+v", drawn)
+	}
+
+	if status := getStatus(t, http.MethodGet, server.URL+"/deck/missing/upcoming/fingerprint"); status != http.StatusNotFound {
+		t.Errorf("missing deck: got %d, want 404", status)
+	}
+}
+
+func fetchFingerprint(t *testing.T, url string) Fingerprint {
+	t.Helper()
+	var fingerprint Fingerprint
+	fetchUpcoming(t, url, &fingerprint)
+	return fingerprint
+}
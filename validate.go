@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits enforced by request validation.
+const (
+	maxPacks     = 10
+	maxDrawCount = 1000
+	maxPlayers   = 52
+	maxJokers    = 8
+)
+
+// drawTagPattern is what a client-chosen tag recorded with every drawn card
+// may look like: a session ID such as a UUID, or a label such as question-7.
+var drawTagPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// checkDrawTag reports an invalid session ID or label in field. An empty one
+// means none.
+func checkDrawTag(v *Validator, field, tag string) {
+	if tag == "" {
+		return
+	}
+	v.Check(drawTagPattern.MatchString(tag), field, "invalid_format", "%s must be 1 to 64 letters, digits, '.', '_' or '-'", field)
+}
+
+// FieldError represents one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors represents every invalid field of a request.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validator accumulates the field errors of a request, so that every bad
+// field is reported at once instead of only the first.
+type Validator struct {
+	errs ValidationErrors
+}
+
+// Add records an error on field.
+func (v *Validator) Add(field, code, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Check records an error on field unless ok.
+func (v *Validator) Check(ok bool, field, code, format string, args ...interface{}) {
+	if !ok {
+		v.Add(field, code, format, args...)
+	}
+}
+
+// RequireInt parses a required integer in [min, max].
+func (v *Validator) RequireInt(field, value string, min, max int) int {
+	if value == "" {
+		v.Add(field, "missing", "%s is required", field)
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		v.Add(field, "invalid_integer", "%s must be an integer", field)
+		return 0
+	}
+	if n < min || n > max {
+		v.Add(field, "out_of_range", "%s must be between %d and %d", field, min, max)
+		return 0
+	}
+	return n
+}
+
+// OptionalInt parses an integer in [min, max], or returns def if it is empty.
+func (v *Validator) OptionalInt(field, value string, def, min, max int) int {
+	if value == "" {
+		return def
+	}
+	return v.RequireInt(field, value, min, max)
+}
+
+// Bool parses an optional "true"/"false" flag.
+func (v *Validator) Bool(field, value string) bool {
+	switch value {
+	case "", "false":
+		return false
+	case "true":
+		return true
+	}
+	v.Add(field, "invalid_boolean", "%s must be true or false", field)
+	return false
+}
+
+// RequireOneOf checks a required value against the allowed ones.
+func (v *Validator) RequireOneOf(field, value string, allowed []string) string {
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	v.Add(field, "invalid_choice", "%s must be one of %s", field, strings.Join(allowed, ", "))
+	return ""
+}
+
+// OneOf checks an optional value against the allowed ones.
+func (v *Validator) OneOf(field, value string, allowed []string) string {
+	if value == "" {
+		return ""
+	}
+	return v.RequireOneOf(field, value, allowed)
+}
+
+// Err returns the accumulated errors as a ValidationErrors, or nil.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// writeValidationErrors rejects a request with a 400 listing each bad field.
+func writeValidationErrors(w http.ResponseWriter, err error) {
+	writeFieldErrors(w, http.StatusBadRequest, err)
+}
+
+// writeFieldErrors rejects a request with status listing each bad field, for
+// requests that are well-formed but do not fit the state of the deck.
+func writeFieldErrors(w http.ResponseWriter, status int, err error) {
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		errs = ValidationErrors{{Field: "request", Code: "invalid", Message: err.Error()}}
+	}
+	writeJSONStatus(w, status, map[string]ValidationErrors{"errors": errs})
+}
+
+// CreateParams represents the validated input of GET /deck/new/{packs}/{jokers}.
+type CreateParams struct {
+	Packs       int
+	Jokers      bool
+	JokerCount  int // jokers per pack, unless JokersTotal is set
+	JokersTotal int // jokers for the whole deck, or -1 for JokerCount per pack
+	Order       CardOrder
+	LocksAt     string
+	RefillFrom  string
+	Scoring     string
+	ReshuffleAt int    // percentage of cards left below which draws reshuffle, or 0
+	Seed        *int64 // seed of every shuffle, or nil for random shuffles
+
+	MinDrawInterval time.Duration // minimum time between two draws, or 0
+}
+
+func parseCreateParams(r *http.Request) (CreateParams, error) {
+	v := &Validator{}
+	params := CreateParams{Packs: 1, JokerCount: 2, JokersTotal: -1}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/deck/new/"), "/"), "/")
+	v.Check(len(parts) <= 2, "path", "too_many_segments", "expected /deck/new/{packs}/{jokers}")
+	if len(parts) > 0 && parts[0] != "" {
+		params.Packs = v.RequireInt("packs", parts[0], 1, maxPacks)
+	}
+	if len(parts) > 1 {
+		params.Jokers = v.Bool("jokers", parts[1])
+	}
+
+	query := r.URL.Query()
+	if jokersTotal := query.Get("jokers_total"); jokersTotal != "" {
+		params.JokersTotal = v.RequireInt("jokers_total", jokersTotal, 0, maxJokers)
+		v.Check(params.Jokers, "jokers_total", "requires_jokers", "jokers_total requires jokers to be true")
+	}
+	if jokerCount := query.Get("joker_count"); jokerCount != "" {
+		if v.RequireOneOf("joker_count", jokerCount, jokerCardCounts) != "" {
+			params.JokerCount, _ = strconv.Atoi(jokerCount)
+		}
+		v.Check(params.Jokers, "joker_count", "requires_jokers", "joker_count requires jokers to be true")
+		v.Check(params.JokersTotal < 0, "joker_count", "conflict", "joker_count and jokers_total cannot be combined")
+	}
+	params.Order.RankFirst = v.OneOf("order", query.Get("order"), []string{"rank_first", "suit_first"}) == "rank_first"
+	params.Order.AceLow = v.OneOf("ace", query.Get("ace"), []string{"high", "low"}) == "low"
+
+	locksAt, err := parseDeadline(query.Get("locks_at"))
+	v.Check(err == nil, "locks_at", "invalid_time", "locks_at must be an RFC 3339 time")
+	params.LocksAt = locksAt
+
+	v.Check(validateScoring(query.Get("scoring")) == nil, "scoring", "invalid_choice", "unknown scoring scheme")
+	params.Scoring = query.Get("scoring")
+	params.RefillFrom = query.Get("refill_from")
+	params.ReshuffleAt = v.OptionalInt("reshuffle_at", query.Get("reshuffle_at"), 0, 0, 100)
+	if seedStr := query.Get("seed"); seedStr != "" {
+		seed, err := strconv.ParseInt(seedStr, 10, 64)
+		v.Check(err == nil, "seed", "invalid_integer", "seed must be an integer")
+		params.Seed = &seed
+	}
+	params.MinDrawInterval = parseDrawInterval(v, query.Get("min_draw_interval"))
+
+	return params, v.Err()
+}
+
+// DrawParams represents the validated input of a draw.
+type DrawParams struct {
+	Count         int
+	WithRemaining bool
+	Exact         bool
+	SplitBySuit   bool
+	Lenient       bool
+	Order         string
+	Street        string // board street recorded with the drawn cards, or ""
+	Sort          bool   // return the cards in canonical order instead of draw order
+	Session       string // session recorded with the drawn cards, or ""
+	Label         string // label recorded with the drawn cards, or ""
+	Table         string // shoe table recorded with the drawn cards, or ""
+}
+
+// parseDrawTags reads the street, session and label a draw records with the
+// cards it draws.
+func parseDrawTags(v *Validator, query url.Values) DrawParams {
+	params := DrawParams{
+		Street:  v.OneOf("street", query.Get("street"), boardStreets),
+		Session: query.Get("session"),
+		Label:   query.Get("label"),
+	}
+	checkDrawTag(v, "session", params.Session)
+	checkDrawTag(v, "label", params.Label)
+	return params
+}
+
+func parseDrawParams(countStr string, query url.Values) (DrawParams, error) {
+	v := &Validator{}
+	count := v.RequireInt("count", countStr, 1, maxDrawCount)
+	params := parseDrawTags(v, query)
+	params.Count = count
+	params.WithRemaining = v.Bool("withRemaining", query.Get("withRemaining"))
+	params.Exact = v.Bool("exact", query.Get("exact"))
+	params.SplitBySuit = v.Bool("split-by-suit", query.Get("split-by-suit"))
+	params.Lenient = v.Bool("lenient", query.Get("lenient"))
+	params.Order = v.OneOf("order", query.Get("order"), []string{orderTopFirst, orderBottomFirst})
+	params.Sort = v.Bool("sort", query.Get("sort"))
+	v.Check(!params.Sort || params.Order == "", "sort", "conflict", "sort and order cannot be combined")
+	return params, v.Err()
+}
+
+// CollectParams represents the validated input of GET
+// /deck/{id}/draw/collect. The street, session and label the drawn cards are
+// recorded with come back as the DrawParams of the draw.
+type CollectParams struct {
+	Suit  string
+	Count int
+}
+
+// collectUnsupported lists the draw options a collect draw does not take:
+// they are rejected rather than ignored.
+var collectUnsupported = []string{"withRemaining", "exact", "split-by-suit", "lenient", "order", "sort"}
+
+func parseCollectParams(query url.Values) (CollectParams, DrawParams, error) {
+	v := &Validator{}
+	params := CollectParams{
+		Suit:  v.RequireOneOf("suit", query.Get("suit"), suitCodes),
+		Count: v.RequireInt("count", query.Get("count"), 1, maxDrawCount),
+	}
+	draw := parseDrawTags(v, query)
+	for _, name := range collectUnsupported {
+		v.Check(!query.Has(name), name, "unsupported", "%s does not apply to a collect draw", name)
+	}
+	return params, draw, v.Err()
+}
+
+// ShowParams represents the validated input of GET /deck/{id}/show/{type}/{count}.
+// Type "0" shows drawn cards and "1" upcoming cards. The upper bound of Count
+// depends on the deck and is checked once it is loaded.
+type ShowParams struct {
+	Type  string
+	Count int
+	Label string // only the drawn cards with this label, or ""
+}
+
+func parseShowParams(typeStr, countStr string, query url.Values) (ShowParams, error) {
+	v := &Validator{}
+	params := ShowParams{
+		Type:  v.RequireOneOf("type", typeStr, []string{"0", "1"}),
+		Count: v.RequireInt("count", countStr, 0, maxDrawCount*maxPacks),
+		Label: query.Get("label"),
+	}
+	checkDrawTag(v, "label", params.Label)
+	v.Check(params.Label == "" || params.Type != "1", "label", "conflict", "label only applies to drawn cards")
+	v.OptionalInt("cursor", query.Get("cursor"), 0, 0, maxDrawCount*maxPacks)
+	v.Bool("no_truncate", query.Get("no_truncate"))
+	return params, v.Err()
+}
+
+// AddParams represents the validated input of POST /deck/{id}/add. The
+// standard cards of ?cards come first, then the custom cards of ?custom.
+type AddParams struct {
+	Cards []Card
+}
+
+func parseAddParams(query url.Values) (AddParams, error) {
+	v := &Validator{}
+	var params AddParams
+
+	cardsStr, customStr := query.Get("cards"), query.Get("custom")
+	if cardsStr == "" && customStr == "" {
+		v.Add("cards", "missing", "cards is required")
+		return params, v.Err()
+	}
+	// Each unknown card is reported with its position, so a client can point
+	// at the bad entries of the list.
+	if cardsStr != "" {
+		for i, token := range strings.Split(cardsStr, ",") {
+			code, err := resolveCardCode(token)
+			if err != nil {
+				v.Add(fmt.Sprintf("cards[%d]", i), "unknown_card", "%s", err.Error())
+				continue
+			}
+			params.Cards = append(params.Cards, cardFromCode(code))
+		}
+	}
+	if customStr != "" {
+		for i, token := range strings.Split(customStr, ",") {
+			code := strings.TrimSpace(token)
+			field := fmt.Sprintf("custom[%d]", i)
+			if !validCustomCode(code) {
+				v.Add(field, "invalid_code", "custom codes are 1 to %d printable characters", maxGeneratedCode)
+				continue
+			}
+			if _, err := resolveCardCode(code); err == nil {
+				v.Add(field, "standard_card", "%s is a standard card; add it with cards", code)
+				continue
+			}
+			params.Cards = append(params.Cards, customCard(code))
+		}
+	}
+	if err := v.Err(); err != nil {
+		return AddParams{}, err
+	}
+	return params, nil
+}
+
+// DealParams represents the validated input of POST
+// /deck/{id}/shuffle-deal/{players}/{cardsEach}.
+type DealParams struct {
+	Players   int
+	CardsEach int
+}
+
+func parseDealParams(playersStr, cardsEachStr string) (DealParams, error) {
+	v := &Validator{}
+	params := DealParams{
+		Players:   v.RequireInt("players", playersStr, 1, maxPlayers),
+		CardsEach: v.RequireInt("cardsEach", cardsEachStr, 1, maxDrawCount),
+	}
+	return params, v.Err()
+}
+
+// maxStreamInterval bounds the pause between two cards of a draw stream.
+const maxStreamInterval = 60000
+
+// StreamParams represents the validated input of GET /deck/{id}/draw-stream.
+type StreamParams struct {
+	Count    int
+	Interval time.Duration
+	Label    string // label recorded with the drawn cards, or ""
+}
+
+func parseStreamParams(query url.Values) (StreamParams, error) {
+	v := &Validator{}
+	params := StreamParams{
+		Count:    v.RequireInt("count", query.Get("count"), 1, maxDrawCount),
+		Interval: time.Duration(v.OptionalInt("interval_ms", query.Get("interval_ms"), 0, 0, maxStreamInterval)) * time.Millisecond,
+		Label:    query.Get("label"),
+	}
+	checkDrawTag(v, "label", params.Label)
+	return params, v.Err()
+}
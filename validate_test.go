@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fieldCodes returns the "field:code" pairs of the errors collected by v.
+func fieldCodes(v *Validator) []string {
+	var codes []string
+	if err := v.Err(); err != nil {
+		for _, fieldErr := range err.(ValidationErrors) {
+			codes = append(codes, fieldErr.Field+":"+fieldErr.Code)
+		}
+	}
+	return codes
+}
+
+func TestValidatorRequireInt(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		codes []string
+	}{
+		{"5", 5, nil},
+		{"1", 1, nil},
+		{"10", 10, nil},
+		{"", 0, []string{"n:missing"}},
+		{"x", 0, []string{"n:invalid_integer"}},
+		{"2.5", 0, []string{"n:invalid_integer"}},
+		{"0", 0, []string{"n:out_of_range"}},
+		{"11", 0, []string{"n:out_of_range"}},
+	}
+	for _, tt := range tests {
+		v := &Validator{}
+		got := v.RequireInt("n", tt.value, 1, 10)
+		if got != tt.want || !reflect.DeepEqual(fieldCodes(v), tt.codes) {
+			t.Errorf("RequireInt(%q) = %d, %v; want %d, %v", tt.value, got, fieldCodes(v), tt.want, tt.codes)
+		}
+	}
+}
+
+func TestValidatorOptionalInt(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		codes []string
+	}{
+		{"", 7, nil},
+		{"3", 3, nil},
+		{"x", 0, []string{"n:invalid_integer"}},
+		{"99", 0, []string{"n:out_of_range"}},
+	}
+	for _, tt := range tests {
+		v := &Validator{}
+		got := v.OptionalInt("n", tt.value, 7, 0, 10)
+		if got != tt.want || !reflect.DeepEqual(fieldCodes(v), tt.codes) {
+			t.Errorf("OptionalInt(%q) = %d, %v; want %d, %v", tt.value, got, fieldCodes(v), tt.want, tt.codes)
+		}
+	}
+}
+
+func TestValidatorBool(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+		codes []string
+	}{
+		{"", false, nil},
+		{"false", false, nil},
+		{"true", true, nil},
+		{"yes", false, []string{"b:invalid_boolean"}},
+		{"1", false, []string{"b:invalid_boolean"}},
+	}
+	for _, tt := range tests {
+		v := &Validator{}
+		got := v.Bool("b", tt.value)
+		if got != tt.want || !reflect.DeepEqual(fieldCodes(v), tt.codes) {
+			t.Errorf("Bool(%q) = %v, %v; want %v, %v", tt.value, got, fieldCodes(v), tt.want, tt.codes)
+		}
+	}
+}
+
+func TestValidatorOneOf(t *testing.T) {
+	allowed := []string{"0", "1"}
+	tests := []struct {
+		value    string
+		required bool
+		want     string
+		codes    []string
+	}{
+		{"0", true, "0", nil},
+		{"1", false, "1", nil},
+		{"", false, "", nil},
+		{"", true, "", []string{"type:invalid_choice"}},
+		{"2", true, "", []string{"type:invalid_choice"}},
+		{"2", false, "", []string{"type:invalid_choice"}},
+	}
+	for _, tt := range tests {
+		v := &Validator{}
+		var got string
+		if tt.required {
+			got = v.RequireOneOf("type", tt.value, allowed)
+		} else {
+			got = v.OneOf("type", tt.value, allowed)
+		}
+		if got != tt.want || !reflect.DeepEqual(fieldCodes(v), tt.codes) {
+			t.Errorf("OneOf(%q, required=%v) = %q, %v; want %q, %v", tt.value, tt.required, got, fieldCodes(v), tt.want, tt.codes)
+		}
+	}
+}
+
+func TestValidatorCheckAndErr(t *testing.T) {
+	v := &Validator{}
+	if v.Err() != nil {
+		t.Fatal("empty validator returned an error")
+	}
+	v.Check(true, "a", "bad", "a is bad")
+	v.Check(false, "b", "bad", "%s is bad", "b")
+	v.Add("c", "worse", "c is worse")
+
+	err, ok := v.Err().(ValidationErrors)
+	if !ok {
+		t.Fatalf("Err() returned %T, want ValidationErrors", v.Err())
+	}
+	want := ValidationErrors{
+		{Field: "b", Code: "bad", Message: "b is bad"},
+		{Field: "c", Code: "worse", Message: "c is worse"},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Fatalf("Err() = %+v, want %+v", err, want)
+	}
+	if err.Error() != "b is bad; c is worse" {
+		t.Fatalf("Error() = %q", err.Error())
+	}
+}
+
+func TestParseShowParamsReportsEveryField(t *testing.T) {
+	_, err := parseShowParams("2", "x", url.Values{"no_truncate": {"maybe"}})
+	v := &Validator{errs: err.(ValidationErrors)}
+	want := []string{"type:invalid_choice", "count:invalid_integer", "no_truncate:invalid_boolean"}
+	if got := fieldCodes(v); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseCreateParamsJokerCount(t *testing.T) {
+	tests := []struct {
+		path, rawQuery string
+		jokers         []string
+		codes          []string
+	}{
+		{"1/true", "", []string{jokerCode, jokerCode}, nil},
+		{"1/true", "joker_count=0", nil, nil},
+		{"2/true", "joker_count=1", []string{jokerCode, jokerCode}, nil},
+		{"1/true", "joker_count=4", []string{redJokerCode, redJokerCode, blackJokerCode, blackJokerCode}, nil},
+		{"1/true", "joker_count=3", nil, []string{"joker_count:invalid_choice"}},
+		{"1/false", "joker_count=1", nil, []string{"joker_count:requires_jokers"}},
+		{"1/true", "joker_count=1&jokers_total=3", nil, []string{"joker_count:conflict"}},
+	}
+	for _, tt := range tests {
+		r := &http.Request{URL: &url.URL{Path: "/deck/new/" + tt.path, RawQuery: tt.rawQuery}}
+		params, err := parseCreateParams(r)
+		v := &Validator{}
+		if err != nil {
+			v.errs = err.(ValidationErrors)
+		}
+		if got := fieldCodes(v); !reflect.DeepEqual(got, tt.codes) {
+			t.Errorf("%s?%s: got errors %v, want %v", tt.path, tt.rawQuery, got, tt.codes)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		var jokers []string
+		for _, card := range generateCards(params.Packs, params.JokerCount, params.Order) {
+			if isJoker(card.Code) {
+				jokers = append(jokers, card.Code)
+			}
+		}
+		if !reflect.DeepEqual(jokers, tt.jokers) {
+			t.Errorf("%s?%s: got jokers %v, want %v", tt.path, tt.rawQuery, jokers, tt.jokers)
+		}
+	}
+}
+
+func FuzzParseCreateParams(f *testing.F) {
+	for _, seed := range []string{"", "1", "2/true", "11", "-1/true", "abc/maybe", "1/true/extra", "0", "999999999999999999999"} {
+		f.Add(seed, "order=rank_first&ace=low")
+		f.Add(seed, "locks_at=yesterday&scoring=poker")
+	}
+
+	f.Fuzz(func(t *testing.T, path, rawQuery string) {
+		r := &http.Request{URL: &url.URL{Path: "/deck/new/" + path, RawQuery: rawQuery}}
+		params, err := parseCreateParams(r)
+		if err != nil {
+			return
+		}
+		if params.Packs < 1 || params.Packs > maxPacks {
+			t.Fatalf("accepted %d packs from %q", params.Packs, path)
+		}
+	})
+}
+
+func FuzzParseDrawParams(f *testing.F) {
+	for _, seed := range []string{"1", "0", "-5", "1000", "1001", "x", "", "3.5"} {
+		f.Add(seed, "exact=true&withRemaining=yes")
+	}
+
+	f.Fuzz(func(t *testing.T, count, rawQuery string) {
+		query, _ := url.ParseQuery(rawQuery)
+		params, err := parseDrawParams(count, query)
+		if err != nil {
+			for _, fieldErr := range err.(ValidationErrors) {
+				if fieldErr.Field == "" || fieldErr.Code == "" || fieldErr.Message == "" {
+					t.Fatalf("incomplete field error %+v", fieldErr)
+				}
+			}
+			return
+		}
+		if params.Count < 1 || params.Count > maxDrawCount {
+			t.Fatalf("accepted count %d from %q", params.Count, count)
+		}
+	})
+}
+
+// FuzzDeckRoutes feeds junk paths and queries to the deck routes of a real
+// deck and checks that bad input never turns into a server error.
+func FuzzDeckRoutes(f *testing.F) {
+	for _, seed := range []string{"draw/x", "draw/-1", "draw/distinct/zz", "show/2/1", "show/0/abc", "show/1/99999", "upcoming/top/x/hashes", "upcoming/next-of-suit/x", "add", "shuffle-deal/0/x"} {
+		f.Add("GET", seed, "exact=maybe")
+		f.Add("POST", seed, "cards=zz,ah")
+	}
+
+	deckID := newTestDeck(f, newTestServer(f), 1)
+	handler := routes()
+
+	f.Fuzz(func(t *testing.T, method, path, rawQuery string) {
+		if method != http.MethodGet && method != http.MethodPost {
+			return
+		}
+		r := httptest.NewRequest(method, "/", nil)
+		r.URL.Path = "/deck/" + deckID + "/" + path
+		r.URL.RawQuery = rawQuery
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code >= 500 {
+			t.Fatalf("%s %s?%s returned %d: %s", method, r.URL.Path, rawQuery, w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestParseAddParamsReportsEachUnknownCard(t *testing.T) {
+	_, err := parseAddParams(url.Values{"cards": {"zz,ah,queen_of_stars"}})
+	v := &Validator{errs: err.(ValidationErrors)}
+	want := []string{"cards[0]:unknown_card", "cards[2]:unknown_card"}
+	if got := fieldCodes(v); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	params, err := parseAddParams(url.Values{"cards": {"ah,10_of_spades"}})
+	if err != nil || len(params.Cards) != 2 || params.Cards[1].Code != "10s" {
+		t.Fatalf("got %+v, %v", params.Cards, err)
+	}
+}
+
+// Endpoints answer a bad request with every invalid field in a JSON body.
+func TestValidationErrorResponses(t *testing.T) {
+	server := newTestServer(t)
+	deckURL := server.URL + "/deck/" + newTestDeck(t, server, 1)
+
+	tests := []struct {
+		method, url string
+		want        []string
+	}{
+		{http.MethodGet, server.URL + "/deck/new/x/maybe?order=diagonal", []string{"packs:invalid_integer", "jokers:invalid_boolean", "order:invalid_choice"}},
+		{http.MethodPost, deckURL + "/add", []string{"cards:missing"}},
+		{http.MethodPost, deckURL + "/add?cards=ah,xx", []string{"cards[1]:unknown_card"}},
+		{http.MethodGet, deckURL + "/draw/collect?suit=h&count=2&order=bottom_first&sort=true&split-by-suit=true&exact=true", []string{"exact:unsupported", "split-by-suit:unsupported", "order:unsupported", "sort:unsupported"}},
+		{http.MethodPost, deckURL + "/add?custom=dragon,ah,%01," + strings.Repeat("x", maxGeneratedCode+1), []string{"custom[1]:standard_card", "custom[2]:invalid_code", "custom[3]:invalid_code"}},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.url, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Errors ValidationErrors `json:"errors"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %s: status %d, decode error %v", tt.method, tt.url, resp.StatusCode, err)
+			continue
+		}
+		v := &Validator{errs: body.Errors}
+		if got := fieldCodes(v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s: got %v, want %v", tt.method, tt.url, got, tt.want)
+		}
+		for _, fieldErr := range body.Errors {
+			if fieldErr.Message == "" {
+				t.Errorf("%s %s: %s has no message", tt.method, tt.url, fieldErr.Field)
+			}
+		}
+	}
+}
+
+func TestEmptyDeckIDIsRejected(t *testing.T) {
+	server := newTestServer(t)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		req, _ := http.NewRequest(method, server.URL+"/deck/", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Errors ValidationErrors `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || len(body.Errors) != 1 || body.Errors[0].Field != "deck_id" {
+			t.Errorf("%s /deck/: status %d, errors %+v", method, resp.StatusCode, body.Errors)
+		}
+	}
+}
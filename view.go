@@ -0,0 +1,93 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+var viewTemplate = template.Must(template.ParseFS(templateFS, "templates/view.html"))
+
+// viewCard represents one drawn card on the deck view page.
+type viewCard struct {
+	Code  string
+	Time  string
+	Image string
+}
+
+// viewData is the data rendered by the deck view template.
+type viewData struct {
+	DeckID    string
+	ReadOnly  bool
+	Remaining int
+	Drawn     []viewCard
+}
+
+// ViewShare represents a share link to the read-only view of a deck.
+type ViewShare struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// shareToken returns the share token of a deck. It is derived from the admin
+// token, so only an admin can issue it and it needs no storage.
+func shareToken(deckID string) string {
+	return adminDigest("share:" + deckID)
+}
+
+// showViewShare serves GET /deck/{id}/share: the link spectators open to
+// follow a deck without controlling it. Admin only.
+func showViewShare(w http.ResponseWriter, r *http.Request, deckID string) {
+	if !deckExists(readDB, deckID) {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	}
+	token := shareToken(deckID)
+	writeJSON(w, ViewShare{Token: token, URL: "/deck/" + deckID + "/view?share=" + token})
+}
+
+// viewDeck renders a deck as an HTML page for projecting during class. Only
+// an admin, such as the instructor logged in to the dashboard, gets the Draw
+// and Shuffle buttons, and only while the deck takes draws; spectators open
+// the page with the share token of GET /deck/{id}/share and always get it
+// read-only. Anyone else is turned away. The buttons are added by script, so
+// without JavaScript the page is a static snapshot.
+func viewDeck(w http.ResponseWriter, r *http.Request, deckID string) {
+	admin := isAdmin(r)
+	share := r.URL.Query().Get("share")
+	if !admin && (adminToken == "" || share == "" || !equalSecret(share, shareToken(deckID))) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	drawnCards, err := loadDrawnCards(deckID)
+	if err == errDeckNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	upcomingCards, err := loadUpcomingCards(deckID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	readOnly := !admin || deckUnlocked(readDB, deckID) != nil
+
+	data := viewData{
+		DeckID:    deckID,
+		ReadOnly:  readOnly,
+		Remaining: len(upcomingCards),
+	}
+	for _, card := range drawnCards {
+		data.Drawn = append(data.Drawn, viewCard{Code: card.Code, Time: card.Time, Image: cardImage(card.Code)})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := viewTemplate.Execute(w, data); err != nil {
+		log.Printf("Error rendering deck view: %v", err)
+	}
+}
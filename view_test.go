@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestViewDeck renders a deck holding jokers and custom cards and checks that
+// the controls follow the viewer and the deck's own state: present for an
+// admin while the deck takes draws, gone once it is frozen or past its
+// deadline, and never there for a spectator, whatever the query string says.
+func TestViewDeck(t *testing.T) {
+	setupAdminToken(t)
+	server := newTestServer(t)
+	deckID := fetchDeck(t, http.MethodGet, server.URL+"/deck/new/1/true").ID
+	base := server.URL + "/deck/" + deckID
+	custom := []string{"dragon", "🂡joker"}
+	query := url.Values{"custom": {strings.Join(custom, ",")}}
+	if status := getStatus(t, http.MethodPost, base+"/add?"+query.Encode()); status != http.StatusOK {
+		t.Fatalf("add returned %d", status)
+	}
+	fetchDeck(t, http.MethodGet, base+"/draw/56")
+
+	page := viewPage(t, base+"/view?readonly=true", true)
+	if !strings.Contains(page, `id="draw"`) || !strings.Contains(page, `id="shuffle"`) {
+		t.Error("open deck rendered without controls for an admin")
+	}
+	if !strings.Contains(page, ">"+jokerCode+"<") || !strings.Contains(page, "Remaining: 0") {
+		t.Errorf("page does not show the drawn jokers:\n%s", page)
+	}
+	for _, code := range custom {
+		if !strings.Contains(page, ">"+code+"<") || !strings.Contains(page, `src="`+html.EscapeString(cardImage(code))+`"`) {
+			t.Errorf("page does not show the custom card %s with its image:\n%s", code, page)
+		}
+	}
+
+	// Spectators follow the deck through the share link, without controls.
+	if status := getStatus(t, http.MethodGet, base+"/share"); status != http.StatusForbidden {
+		t.Errorf("share link without the admin token: got %d, want 403", status)
+	}
+	resp := adminRequest(t, http.MethodGet, base+"/share", "")
+	var share ViewShare
+	err := json.NewDecoder(resp.Body).Decode(&share)
+	resp.Body.Close()
+	if err != nil || share.Token == "" {
+		t.Fatalf("share = %+v, %v", share, err)
+	}
+	page = viewPage(t, server.URL+share.URL+"&readonly=false", false)
+	if strings.Contains(page, `id="draw"`) || strings.Contains(page, `id="shuffle"`) {
+		t.Error("spectator view rendered with controls")
+	}
+	if !strings.Contains(page, ">dragon<") {
+		t.Errorf("spectator view does not show the deck:\n%s", page)
+	}
+	for _, url := range []string{base + "/view", base + "/view?readonly=false", base + "/view?share=forged"} {
+		if status := getStatus(t, http.MethodGet, url); status != http.StatusForbidden {
+			t.Errorf("%s without a share token: got %d, want 403", url, status)
+		}
+	}
+	other := newTestDeck(t, server, 1)
+	if status := getStatus(t, http.MethodGet, server.URL+"/deck/"+other+"/view?share="+share.Token); status != http.StatusForbidden {
+		t.Errorf("share token of another deck: got %d, want 403", status)
+	}
+
+	if status := adminStatus(t, http.MethodPost, base+"/freeze"); status != http.StatusOK {
+		t.Fatalf("freeze returned %d", status)
+	}
+	if page := viewPage(t, base+"/view?readonly=false", true); strings.Contains(page, `id="draw"`) {
+		t.Error("frozen deck rendered with a Draw button")
+	}
+
+	if status := adminStatus(t, http.MethodPost, base+"/unfreeze"); status != http.StatusOK {
+		t.Fatalf("unfreeze returned %d", status)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE decks SET locks_at = ? WHERE id = ?", past, deckID); err != nil {
+		t.Fatal(err)
+	}
+	if page := viewPage(t, base+"/view", true); strings.Contains(page, `id="draw"`) {
+		t.Error("locked deck rendered with a Draw button")
+	}
+
+	if status := adminStatus(t, http.MethodGet, server.URL+"/deck/missing/view"); status != http.StatusNotFound {
+		t.Errorf("missing deck: got %d, want 404", status)
+	}
+}
+
+// viewPage fetches a deck view, as an admin or not.
+func viewPage(t *testing.T, url string, admin bool) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return string(body)
+}
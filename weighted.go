@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"TPReseau/deck"
+)
+
+// maxCardWeight bounds the weights of a weighted draw.
+const maxCardWeight = 1e6
+
+// WeightedParams represents the validated input of POST
+// /deck/{id}/draw/{n}/weighted. Weights maps card codes to their weight;
+// cards not listed weigh Default.
+type WeightedParams struct {
+	Count   int                `json:"count"`
+	Weights map[string]float64 `json:"weights"`
+	Default float64            `json:"default"`
+	Label   string             `json:"label,omitempty"`
+}
+
+func parseWeightedParams(countStr string, r *http.Request) (WeightedParams, error) {
+	v := &Validator{}
+	params := WeightedParams{
+		Count:   v.RequireInt("count", countStr, 1, maxDrawCount),
+		Weights: make(map[string]float64),
+		Default: 1,
+		Label:   r.URL.Query().Get("label"),
+	}
+	checkDrawTag(v, "label", params.Label)
+
+	var body struct {
+		Weights map[string]float64 `json:"weights"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		v.Add("body", "invalid_json", `body must be a JSON object such as {"weights": {"ah": 5}}`)
+		return params, v.Err()
+	}
+
+	codes := make([]string, 0, len(body.Weights))
+	for code := range body.Weights {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		weight := body.Weights[code]
+		field := "weights." + code
+		v.Check(weight >= 0 && weight <= maxCardWeight, field, "out_of_range", "%s must be between 0 and %g", field, float64(maxCardWeight))
+		if code == "default" {
+			params.Default = weight
+			continue
+		}
+		resolved, err := resolveCardCode(code)
+		if err != nil {
+			v.Add(field, "unknown_card", "%s", err.Error())
+			continue
+		}
+		params.Weights[resolved] = weight
+	}
+	return params, v.Err()
+}
+
+// weight returns the weight of a card.
+func (p WeightedParams) weight(card Card) float64 {
+	if weight, ok := p.Weights[card.Code]; ok {
+		return weight
+	}
+	return p.Default
+}
+
+// drawWeightedCards draws Weighted.Count cards from anywhere in the upcoming cards,
+// each card being picked with a probability proportional to its weight. Cards
+// of weight 0 are never drawn. The sampling is without replacement, by
+// weighted reservoir sampling: every card gets the key u^(1/weight) for a
+// uniform u, and the cards with the largest keys are drawn, largest first.
+func drawWeightedCards(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	params := req.Weighted
+	if params.Count < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid weighted draw")}
+		return
+	}
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if len(upcomingCards) == 0 {
+		req.ReplyCh <- Response{Error: errDeckEmpty}
+		return
+	}
+
+	type keyed struct {
+		index int
+		key   float64
+	}
+	var candidates []keyed
+	rng.Lock()
+	for i, card := range upcomingCards {
+		if weight := params.weight(card); weight > 0 {
+			candidates = append(candidates, keyed{i, math.Pow(rng.Float64(), 1/weight)})
+		}
+	}
+	rng.Unlock()
+	if len(candidates) == 0 {
+		req.ReplyCh <- Response{Error: errNotEnoughCards}
+		return
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].key > candidates[j].key })
+	if len(candidates) > params.Count {
+		candidates = candidates[:params.Count]
+	}
+
+	picked := make([]int, len(candidates))
+	for i, c := range candidates {
+		picked[i] = c.index
+	}
+
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	drawnCards := deck.DrawPicked(&state, picked, clock.Now())
+	offCommitment := !drawnFromTop(upcomingCards, drawnCards)
+	tagDrawn(state.Drawn[len(drawnHistory):], req.Draw)
+	keptCards, reshuffled, err := saveDraw(req.DeckID, state.Upcoming, state.Drawn, len(drawnCards), req.UnmodifiedSince)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	shuffled := deckShuffled(req.DeckID)
+	req.ReplyCh <- Response{Deck: Deck{
+		ID:            req.DeckID,
+		Cards:         drawnCards,
+		Remaining:     len(keptCards),
+		Shuffled:      &shuffled,
+		Reshuffled:    reshuffled,
+		OffCommitment: offCommitment,
+	}}
+}
+
+// weightedDraw serves POST /deck/{id}/draw/{n}/weighted.
+func weightedDraw(w http.ResponseWriter, r *http.Request, deckID, countStr string) {
+	params, err := parseWeightedParams(countStr, r)
+	if err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+	resp := submit(Request{
+		Type:     "draw-weighted",
+		DeckID:   deckID,
+		Weighted: params,
+		Draw:     DrawParams{Label: params.Label},
+		ReplyCh:  make(chan Response),
+	})
+	handleResponse(w, r, resp)
+}
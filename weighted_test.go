@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWeightedDraw(t *testing.T) {
+	server := newTestServer(t)
+	deckID := newTestDeck(t, server, 1)
+
+	// Only the cards with a weight can be drawn, however many are asked for.
+	resp, err := http.Post(server.URL+"/deck/"+deckID+"/draw/5/weighted", "application/json",
+		strings.NewReader(`{"weights": {"default": 0, "AH": 1, "ks": 2}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deck Deck
+	err = json.NewDecoder(resp.Body).Decode(&deck)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("weighted draw returned %d: %v", resp.StatusCode, err)
+	}
+	got := cardCodes(deck.Cards)
+	if len(got) != 2 || !reflect.DeepEqual(map[string]bool{got[0]: true, got[1]: true}, map[string]bool{"ah": true, "ks": true}) || deck.Remaining != 50 {
+		t.Errorf("drew %v leaving %d, want ah and ks leaving 50", got, deck.Remaining)
+	}
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"TPReseau/deck"
+)
+
+// Request represents a request for deck operations. Draw holds the
+// parameters of the draws, including the distinct, alternate and teach ones;
+// Collect, Weighted and Deal those of the operations they are named after.
+type Request struct {
+	Type       string
+	DeckID     string
+	Draw       DrawParams
+	Collect    CollectParams
+	Weighted   WeightedParams
+	Deal       DealParams
+	ReplyCh    chan Response
+	EnqueuedAt time.Time
+
+	// UnmodifiedSince is the If-Unmodified-Since time of a draw or shuffle,
+	// or the zero time.
+	UnmodifiedSince time.Time
+}
+
+// Response represents a response from deck operations.
+type Response struct {
+	Deck  Deck
+	Drawn []DrawnCard
+	Odds  []DrawOdds
+	Error error
+}
+
+func handleRequests() {
+	for req := range requestChannel {
+		atomic.AddInt64(&queueDepth, -1)
+		observeQueueWait(req)
+		switch req.Type {
+		case "draw":
+			drawCards(req)
+		case "draw-distinct":
+			drawDistinctCards(req)
+		case "draw-alternate":
+			drawAlternateCards(req)
+		case "draw-collect":
+			drawCollectCards(req)
+		case "draw-weighted":
+			drawWeightedCards(req)
+		case "draw-teach":
+			drawTeachCards(req)
+		case "shuffle":
+			shuffleDeck(req)
+		case "shuffle-deal":
+			shuffleAndDeal(req)
+		}
+	}
+}
+
+var requestChannel = make(chan Request)
+
+func drawCards(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nbrCarte := req.Draw.Count
+	if nbrCarte < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid number of cards")}
+		return
+	}
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	// When the deck runs short, the missing cards come from its refill chain.
+	var pulls []fallbackPull
+	var refilled []Card
+	if nbrCarte > len(upcomingCards) {
+		pulls = pullFromFallbacks(req.DeckID, nbrCarte-len(upcomingCards))
+	}
+	for _, pull := range pulls {
+		refilled = append(refilled, pull.pulled...)
+	}
+
+	// With ?exact=true the draw is all-or-nothing: nothing has been written
+	// yet, so failing here leaves both decks untouched.
+	if req.Draw.Exact && len(upcomingCards)+len(refilled) < nbrCarte {
+		req.ReplyCh <- Response{Error: errNotEnoughCards}
+		return
+	}
+
+	firstEntry := len(drawnHistory)
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	drawnCards, err := deck.DrawN(&state, nbrCarte, clock.Now())
+	if err != nil && !(err == errDeckEmpty && len(refilled) > 0) {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	drawnCards = append(drawnCards, refilled...)
+	upcomingCards, drawnHistory = state.Upcoming, state.Drawn
+
+	for _, pull := range pulls {
+		for _, entry := range drawnEntries(pull.pulled) {
+			entry.From = pull.source
+			drawnHistory = append(drawnHistory, entry)
+		}
+	}
+	tagDrawn(drawnHistory[firstEntry:], req.Draw)
+
+	tx, err := db.Begin()
+	if err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	defer tx.Rollback()
+
+	if err := checkUnmodifiedSince(tx, req.DeckID, req.UnmodifiedSince); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if err := paceDraw(tx, req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if len(refilled) > 0 {
+		if err := adjustCardTotal(tx, req.DeckID, len(refilled)); err != nil {
+			req.ReplyCh <- Response{Error: err}
+			return
+		}
+	}
+	for _, pull := range pulls {
+		if err := adjustCardTotal(tx, pull.source, -len(pull.pulled)); err != nil {
+			req.ReplyCh <- Response{Error: err}
+			return
+		}
+	}
+	upcomingCards, drawnHistory, reshuffled, err := autoReshuffle(tx, req.DeckID, upcomingCards, drawnHistory, len(drawnCards))
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	stored := firstEntry
+	if reshuffled {
+		stored = -1
+	}
+	if err := appendDeckState(tx, req.DeckID, upcomingCards, drawnHistory, stored); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if err := recordLabeledDraw(tx, req.DeckID, drawnHistory[len(drawnHistory)-len(drawnCards):]); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	for _, pull := range pulls {
+		if err := appendDeckState(tx, pull.source, pull.upcoming, pull.history, len(pull.history)); err != nil {
+			req.ReplyCh <- Response{Error: err}
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+
+	shuffled := deckShuffled(req.DeckID)
+	response := Deck{
+		ID:         req.DeckID,
+		Cards:      drawnCards,
+		Remaining:  len(upcomingCards),
+		Shuffled:   &shuffled,
+		Order:      orderTopFirst,
+		Reshuffled: reshuffled,
+	}
+	if req.Draw.WithRemaining {
+		response.RemainingCounts = countCards(upcomingCards)
+	}
+
+	req.ReplyCh <- Response{Deck: response}
+}
+
+// tagDrawn records the street, shoe table, session and label of a draw on
+// the history entries it appended.
+func tagDrawn(entries []DrawnCard, params DrawParams) {
+	for i := range entries {
+		entries[i].Street = params.Street
+		entries[i].Table = params.Table
+		entries[i].Session = params.Session
+		entries[i].Label = params.Label
+	}
+}
+
+// saveDraw saves a draw that appended drawn entries to drawnHistory as read
+// from the deck and left upcomingCards, in one transaction:
+// checkUnmodifiedSince refuses it if the deck changed after since, paceDraw
+// refuses it or records its time, autoReshuffle puts the drawn cards back
+// when the deck runs low, the new state is written and a labeled draw is
+// added to the event log. It returns the upcoming cards as saved and whether
+// the deck was reshuffled. The caller must hold mu.
+func saveDraw(deckID string, upcomingCards []Card, drawnHistory []DrawnCard, drawn int, since time.Time) ([]Card, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("Error updating deck")
+	}
+	defer tx.Rollback()
+
+	if err := checkUnmodifiedSince(tx, deckID, since); err != nil {
+		return nil, false, err
+	}
+	if err := paceDraw(tx, deckID); err != nil {
+		return nil, false, err
+	}
+	stored := len(drawnHistory) - drawn
+	upcomingCards, drawnHistory, reshuffled, err := autoReshuffle(tx, deckID, upcomingCards, drawnHistory, drawn)
+	if err != nil {
+		return nil, false, err
+	}
+	if reshuffled {
+		stored = -1
+	}
+	if err := appendDeckState(tx, deckID, upcomingCards, drawnHistory, stored); err != nil {
+		return nil, false, err
+	}
+	if err := recordLabeledDraw(tx, deckID, drawnHistory[len(drawnHistory)-drawn:]); err != nil {
+		return nil, false, fmt.Errorf("Error updating deck")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("Error updating deck")
+	}
+	return upcomingCards, reshuffled, nil
+}
+
+// drawDistinctCards draws the first N cards of distinct ranks from the top of
+// the deck. Cards skipped because their rank was already drawn stay in the
+// deck in their original order.
+func drawDistinctCards(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nbrCarte := req.Draw.Count
+	if nbrCarte < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid number of cards")}
+		return
+	}
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	drawnCards, err := deck.DrawDistinct(&state, nbrCarte, clock.Now())
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	offCommitment := !drawnFromTop(upcomingCards, drawnCards)
+	tagDrawn(state.Drawn[len(drawnHistory):], req.Draw)
+	keptCards, reshuffled, err := saveDraw(req.DeckID, state.Upcoming, state.Drawn, len(drawnCards), req.UnmodifiedSince)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	shuffled := deckShuffled(req.DeckID)
+	req.ReplyCh <- Response{Deck: Deck{
+		ID:            req.DeckID,
+		Cards:         drawnCards,
+		Remaining:     len(keptCards),
+		Shuffled:      &shuffled,
+		Order:         orderTopFirst,
+		Reshuffled:    reshuffled,
+		OffCommitment: offCommitment,
+	}}
+}
+
+// drawAlternateCards draws cards alternately from the top and the bottom of
+// the deck, starting with the top, and clamps the count to the cards left.
+func drawAlternateCards(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nbrCarte := req.Draw.Count
+	if nbrCarte < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid number of cards")}
+		return
+	}
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	drawnCards, err := deck.DrawAlternate(&state, nbrCarte, clock.Now())
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	offCommitment := !drawnFromTop(upcomingCards, drawnCards)
+	tagDrawn(state.Drawn[len(drawnHistory):], req.Draw)
+	upcomingCards, reshuffled, err := saveDraw(req.DeckID, state.Upcoming, state.Drawn, len(drawnCards), req.UnmodifiedSince)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	shuffled := deckShuffled(req.DeckID)
+	req.ReplyCh <- Response{Deck: Deck{
+		ID:            req.DeckID,
+		Cards:         drawnCards,
+		Remaining:     len(upcomingCards),
+		Shuffled:      &shuffled,
+		Order:         orderTopFirst,
+		Reshuffled:    reshuffled,
+		OffCommitment: offCommitment,
+	}}
+}
+
+// drawCollectCards draws from the top of the deck until Collect.Count cards
+// of suit Collect.Suit have been drawn, or the deck is empty. Every card drawn on
+// the way, of any suit, is drawn for good.
+func drawCollectCards(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	suit, target := req.Collect.Suit, req.Collect.Count
+	if target < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid number of cards")}
+		return
+	}
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if len(upcomingCards) == 0 {
+		req.ReplyCh <- Response{Error: errDeckEmpty}
+		return
+	}
+
+	drawn, collected := 0, 0
+	for drawn < len(upcomingCards) && collected < target {
+		if cardSuit(upcomingCards[drawn]) == suit {
+			collected++
+		}
+		drawn++
+	}
+
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	drawnCards, err := deck.DrawN(&state, drawn, clock.Now())
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	tagDrawn(state.Drawn[len(drawnHistory):], req.Draw)
+	upcomingCards, reshuffled, err := saveDraw(req.DeckID, state.Upcoming, state.Drawn, len(drawnCards), req.UnmodifiedSince)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	shuffled := deckShuffled(req.DeckID)
+	req.ReplyCh <- Response{Deck: Deck{
+		ID:         req.DeckID,
+		Cards:      drawnCards,
+		Remaining:  len(upcomingCards),
+		Shuffled:   &shuffled,
+		Order:      orderTopFirst,
+		Reshuffled: reshuffled,
+	}}
+}
+
+func shuffleDeck(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	state, err := sqlStore{db}.Load(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	// A shuffle with nothing to do still answers to the precondition, so it
+	// is checked before the early return below; mu keeps the deck from
+	// changing until the write.
+	if err := checkUnmodifiedSince(db, req.DeckID, req.UnmodifiedSince); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	// With fewer than two cards there is nothing to shuffle; say so explicitly
+	// rather than returning what looks like an empty result.
+	if len(state.Upcoming) < 2 {
+		shuffled := deckShuffled(req.DeckID)
+		req.ReplyCh <- Response{Deck: Deck{
+			ID:             req.DeckID,
+			Cards:          state.Upcoming,
+			Remaining:      len(state.Upcoming),
+			Shuffled:       &shuffled,
+			ShuffleSkipped: true,
+		}}
+		return
+	}
+
+	shuffle, err := shuffleDeckCards(db, req.DeckID, state.Upcoming)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	defer tx.Rollback()
+
+	if err := (sqlStore{tx}).Save(req.DeckID, state); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if _, err := tx.Exec("UPDATE decks SET shuffled = 1 WHERE id = ?", req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	if err := logShuffle(tx, "shuffle", shuffle); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+
+	shuffled := true
+	response := Deck{
+		ID:        req.DeckID,
+		Cards:     state.Upcoming,
+		Remaining: len(state.Upcoming),
+		Shuffled:  &shuffled,
+	}
+
+	req.ReplyCh <- Response{Deck: response}
+}
+
+// shuffleAndDeal shuffles the upcoming cards and deals cardsEach cards to
+// each player, one card at a time around the table. The shuffle and the deal
+// are committed together and the shuffled order is never returned, so no
+// client can observe it before the hands are dealt. Like any draw, the deal
+// honors If-Unmodified-Since and draw pacing and may auto-reshuffle.
+func shuffleAndDeal(req Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	players, cardsEach := req.Deal.Players, req.Deal.CardsEach
+	if players < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid number of players")}
+		return
+	}
+	if cardsEach < 1 {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Invalid number of cards")}
+		return
+	}
+
+	if err := checkDeckUnlocked(req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	upcomingCards, drawnHistory, err := readDeckState(req.DeckID)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if players*cardsEach > len(upcomingCards) {
+		req.ReplyCh <- Response{Error: errNotEnoughCards}
+		return
+	}
+
+	shuffle, err := shuffleDeckCards(db, req.DeckID, upcomingCards)
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+
+	deal := lastDeal(drawnHistory) + 1
+	state := deck.State{Upcoming: upcomingCards, Drawn: drawnHistory}
+	dealt, err := deck.DrawExactly(&state, players*cardsEach, clock.Now())
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	hands := make([][]Card, players)
+	for i, card := range dealt {
+		hands[i%players] = append(hands[i%players], card)
+		state.Drawn[len(drawnHistory)+i].Deal, state.Drawn[len(drawnHistory)+i].Seat = deal, i%players+1
+	}
+	upcomingCards, drawnHistory = state.Upcoming, state.Drawn
+
+	tx, err := db.Begin()
+	if err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	defer tx.Rollback()
+
+	if err := checkUnmodifiedSince(tx, req.DeckID, req.UnmodifiedSince); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if err := paceDraw(tx, req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	upcomingCards, drawnHistory, reshuffled, err := autoReshuffle(tx, req.DeckID, upcomingCards, drawnHistory, len(dealt))
+	if err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if err := writeDeckState(tx, req.DeckID, upcomingCards, drawnHistory); err != nil {
+		req.ReplyCh <- Response{Error: err}
+		return
+	}
+	if _, err := tx.Exec("UPDATE decks SET shuffled = 1 WHERE id = ?", req.DeckID); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	if err := logShuffle(tx, "shuffle-deal", shuffle); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		req.ReplyCh <- Response{Error: fmt.Errorf("Error updating deck")}
+		return
+	}
+
+	shuffled := true
+	req.ReplyCh <- Response{Deck: Deck{
+		ID:         req.DeckID,
+		Shuffled:   &shuffled,
+		Hands:      hands,
+		Order:      orderTopFirst,
+		Remaining:  len(upcomingCards),
+		Reshuffled: reshuffled,
+	}}
+}